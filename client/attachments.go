@@ -0,0 +1,90 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"example/rest-api/models"
+)
+
+// UploadAttachment uploads a file to a note, the server detects its type from the content. The file is read in
+// memory to be sent again on retries.
+func (c *Client) UploadAttachment(ctx context.Context, noteID, fileName string, file io.Reader) (*models.Attachment, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, fmt.Errorf("read attachment: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req := (&request{
+		method:      http.MethodPost,
+		path:        "/api/notes/" + url.PathEscape(noteID) + "/attachments",
+		auth:        true,
+		body:        body.Bytes(),
+		contentType: form.FormDataContentType(),
+	}).idempotent()
+
+	var resp struct {
+		Data struct {
+			Attachment models.Attachment `json:"attachment"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data.Attachment, nil
+}
+
+// FindAttachments lists the attachments of a note
+func (c *Client) FindAttachments(ctx context.Context, noteID string) ([]models.Attachment, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/"+url.PathEscape(noteID)+"/attachments", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Attachments []models.Attachment `json:"attachments"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Attachments, nil
+}
+
+// DownloadAttachment returns the content of an attachment, the caller closes it
+func (c *Client) DownloadAttachment(ctx context.Context, noteID, id string) (io.ReadCloser, error) {
+	req, err := newRequest(http.MethodGet, attachmentPath(noteID, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DeleteAttachment deletes an attachment of a note
+func (c *Client) DeleteAttachment(ctx context.Context, noteID, id string) error {
+	req, err := newRequest(http.MethodDelete, attachmentPath(noteID, id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+func attachmentPath(noteID, id string) string {
+	return "/api/notes/" + url.PathEscape(noteID) + "/attachments/" + url.PathEscape(id)
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"example/rest-api/models"
+)
+
+// Register creates a user, it does not log the client in
+func (c *Client) Register(ctx context.Context, user models.CreateUserSchema) (*models.User, error) {
+	req, err := newRequest(http.MethodPost, "/api/auth/register", user)
+	if err != nil {
+		return nil, err
+	}
+	req.auth = false
+
+	var resp struct {
+		Data models.User `json:"data"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+// Login logs in with the email or username and the password. The credentials are kept to log in again when the
+// token expires.
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	token, err := c.login(ctx, login, password)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.credentials = &credentials{login: login, password: password}
+	c.setToken(token)
+	return nil
+}
+
+// login returns a new token of the user, login is an email when it holds an @ and a username otherwise
+func (c *Client) login(ctx context.Context, login, password string) (string, error) {
+	payload := models.LoginSchema{Password: password}
+	if strings.Contains(login, "@") {
+		payload.Email = login
+	} else {
+		payload.Username = &login
+	}
+	req, err := newRequest(http.MethodPost, "/api/auth/login", payload)
+	if err != nil {
+		return "", err
+	}
+	req.auth = false
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// Logout logs the client out and forgets its credentials
+func (c *Client) Logout(ctx context.Context) error {
+	req, err := newRequest(http.MethodPost, "/api/auth/logout", nil)
+	if err != nil {
+		return err
+	}
+	err = c.do(ctx, req, nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+	c.credentials = nil
+	return err
+}
@@ -0,0 +1,388 @@
+// Package client calls the notes API over HTTP. It logs in again when the token expires, retries the requests
+// that failed on the way or were rate limited, waiting for the Retry-After of the server, and returns the error
+// responses as a *problem.Problem.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example/rest-api/problem"
+
+	"github.com/google/uuid"
+)
+
+// refreshMargin is how long before its expiry a token is replaced
+const refreshMargin = time.Minute
+
+// Client calls the API, it is safe for concurrent use
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	// maxRetries is how many times a failed request is sent again
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// maxRetryWait is the longest Retry-After waited for, the error is returned past it
+	maxRetryWait time.Duration
+	userAgent    string
+
+	// mu guards the token and the credentials, it is held while logging in so that concurrent requests log in once
+	mu          sync.Mutex
+	token       string
+	expiresAt   time.Time
+	credentials *credentials
+}
+
+// credentials log the client in again when its token expires
+type credentials struct {
+	login    string
+	password string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithToken authenticates the requests with a token obtained elsewhere
+func WithToken(token string) Option {
+	return func(c *Client) { c.setToken(token) }
+}
+
+// WithCredentials logs in with the email or username and the password on the first request, and again whenever
+// the token expires
+func WithCredentials(login, password string) Option {
+	return func(c *Client) { c.credentials = &credentials{login: login, password: password} }
+}
+
+// WithRetries sends a failed request up to max more times, waiting between attempts from minBackoff doubling up
+// to maxBackoff. 0 disables the retries.
+func WithRetries(max int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithMaxRetryWait bounds the Retry-After waited for before a retry, a longer one returns the error instead
+func WithMaxRetryWait(d time.Duration) Option {
+	return func(c *Client) { c.maxRetryWait = d }
+}
+
+// WithUserAgent sets the User-Agent of the requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// New returns a client of the API served at baseURL, like http://localhost:8750
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url %q must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:      u,
+		http:         http.DefaultClient,
+		maxRetries:   3,
+		minBackoff:   200 * time.Millisecond,
+		maxBackoff:   5 * time.Second,
+		maxRetryWait: time.Minute,
+		userAgent:    "notes-api-go-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Token returns the token the requests are sent with, empty until the client logs in
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// setToken stores a token along with its expiry, read from its claims
+func (c *Client) setToken(token string) {
+	c.token = token
+	c.expiresAt = tokenExpiry(token)
+}
+
+// tokenExpiry returns the exp claim of a jwt, zero when it has none. The signature is the server's business.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// currentToken returns the token to send, logging in first when there is none or it is about to expire
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fresh := c.token != "" && (c.expiresAt.IsZero() || time.Until(c.expiresAt) > refreshMargin)
+	if fresh || c.credentials == nil {
+		return c.token, nil
+	}
+	token, err := c.login(ctx, c.credentials.login, c.credentials.password)
+	if err != nil {
+		return "", fmt.Errorf("log in again: %w", err)
+	}
+	c.setToken(token)
+	return token, nil
+}
+
+// expireToken drops a token the server rejected, unless another request replaced it already.
+// It reports whether the request can be sent again with a new token.
+func (c *Client) expireToken(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.credentials == nil {
+		return false
+	}
+	if c.token == token {
+		c.token = ""
+	}
+	return true
+}
+
+// request is a call to the API, its body is kept in memory so that it can be sent again
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   []byte
+	// contentType is the type of the body, JSON when empty
+	contentType string
+	header      http.Header
+	// auth sends the token of the client
+	auth bool
+	// idempotencyKey makes a POST safe to send again, it is generated by newRequest for the routes taking one
+	idempotencyKey string
+}
+
+// newRequest returns a request with body encoded as JSON, a nil body sends none
+func newRequest(method, path string, body interface{}) (*request, error) {
+	req := &request{method: method, path: path, auth: true}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request body: %w", err)
+		}
+		req.body = data
+	}
+	return req, nil
+}
+
+// idempotent gives the request an Idempotency-Key, so that it runs once however many times it is sent
+func (req *request) idempotent() *request {
+	req.idempotencyKey = uuid.New().String()
+	return req
+}
+
+// replayable reports whether the server may run the request twice without harm
+func (req *request) replayable() bool {
+	return req.method != http.MethodPost || req.idempotencyKey != ""
+}
+
+// do sends req and decodes the JSON body of its response into out, which may be nil
+func (c *Client) do(ctx context.Context, req *request, out interface{}) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send sends req until it succeeds, fails for good or runs out of retries, and returns the successful response
+// with its body left to read. A rejected token is replaced once when the client has credentials.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	relogged := false
+	for attempt := 0; ; attempt++ {
+		token := ""
+		if req.auth {
+			var err error
+			if token, err = c.currentToken(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.http.Do(c.httpRequest(ctx, req, token))
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !req.replayable() || attempt >= c.maxRetries {
+				return nil, err
+			}
+			wait = c.backoff(attempt)
+		case resp.StatusCode < http.StatusBadRequest:
+			return resp, nil
+		default:
+			apiErr := readProblem(resp)
+			retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			switch {
+			case resp.StatusCode == http.StatusUnauthorized && req.auth && !relogged && c.expireToken(token):
+				// the token expired or was revoked, log in again without counting an attempt
+				relogged = true
+				attempt--
+				continue
+			case !c.retryable(req, resp.StatusCode, apiErr) || attempt >= c.maxRetries:
+				return nil, apiErr
+			case hasRetryAfter:
+				if retryAfter > c.maxRetryWait {
+					return nil, apiErr
+				}
+				wait = retryAfter
+			default:
+				wait = c.backoff(attempt)
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a request that got an error response can be sent again
+func (c *Client) retryable(req *request, status int, apiErr *problem.Problem) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		// the rate limiter rejects the requests before they run
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return req.replayable()
+	case http.StatusConflict:
+		// the first request with the same Idempotency-Key is still running, unlike a conflict on a field
+		return req.idempotencyKey != "" && apiErr.Type == problem.TypeBlank
+	}
+	return false
+}
+
+// backoff returns the wait before the retry following attempt, doubling every time with some jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.minBackoff << attempt
+	if wait > c.maxBackoff || wait <= 0 {
+		wait = c.maxBackoff
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// parseRetryAfter reads a Retry-After in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func (c *Client) httpRequest(ctx context.Context, req *request, token string) *http.Request {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	// the method and the url are known to be valid
+	httpReq, _ := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	for key, values := range req.header {
+		httpReq.Header[key] = values
+	}
+	if req.body != nil {
+		contentType := req.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	if req.idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	return httpReq
+}
+
+// readProblem reads an error response and closes it, the responses that are not problems become one
+func readProblem(resp *http.Response) *problem.Problem {
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	p := &problem.Problem{}
+	if err != nil || json.Unmarshal(data, p) != nil || p.Status == 0 {
+		p = problem.New(resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if p.RequestID == "" {
+		p.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return p
+}
+
+// StatusCode returns the status of the error response err holds, 0 when it is another kind of error
+func StatusCode(err error) int {
+	var p *problem.Problem
+	if errors.As(err, &p) {
+		return p.Status
+	}
+	return 0
+}
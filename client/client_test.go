@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example/rest-api/models"
+	"example/rest-api/problem"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		if got, ok := parseRetryAfter(tt.value); got != tt.want || ok != tt.ok {
+			t.Errorf("%q: expected %s %v, got %s %v", tt.value, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c, _ := New("http://localhost", WithRetries(10, 100*time.Millisecond, time.Second))
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if wait := c.backoff(attempt); wait < max/2 || wait > max {
+			t.Errorf("attempt %d: expected a wait between %s and %s, got %s", attempt, max/2, max, wait)
+		}
+	}
+	if wait := c.backoff(100); wait > time.Second {
+		t.Errorf("expected the wait to stay under the maximum, got %s", wait)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			problem.Write(w, r, problem.New(http.StatusServiceUnavailable, "starting"))
+			return
+		}
+		w.Write([]byte(`{"notes": []}`))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	c, _ := New(server.URL, WithRetries(3, time.Millisecond, time.Millisecond))
+
+	if _, err := c.FindNotes(ctx, 1, 10); err != nil || calls.Load() != 3 {
+		t.Errorf("expected the GET to succeed on the third attempt, got %v after %d", err, calls.Load())
+	}
+
+	// a POST without an Idempotency-Key may have run already
+	calls.Store(0)
+	if _, err := c.Register(ctx, models.CreateUserSchema{}); StatusCode(err) != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("expected the POST to be sent once, got %v after %d", err, calls.Load())
+	}
+
+	calls.Store(0)
+	if _, err := c.CreateNote(ctx, models.CreateNoteSchema{}); err != nil || calls.Load() != 3 {
+		t.Errorf("expected the idempotent POST to be sent again, got %v after %d", err, calls.Load())
+	}
+}
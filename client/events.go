@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Event is a change to the notes sent by the event stream
+type Event struct {
+	// ID is the position of the event in the stream, a new stream resumes after it
+	ID string
+	// Type is note.created, note.updated or note.deleted, or reset when some events were lost and the notes
+	// should be loaded again
+	Type string
+	// Data is the JSON of the event, its data member holds the note
+	Data json.RawMessage
+}
+
+// EventStream reads the events of the notes as they happen
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	lastID  string
+}
+
+// NoteEvents opens the stream of the changes to the notes the user sees, starting after lastEventID when it is
+// not empty. The stream ends when ctx is done or Close is called.
+func (c *Client) NoteEvents(ctx context.Context, lastEventID string) (*EventStream, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.header = http.Header{"Accept": {"text/event-stream"}}
+	if lastEventID != "" {
+		req.header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	return &EventStream{body: resp.Body, scanner: scanner, lastID: lastEventID}, nil
+}
+
+// Next waits for the next event, it returns io.EOF once the server closed the stream. Open a new stream after
+// LastEventID to resume.
+func (s *EventStream) Next() (*Event, error) {
+	event := &Event{}
+	var data []string
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" {
+			if len(data) == 0 {
+				// a heartbeat or an event without data
+				event = &Event{}
+				continue
+			}
+			event.Data = json.RawMessage(strings.Join(data, "\n"))
+			if event.ID != "" {
+				s.lastID = event.ID
+			}
+			return event, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Type = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// LastEventID returns the id of the last event read
+func (s *EventStream) LastEventID() string {
+	return s.lastID
+}
+
+// Close ends the stream
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,293 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"example/rest-api/models"
+	"example/rest-api/render"
+)
+
+// CreateNote creates a note of the logged in user
+func (c *Client) CreateNote(ctx context.Context, note models.CreateNoteSchema) (*models.Note, error) {
+	req, err := newRequest(http.MethodPost, "/api/notes/", note)
+	if err != nil {
+		return nil, err
+	}
+	return c.doNote(ctx, req.idempotent())
+}
+
+// GetNote returns a note by id
+func (c *Client) GetNote(ctx context.Context, id string) (*models.Note, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.doNote(ctx, req)
+}
+
+// RenderNote returns a note along with its content rendered to sanitized html
+func (c *Client) RenderNote(ctx context.Context, id string) (*models.Note, *render.Result, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.query = url.Values{"render": {"html"}}
+
+	var resp struct {
+		Data struct {
+			Note     models.Note    `json:"note"`
+			Rendered *render.Result `json:"rendered"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, nil, err
+	}
+	return &resp.Data.Note, resp.Data.Rendered, nil
+}
+
+// FindNotes returns a page of notes, page starts at 1
+func (c *Client) FindNotes(ctx context.Context, page, limit int) ([]models.Note, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.query = url.Values{"page": {strconv.Itoa(page)}, "limit": {strconv.Itoa(limit)}}
+
+	var resp struct {
+		Notes []models.Note `json:"notes"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Notes, nil
+}
+
+// SearchFilter holds the case insensitive substrings a search matches on, empty fields match everything
+type SearchFilter struct {
+	Title    string
+	Content  string
+	Category string
+}
+
+// SearchNote returns the notes matching every field of the filter
+func (c *Client) SearchNote(ctx context.Context, filter SearchFilter) ([]models.Note, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/search", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.query = url.Values{}
+	for key, value := range map[string]string{"title": filter.Title, "content": filter.Content, "category": filter.Category} {
+		if value != "" {
+			req.query.Set(key, value)
+		}
+	}
+
+	var notes []models.Note
+	if err := c.do(ctx, req, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// UpdateNote changes the fields of a note that are set in update
+func (c *Client) UpdateNote(ctx context.Context, id string, update models.UpdateNoteSchema) (*models.Note, error) {
+	req, err := newRequest(http.MethodPatch, "/api/notes/"+url.PathEscape(id), update)
+	if err != nil {
+		return nil, err
+	}
+	return c.doNote(ctx, req)
+}
+
+// DeleteNote deletes a note along with its attachments
+func (c *Client) DeleteNote(ctx context.Context, id string) error {
+	req, err := newRequest(http.MethodDelete, "/api/notes/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// doNote sends a request answered with a single note
+func (c *Client) doNote(ctx context.Context, req *request) (*models.Note, error) {
+	var resp struct {
+		Data struct {
+			Note models.Note `json:"note"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data.Note, nil
+}
+
+// BulkResult is the outcome of one note of a bulk request
+type BulkResult struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	ID      string       `json:"id,omitempty"`
+	Status  int          `json:"status"`
+	Message string       `json:"message,omitempty"`
+	Note    *models.Note `json:"note,omitempty"`
+}
+
+// BulkResponse is the outcome of a bulk request, Status is partial when some items failed in best_effort mode
+type BulkResponse struct {
+	Status  string       `json:"status"`
+	Mode    string       `json:"mode"`
+	Failed  int          `json:"failed"`
+	Results []BulkResult `json:"results"`
+}
+
+// BulkNotes applies many operations in one request. An item failing in atomic mode rolls the request back and
+// returns a problem whose "results" extension holds the outcome of every item.
+func (c *Client) BulkNotes(ctx context.Context, bulk models.BulkNoteSchema) (*BulkResponse, error) {
+	req, err := newRequest(http.MethodPost, "/api/notes/bulk", bulk)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp BulkResponse
+	if err := c.do(ctx, req.idempotent(), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportNotes downloads the notes of the user as a zip of markdown files or as ndjson, the caller closes the
+// returned body
+func (c *Client) ExportNotes(ctx context.Context, format string) (io.ReadCloser, error) {
+	req, err := newRequest(http.MethodGet, "/api/notes/export", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.query = url.Values{"format": {format}}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ImportItem is the outcome of one note of an import
+type ImportItem struct {
+	Source  string `json:"source"`
+	Title   string `json:"title,omitempty"`
+	Status  string `json:"status"`
+	NoteID  string `json:"noteId,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ImportReport sums up an import
+type ImportReport struct {
+	Total       int          `json:"total"`
+	Created     int          `json:"created"`
+	Renamed     int          `json:"renamed"`
+	Overwritten int          `json:"overwritten"`
+	Skipped     int          `json:"skipped"`
+	Failed      int          `json:"failed"`
+	Items       []ImportItem `json:"items"`
+}
+
+// the content types of the import formats
+var importTypes = map[string]string{
+	"zip":      "application/zip",
+	"ndjson":   "application/x-ndjson",
+	"markdown": "text/markdown",
+}
+
+// ImportNotes imports a zip archive, ndjson or a single markdown file, onDuplicate is skip, rename, overwrite,
+// fail or empty for the default of the server. The body is read in memory to be sent again on retries.
+func (c *Client) ImportNotes(ctx context.Context, format string, body io.Reader, onDuplicate string) (*ImportReport, error) {
+	contentType, ok := importTypes[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, fmt.Errorf("read import: %w", err)
+	}
+
+	req := (&request{method: http.MethodPost, path: "/api/notes/import", auth: true, body: buf.Bytes(), contentType: contentType}).idempotent()
+	if onDuplicate != "" {
+		req.query = url.Values{"onDuplicate": {onDuplicate}}
+	}
+
+	var resp struct {
+		Report ImportReport `json:"report"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Report, nil
+}
+
+// NoteIterator walks through notes fetched as they are needed:
+//
+//	it := c.IterateNotes(ctx, 50)
+//	for it.Next() {
+//		fmt.Println(it.Note().Title)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type NoteIterator struct {
+	ctx context.Context
+	// fetch returns the next notes, and whether they are the last ones
+	fetch func(ctx context.Context) ([]models.Note, bool, error)
+	notes []models.Note
+	note  *models.Note
+	last  bool
+	err   error
+}
+
+// Next moves to the next note and reports whether there is one, it fetches a page when the current one is done
+func (it *NoteIterator) Next() bool {
+	for len(it.notes) == 0 {
+		if it.last || it.err != nil {
+			it.note = nil
+			return false
+		}
+		it.notes, it.last, it.err = it.fetch(it.ctx)
+	}
+	it.note = &it.notes[0]
+	it.notes = it.notes[1:]
+	return true
+}
+
+// Note returns the current note
+func (it *NoteIterator) Note() *models.Note {
+	return it.note
+}
+
+// Err returns the error that stopped the iteration, nil when every note was seen
+func (it *NoteIterator) Err() error {
+	return it.err
+}
+
+// IterateNotes walks through all the notes, fetching pageSize of them at a time
+func (c *Client) IterateNotes(ctx context.Context, pageSize int) *NoteIterator {
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	page := 0
+	return &NoteIterator{ctx: ctx, fetch: func(ctx context.Context) ([]models.Note, bool, error) {
+		page++
+		notes, err := c.FindNotes(ctx, page, pageSize)
+		return notes, len(notes) < pageSize, err
+	}}
+}
+
+// IterateSearch walks through the notes matching the filter, the search returns them all at once
+func (c *Client) IterateSearch(ctx context.Context, filter SearchFilter) *NoteIterator {
+	return &NoteIterator{ctx: ctx, fetch: func(ctx context.Context) ([]models.Note, bool, error) {
+		notes, err := c.SearchNote(ctx, filter)
+		return notes, true, err
+	}}
+}
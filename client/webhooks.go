@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"example/rest-api/models"
+)
+
+// CreateWebhook subscribes a URL to the events, the returned webhook holds the secret signing the deliveries
+func (c *Client) CreateWebhook(ctx context.Context, webhook models.CreateWebhookSchema) (*models.Webhook, error) {
+	req, err := newRequest(http.MethodPost, "/api/webhooks", webhook)
+	if err != nil {
+		return nil, err
+	}
+	return c.doWebhook(ctx, req)
+}
+
+// FindWebhooks lists the webhooks of the user
+func (c *Client) FindWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	req, err := newRequest(http.MethodGet, "/api/webhooks", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Webhooks []models.Webhook `json:"webhooks"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Webhooks, nil
+}
+
+// GetWebhook returns a webhook by id
+func (c *Client) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	req, err := newRequest(http.MethodGet, "/api/webhooks/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.doWebhook(ctx, req)
+}
+
+// UpdateWebhook changes the URL or the events of a webhook, or pauses it
+func (c *Client) UpdateWebhook(ctx context.Context, id string, update models.UpdateWebhookSchema) (*models.Webhook, error) {
+	req, err := newRequest(http.MethodPatch, "/api/webhooks/"+url.PathEscape(id), update)
+	if err != nil {
+		return nil, err
+	}
+	return c.doWebhook(ctx, req)
+}
+
+// DeleteWebhook deletes a webhook along with its delivery log
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	req, err := newRequest(http.MethodDelete, "/api/webhooks/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, req, nil)
+}
+
+// FindDeliveries returns the latest deliveries of a webhook, newest first, limit 0 lets the server pick
+func (c *Client) FindDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	req, err := newRequest(http.MethodGet, "/api/webhooks/"+url.PathEscape(webhookID)+"/deliveries", nil)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 {
+		req.query = url.Values{"limit": {strconv.Itoa(limit)}}
+	}
+
+	var resp struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Deliveries, nil
+}
+
+// Redeliver queues a delivery of a webhook again and returns the new delivery
+func (c *Client) Redeliver(ctx context.Context, webhookID, deliveryID string) (*models.WebhookDelivery, error) {
+	path := "/api/webhooks/" + url.PathEscape(webhookID) + "/deliveries/" + url.PathEscape(deliveryID) + "/redeliver"
+	req, err := newRequest(http.MethodPost, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Delivery models.WebhookDelivery `json:"delivery"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data.Delivery, nil
+}
+
+// doWebhook sends a request answered with a single webhook
+func (c *Client) doWebhook(ctx context.Context, req *request) (*models.Webhook, error) {
+	var resp struct {
+		Data struct {
+			Webhook models.Webhook `json:"webhook"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data.Webhook, nil
+}
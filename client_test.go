@@ -0,0 +1,341 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"example/rest-api/client"
+	"example/rest-api/events"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+	"example/rest-api/utils"
+)
+
+// newTestClient returns a client of srv, failing the test when opts are invalid
+func newTestClient(t *testing.T, srv *testServer, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(srv.URL, append([]client.Option{client.WithHTTPClient(srv.Client())}, opts...)...)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return c
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryStore()
+	srv := newTestServer(t, repo, nil)
+
+	anonymous := newTestClient(t, srv)
+	user, err := anonymous.Register(ctx, models.CreateUserSchema{Username: "alice", Email: "alice@example.com", Password: "correct horse", FullName: "Alice Liddell"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := anonymous.FindNotes(ctx, 1, 10); client.StatusCode(err) != http.StatusUnauthorized {
+		t.Errorf("expected the anonymous client to be rejected, got %v", err)
+	}
+
+	// the client logs in on its first request
+	c := newTestClient(t, srv, client.WithCredentials("alice", "correct horse"))
+
+	t.Run("notes", func(t *testing.T) {
+		note, err := c.CreateNote(ctx, models.CreateNoteSchema{Title: "Groceries", Content: "**milk**", ContentFormat: "markdown", Category: "home"})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if note.ID == "" || note.UserID != user.ID || c.Token() == "" {
+			t.Fatalf("unexpected note %+v", note)
+		}
+
+		_, err = c.CreateNote(ctx, models.CreateNoteSchema{Title: "Empty"})
+		var p *problem.Problem
+		if !errors.As(err, &p) || p.Status != http.StatusBadRequest || p.RequestID == "" {
+			t.Errorf("expected a validation problem, got %#v", err)
+		}
+		if _, err := c.GetNote(ctx, "missing"); client.StatusCode(err) != http.StatusNotFound {
+			t.Errorf("expected a 404, got %v", err)
+		}
+
+		published := true
+		updated, err := c.UpdateNote(ctx, note.ID, models.UpdateNoteSchema{Content: "**oat milk**", Published: &published})
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if updated.Title != "Groceries" || !updated.Published {
+			t.Errorf("unexpected update %+v", updated)
+		}
+
+		got, rendered, err := c.RenderNote(ctx, note.ID)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if got.ID != note.ID || rendered == nil || !strings.Contains(rendered.HTML, "<strong>oat milk</strong>") {
+			t.Errorf("unexpected rendering %+v of %+v", rendered, got)
+		}
+
+		if err := c.DeleteNote(ctx, note.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := c.GetNote(ctx, note.ID); client.StatusCode(err) != http.StatusNotFound {
+			t.Errorf("expected the note to be gone, got %v", err)
+		}
+	})
+
+	t.Run("iterate", func(t *testing.T) {
+		for _, title := range []string{"Books", "Movies", "Music", "Games", "Podcasts"} {
+			if _, err := c.CreateNote(ctx, models.CreateNoteSchema{Title: title, Content: "list of " + title}); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+
+		var titles []string
+		it := c.IterateNotes(ctx, 2)
+		for it.Next() {
+			titles = append(titles, it.Note().Title)
+		}
+		if err := it.Err(); err != nil || len(titles) != 5 || titles[0] != "Books" || titles[4] != "Podcasts" {
+			t.Errorf("expected the 5 notes over 3 pages, got %v, %v", titles, err)
+		}
+
+		found, err := c.SearchNote(ctx, client.SearchFilter{Content: "list of m"})
+		if err != nil || len(found) != 2 {
+			t.Errorf("expected 2 notes, got %v, %v", found, err)
+		}
+		titles = nil
+		it = c.IterateSearch(ctx, client.SearchFilter{Title: "games"})
+		for it.Next() {
+			titles = append(titles, it.Note().Title)
+		}
+		if it.Err() != nil || len(titles) != 1 || titles[0] != "Games" {
+			t.Errorf("expected Games, got %v, %v", titles, it.Err())
+		}
+	})
+
+	t.Run("bulk", func(t *testing.T) {
+		resp, err := c.BulkNotes(ctx, models.BulkNoteSchema{
+			Mode: "best_effort",
+			Operations: []models.BulkOperationSchema{
+				{Op: "create", Data: json.RawMessage(`{"title": "Created in bulk", "content": "text"}`)},
+				{Op: "delete", IDs: []string{"missing"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("bulk: %v", err)
+		}
+		if resp.Failed != 1 || len(resp.Results) != 2 || resp.Results[0].Note == nil || resp.Results[1].Status != http.StatusNotFound {
+			t.Errorf("unexpected bulk response %+v", resp)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		body, err := c.ExportNotes(ctx, "zip")
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		archive, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatalf("read export: %v", err)
+		}
+		if _, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive))); err != nil {
+			t.Fatalf("expected a zip archive: %v", err)
+		}
+
+		report, err := c.ImportNotes(ctx, "zip", bytes.NewReader(archive), "skip")
+		if err != nil {
+			t.Fatalf("import: %v", err)
+		}
+		if report.Total != 6 || report.Skipped != 6 {
+			t.Errorf("expected every note to be skipped, got %+v", report)
+		}
+		_, err = c.ImportNotes(ctx, "zip", bytes.NewReader(archive), "fail")
+		if client.StatusCode(err) != http.StatusConflict {
+			t.Errorf("expected a conflict, got %v", err)
+		}
+		if _, err := c.ImportNotes(ctx, "csv", strings.NewReader(""), ""); err == nil {
+			t.Errorf("expected an unknown format to be rejected")
+		}
+	})
+
+	t.Run("attachments", func(t *testing.T) {
+		note, err := c.CreateNote(ctx, models.CreateNoteSchema{Title: "With files", Content: "text"})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		content := "plain text attachment"
+		attachment, err := c.UploadAttachment(ctx, note.ID, "notes.txt", strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+
+		attachments, err := c.FindAttachments(ctx, note.ID)
+		if err != nil || len(attachments) != 1 || attachments[0].ID != attachment.ID {
+			t.Errorf("expected the attachment to be listed, got %v, %v", attachments, err)
+		}
+		body, err := c.DownloadAttachment(ctx, note.ID, attachment.ID)
+		if err != nil {
+			t.Fatalf("download: %v", err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != content {
+			t.Errorf("expected %q, got %q", content, data)
+		}
+
+		if err := c.DeleteAttachment(ctx, note.ID, attachment.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := c.DownloadAttachment(ctx, note.ID, attachment.ID); client.StatusCode(err) != http.StatusNotFound {
+			t.Errorf("expected the attachment to be gone, got %v", err)
+		}
+	})
+
+	t.Run("webhooks", func(t *testing.T) {
+		webhook, err := c.CreateWebhook(ctx, models.CreateWebhookSchema{URL: "https://example.com/hook", Events: []string{models.EventNoteCreated}})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if webhook.Secret == "" || !webhook.Active {
+			t.Errorf("expected an active webhook with a secret, got %+v", webhook)
+		}
+
+		active := false
+		if updated, err := c.UpdateWebhook(ctx, webhook.ID, models.UpdateWebhookSchema{Active: &active}); err != nil || updated.Active {
+			t.Errorf("expected the webhook to be paused, got %+v, %v", updated, err)
+		}
+		webhooks, err := c.FindWebhooks(ctx)
+		if err != nil || len(webhooks) != 1 {
+			t.Errorf("expected one webhook, got %v, %v", webhooks, err)
+		}
+		if deliveries, err := c.FindDeliveries(ctx, webhook.ID, 10); err != nil || len(deliveries) != 0 {
+			t.Errorf("expected no delivery, got %v, %v", deliveries, err)
+		}
+
+		if err := c.DeleteWebhook(ctx, webhook.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := c.GetWebhook(ctx, webhook.ID); client.StatusCode(err) != http.StatusNotFound {
+			t.Errorf("expected the webhook to be gone, got %v", err)
+		}
+	})
+
+	t.Run("graphql", func(t *testing.T) {
+		var data struct {
+			Me struct{ Username string }
+		}
+		if err := c.GraphQL(ctx, `{ me { username } }`, nil, &data); err != nil || data.Me.Username != "alice" {
+			t.Errorf("expected alice, got %+v, %v", data, err)
+		}
+
+		err := c.GraphQL(ctx, `query($id: ID!) { note(id: $id) { title } }`, map[string]interface{}{"id": "missing"}, nil)
+		var errs client.GraphQLErrors
+		if !errors.As(err, &errs) || errs[0].Extensions["code"] != "NOT_FOUND" {
+			t.Errorf("expected a NOT_FOUND error, got %v", err)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		cfg := testConfig()
+		relay := events.NewRelay(repo, cfg.Outbox, nil, srv.bus)
+		relay.RunOnce(ctx)
+
+		streamCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		stream, err := c.NoteEvents(streamCtx, "")
+		if err != nil {
+			t.Fatalf("open stream: %v", err)
+		}
+		defer stream.Close()
+
+		note, err := c.CreateNote(ctx, models.CreateNoteSchema{Title: "Streamed", Content: "text"})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		relay.RunOnce(ctx)
+
+		event, err := stream.Next()
+		if err != nil {
+			t.Fatalf("next event: %v", err)
+		}
+		var payload struct {
+			Data struct {
+				Note models.Note `json:"note"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(event.Data, &payload); err != nil {
+			t.Fatalf("decode %s: %v", event.Data, err)
+		}
+		if event.Type != models.EventNoteCreated || payload.Data.Note.ID != note.ID || stream.LastEventID() != event.ID {
+			t.Errorf("expected the creation of %s, got %+v", note.ID, event)
+		}
+	})
+
+	t.Run("log in again", func(t *testing.T) {
+		// a rejected token is replaced on the fly
+		stale := newTestClient(t, srv, client.WithToken("expired"), client.WithCredentials("alice@example.com", "correct horse"))
+		if _, err := stale.FindNotes(ctx, 1, 1); err != nil {
+			t.Fatalf("expected the client to log in again, got %v", err)
+		}
+
+		// a token about to expire is replaced before it is sent
+		expiring, _ := utils.GenerateJWT(testConfig().Auth.JWTSecret, 30*time.Second, user.ID, user.Username, "")
+		refreshed := newTestClient(t, srv, client.WithToken(expiring), client.WithCredentials("alice", "correct horse"))
+		if _, err := refreshed.FindNotes(ctx, 1, 1); err != nil || refreshed.Token() == expiring {
+			t.Errorf("expected the token to be refreshed, got %v", err)
+		}
+
+		wrong := newTestClient(t, srv, client.WithCredentials("alice", "wrong password"))
+		if _, err := wrong.FindNotes(ctx, 1, 1); client.StatusCode(err) != http.StatusUnauthorized {
+			t.Errorf("expected the login to fail, got %v", err)
+		}
+
+		if err := c.Logout(ctx); err != nil {
+			t.Fatalf("logout: %v", err)
+		}
+		if _, err := c.FindNotes(ctx, 1, 1); client.StatusCode(err) != http.StatusUnauthorized {
+			t.Errorf("expected the client to be logged out, got %v", err)
+		}
+	})
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	// a token comes back every 2 seconds, longer than a registration takes even with the race detector
+	cfg.RateLimit.RPS = 0.5
+	cfg.RateLimit.Burst = 1
+	srv := newTestServer(t, repository.NewMemoryStore(), cfg)
+
+	c := newTestClient(t, srv)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := c.Register(ctx, models.CreateUserSchema{Username: "user" + string(rune('a'+i)), Email: string(rune('a'+i)) + "@example.com", Password: "correct horse", FullName: "Test user"}); err != nil {
+			t.Fatalf("register %d: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected the client to wait for the Retry-After, took %s", elapsed)
+	}
+
+	impatient := newTestClient(t, srv, client.WithMaxRetryWait(0))
+	_, err := impatient.Register(ctx, models.CreateUserSchema{Username: "userc", Email: "c@example.com", Password: "correct horse", FullName: "Test user"})
+	if client.StatusCode(err) != http.StatusTooManyRequests {
+		t.Errorf("expected a 429 past the longest wait, got %v", err)
+	}
+
+	canceled, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = c.Register(canceled, models.CreateUserSchema{Username: "userd", Email: "d@example.com", Password: "correct horse", FullName: "Test user"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/repository"
+)
+
+// Hub holds the rooms of the notes being edited on this replica, a note has a single room as long as its
+// clients are routed to the same replica
+type Hub struct {
+	store repository.Store
+	cfg   config.CollabConfig
+
+	mu    sync.Mutex
+	rooms map[string]*Room
+}
+
+func NewHub(store repository.Store, cfg config.CollabConfig) *Hub {
+	return &Hub{store: store, cfg: cfg, rooms: map[string]*Room{}}
+}
+
+// Join adds a client to the room of a note, opening it from the store if needed.
+// It returns repository.ErrNotFound when the note does not exist.
+func (h *Hub) Join(ctx context.Context, noteID string, peer Peer) (*Client, error) {
+	for {
+		h.mu.Lock()
+		room, ok := h.rooms[noteID]
+		if !ok {
+			room = &Room{hub: h, noteID: noteID, clients: map[*Client]struct{}{}}
+			h.rooms[noteID] = room
+		}
+		h.mu.Unlock()
+
+		// the note is read outside the lock of the hub, only the clients of this room wait for it
+		room.mu.Lock()
+		if room.closed {
+			// closed while the client was joining, the next room reads the content it saved
+			room.mu.Unlock()
+			continue
+		}
+		if !room.loaded {
+			if err := room.load(ctx); err != nil {
+				room.closed = true
+				h.remove(room)
+				room.mu.Unlock()
+				return nil, err
+			}
+		}
+		client := room.join(peer)
+		room.mu.Unlock()
+		return client, nil
+	}
+}
+
+// remove takes a room out of the hub unless it was replaced already
+func (h *Hub) remove(room *Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room.noteID] == room {
+		delete(h.rooms, room.noteID)
+	}
+}
+
+// list returns the open rooms
+func (h *Hub) list() []*Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Snapshot saves the content of every room to its note, the rooms of deleted notes are closed
+func (h *Hub) Snapshot(ctx context.Context) {
+	for _, room := range h.list() {
+		room.mu.Lock()
+		if !room.closed && room.loaded {
+			err := room.snapshot(ctx)
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				room.close(ctx, "The note was deleted")
+			case err != nil:
+				slog.Error("Failed to save a collaborative note", "note_id", room.noteID, "error", err)
+			}
+		}
+		room.mu.Unlock()
+	}
+}
+
+// Run saves the rooms every snapshot interval until ctx is cancelled, then saves and closes them all.
+// It is meant to run as a background worker.
+func (h *Hub) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.cfg.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.Close(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			h.Snapshot(ctx)
+		}
+	}
+}
+
+// Close saves and closes every room, the clients are told to reconnect
+func (h *Hub) Close(ctx context.Context) {
+	for _, room := range h.list() {
+		room.mu.Lock()
+		if !room.closed && room.loaded {
+			room.close(ctx, "The server is shutting down, reconnect")
+		}
+		room.mu.Unlock()
+	}
+}
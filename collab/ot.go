@@ -0,0 +1,247 @@
+// Package collab syncs the concurrent edits of a note with operational transformation, the server orders
+// the operations and transforms the ones sent against an older revision
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrMismatch is returned for an operation that does not apply to the document or to the other operation
+var ErrMismatch = errors.New("the operation does not match the length of the document")
+
+// component is a retain, an insert or a delete, exactly one field is set
+type component struct {
+	retain int
+	insert string
+	delete int
+}
+
+// Operation is an edit of a whole document. Its JSON form is the one of ot.js, an array where a positive
+// integer retains characters, a string inserts text and a negative integer deletes characters.
+// Lengths count Unicode code points.
+type Operation struct {
+	ops []component
+	// baseLen is the length of the documents it applies to, targetLen the length of the results
+	baseLen, targetLen int
+}
+
+// Retain skips n characters
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	o.targetLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].retain > 0 {
+		o.ops[last].retain += n
+		return o
+	}
+	o.ops = append(o.ops, component{retain: n})
+	return o
+}
+
+// Insert inserts text, an insert following a delete is put before it so that equal operations look the same
+func (o *Operation) Insert(text string) *Operation {
+	if text == "" {
+		return o
+	}
+	o.targetLen += utf8.RuneCountInString(text)
+	last := len(o.ops) - 1
+	switch {
+	case last >= 0 && o.ops[last].insert != "":
+		o.ops[last].insert += text
+	case last >= 0 && o.ops[last].delete > 0:
+		if last > 0 && o.ops[last-1].insert != "" {
+			o.ops[last-1].insert += text
+		} else {
+			o.ops = append(o.ops[:last], component{insert: text}, o.ops[last])
+		}
+	default:
+		o.ops = append(o.ops, component{insert: text})
+	}
+	return o
+}
+
+// Delete deletes n characters
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].delete > 0 {
+		o.ops[last].delete += n
+		return o
+	}
+	o.ops = append(o.ops, component{delete: n})
+	return o
+}
+
+// BaseLen is the length of the documents the operation applies to
+func (o *Operation) BaseLen() int { return o.baseLen }
+
+// TargetLen is the length of the documents the operation results in
+func (o *Operation) TargetLen() int { return o.targetLen }
+
+// IsNoop reports whether the operation leaves the document unchanged
+func (o *Operation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].retain > 0)
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	ops := make([]interface{}, len(o.ops))
+	for i, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			ops[i] = c.retain
+		case c.insert != "":
+			ops[i] = c.insert
+		default:
+			ops[i] = -c.delete
+		}
+	}
+	return json.Marshal(ops)
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*o = Operation{}
+	for i, item := range raw {
+		var n int
+		if err := json.Unmarshal(item, &n); err == nil {
+			switch {
+			case n > 0:
+				o.Retain(n)
+			case n < 0:
+				o.Delete(-n)
+			default:
+				return fmt.Errorf("component %d: zero is neither a retain nor a delete", i)
+			}
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(item, &text); err != nil || text == "" {
+			return fmt.Errorf("component %d: expected a non-zero integer or a non-empty string", i)
+		}
+		o.Insert(text)
+	}
+	return nil
+}
+
+// Apply returns the document edited by the operation
+func (o *Operation) Apply(doc []rune) ([]rune, error) {
+	if len(doc) != o.baseLen {
+		return nil, ErrMismatch
+	}
+	result := make([]rune, 0, o.targetLen)
+	pos := 0
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			result = append(result, doc[pos:pos+c.retain]...)
+			pos += c.retain
+		case c.insert != "":
+			result = append(result, []rune(c.insert)...)
+		default:
+			pos += c.delete
+		}
+	}
+	return result, nil
+}
+
+// Transform returns a' and b' such that applying a then b' gives the same document as b then a',
+// a and b being concurrent operations on the same document. The inserts of a at the same position
+// as the inserts of b come first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLen != b.baseLen {
+		return nil, nil, ErrMismatch
+	}
+	aPrime, bPrime := &Operation{}, &Operation{}
+	ops1, ops2 := a.ops, b.ops
+	var op1, op2 *component
+	next := func(ops *[]component) *component {
+		if len(*ops) == 0 {
+			return nil
+		}
+		c := (*ops)[0]
+		*ops = (*ops)[1:]
+		return &c
+	}
+	op1, op2 = next(&ops1), next(&ops2)
+
+	for op1 != nil || op2 != nil {
+		if op1 != nil && op1.insert != "" {
+			aPrime.Insert(op1.insert)
+			bPrime.Retain(utf8.RuneCountInString(op1.insert))
+			op1 = next(&ops1)
+			continue
+		}
+		if op2 != nil && op2.insert != "" {
+			aPrime.Retain(utf8.RuneCountInString(op2.insert))
+			bPrime.Insert(op2.insert)
+			op2 = next(&ops2)
+			continue
+		}
+		if op1 == nil || op2 == nil {
+			return nil, nil, ErrMismatch
+		}
+
+		n1, n2 := op1.retain+op1.delete, op2.retain+op2.delete
+		n := min(n1, n2)
+		switch {
+		case op1.retain > 0 && op2.retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case op1.delete > 0 && op2.retain > 0:
+			aPrime.Delete(n)
+		case op1.retain > 0 && op2.delete > 0:
+			bPrime.Delete(n)
+		}
+		// both deleting the same characters leaves nothing to do
+
+		op1, op2 = shorten(op1, n, &ops1, next), shorten(op2, n, &ops2, next)
+	}
+	return aPrime, bPrime, nil
+}
+
+// shorten consumes n characters of a retain or a delete and moves on to the next component once it is used up
+func shorten(c *component, n int, ops *[]component, next func(*[]component) *component) *component {
+	if c.retain > 0 {
+		c.retain -= n
+		if c.retain > 0 {
+			return c
+		}
+	} else {
+		c.delete -= n
+		if c.delete > 0 {
+			return c
+		}
+	}
+	return next(ops)
+}
+
+// TransformIndex moves a position in the document before the operation to the same place after it,
+// an insert at the position pushes it forward
+func (o *Operation) TransformIndex(index int) int {
+	result, pos := index, 0
+	for _, c := range o.ops {
+		if pos > index {
+			break
+		}
+		switch {
+		case c.retain > 0:
+			pos += c.retain
+		case c.insert != "":
+			result += utf8.RuneCountInString(c.insert)
+		default:
+			result -= min(c.delete, index-pos)
+			pos += c.delete
+		}
+	}
+	return max(0, min(result, o.targetLen))
+}
@@ -0,0 +1,118 @@
+package collab
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// randomOperation returns a random edit of doc
+func randomOperation(r *rand.Rand, doc []rune) *Operation {
+	op := &Operation{}
+	for pos := 0; pos < len(doc); {
+		n := 1 + r.Intn(len(doc)-pos)
+		switch r.Intn(3) {
+		case 0:
+			op.Retain(n)
+		case 1:
+			op.Delete(n)
+		default:
+			op.Insert(string([]rune("aé字🙂")[r.Intn(4):]))
+			continue
+		}
+		pos += n
+	}
+	if r.Intn(2) == 0 {
+		op.Insert("z")
+	}
+	return op
+}
+
+func TestOperationJSON(t *testing.T) {
+	var op Operation
+	if err := json.Unmarshal([]byte(`[2, "hé", -1, 1, -2, "!"]`), &op); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if op.BaseLen() != 6 || op.TargetLen() != 6 {
+		t.Errorf("expected lengths 6 and 6, got %d and %d", op.BaseLen(), op.TargetLen())
+	}
+	doc, err := op.Apply([]rune("abcdef"))
+	if err != nil || string(doc) != "abhéd!" {
+		t.Errorf("expected abhéd!, got %q: %v", string(doc), err)
+	}
+	data, _ := json.Marshal(op)
+	if string(data) != `[2,"hé",-1,1,"!",-2]` {
+		t.Errorf("unexpected encoding %s", data)
+	}
+
+	for _, invalid := range []string{`{}`, `[0]`, `[""]`, `[true]`, `[1.5]`} {
+		if err := json.Unmarshal([]byte(invalid), &op); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+	if _, err := op.Apply([]rune("too short")); err != ErrMismatch {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		doc := []rune(string([]rune("héllo wörld, 字 🙂")[:r.Intn(17)]))
+		a, b := randomOperation(r, doc), randomOperation(r, doc)
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("transform: %v", err)
+		}
+
+		afterA, _ := a.Apply(doc)
+		afterB, _ := b.Apply(doc)
+		ab, err := bPrime.Apply(afterA)
+		if err != nil {
+			t.Fatalf("apply b': %v", err)
+		}
+		ba, err := aPrime.Apply(afterB)
+		if err != nil {
+			t.Fatalf("apply a': %v", err)
+		}
+		if string(ab) != string(ba) {
+			a, _ := json.Marshal(a)
+			b, _ := json.Marshal(b)
+			t.Fatalf("%q diverged with %s and %s: %q and %q", string(doc), a, b, string(ab), string(ba))
+		}
+	}
+}
+
+func TestTransformTies(t *testing.T) {
+	a := (&Operation{}).Retain(1).Insert("a").Retain(1)
+	b := (&Operation{}).Retain(1).Insert("b").Retain(1)
+	_, bPrime, _ := Transform(a, b)
+	afterA, _ := a.Apply([]rune("xy"))
+	doc, _ := bPrime.Apply(afterA)
+	if string(doc) != "xaby" {
+		t.Errorf("expected the insert of the first operation first, got %q", string(doc))
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	// "hello world" to "hi world!"
+	op := (&Operation{}).Retain(1).Delete(4).Insert("i").Retain(6).Insert("!")
+	tests := []struct{ index, want int }{
+		{0, 0}, {1, 2}, {3, 2}, {5, 2}, {6, 3}, {11, 9},
+	}
+	for _, tt := range tests {
+		if got := op.TransformIndex(tt.index); got != tt.want {
+			t.Errorf("index %d: expected %d, got %d", tt.index, tt.want, got)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := [][2]string{{"", ""}, {"abc", "abc"}, {"abc", ""}, {"", "abc"}, {"héllo", "hallo"}, {"aaa", "aaaa"}, {"one two", "one 2 two"}}
+	for _, tt := range tests {
+		doc, err := diff(tt[0], tt[1]).Apply([]rune(tt[0]))
+		if err != nil || string(doc) != tt[1] {
+			t.Errorf("diff(%q, %q) gives %q: %v", tt[0], tt[1], string(doc), err)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"example/rest-api/events"
+	"example/rest-api/repository"
+
+	"github.com/google/uuid"
+)
+
+// the types of the messages, the clients send op and cursor messages
+const (
+	MessageInit   = "init"
+	MessageOp     = "op"
+	MessageAck    = "ack"
+	MessageCursor = "cursor"
+	MessageJoin   = "join"
+	MessageLeave  = "leave"
+	MessageError  = "error"
+)
+
+const (
+	// sendBuffer is how many messages a client can lag behind before it is dropped, it reconnects
+	sendBuffer = 256
+	// maxContentLength bounds the content of a note edited collaboratively, in characters
+	maxContentLength = 1 << 20
+)
+
+var (
+	// ErrRevision is returned for an operation sent against a revision the room no longer knows, the client resyncs
+	ErrRevision = errors.New("the revision is unknown, reload the note")
+	// ErrTooLarge is returned for an operation growing the note beyond the maximum length
+	ErrTooLarge = fmt.Errorf("the content of a note is limited to %d characters", maxContentLength)
+)
+
+// Cursor is the selection of a client, from Anchor to Head, in characters from the start of the content
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// transform moves the selection past an operation
+func (c *Cursor) transform(op *Operation) *Cursor {
+	return &Cursor{Anchor: op.TransformIndex(c.Anchor), Head: op.TransformIndex(c.Head)}
+}
+
+// Peer is a client of a room as the others see it
+type Peer struct {
+	ID       string  `json:"id"`
+	UserID   string  `json:"userId"`
+	Username string  `json:"username"`
+	Cursor   *Cursor `json:"cursor,omitempty"`
+}
+
+// Message is sent both ways over the connection of a client, Type tells which fields are set
+type Message struct {
+	Type string `json:"type"`
+	// Revision is the number of operations applied to the note since the room was opened, an op is sent
+	// against the revision it was made on and the ack and op messages carry the revision it produced
+	Revision int        `json:"revision"`
+	Op       *Operation `json:"op,omitempty"`
+	// Cursor is relative to the content of the sender when it sent it
+	Cursor *Cursor `json:"cursor,omitempty"`
+	// ClientID is the id given to the client in init, and the sender of the op, cursor and leave messages
+	ClientID string `json:"clientId,omitempty"`
+	// Content and Peers are the state of the room sent in init
+	Content string `json:"content,omitempty"`
+	Peers   []Peer `json:"peers,omitempty"`
+	// Peer is the client that joined
+	Peer  *Peer  `json:"peer,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Client is a connection to a room
+type Client struct {
+	peer Peer
+	// Send receives the messages for the client, it is closed once the client is dropped from the room
+	Send chan Message
+	room *Room
+}
+
+// ID is the id of the client in its room
+func (c *Client) ID() string { return c.peer.ID }
+
+// Room holds the content of a note edited by its clients, every operation goes through it
+type Room struct {
+	hub    *Hub
+	noteID string
+
+	mu     sync.Mutex
+	loaded bool
+	// closed rooms are out of the hub, a client joining one retries with a new room
+	closed   bool
+	doc      []rune
+	revision int
+	// history holds the last operations, up to revision
+	history []*Operation
+	// saved is the content of the note in the store as of savedRevision
+	saved         string
+	savedRevision int
+	clients       map[*Client]struct{}
+}
+
+// load reads the note, the room must be locked
+func (r *Room) load(ctx context.Context) error {
+	note, err := r.hub.store.Notes().FindByID(ctx, r.noteID)
+	if err != nil {
+		return err
+	}
+	r.doc = []rune(note.Content)
+	r.saved = note.Content
+	r.loaded = true
+	return nil
+}
+
+// join adds a client and sends it the state of the room, the room must be locked
+func (r *Room) join(peer Peer) *Client {
+	peer.ID = uuid.NewString()
+	client := &Client{peer: peer, Send: make(chan Message, sendBuffer), room: r}
+
+	peers := make([]Peer, 0, len(r.clients))
+	for other := range r.clients {
+		peers = append(peers, other.peer)
+	}
+	r.broadcast(nil, Message{Type: MessageJoin, Revision: r.revision, Peer: &peer})
+	r.clients[client] = struct{}{}
+	client.Send <- Message{Type: MessageInit, Revision: r.revision, ClientID: peer.ID, Content: string(r.doc), Peers: peers}
+	return client
+}
+
+// broadcast sends a message to every client but one, the ones lagging behind are dropped.
+// The room must be locked.
+func (r *Room) broadcast(except *Client, msg Message) {
+	for client := range r.clients {
+		if client == except {
+			continue
+		}
+		select {
+		case client.Send <- msg:
+		default:
+			r.drop(client)
+		}
+	}
+}
+
+// drop removes a client and tells the others, the room must be locked
+func (r *Room) drop(client *Client) {
+	if _, ok := r.clients[client]; !ok {
+		return
+	}
+	delete(r.clients, client)
+	close(client.Send)
+	r.broadcast(nil, Message{Type: MessageLeave, Revision: r.revision, ClientID: client.peer.ID})
+}
+
+// apply transforms an operation made on revision against the ones applied since, applies it and
+// returns it as applied, the room must be locked
+func (r *Room) apply(revision int, op *Operation) (*Operation, error) {
+	first := r.revision - len(r.history)
+	if revision < first || revision > r.revision {
+		return nil, ErrRevision
+	}
+	for _, concurrent := range r.history[revision-first:] {
+		var err error
+		if op, _, err = Transform(op, concurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := op.Apply(r.doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) > maxContentLength && len(doc) > len(r.doc) {
+		return nil, ErrTooLarge
+	}
+	r.commit(op, doc)
+	return op, nil
+}
+
+// commit records an operation resulting in doc and moves the cursors past it, the room must be locked
+func (r *Room) commit(op *Operation, doc []rune) {
+	r.doc = doc
+	r.revision++
+	r.history = append(r.history, op)
+	if extra := len(r.history) - r.hub.cfg.MaxHistory; extra > 0 {
+		r.history = append(r.history[:0:0], r.history[extra:]...)
+	}
+
+	for client := range r.clients {
+		if client.peer.Cursor != nil {
+			client.peer.Cursor = client.peer.Cursor.transform(op)
+		}
+	}
+}
+
+// Submit applies an operation of the client made on revision, it is acknowledged to the client and sent
+// to the others
+func (c *Client) Submit(revision int, op *Operation, cursor *Cursor) error {
+	r := c.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[c]; !ok {
+		return nil
+	}
+
+	op, err := r.apply(revision, op)
+	if err != nil {
+		return err
+	}
+	if cursor != nil {
+		c.peer.Cursor = cursor
+	}
+	select {
+	case c.Send <- Message{Type: MessageAck, Revision: r.revision}:
+	default:
+		r.drop(c)
+	}
+	r.broadcast(c, Message{Type: MessageOp, Revision: r.revision, Op: op, Cursor: cursor, ClientID: c.peer.ID})
+	return nil
+}
+
+// MoveCursor shares the selection of the client with the others
+func (c *Client) MoveCursor(cursor *Cursor) {
+	r := c.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[c]; !ok || cursor == nil {
+		return
+	}
+	c.peer.Cursor = cursor
+	r.broadcast(c, Message{Type: MessageCursor, Revision: r.revision, Cursor: cursor, ClientID: c.peer.ID})
+}
+
+// Leave removes the client from its room, with an error message when reason is set.
+// The room is saved and closed when its last client leaves.
+func (c *Client) Leave(ctx context.Context, reason string) {
+	r := c.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[c]; !ok {
+		return
+	}
+	if reason != "" {
+		select {
+		case c.Send <- Message{Type: MessageError, Revision: r.revision, Error: reason}:
+		default:
+		}
+	}
+	r.drop(c)
+	if len(r.clients) == 0 {
+		// saved before a client can open the room again
+		r.close(ctx, "")
+	}
+}
+
+// snapshot saves the content to the note along with a note.updated event. The changes made to the content
+// through the REST API since the last snapshot are merged like a concurrent operation, and sent to the clients.
+// The room must be locked.
+func (r *Room) snapshot(ctx context.Context) error {
+	var merged *Operation
+	content := string(r.doc)
+	err := r.hub.store.Transaction(ctx, func(tx repository.Store) error {
+		note, err := tx.Notes().FindByIDForUpdate(ctx, r.noteID)
+		if err != nil {
+			return err
+		}
+		merged, content = nil, string(r.doc)
+		if note.Content != r.saved {
+			if merged, content, err = r.rebase(diff(r.saved, note.Content)); err != nil {
+				return err
+			}
+		}
+		if note.Content == content {
+			return nil
+		}
+
+		before := *note
+		note.Content = content
+		if err := tx.Notes().Update(ctx, note); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx, events.NoteEvents(&before, note)...)
+	})
+	if err != nil {
+		return err
+	}
+
+	if merged != nil {
+		r.commit(merged, []rune(content))
+		r.broadcast(nil, Message{Type: MessageOp, Revision: r.revision, Op: merged})
+	}
+	r.saved, r.savedRevision = content, r.revision
+	return nil
+}
+
+// rebase transforms an operation made on the saved content against the ones applied since, and returns
+// it along with the content it results in. An operation older than the history is dropped, the content
+// of the room wins.
+func (r *Room) rebase(op *Operation) (*Operation, string, error) {
+	first := r.revision - len(r.history)
+	if r.savedRevision < first {
+		slog.Warn("A change made to a collaborative note through the API is lost, it is older than the history", "note_id", r.noteID)
+		return nil, string(r.doc), nil
+	}
+	for _, concurrent := range r.history[r.savedRevision-first:] {
+		var err error
+		if _, op, err = Transform(concurrent, op); err != nil {
+			return nil, "", err
+		}
+	}
+	doc, err := op.Apply(r.doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return op, string(doc), nil
+}
+
+// close saves the room and drops its clients with an error message when reason is set, the room must be locked
+func (r *Room) close(ctx context.Context, reason string) {
+	if err := r.snapshot(ctx); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("Failed to save a collaborative note", "note_id", r.noteID, "error", err)
+	}
+	for client := range r.clients {
+		if reason != "" {
+			select {
+			case client.Send <- Message{Type: MessageError, Revision: r.revision, Error: reason}:
+			default:
+			}
+		}
+		delete(r.clients, client)
+		close(client.Send)
+	}
+	r.closed = true
+	r.hub.remove(r)
+}
+
+// diff returns the operation turning a into b, as a single replacement between their common prefix and suffix
+func diff(a, b string) *Operation {
+	ra, rb := []rune(a), []rune(b)
+	prefix := 0
+	for prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ra)-prefix && suffix < len(rb)-prefix && ra[len(ra)-1-suffix] == rb[len(rb)-1-suffix] {
+		suffix++
+	}
+	op := &Operation{}
+	return op.Retain(prefix).
+		Delete(len(ra) - prefix - suffix).
+		Insert(string(rb[prefix : len(rb)-suffix])).
+		Retain(suffix)
+}
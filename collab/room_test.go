@@ -0,0 +1,146 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+func testHub(t *testing.T, content string) (*Hub, repository.Store, string) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	note := &models.Note{UserID: "alice", Title: "Shared", Content: content}
+	if err := store.Notes().Create(context.Background(), note); err != nil {
+		t.Fatalf("create note: %v", err)
+	}
+	return NewHub(store, config.CollabConfig{SnapshotInterval: time.Hour, MaxHistory: 2}), store, note.ID
+}
+
+// receive returns the next message of a client
+func receive(t *testing.T, client *Client) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-client.Send:
+		if !ok {
+			t.Fatal("the client was dropped")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+	return Message{}
+}
+
+func content(t *testing.T, store repository.Store, noteID string) string {
+	t.Helper()
+	note, err := store.Notes().FindByID(context.Background(), noteID)
+	if err != nil {
+		t.Fatalf("find note: %v", err)
+	}
+	return note.Content
+}
+
+func TestRoom(t *testing.T) {
+	ctx := context.Background()
+	hub, store, noteID := testHub(t, "hello")
+
+	alice, err := hub.Join(ctx, noteID, Peer{UserID: "alice", Username: "alice"})
+	if err != nil {
+		t.Fatalf("join: %v", err)
+	}
+	if init := receive(t, alice); init.Type != MessageInit || init.Content != "hello" || init.Revision != 0 || init.ClientID != alice.ID() {
+		t.Fatalf("unexpected init %+v", init)
+	}
+	bob, _ := hub.Join(ctx, noteID, Peer{UserID: "bob", Username: "bob"})
+	if init := receive(t, bob); len(init.Peers) != 1 || init.Peers[0].Username != "alice" {
+		t.Fatalf("expected alice in the peers, got %+v", init.Peers)
+	}
+	if join := receive(t, alice); join.Type != MessageJoin || join.Peer.Username != "bob" {
+		t.Fatalf("expected bob to join, got %+v", join)
+	}
+
+	// both edit revision 0, bob's edit is transformed against alice's
+	bob.MoveCursor(&Cursor{Anchor: 5, Head: 5})
+	receive(t, alice)
+	if err := alice.Submit(0, (&Operation{}).Insert("oh ").Retain(5), nil); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if err := bob.Submit(0, (&Operation{}).Retain(5).Insert("!"), &Cursor{Anchor: 6, Head: 6}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if ack := receive(t, alice); ack.Type != MessageAck || ack.Revision != 1 {
+		t.Errorf("expected alice's op to be acknowledged, got %+v", ack)
+	}
+	if op := receive(t, bob); op.Type != MessageOp || op.ClientID != alice.ID() || op.Revision != 1 {
+		t.Errorf("expected alice's op, got %+v", op)
+	}
+	if ack := receive(t, bob); ack.Type != MessageAck || ack.Revision != 2 {
+		t.Errorf("expected bob's op to be acknowledged, got %+v", ack)
+	}
+	if op := receive(t, alice); op.Op.BaseLen() != 8 || op.Cursor.Head != 6 {
+		t.Errorf("expected bob's op transformed, got %+v", op)
+	}
+
+	// revision 0 is out of the history of 2 operations once a third is applied
+	alice.Submit(2, (&Operation{}).Retain(9).Insert("?"), nil)
+	if err := bob.Submit(0, (&Operation{}).Retain(5), nil); !errors.Is(err, ErrRevision) {
+		t.Errorf("expected an unknown revision, got %v", err)
+	}
+	if err := bob.Submit(3, (&Operation{}).Retain(1), nil); !errors.Is(err, ErrMismatch) {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+
+	hub.Snapshot(ctx)
+	if got := content(t, store, noteID); got != "oh hello!?" {
+		t.Errorf("expected the snapshot to be saved, got %q", got)
+	}
+
+	alice.Leave(ctx, "")
+	bob.Submit(3, (&Operation{}).Delete(3).Retain(7), nil)
+	bob.Leave(ctx, "")
+	if got := content(t, store, noteID); got != "hello!?" {
+		t.Errorf("expected the room to be saved when the last client leaves, got %q", got)
+	}
+	if len(hub.list()) != 0 {
+		t.Error("expected the room to be closed")
+	}
+}
+
+func TestSnapshotMerges(t *testing.T) {
+	ctx := context.Background()
+	hub, store, noteID := testHub(t, "one three")
+	client, _ := hub.Join(ctx, noteID, Peer{})
+	receive(t, client)
+
+	client.Submit(0, (&Operation{}).Retain(9).Insert(" four"), nil)
+	receive(t, client)
+	// edited through the REST API meanwhile
+	note, _ := store.Notes().FindByID(ctx, noteID)
+	note.Content = "one two three"
+	store.Notes().Update(ctx, note)
+
+	hub.Snapshot(ctx)
+	if got := content(t, store, noteID); got != "one two three four" {
+		t.Errorf("expected both edits in the note, got %q", got)
+	}
+	if op := receive(t, client); op.Type != MessageOp || op.ClientID != "" || op.Revision != 2 {
+		t.Errorf("expected the edit to be sent to the client, got %+v", op)
+	}
+
+	store.Notes().Delete(ctx, noteID)
+	hub.Snapshot(ctx)
+	if msg := receive(t, client); msg.Type != MessageError {
+		t.Errorf("expected an error once the note is deleted, got %+v", msg)
+	}
+	if _, ok := <-client.Send; ok {
+		t.Error("expected the client to be dropped")
+	}
+	if _, err := hub.Join(ctx, noteID, Peer{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected the note to be missing, got %v", err)
+	}
+}
@@ -0,0 +1,606 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// the environments the server runs in
+const (
+	EnvProduction  = "production"
+	EnvDevelopment = "development"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	// Env is production or development, development validates the responses against the API schema
+	Env         string
+	Server      ServerConfig
+	Log         LogConfig
+	Database    DatabaseConfig
+	Auth        AuthConfig
+	CORS        CORSConfig
+	RateLimit   RateLimitConfig
+	Storage     StorageConfig
+	Attachments AttachmentConfig
+	Idempotency IdempotencyConfig
+	Webhooks    WebhookConfig
+	Outbox      OutboxConfig
+	Stream      StreamConfig
+	Collab      CollabConfig
+	GraphQL     GraphQLConfig
+	GRPC        GRPCConfig
+	Metrics     MetricsConfig
+	Tracing     TracingConfig
+}
+
+type ServerConfig struct {
+	Port int
+	// ReadTimeout bounds reading a whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing a response, measured from the end of the request headers
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection waits for the next request
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	// MaxBodySize bounds the JSON request bodies, uploads and imports have their own limits
+	MaxBodySize int64
+	// ShutdownTimeout is how long in-flight requests and workers get to finish after SIGINT or SIGTERM
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long /readyz reports draining before the server stops accepting connections
+	DrainDelay time.Duration
+	// HealthCheckTimeout bounds each dependency check of /readyz
+	HealthCheckTimeout time.Duration
+}
+
+type LogConfig struct {
+	Level slog.Level
+	// Format is json or text
+	Format string
+}
+
+type DatabaseConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// DSN returns the postgres connection string
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
+}
+
+type AuthConfig struct {
+	JWTSecret string
+	// TokenTTL is how long an issued token stays valid
+	TokenTTL time.Duration
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
+type RateLimitConfig struct {
+	// RPS is the number of requests per second allowed on average
+	RPS   float64
+	Burst int
+}
+
+type StorageConfig struct {
+	// Driver is local or s3
+	Driver   string
+	LocalDir string
+	S3       S3Config
+}
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+type AttachmentConfig struct {
+	// MaxSize is the size limit of an attachment in bytes
+	MaxSize      int64
+	AllowedTypes []string
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long the response to a request sent with an Idempotency-Key is replayed
+	TTL time.Duration
+}
+
+type WebhookConfig struct {
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+	// MaxAttempts is how many times a delivery is tried before it is marked failed
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, it doubles with every attempt up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is how often the queue is checked for due deliveries
+	PollInterval time.Duration
+}
+
+type OutboxConfig struct {
+	// PollInterval is how often the outbox is checked for events to relay
+	PollInterval time.Duration
+	// Retention is how long the published events are kept
+	Retention time.Duration
+	// File appends the events to an NDJSON file when it is set
+	File string
+}
+
+type StreamConfig struct {
+	// Heartbeat is how often an idle event stream gets a comment, keeping proxies from closing it
+	Heartbeat time.Duration
+	// ReplaySize is how many events are kept for the streams resuming with Last-Event-ID
+	ReplaySize int
+}
+
+type CollabConfig struct {
+	// SnapshotInterval is how often the content edited collaboratively is saved to the notes
+	SnapshotInterval time.Duration
+	// MaxHistory is how many operations a room keeps to transform the ones sent against an older revision
+	MaxHistory int
+}
+
+type GraphQLConfig struct {
+	// MaxDepth bounds the nesting of the fields of a query
+	MaxDepth int
+	// MaxComplexity bounds the cost of a query, a field costs 1 and a connection its page size times its fields
+	MaxComplexity int
+}
+
+type GRPCConfig struct {
+	// Port serves the gRPC services on their own port, 0 disables them
+	Port int
+}
+
+type MetricsConfig struct {
+	Enabled bool
+	// Port serves /metrics on a separate admin port, 0 serves it on the API port
+	Port int
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector
+	Endpoint string
+	// Insecure sends the spans to the collector over plain HTTP
+	Insecure    bool
+	SampleRatio float64
+	ServiceName string
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Env: EnvProduction,
+		Server: ServerConfig{
+			Port:               8750,
+			ReadTimeout:        30 * time.Second,
+			WriteTimeout:       60 * time.Second,
+			IdleTimeout:        120 * time.Second,
+			MaxHeaderBytes:     1 << 20, // 1 MB
+			MaxBodySize:        1 << 20, // 1 MB
+			ShutdownTimeout:    15 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Log: LogConfig{Level: slog.LevelInfo, Format: "json"},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "go-server",
+			SSLMode: "disable",
+		},
+		Auth: AuthConfig{TokenTTL: 2 * time.Hour},
+		CORS: CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}},
+		// 1 request per second and a burst size of 5
+		RateLimit: RateLimitConfig{RPS: 1, Burst: 5},
+		Storage:   StorageConfig{Driver: "local", LocalDir: "data/attachments"},
+		Attachments: AttachmentConfig{
+			MaxSize: 10 << 20, // 10 MB
+			AllowedTypes: []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp",
+				"application/pdf", "text/plain", "text/csv",
+			},
+		},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour},
+		Webhooks: WebhookConfig{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  10,
+			MinBackoff:   30 * time.Second,
+			MaxBackoff:   time.Hour,
+			PollInterval: 5 * time.Second,
+		},
+		Outbox:  OutboxConfig{PollInterval: time.Second, Retention: 7 * 24 * time.Hour},
+		Stream:  StreamConfig{Heartbeat: 15 * time.Second, ReplaySize: 1000},
+		Collab:  CollabConfig{SnapshotInterval: 5 * time.Second, MaxHistory: 1000},
+		GraphQL: GraphQLConfig{MaxDepth: 10, MaxComplexity: 1000},
+		Metrics: MetricsConfig{Enabled: true},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "notes-api",
+		},
+	}
+}
+
+// Load builds the configuration from, by increasing priority, the defaults, the config file,
+// the environment variables and the command line flags. The config file is a .env style file
+// given by -config or CONFIG_FILE, ./.env is read when it exists and no file is given.
+// The arguments left after the flags are returned, only the database settings are validated when they
+// start with the migrate command.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+
+	flags := flag.NewFlagSet("rest-api", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path of a .env style config file")
+	env := flags.String("env", "", "environment: production or development")
+	port := flags.Int("port", 0, "port the API listens on")
+	corsOrigins := flags.String("cors-origins", "", "comma separated origins allowed by CORS")
+	rateLimit := flags.Float64("rate-limit", 0, "requests per second allowed on average")
+	rateBurst := flags.Int("rate-burst", 0, "requests allowed in a burst")
+	logLevel := flags.String("log-level", "", "minimum level logged: debug, info, warn or error")
+	metricsPort := flags.Int("metrics-port", 0, "separate admin port serving /metrics")
+	grpcPort := flags.Int("grpc-port", 0, "port of the gRPC services, 0 disables them")
+	tracingExporter := flags.String("tracing-exporter", "", "span exporter: none, stdout or otlp")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 0, "time given to in-flight requests on shutdown")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := readFile(*configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := &loader{file: file}
+	l.apply(cfg)
+	if l.errs != nil {
+		return nil, nil, errors.Join(l.errs...)
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			cfg.Env = *env
+		case "port":
+			cfg.Server.Port = *port
+		case "cors-origins":
+			cfg.CORS.AllowedOrigins = splitList(*corsOrigins)
+		case "rate-limit":
+			cfg.RateLimit.RPS = *rateLimit
+		case "rate-burst":
+			cfg.RateLimit.Burst = *rateBurst
+		case "log-level":
+			if err := cfg.Log.Level.UnmarshalText([]byte(*logLevel)); err != nil {
+				l.fail("-log-level", *logLevel, err)
+			}
+		case "metrics-port":
+			cfg.Metrics.Port = *metricsPort
+		case "grpc-port":
+			cfg.GRPC.Port = *grpcPort
+		case "tracing-exporter":
+			cfg.Tracing.Exporter = *tracingExporter
+		case "shutdown-timeout":
+			cfg.Server.ShutdownTimeout = *shutdownTimeout
+		}
+	})
+
+	if l.errs != nil {
+		return nil, nil, errors.Join(l.errs...)
+	}
+	// the migrate command only needs the database
+	validate := cfg.Validate
+	if flags.Arg(0) == "migrate" {
+		validate = cfg.Database.Validate
+	}
+	if err := validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// readFile reads the config file, a missing ./.env is fine but an explicit file has to exist
+func readFile(path string) (map[string]string, error) {
+	explicit := path != ""
+	if !explicit {
+		path = ".env"
+	}
+
+	values, err := godotenv.Read(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	return values, nil
+}
+
+// Validate reports every invalid database setting at once
+func (c DatabaseConfig) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Host != "", "DB_HOST must be set")
+	check(c.Port > 0 && c.Port < 65536, "DB_PORT must be between 1 and 65535, got %d", c.Port)
+	check(c.Name != "", "DB_NAME must be set")
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == EnvProduction || c.Env == EnvDevelopment, "APP_ENV must be production or development, got %q", c.Env)
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "PORT must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "SERVER_READ_TIMEOUT must be positive")
+	check(c.Server.WriteTimeout > 0, "SERVER_WRITE_TIMEOUT must be positive")
+	check(c.Server.IdleTimeout > 0, "SERVER_IDLE_TIMEOUT must be positive")
+	check(c.Server.MaxHeaderBytes > 0, "SERVER_MAX_HEADER_BYTES must be positive")
+	check(c.Server.MaxBodySize > 0, "SERVER_MAX_BODY_SIZE must be positive")
+	check(c.Server.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(c.Server.DrainDelay >= 0, "SHUTDOWN_DRAIN_DELAY must not be negative")
+	check(c.Server.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT must be positive")
+	check(c.Log.Format == "json" || c.Log.Format == "text", "LOG_FORMAT must be json or text, got %q", c.Log.Format)
+	errs = append(errs, c.Database.Validate())
+	check(c.Auth.JWTSecret != "", "JWT_SECRET must be set")
+	check(c.Auth.TokenTTL > 0, "JWT_TTL must be positive")
+	check(c.RateLimit.RPS > 0, "RATE_LIMIT_RPS must be positive")
+	check(c.RateLimit.Burst > 0, "RATE_LIMIT_BURST must be positive")
+	check(c.Attachments.MaxSize > 0, "ATTACHMENT_MAX_SIZE must be positive")
+	check(len(c.Attachments.AllowedTypes) > 0, "ATTACHMENT_ALLOWED_TYPES must not be empty")
+	check(c.Idempotency.TTL > 0, "IDEMPOTENCY_TTL must be positive")
+	check(c.Webhooks.Timeout > 0, "WEBHOOK_TIMEOUT must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS must be positive")
+	check(c.Webhooks.MinBackoff > 0, "WEBHOOK_MIN_BACKOFF must be positive")
+	check(c.Webhooks.MaxBackoff >= c.Webhooks.MinBackoff, "WEBHOOK_MAX_BACKOFF must not be less than WEBHOOK_MIN_BACKOFF")
+	check(c.Webhooks.PollInterval > 0, "WEBHOOK_POLL_INTERVAL must be positive")
+	check(c.Outbox.PollInterval > 0, "OUTBOX_POLL_INTERVAL must be positive")
+	check(c.Outbox.Retention > 0, "OUTBOX_RETENTION must be positive")
+	check(c.Stream.Heartbeat > 0, "STREAM_HEARTBEAT must be positive")
+	check(c.Stream.ReplaySize >= 0, "STREAM_REPLAY_SIZE must not be negative")
+	check(c.Collab.SnapshotInterval > 0, "COLLAB_SNAPSHOT_INTERVAL must be positive")
+	check(c.Collab.MaxHistory > 0, "COLLAB_MAX_HISTORY must be positive")
+	check(c.GraphQL.MaxDepth > 0, "GRAPHQL_MAX_DEPTH must be positive")
+	check(c.GraphQL.MaxComplexity > 0, "GRAPHQL_MAX_COMPLEXITY must be positive")
+
+	check(c.Metrics.Port >= 0 && c.Metrics.Port < 65536, "METRICS_PORT must be between 0 and 65535, got %d", c.Metrics.Port)
+	check(c.Metrics.Port == 0 || c.Metrics.Port != c.Server.Port, "METRICS_PORT must differ from PORT")
+	check(c.GRPC.Port >= 0 && c.GRPC.Port < 65536, "GRPC_PORT must be between 0 and 65535, got %d", c.GRPC.Port)
+	check(c.GRPC.Port == 0 || c.GRPC.Port != c.Server.Port && c.GRPC.Port != c.Metrics.Port, "GRPC_PORT must differ from PORT and METRICS_PORT")
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		check(c.Tracing.Endpoint != "", "TRACING_ENDPOINT must be set")
+	default:
+		check(false, "TRACING_EXPORTER must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "TRACING_SERVICE_NAME must be set")
+
+	switch c.Storage.Driver {
+	case "local":
+		check(c.Storage.LocalDir != "", "STORAGE_LOCAL_DIR must be set")
+	case "s3":
+		check(c.Storage.S3.Endpoint != "", "S3_ENDPOINT must be set")
+		check(c.Storage.S3.Bucket != "", "S3_BUCKET must be set")
+	default:
+		check(false, "STORAGE_DRIVER must be local or s3, got %q", c.Storage.Driver)
+	}
+
+	return errors.Join(errs...)
+}
+
+// loader parses the raw values into the config and collects the errors
+type loader struct {
+	// file holds the values of the config file, the environment takes precedence over them
+	file map[string]string
+	errs []error
+}
+
+func (l *loader) apply(cfg *Config) {
+	l.string("APP_ENV", &cfg.Env)
+
+	l.int("PORT", &cfg.Server.Port)
+	l.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	l.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	l.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	l.int("SERVER_MAX_HEADER_BYTES", &cfg.Server.MaxHeaderBytes)
+	l.int64("SERVER_MAX_BODY_SIZE", &cfg.Server.MaxBodySize)
+	l.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	l.duration("SHUTDOWN_DRAIN_DELAY", &cfg.Server.DrainDelay)
+	l.duration("HEALTH_CHECK_TIMEOUT", &cfg.Server.HealthCheckTimeout)
+
+	l.level("LOG_LEVEL", &cfg.Log.Level)
+	l.string("LOG_FORMAT", &cfg.Log.Format)
+
+	l.string("DB_HOST", &cfg.Database.Host)
+	l.int("DB_PORT", &cfg.Database.Port)
+	l.string("DB_USER", &cfg.Database.User)
+	l.string("DB_PASSWORD", &cfg.Database.Password)
+	l.string("DB_NAME", &cfg.Database.Name)
+	l.string("DB_SSL_MODE", &cfg.Database.SSLMode)
+
+	l.string("JWT_SECRET", &cfg.Auth.JWTSecret)
+	l.duration("JWT_TTL", &cfg.Auth.TokenTTL)
+
+	l.list("CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)
+
+	l.float("RATE_LIMIT_RPS", &cfg.RateLimit.RPS)
+	l.int("RATE_LIMIT_BURST", &cfg.RateLimit.Burst)
+
+	l.string("STORAGE_DRIVER", &cfg.Storage.Driver)
+	l.string("STORAGE_LOCAL_DIR", &cfg.Storage.LocalDir)
+	l.string("S3_ENDPOINT", &cfg.Storage.S3.Endpoint)
+	l.string("S3_REGION", &cfg.Storage.S3.Region)
+	l.string("S3_BUCKET", &cfg.Storage.S3.Bucket)
+	l.string("S3_ACCESS_KEY", &cfg.Storage.S3.AccessKey)
+	l.string("S3_SECRET_KEY", &cfg.Storage.S3.SecretKey)
+	l.bool("S3_USE_SSL", &cfg.Storage.S3.UseSSL)
+
+	l.int64("ATTACHMENT_MAX_SIZE", &cfg.Attachments.MaxSize)
+	l.list("ATTACHMENT_ALLOWED_TYPES", &cfg.Attachments.AllowedTypes)
+
+	l.duration("IDEMPOTENCY_TTL", &cfg.Idempotency.TTL)
+
+	l.duration("WEBHOOK_TIMEOUT", &cfg.Webhooks.Timeout)
+	l.int("WEBHOOK_MAX_ATTEMPTS", &cfg.Webhooks.MaxAttempts)
+	l.duration("WEBHOOK_MIN_BACKOFF", &cfg.Webhooks.MinBackoff)
+	l.duration("WEBHOOK_MAX_BACKOFF", &cfg.Webhooks.MaxBackoff)
+	l.duration("WEBHOOK_POLL_INTERVAL", &cfg.Webhooks.PollInterval)
+
+	l.duration("OUTBOX_POLL_INTERVAL", &cfg.Outbox.PollInterval)
+	l.duration("OUTBOX_RETENTION", &cfg.Outbox.Retention)
+	l.string("OUTBOX_FILE", &cfg.Outbox.File)
+
+	l.duration("STREAM_HEARTBEAT", &cfg.Stream.Heartbeat)
+	l.int("STREAM_REPLAY_SIZE", &cfg.Stream.ReplaySize)
+
+	l.duration("COLLAB_SNAPSHOT_INTERVAL", &cfg.Collab.SnapshotInterval)
+	l.int("COLLAB_MAX_HISTORY", &cfg.Collab.MaxHistory)
+
+	l.int("GRAPHQL_MAX_DEPTH", &cfg.GraphQL.MaxDepth)
+	l.int("GRAPHQL_MAX_COMPLEXITY", &cfg.GraphQL.MaxComplexity)
+
+	l.int("GRPC_PORT", &cfg.GRPC.Port)
+
+	l.bool("METRICS_ENABLED", &cfg.Metrics.Enabled)
+	l.int("METRICS_PORT", &cfg.Metrics.Port)
+
+	l.string("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	l.string("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	l.bool("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	l.float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	l.string("TRACING_SERVICE_NAME", &cfg.Tracing.ServiceName)
+}
+
+// lookup returns the value of key, empty values leave the default in place
+func (l *loader) lookup(key string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		value = strings.TrimSpace(l.file[key])
+	}
+	return value, value != ""
+}
+
+func (l *loader) fail(key, value string, err error) {
+	l.errs = append(l.errs, fmt.Errorf("invalid %s %q: %w", key, value, err))
+}
+
+func (l *loader) string(key string, dst *string) {
+	if value, ok := l.lookup(key); ok {
+		*dst = value
+	}
+}
+
+func (l *loader) list(key string, dst *[]string) {
+	if value, ok := l.lookup(key); ok {
+		*dst = splitList(value)
+	}
+}
+
+func (l *loader) int(key string, dst *int) {
+	if value, ok := l.lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			l.fail(key, value, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (l *loader) int64(key string, dst *int64) {
+	if value, ok := l.lookup(key); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			l.fail(key, value, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (l *loader) float(key string, dst *float64) {
+	if value, ok := l.lookup(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			l.fail(key, value, err)
+			return
+		}
+		*dst = f
+	}
+}
+
+func (l *loader) bool(key string, dst *bool) {
+	if value, ok := l.lookup(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			l.fail(key, value, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+func (l *loader) duration(key string, dst *time.Duration) {
+	if value, ok := l.lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			l.fail(key, value, err)
+			return
+		}
+		*dst = d
+	}
+}
+
+func (l *loader) level(key string, dst *slog.Level) {
+	if value, ok := l.lookup(key); ok {
+		if err := dst.UnmarshalText([]byte(value)); err != nil {
+			l.fail(key, value, err)
+		}
+	}
+}
+
+// splitList splits a comma separated list and drops the empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeConfigFile(t, "JWT_SECRET=from-file\nPORT=9000\nRATE_LIMIT_BURST=7\nJWT_TTL=30m\n")
+	t.Setenv("PORT", "9100")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example, https://b.example")
+
+	cfg, args, err := Load([]string{"-config", file, "-rate-burst", "9", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if cfg.Auth.JWTSecret != "from-file" || cfg.Auth.TokenTTL != 30*time.Minute {
+		t.Errorf("expected the auth settings of the file, got %+v", cfg.Auth)
+	}
+	if cfg.Server.Port != 9100 {
+		t.Errorf("expected the environment to override the file, got port %d", cfg.Server.Port)
+	}
+	if cfg.RateLimit.Burst != 9 {
+		t.Errorf("expected the flag to override the file, got burst %d", cfg.RateLimit.Burst)
+	}
+	if cfg.RateLimit.RPS != 1 {
+		t.Errorf("expected the default rate, got %v", cfg.RateLimit.RPS)
+	}
+	if strings.Join(cfg.CORS.AllowedOrigins, " ") != "https://a.example https://b.example" {
+		t.Errorf("unexpected origins %v", cfg.CORS.AllowedOrigins)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("expected the remaining arguments, got %v", args)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("JWT_SECRET", "from-env")
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("load without a .env file: %v", err)
+	}
+	if cfg.Server.Port != 8750 || cfg.Storage.Driver != "local" || cfg.GRPC.Port != 0 {
+		t.Errorf("expected the defaults, got %+v", cfg)
+	}
+}
+
+func TestLoadMigrate(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("STORAGE_DRIVER", "ftp")
+
+	if _, _, err := Load([]string{"migrate", "up"}); err != nil {
+		t.Fatalf("expected the migrate command to only need the database, got %v", err)
+	}
+
+	t.Setenv("DB_PORT", "0")
+	if _, _, err := Load([]string{"migrate", "up"}); err == nil || !strings.Contains(err.Error(), "DB_PORT must be between 1 and 65535") {
+		t.Errorf("expected an error containing %q, got %v", "DB_PORT must be between 1 and 65535", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"missing secret", nil, nil, "JWT_SECRET must be set"},
+		{"bad port", map[string]string{"PORT": "http"}, nil, `invalid PORT "http"`},
+		{"port out of range", map[string]string{"PORT": "70000"}, nil, "PORT must be between 1 and 65535"},
+		{"bad duration", map[string]string{"JWT_TTL": "2"}, nil, `invalid JWT_TTL "2"`},
+		{"unknown driver", map[string]string{"STORAGE_DRIVER": "ftp"}, nil, "STORAGE_DRIVER must be local or s3"},
+		{"s3 without bucket", map[string]string{"STORAGE_DRIVER": "s3", "S3_ENDPOINT": "localhost:9000"}, nil, "S3_BUCKET must be set"},
+		{"negative rate flag", nil, []string{"-rate-limit", "-1"}, "RATE_LIMIT_RPS must be positive"},
+		{"missing config file", nil, []string{"-config", "does-not-exist.env"}, "read config file"},
+		{"unknown exporter", nil, []string{"-tracing-exporter", "jaeger"}, "TRACING_EXPORTER must be none, stdout or otlp"},
+		{"unknown environment", nil, []string{"-env", "staging"}, "APP_ENV must be production or development"},
+		{"sample ratio out of range", map[string]string{"TRACING_SAMPLE_RATIO": "2"}, nil, "TRACING_SAMPLE_RATIO must be between 0 and 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", "")
+			if tt.want != "JWT_SECRET must be set" {
+				t.Setenv("JWT_SECRET", "secret")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, _, err := Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -1,52 +1,40 @@
 package db
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"log/slog"
 
-	"example/rest-api/models"
+	"example/rest-api/config"
+	"example/rest-api/logging"
 
-	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-func ConnectDB() error {
-
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-
-	// Get database connection details from environment variables
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	sslmode := os.Getenv("DB_SSL_MODE")
-
-	// Build the connection string
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", host, port, user, password, dbname, sslmode)
-
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// ConnectDB opens the connection shared through DB
+func ConnectDB(cfg config.DatabaseConfig) error {
+	var err error
+	DB, err = Open(cfg.DSN())
 	if err != nil {
 		return err
 	}
 
-	DB.Logger = logger.Default.LogMode(logger.Info)
+	slog.Info("🚀 Connected Successfully to the Database", "host", cfg.Host, "database", cfg.Name)
+	return nil
+}
 
-	log.Println("Running Migrations")
-	err = DB.AutoMigrate(&models.User{}, &models.Note{})
+// Close closes the connections of DB
+func Close() error {
+	sqlDB, err := DB.DB()
 	if err != nil {
 		return err
 	}
+	return sqlDB.Close()
+}
 
-	log.Println("🚀 Connected Successfully to the Database")
-	return nil
+// Open connects to the database behind dsn, the schema is managed by the migrations
+func Open(dsn string) (*gorm.DB, error) {
+	// queries are logged through the default slog logger, at debug level
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logging.NewGormLogger(slog.Default())})
 }
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolationCode is the SQLSTATE Postgres reports for a unique constraint violation
+const uniqueViolationCode = "23505"
+
+// uniqueFields maps the unique indexes to the field they protect
+var uniqueFields = map[string]string{
+	"idx_notes_user_title": "title",
+	"idx_users_username":   "username",
+	"idx_users_email":      "email",
+}
+
+// UniqueViolation reports whether err is a unique constraint violation and returns the conflicting field.
+// The field is empty when the violated constraint is unknown.
+func UniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationCode {
+		return "", false
+	}
+	return uniqueFields[pgErr.ConstraintName], true
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantField string
+		wantOK    bool
+	}{
+		{"note title", &pgconn.PgError{Code: "23505", ConstraintName: "idx_notes_user_title"}, "title", true},
+		{"username", &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_username"}, "username", true},
+		{"email", &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_email"}, "email", true},
+		{"wrapped", fmt.Errorf("create user: %w", &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_email"}), "email", true},
+		{"unknown constraint", &pgconn.PgError{Code: "23505", ConstraintName: "outbox_events_event_id_key"}, "", true},
+		{"foreign key", &pgconn.PgError{Code: "23503", ConstraintName: "idx_notes_user_title"}, "", false},
+		{"not null", &pgconn.PgError{Code: "23502", ColumnName: "title"}, "", false},
+		{"not a postgres error", errors.New("duplicate key value violates unique constraint"), "", false},
+		{"nil", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := UniqueViolation(tt.err)
+			if field != tt.wantField || ok != tt.wantOK {
+				t.Errorf("expected %q %v, got %q %v", tt.wantField, tt.wantOK, field, ok)
+			}
+		})
+	}
+}
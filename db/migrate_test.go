@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("load embedded migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migration embedded")
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("expected version %d, got %d_%s", i+1, migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{"bad name", fstest.MapFS{"m/create_notes.up.sql": {}}, "invalid migration file name"},
+		{"missing down", fstest.MapFS{"m/0001_notes.up.sql": {Data: []byte("SELECT 1")}}, "needs both an up and a down file"},
+		{"two names", fstest.MapFS{
+			"m/0001_notes.up.sql":   {Data: []byte("SELECT 1")},
+			"m/0001_users.down.sql": {Data: []byte("SELECT 1")},
+		}, "has two names"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// testMigrator connects to the database in TEST_DATABASE_URL, every table in it is dropped by the tests
+func testMigrator(t *testing.T) (*gorm.DB, *Migrator) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	conn, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	return conn, migrator
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	_, migrator := testMigrator(t)
+
+	if _, err := migrator.Down(ctx, len(migrator.migrations)); err != nil {
+		t.Fatalf("revert everything: %v", err)
+	}
+	if err := migrator.CheckMigrations(ctx); !errors.Is(err, ErrSchemaNotMigrated) {
+		t.Fatalf("expected ErrSchemaNotMigrated, got %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Errorf("expected %d migrations to be applied, got %d", len(migrator.migrations), len(applied))
+	}
+	if err := migrator.CheckMigrations(ctx); err != nil {
+		t.Fatalf("expected an up to date schema, got %v", err)
+	}
+
+	// a second run has nothing to do
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("expected no migration to apply, got %d (%v)", len(applied), err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt.IsZero() {
+			t.Errorf("expected migration %d to be applied", status.Version)
+		}
+	}
+}
+
+// baselineUser and baselineNote are the models AutoMigrate created the schema from before the migrations
+type baselineUser struct {
+	ID        string    `gorm:"type:char(36);primary_key"`
+	Username  string    `gorm:"type:varchar(100);uniqueIndex:idx_users_username,LENGTH(100);not null"`
+	Email     string    `gorm:"type:varchar(255);uniqueIndex:idx_users_email,LENGTH(255);not null"`
+	Password  string    `gorm:"type:varchar(255);not null"`
+	FullName  string    `gorm:"type:varchar(255);not null"`
+	Role      string    `gorm:"type:varchar(50);default:'user'"`
+	CreatedAt time.Time `gorm:"not null;default:'1970-01-01 00:00:01'"`
+	UpdatedAt time.Time `gorm:"not null;default:'1970-01-01 00:00:01'; ON UPDATE CURRENT_TIMESTAMP"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineNote struct {
+	ID        string    `gorm:"type:char(36);primary_key"`
+	Title     string    `gorm:"type:varchar(255);uniqueIndex:idx_notes_title,LENGTH(255);not null"`
+	Content   string    `gorm:"not null"`
+	Category  string    `gorm:"varchar(100)"`
+	Published bool      `gorm:"default:false;not null"`
+	CreatedAt time.Time `gorm:"not null;default:'1970-01-01 00:00:01'"`
+	UpdatedAt time.Time `gorm:"not null;default:'1970-01-01 00:00:01';ON UPDATE CURRENT_TIMESTAMP"`
+}
+
+func (baselineNote) TableName() string { return "notes" }
+
+// TestMigratorBaseline applies the migrations to a database created by AutoMigrate, keeping its notes
+func TestMigratorBaseline(t *testing.T) {
+	ctx := context.Background()
+	conn, migrator := testMigrator(t)
+
+	if _, err := migrator.Down(ctx, len(migrator.migrations)); err != nil {
+		t.Fatalf("revert everything: %v", err)
+	}
+	if err := conn.AutoMigrate(&baselineUser{}, &baselineNote{}); err != nil {
+		t.Fatalf("create the baseline schema: %v", err)
+	}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := []baselineUser{
+		{ID: "00000000-0000-0000-0000-00000000000a", Username: "alice", Email: "alice@example.com", Password: "x", FullName: "Alice", Role: "user", CreatedAt: created},
+		{ID: "00000000-0000-0000-0000-00000000000b", Username: "admin", Email: "admin@example.com", Password: "x", FullName: "Admin", Role: "ADMIN", CreatedAt: created.Add(time.Hour)},
+	}
+	if err := conn.Create(&users).Error; err != nil {
+		t.Fatalf("create the baseline users: %v", err)
+	}
+	note := baselineNote{ID: "00000000-0000-0000-0000-000000000001", Title: "Groceries", Content: "Milk"}
+	if err := conn.Create(&note).Error; err != nil {
+		t.Fatalf("create a baseline note: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	var migrated struct {
+		UserID        string
+		Title         string
+		ContentFormat string
+	}
+	if err := conn.Raw("SELECT user_id, title, content_format FROM notes WHERE id = ?", note.ID).Scan(&migrated).Error; err != nil {
+		t.Fatalf("read the migrated note: %v", err)
+	}
+	if migrated.Title != "Groceries" || migrated.ContentFormat != "plain" {
+		t.Errorf("expected the note to be kept as plain text, got %+v", migrated)
+	}
+	// the notes without an owner go to the admin, even when an older user exists
+	if migrated.UserID != users[1].ID {
+		t.Errorf("expected the note to be given to the admin, got the owner %q", migrated.UserID)
+	}
+
+	// titles are unique per user now
+	if err := conn.Exec("INSERT INTO notes (id, user_id, title, content) VALUES (?, ?, ?, ?)",
+		"00000000-0000-0000-0000-000000000002", users[0].ID, "Groceries", "Eggs").Error; err != nil {
+		t.Errorf("expected the title of another user to be accepted, got %v", err)
+	}
+	// and every note has an existing owner
+	if err := conn.Exec("INSERT INTO notes (id, user_id, title, content) VALUES (?, ?, ?, ?)",
+		"00000000-0000-0000-0000-000000000003", "00000000-0000-0000-0000-00000000000c", "Orphan", "Eggs").Error; err == nil {
+		t.Error("expected a note of an unknown user to be rejected")
+	}
+}
@@ -0,0 +1,57 @@
+-- the baseline matches the schema AutoMigrate used to create, so existing databases can adopt it as is
+CREATE TABLE IF NOT EXISTS users (
+    id char(36) PRIMARY KEY,
+    username varchar(100) NOT NULL,
+    email varchar(255) NOT NULL,
+    password varchar(255) NOT NULL,
+    full_name varchar(255) NOT NULL,
+    role varchar(50) DEFAULT 'user',
+    created_at timestamptz NOT NULL DEFAULT '1970-01-01 00:00:01',
+    updated_at timestamptz NOT NULL DEFAULT '1970-01-01 00:00:01'
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS notes (
+    id char(36) PRIMARY KEY,
+    user_id char(36) NOT NULL REFERENCES users(id),
+    title varchar(255) NOT NULL,
+    content text NOT NULL,
+    content_format varchar(20) NOT NULL DEFAULT 'plain',
+    category text,
+    published boolean NOT NULL DEFAULT false,
+    tags text[],
+    created_at timestamptz NOT NULL DEFAULT '1970-01-01 00:00:01',
+    updated_at timestamptz NOT NULL DEFAULT '1970-01-01 00:00:01'
+);
+-- the notes created by AutoMigrate predate these columns
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS user_id char(36);
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS content_format varchar(20) NOT NULL DEFAULT 'plain';
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS tags text[];
+-- the notes without an owner, or whose owner is gone, are given to the first admin or else to the oldest user
+UPDATE notes SET user_id = (
+    SELECT id FROM users ORDER BY CASE WHEN role = 'ADMIN' THEN 0 ELSE 1 END, created_at, id LIMIT 1
+) WHERE user_id IS NULL OR user_id NOT IN (SELECT id FROM users);
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM notes WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'the notes have no owner and there is no user to give them to, register a user first';
+    END IF;
+END $$;
+ALTER TABLE notes ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE notes DROP CONSTRAINT IF EXISTS notes_user_id_fkey;
+ALTER TABLE notes ADD CONSTRAINT notes_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+-- titles used to be unique across all users, they are unique per user now
+DROP INDEX IF EXISTS idx_notes_title;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notes_user_title ON notes (user_id, title);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id char(36) PRIMARY KEY,
+    note_id char(36) NOT NULL,
+    file_name varchar(255) NOT NULL,
+    content_type varchar(255) NOT NULL,
+    size bigint NOT NULL,
+    storage_key varchar(512) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT '1970-01-01 00:00:01'
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_note_id ON attachments (note_id);
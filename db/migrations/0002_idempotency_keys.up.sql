@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id varchar(36) NOT NULL,
+    key varchar(255) NOT NULL,
+    fingerprint char(64) NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    content_type varchar(255),
+    body bytea,
+    created_at timestamptz NOT NULL,
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
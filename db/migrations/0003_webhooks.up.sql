@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id char(36) PRIMARY KEY,
+    user_id varchar(36) NOT NULL DEFAULT '',
+    url varchar(2048) NOT NULL,
+    events text[],
+    secret varchar(255) NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id char(36) PRIMARY KEY,
+    webhook_id char(36) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id char(36) NOT NULL,
+    event varchar(50) NOT NULL,
+    payload bytea NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    last_attempt_at timestamptz,
+    response_status integer NOT NULL DEFAULT 0,
+    response_body text,
+    error text,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+-- the dispatcher polls the pending deliveries that are due
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial PRIMARY KEY,
+    event_id char(36) NOT NULL UNIQUE,
+    type varchar(50) NOT NULL,
+    user_id varchar(36) NOT NULL DEFAULT '',
+    payload bytea NOT NULL,
+    created_at timestamptz NOT NULL,
+    published_at timestamptz,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL,
+    last_error text
+);
+-- the relay polls the pending events in order
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events (id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_published_at ON outbox_events (published_at);
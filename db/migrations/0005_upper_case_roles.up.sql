@@ -0,0 +1,4 @@
+-- the roles are upper case like the ADMIN role, the users registered before had the user role
+UPDATE users SET role = upper(role) WHERE role <> upper(role);
+UPDATE users SET role = 'USER' WHERE role IS NULL;
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'USER';
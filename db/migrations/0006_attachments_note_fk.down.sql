@@ -0,0 +1 @@
+ALTER TABLE attachments DROP CONSTRAINT IF EXISTS attachments_note_id_fkey;
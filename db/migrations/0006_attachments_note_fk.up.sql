@@ -0,0 +1,4 @@
+-- the attachments of the notes deleted before are dropped, their blobs are left in the storage
+DELETE FROM attachments WHERE note_id NOT IN (SELECT id FROM notes);
+ALTER TABLE attachments DROP CONSTRAINT IF EXISTS attachments_note_id_fkey;
+ALTER TABLE attachments ADD CONSTRAINT attachments_note_id_fkey FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE;
@@ -0,0 +1,216 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"example/rest-api/repository"
+)
+
+// holdBack is how long the events following a missing sequence wait for it. The transactions of the
+// replicas commit their events out of order, a sequence missing for longer belongs to a rolled back
+// transaction or to an event relayed late, which is handed to the subscribers when it comes.
+const holdBack = time.Second
+
+// Bus fans the relayed events out to the subscribers in the process in the order of their sequences,
+// and keeps the last ones in a bounded buffer for the subscribers resuming after an event they got
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	// replay holds the last events handed to the subscribers ordered by sequence, up to replaySize
+	replay     []Event
+	replaySize int
+	// evicted is the highest sequence dropped from the replay buffer
+	evicted int64
+	// delivered is the highest sequence handed to the subscribers
+	delivered int64
+	// held are the events published after a missing sequence, ordered by sequence, they are handed to
+	// the subscribers once it is published or after holdBack
+	held []Event
+	// heldSince is when the first held event started waiting for the missing sequence
+	heldSince time.Time
+	holdTimer *time.Timer
+	holdBack  time.Duration
+	closed    bool
+}
+
+// NewBus returns a bus replaying up to replaySize events
+func NewBus(replaySize int) *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{}), replaySize: replaySize, holdBack: holdBack}
+}
+
+func (b *Bus) Name() string { return "bus" }
+
+// Subscription is a stream of the events published on a bus
+type Subscription struct {
+	// Missed are the buffered events following the last one the subscriber got
+	Missed []Event
+	// Gap reports that some of the events following the last one the subscriber got are no longer buffered
+	Gap bool
+	// Events receives the events published from now on, it is closed when the subscriber falls more than
+	// its buffer behind, when the subscription is closed and when the bus is
+	Events <-chan Event
+	close  func()
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// Subscribe starts a subscription with a channel of buffer events. When lastSequence is not 0, the
+// buffered events with a greater sequence are returned as missed. A subscriber never blocks the bus.
+func (b *Bus) Subscribe(lastSequence int64, buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription{Events: ch, close: func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(ch)
+	}}
+	if lastSequence != 0 {
+		sub.Gap = lastSequence < b.evicted
+		for _, event := range b.replay {
+			if event.Sequence > lastSequence {
+				sub.Missed = append(sub.Missed, event)
+			}
+		}
+	}
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	b.subscribers[ch] = struct{}{}
+	return sub
+}
+
+// drop closes the channel of a subscriber once, the lock must be held
+func (b *Bus) drop(ch chan Event) {
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish hands the event to every subscriber, an event already buffered is ignored. An event following
+// a missing sequence is held back until the missing one is published.
+func (b *Bus) Publish(ctx context.Context, tx repository.Store, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || b.buffered(event) {
+		return nil
+	}
+
+	if event.Sequence == 0 || b.delivered == 0 || event.Sequence <= b.delivered+1 {
+		b.deliver(event)
+		b.release()
+		return nil
+	}
+
+	if len(b.held) == 0 {
+		b.heldSince = time.Now()
+	}
+	i := sort.Search(len(b.held), func(i int) bool { return b.held[i].Sequence > event.Sequence })
+	b.held = append(b.held[:i], append([]Event{event}, b.held[i:]...)...)
+	if b.holdTimer == nil {
+		b.holdTimer = time.AfterFunc(b.holdBack, b.expire)
+	}
+	return nil
+}
+
+// deliver buffers the event and hands it to every subscriber, the lock must be held
+func (b *Bus) deliver(event Event) {
+	b.delivered = max(b.delivered, event.Sequence)
+	if b.replaySize > 0 {
+		i := len(b.replay)
+		if event.Sequence != 0 {
+			i = sort.Search(len(b.replay), func(i int) bool { return b.replay[i].Sequence > event.Sequence })
+		}
+		b.replay = append(b.replay[:i], append([]Event{event}, b.replay[i:]...)...)
+		if len(b.replay) > b.replaySize {
+			b.evicted = max(b.evicted, b.replay[0].Sequence)
+			b.replay = append(b.replay[:0], b.replay[1:]...)
+		}
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.drop(ch)
+		}
+	}
+}
+
+// release delivers the held events no sequence is missing before, the lock must be held
+func (b *Bus) release() {
+	released := false
+	for len(b.held) > 0 && b.held[0].Sequence <= b.delivered+1 {
+		b.deliver(b.held[0])
+		b.held = b.held[1:]
+		released = true
+	}
+	if len(b.held) == 0 && b.holdTimer != nil {
+		b.holdTimer.Stop()
+		b.holdTimer = nil
+	}
+	if released {
+		// the events left wait for another missing sequence
+		b.heldSince = time.Now()
+	}
+}
+
+// expire gives up on the missing sequence once the first held event waited holdBack
+func (b *Bus) expire() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.holdTimer = nil
+	if b.closed || len(b.held) == 0 {
+		return
+	}
+	if wait := b.holdBack - time.Since(b.heldSince); wait > 0 {
+		b.holdTimer = time.AfterFunc(wait, b.expire)
+		return
+	}
+
+	b.deliver(b.held[0])
+	b.held = b.held[1:]
+	b.heldSince = time.Now()
+	b.release()
+	if len(b.held) > 0 {
+		b.holdTimer = time.AfterFunc(b.holdBack, b.expire)
+	}
+}
+
+// buffered reports whether an event with the same sequence is buffered or held, the lock must be held
+func (b *Bus) buffered(event Event) bool {
+	if event.Sequence == 0 {
+		return false
+	}
+	for _, events := range [][]Event{b.replay, b.held} {
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].Sequence == event.Sequence {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Close ends every subscription, the events published afterwards are dropped
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.holdTimer != nil {
+		b.holdTimer.Stop()
+		b.holdTimer = nil
+	}
+	b.held = nil
+	for ch := range b.subscribers {
+		b.drop(ch)
+	}
+}
@@ -0,0 +1,105 @@
+// Package events holds the domain events, written to the outbox in the transaction of the change they are
+// about and relayed to the sinks once it commits
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"example/rest-api/models"
+	"example/rest-api/repository"
+
+	"github.com/google/uuid"
+)
+
+// Types lists the event types
+var Types = []string{
+	models.EventNoteCreated,
+	models.EventNoteUpdated,
+	models.EventNotePublished,
+	models.EventNoteDeleted,
+	models.EventUserRegistered,
+}
+
+// Event is a domain event, its JSON form is what the sinks publish
+type Event struct {
+	// Sequence is the position of the event in the outbox, 0 until it is written
+	Sequence  int64     `json:"-"`
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	// UserID is the user the event is about, whose webhooks receive it along with the system-wide ones
+	UserID string      `json:"-"`
+	Data   interface{} `json:"data"`
+}
+
+// NewEvent returns an event of type eventType happening now
+func NewEvent(eventType, userID string, data interface{}) Event {
+	return Event{ID: uuid.New().String(), Type: eventType, CreatedAt: time.Now().UTC(), UserID: userID, Data: data}
+}
+
+// NoteEvents returns the events of a note write, before is nil for a creation and after for a deletion.
+// A note made public gets a note.published event on top of its note.created or note.updated one.
+func NoteEvents(before, after *models.Note) []Event {
+	note := func(note *models.Note) map[string]interface{} {
+		return map[string]interface{}{"note": note}
+	}
+	switch {
+	case after == nil:
+		return []Event{NewEvent(models.EventNoteDeleted, before.UserID, note(before))}
+	case before == nil:
+		events := []Event{NewEvent(models.EventNoteCreated, after.UserID, note(after))}
+		if after.Published {
+			events = append(events, NewEvent(models.EventNotePublished, after.UserID, note(after)))
+		}
+		return events
+	default:
+		events := []Event{NewEvent(models.EventNoteUpdated, after.UserID, note(after))}
+		if after.Published && !before.Published {
+			events = append(events, NewEvent(models.EventNotePublished, after.UserID, note(after)))
+		}
+		return events
+	}
+}
+
+// UserRegistered returns the event of a new user, the password hash is left out
+func UserRegistered(user models.User) Event {
+	user.Password = ""
+	return NewEvent(models.EventUserRegistered, user.ID, map[string]interface{}{"user": user})
+}
+
+// Record writes the events to the outbox. Given the store of the transaction writing what the events
+// are about, the events are relayed if and only if it commits.
+func Record(ctx context.Context, store repository.Store, events ...Event) error {
+	for _, event := range events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		err = store.Outbox().Append(ctx, &models.OutboxEvent{
+			EventID:       event.ID,
+			Type:          event.Type,
+			UserID:        event.UserID,
+			Payload:       data,
+			CreatedAt:     event.CreatedAt,
+			NextAttemptAt: event.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fromOutbox returns the event written to the outbox as row
+func fromOutbox(row *models.OutboxEvent) Event {
+	return Event{
+		Sequence:  row.ID,
+		ID:        row.EventID,
+		Type:      row.Type,
+		CreatedAt: row.CreatedAt.UTC(),
+		UserID:    row.UserID,
+		Data:      row.Payload,
+	}
+}
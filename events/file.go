@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"example/rest-api/repository"
+)
+
+// FileSink appends the events to a file, one JSON document per line
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it when it does not exist
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Name() string { return "file" }
+
+// Publish writes the event as a single line, so that concurrent writers never interleave
+func (s *FileSink) Publish(ctx context.Context, tx repository.Store, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"example/rest-api/repository"
+
+	"github.com/lib/pq"
+)
+
+// pingInterval is how often an idle listener checks its connection
+const pingInterval = time.Minute
+
+// Notifier is a sink announcing the events to the listeners of every replica, the announce is sent
+// when the transaction marking the event published commits
+type Notifier struct{}
+
+func (Notifier) Name() string { return "notify" }
+
+func (Notifier) Publish(ctx context.Context, tx repository.Store, event Event) error {
+	return tx.Outbox().Notify(ctx, event.Sequence)
+}
+
+// Listener publishes the events announced by the Notifier of every replica on a bus
+type Listener struct {
+	dsn   string
+	store repository.Store
+	bus   *Bus
+}
+
+// NewListener returns a listener connecting to the Postgres database behind dsn, the events are read from store
+func NewListener(dsn string, store repository.Store, bus *Bus) *Listener {
+	return &Listener{dsn: dsn, store: store, bus: bus}
+}
+
+// Run listens until ctx is cancelled, it is meant to run as a background worker.
+// The events announced while the connection is down are not published.
+func (l *Listener) Run(ctx context.Context) {
+	listener := pq.NewListener(l.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("Event listener connection failed", "error", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(repository.NotifyChannel); err != nil {
+		slog.Error("Failed to listen to the events", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			go listener.Ping()
+		case notification := <-listener.Notify:
+			if notification == nil {
+				slog.Warn("Event listener reconnected, the events announced meanwhile are not streamed")
+				continue
+			}
+			l.publish(ctx, notification.Extra)
+		}
+	}
+}
+
+// publish loads the event announced with id from the outbox and publishes it on the bus
+func (l *Listener) publish(ctx context.Context, id string) {
+	sequence, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		slog.Warn("Ignoring an invalid event announce", "payload", id)
+		return
+	}
+	row, err := l.store.Outbox().FindByID(ctx, sequence)
+	if err != nil {
+		slog.Error("Failed to load an announced event", "sequence", sequence, "error", err)
+		return
+	}
+	l.bus.Publish(ctx, nil, fromOutbox(row))
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/metrics"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+const (
+	// batchSize is how many events are claimed at once
+	batchSize = 100
+	// lease is how long a claimed event is held by a relay before another one may pick it up
+	lease = time.Minute
+	// maxBackoff bounds the delay between the attempts to relay an event
+	maxBackoff = 5 * time.Minute
+	// purgeInterval is how often the published events past the retention are deleted
+	purgeInterval = time.Hour
+)
+
+// Sink is where the relay publishes the events
+type Sink interface {
+	// Name identifies the sink in the logs
+	Name() string
+	// Publish hands an event to the sink. tx is the transaction marking the event published, a sink
+	// writing to the database does it through tx so that its writes commit along with it.
+	Publish(ctx context.Context, tx repository.Store, event Event) error
+}
+
+// Relay publishes the events of the outbox to the sinks in order. An event is published again until
+// every sink accepts it, the sinks outside of the database may get it more than once.
+type Relay struct {
+	store   repository.Store
+	sinks   []Sink
+	cfg     config.OutboxConfig
+	metrics *metrics.Metrics
+}
+
+// NewRelay returns a relay of the events written to the outbox of store, attempts are counted in m
+func NewRelay(store repository.Store, cfg config.OutboxConfig, m *metrics.Metrics, sinks ...Sink) *Relay {
+	return &Relay{store: store, sinks: sinks, cfg: cfg, metrics: m}
+}
+
+// Run relays the events until ctx is cancelled and deletes the published ones past the retention,
+// it is meant to run as a background worker
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-purge.C:
+			deleted, err := r.store.Outbox().DeletePublished(ctx, now.Add(-r.cfg.Retention))
+			if err != nil {
+				slog.Error("Failed to purge the published events", "error", err)
+				continue
+			}
+			slog.Debug("Purged the published events", "deleted", deleted)
+		case <-ticker.C:
+			// drain the outbox before waiting for the next tick
+			for {
+				relayed, err := r.RunOnce(ctx)
+				if err != nil {
+					slog.Error("Failed to claim the outbox events", "error", err)
+				}
+				if err != nil || relayed < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// RunOnce relays a batch of due events and returns how many were claimed
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	rows, err := r.store.Outbox().Claim(ctx, time.Now(), lease, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i := range rows {
+		if ctx.Err() != nil {
+			// shutting down, the lease brings the events back once it expires
+			break
+		}
+		r.relay(ctx, &rows[i])
+	}
+	return len(rows), nil
+}
+
+// Backoff returns the delay before the retry following the given attempt
+func (r *Relay) Backoff(attempt int) time.Duration {
+	backoff := r.cfg.PollInterval
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// relay publishes an event to every sink and marks it published, in a single transaction
+func (r *Relay) relay(ctx context.Context, row *models.OutboxEvent) {
+	event := fromOutbox(row)
+	err := r.store.Transaction(ctx, func(tx repository.Store) error {
+		for _, sink := range r.sinks {
+			if err := sink.Publish(ctx, tx, event); err != nil {
+				return fmt.Errorf("%s: %w", sink.Name(), err)
+			}
+		}
+		now := time.Now()
+		published := *row
+		published.PublishedAt = &now
+		published.LastError = ""
+		return tx.Outbox().Update(ctx, &published)
+	})
+	if err == nil {
+		r.metrics.OutboxRelayed("published")
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	row.Attempts++
+	row.LastError = err.Error()
+	row.NextAttemptAt = time.Now().Add(r.Backoff(row.Attempts))
+	r.metrics.OutboxRelayed("retry")
+	slog.Warn("Failed to relay an event", "event_id", row.EventID, "type", row.Type, "attempts", row.Attempts, "error", err)
+	if err := r.store.Outbox().Update(ctx, row); err != nil {
+		slog.Error("Failed to record an outbox relay attempt", "event_id", row.EventID, "error", err)
+	}
+}
@@ -0,0 +1,253 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+// flakySink fails the first fails events it gets and records the others
+type flakySink struct {
+	fails     int
+	published []Event
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Publish(ctx context.Context, tx repository.Store, event Event) error {
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("unavailable")
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func testRelay(store repository.Store, sinks ...Sink) *Relay {
+	return NewRelay(store, config.OutboxConfig{PollInterval: time.Millisecond, Retention: time.Hour}, nil, sinks...)
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	file, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("open the file sink: %v", err)
+	}
+	defer file.Close()
+	sink := &flakySink{}
+
+	note := &models.Note{ID: "note-1", UserID: "alice", Title: "Hello"}
+	published := *note
+	published.Published = true
+	written := append(NoteEvents(nil, note), NoteEvents(note, &published)...)
+	if err := Record(ctx, store, written...); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	// the events of a rolled back transaction are never relayed
+	store.Transaction(ctx, func(tx repository.Store) error {
+		Record(ctx, tx, NoteEvents(note, nil)...)
+		return errors.New("rollback")
+	})
+
+	relay := testRelay(store, sink, file)
+	if relayed, err := relay.RunOnce(ctx); err != nil || relayed != 3 {
+		t.Fatalf("expected 3 events to be relayed, got %d: %v", relayed, err)
+	}
+	if relayed, _ := relay.RunOnce(ctx); relayed != 0 {
+		t.Errorf("expected the published events to be relayed once, got %d more", relayed)
+	}
+
+	want := []string{models.EventNoteCreated, models.EventNoteUpdated, models.EventNotePublished}
+	if len(sink.published) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(sink.published))
+	}
+	for i, event := range sink.published {
+		if event.Type != want[i] || event.ID != written[i].ID || event.UserID != "alice" {
+			t.Errorf("event %d: expected %s %s, got %+v", i, want[i], written[i].ID, event)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open the events file: %v", err)
+	}
+	defer f.Close()
+	var lines int
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		var event struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Data struct {
+				Note models.Note `json:"note"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %d: %v", lines+1, err)
+		}
+		if event.ID != written[lines].ID || event.Type != want[lines] || event.Data.Note.ID != note.ID {
+			t.Errorf("line %d: unexpected event %s", lines+1, scanner.Bytes())
+		}
+	}
+	if lines != len(want) {
+		t.Errorf("expected %d lines, got %d", len(want), lines)
+	}
+}
+
+func TestRelayRetries(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	sink := &flakySink{fails: 2}
+	Record(ctx, store, NewEvent(models.EventUserRegistered, "alice", nil))
+
+	relay := testRelay(store, sink)
+	for i := 0; i < 10 && len(sink.published) == 0; i++ {
+		relay.RunOnce(ctx)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(sink.published) != 1 {
+		t.Fatalf("expected the event to be published once the sink recovers, got %d", len(sink.published))
+	}
+	if relayed, _ := relay.RunOnce(ctx); relayed != 0 {
+		t.Errorf("expected the event to be published for good, got %d more", relayed)
+	}
+
+	if deleted, err := store.Outbox().DeletePublished(ctx, time.Now().Add(time.Second)); err != nil || deleted != 1 {
+		t.Errorf("expected the published event to be purged, got %d: %v", deleted, err)
+	}
+}
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus(3)
+	fast := bus.Subscribe(0, 10)
+	defer fast.Close()
+	slow := bus.Subscribe(0, 1)
+
+	for sequence := int64(1); sequence <= 5; sequence++ {
+		event := NewEvent(models.EventNoteCreated, "alice", nil)
+		event.Sequence = sequence
+		bus.Publish(ctx, nil, event)
+	}
+	bus.Publish(ctx, nil, Event{Sequence: 5})
+	if len(fast.Events) != 5 {
+		t.Errorf("expected 5 events, duplicates left out, got %d", len(fast.Events))
+	}
+
+	// the slow subscriber got the first event, then its channel was closed
+	if _, ok := <-slow.Events; !ok {
+		t.Error("expected the first event before the channel is closed")
+	}
+	if _, ok := <-slow.Events; ok {
+		t.Error("expected a lagging subscriber to be dropped")
+	}
+
+	tests := []struct {
+		last    int64
+		missed  int
+		gap     bool
+		comment string
+	}{
+		{0, 0, false, "a new subscriber gets the events from now on"},
+		{3, 2, false, "the events after the last one are replayed"},
+		{2, 3, false, "the whole buffer is replayed"},
+		{1, 3, true, "an event following the last one is no longer buffered"},
+	}
+	for _, tt := range tests {
+		sub := bus.Subscribe(tt.last, 10)
+		if len(sub.Missed) != tt.missed || sub.Gap != tt.gap {
+			t.Errorf("%s: expected %d missed events and gap %t, got %d and %t", tt.comment, tt.missed, tt.gap, len(sub.Missed), sub.Gap)
+		}
+		sub.Close()
+		sub.Close()
+	}
+
+	bus.Close()
+	if _, ok := <-bus.Subscribe(0, 1).Events; ok {
+		t.Error("expected the subscriptions to a closed bus to be closed")
+	}
+}
+
+func TestBusOrder(t *testing.T) {
+	ctx := context.Background()
+	bus := NewBus(10)
+	defer bus.Close()
+	publish := func(sequences ...int64) {
+		for _, sequence := range sequences {
+			event := NewEvent(models.EventNoteCreated, "alice", nil)
+			event.Sequence = sequence
+			bus.Publish(ctx, nil, event)
+		}
+	}
+	received := func(sub *Subscription) []int64 {
+		var sequences []int64
+		for {
+			select {
+			case event := <-sub.Events:
+				sequences = append(sequences, event.Sequence)
+			default:
+				return sequences
+			}
+		}
+	}
+	sequences := func(events []Event) []int64 {
+		var sequences []int64
+		for _, event := range events {
+			sequences = append(sequences, event.Sequence)
+		}
+		return sequences
+	}
+
+	// the second replica commits 3 before the first one commits 2
+	live := bus.Subscribe(0, 10)
+	defer live.Close()
+	publish(1, 3)
+	if got := received(live); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("expected 3 to wait for 2, got %v", got)
+	}
+
+	// the subscriber got 1 and resumes from it, 3 is not replayed ahead of 2
+	resumed := bus.Subscribe(1, 10)
+	defer resumed.Close()
+	if len(resumed.Missed) != 0 || resumed.Gap {
+		t.Errorf("expected nothing to replay yet, got %v", sequences(resumed.Missed))
+	}
+	publish(2)
+	if got := received(live); !slices.Equal(got, []int64{2, 3}) {
+		t.Errorf("expected the events in order, got %v", got)
+	}
+	if got := received(resumed); !slices.Equal(got, []int64{2, 3}) {
+		t.Errorf("expected the resumed subscriber to get the events in order, got %v", got)
+	}
+	if missed := bus.Subscribe(2, 10).Missed; !slices.Equal(sequences(missed), []int64{3}) {
+		t.Errorf("expected 3 to be replayed after 2, got %v", sequences(missed))
+	}
+
+	// a sequence missing for longer is given up on, and the late event is still replayed in order
+	bus.mu.Lock()
+	bus.holdBack = 10 * time.Millisecond
+	bus.mu.Unlock()
+	publish(5)
+	time.Sleep(50 * time.Millisecond)
+	if got := received(live); !slices.Equal(got, []int64{5}) {
+		t.Errorf("expected 5 to be delivered once 4 is given up on, got %v", got)
+	}
+	publish(4)
+	if got := received(live); !slices.Equal(got, []int64{4}) {
+		t.Errorf("expected the late event to be delivered, got %v", got)
+	}
+	if missed := bus.Subscribe(3, 10).Missed; !slices.Equal(sequences(missed), []int64{4, 5}) {
+		t.Errorf("expected the replay to be ordered by sequence, got %v", sequences(missed))
+	}
+}
@@ -0,0 +1,135 @@
+// Package graphql executes GraphQL requests against a schema of Go resolvers, the fields of a level of the
+// response are resolved for all their parents at once so that a field can load them in a single batch
+package graphql
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*OperationDefinition
+	Fragments  map[string]*FragmentDefinition
+}
+
+// Location is a position in the request document, lines and columns start at 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type OperationDefinition struct {
+	// Type is query or mutation
+	Type         string
+	Name         string
+	Variables    []*VariableDefinition
+	SelectionSet []Selection
+	Loc          Location
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default *Value
+	Loc     Location
+}
+
+// TypeRef is a type as written in a variable definition, a list when Elem is set
+type TypeRef struct {
+	Name    string
+	Elem    *TypeRef
+	NonNull bool
+}
+
+func (t *TypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// Selection is a *FieldNode, a *FragmentSpread or an *InlineFragment
+type Selection interface {
+	location() Location
+}
+
+type FieldNode struct {
+	Alias        string
+	Name         string
+	Arguments    []*ArgumentNode
+	Directives   []*Directive
+	SelectionSet []Selection
+	Loc          Location
+}
+
+// ResponseKey is the name of the field in the response
+func (f *FieldNode) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+	Loc        Location
+}
+
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+	Loc           Location
+}
+
+type FragmentDefinition struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+	Loc           Location
+}
+
+func (f *FieldNode) location() Location      { return f.Loc }
+func (f *FragmentSpread) location() Location { return f.Loc }
+func (f *InlineFragment) location() Location { return f.Loc }
+
+type ArgumentNode struct {
+	Name  string
+	Value *Value
+	Loc   Location
+}
+
+type Directive struct {
+	Name      string
+	Arguments []*ArgumentNode
+	Loc       Location
+}
+
+// the kinds of values
+const (
+	VariableValue = iota
+	IntValue
+	FloatValue
+	StringValue
+	BooleanValue
+	NullValue
+	EnumValue
+	ListValue
+	ObjectValue
+)
+
+// Value is a literal or a variable, Raw holds the variable name, the enum value or the scalar as written
+type Value struct {
+	Kind   int
+	Raw    string
+	List   []*Value
+	Fields []*ObjectField
+	Loc    Location
+}
+
+type ObjectField struct {
+	Name  string
+	Value *Value
+}
@@ -0,0 +1,690 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Request is a GraphQL request as posted over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// Response is the result of a request, Data is missing when the request failed before its execution
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Execute parses, validates and executes a request, the errors are in the response
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}
+	}
+	op, err := operation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}
+	}
+	root := s.Query
+	if op.Type == "mutation" {
+		if s.Mutation == nil {
+			return &Response{Errors: []*Error{{Message: "Schema is not configured for mutations", Locations: []Location{op.Loc}}}}
+		}
+		root = s.Mutation
+	}
+
+	p := &planner{schema: s, doc: doc}
+	if p.variables, err = p.coerceVariables(op, req.Variables); err == nil {
+		err = p.checkFragments()
+	}
+	var fields []*plan
+	if err == nil {
+		fields, err = p.collect(root, op.SelectionSet, 1, false)
+	}
+	if err == nil {
+		err = p.checkLimits(fields)
+	}
+	if err != nil {
+		return &Response{Errors: []*Error{toError(err, op.Loc)}}
+	}
+
+	e := &executor{schema: s}
+	objects, invalid := e.executeFields(ctx, root, fields, []interface{}{nil}, [][]interface{}{nil})
+	resp := &Response{Errors: e.errors}
+	if invalid[0] {
+		resp.Data = json.RawMessage("null")
+	} else {
+		resp.Data = objects[0]
+	}
+	return resp
+}
+
+// operation returns the operation to execute
+func operation(doc *Document, name string) (*OperationDefinition, error) {
+	if name == "" {
+		if len(doc.Operations) != 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations"}
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: "Unknown operation named \"" + name + "\""}
+}
+
+// toError returns err as a GraphQL error located at loc unless it has a location
+func toError(err error, loc Location) *Error {
+	if gqlErr, ok := err.(*Error); ok {
+		if len(gqlErr.Locations) == 0 {
+			gqlErr.Locations = []Location{loc}
+		}
+		return gqlErr
+	}
+	return &Error{Message: err.Error(), Locations: []Location{loc}}
+}
+
+// plan is a field to resolve, the fields of the selections sharing its response key are merged into it
+type plan struct {
+	key      string
+	name     string
+	field    *Field
+	args     map[string]interface{}
+	loc      Location
+	children []*plan
+	// meta is set for the introspection fields, they are not counted in the limits
+	meta  bool
+	depth int
+}
+
+// planner validates an operation and collects its fields
+type planner struct {
+	schema    *Schema
+	doc       *Document
+	variables map[string]interface{}
+}
+
+func (p *planner) coerceVariables(op *OperationDefinition, values map[string]interface{}) (map[string]interface{}, error) {
+	variables := map[string]interface{}{}
+	for _, def := range op.Variables {
+		if _, ok := variables[def.Name]; ok {
+			return nil, &Error{Message: "There can be only one variable named \"$" + def.Name + "\"", Locations: []Location{def.Loc}}
+		}
+		t, ok := p.typeOf(def.Type)
+		if !ok || !isInputType(t) {
+			return nil, &Error{Message: "Variable \"$" + def.Name + "\" cannot be of type " + def.Type.String(), Locations: []Location{def.Loc}}
+		}
+		raw, present := values[def.Name]
+		if present {
+			raw = jsonValue(raw)
+		} else if def.Default != nil {
+			var err error
+			if raw, _, err = literal(def.Default, nil); err != nil {
+				return nil, err
+			}
+			present = true
+		}
+		if !present {
+			if _, nonNull := t.(*NonNull); nonNull {
+				return nil, &Error{Message: "Variable \"$" + def.Name + "\" of required type " + t.String() + " was not provided", Locations: []Location{def.Loc}}
+			}
+			continue
+		}
+		if _, err := coerceInput(t, raw); err != nil {
+			return nil, &Error{Message: "Variable \"$" + def.Name + "\" got invalid value: " + err.Error(), Locations: []Location{def.Loc}}
+		}
+		// kept raw, the value is coerced again to the type of every argument it is used in
+		variables[def.Name] = raw
+	}
+	return variables, nil
+}
+
+// typeOf returns the type of a variable
+func (p *planner) typeOf(ref *TypeRef) (Type, bool) {
+	var t Type
+	if ref.Elem != nil {
+		elem, ok := p.typeOf(ref.Elem)
+		if !ok {
+			return nil, false
+		}
+		t = NewList(elem)
+	} else {
+		named, ok := p.schema.types[ref.Name]
+		if !ok {
+			return nil, false
+		}
+		t = named
+	}
+	if ref.NonNull {
+		t = NewNonNull(t)
+	}
+	return t, true
+}
+
+// checkFragments rejects the fragments spreading themselves, their expansion would not end
+func (p *planner) checkFragments() error {
+	const visiting, done = 1, 2
+	state := map[string]int{}
+	var visit func(set []Selection) error
+	visit = func(set []Selection) error {
+		for _, selection := range set {
+			switch selection := selection.(type) {
+			case *FieldNode:
+				if err := visit(selection.SelectionSet); err != nil {
+					return err
+				}
+			case *InlineFragment:
+				if err := visit(selection.SelectionSet); err != nil {
+					return err
+				}
+			case *FragmentSpread:
+				fragment, ok := p.doc.Fragments[selection.Name]
+				if !ok {
+					return &Error{Message: "Unknown fragment \"" + selection.Name + "\"", Locations: []Location{selection.Loc}}
+				}
+				switch state[fragment.Name] {
+				case visiting:
+					return &Error{Message: "Cannot spread fragment \"" + fragment.Name + "\" within itself", Locations: []Location{selection.Loc}}
+				case done:
+					continue
+				}
+				state[fragment.Name] = visiting
+				if err := visit(fragment.SelectionSet); err != nil {
+					return err
+				}
+				state[fragment.Name] = done
+			}
+		}
+		return nil
+	}
+	for _, name := range sortedNames(p.doc.Fragments) {
+		if state[name] == 0 {
+			if err := visit([]Selection{&FragmentSpread{Name: name}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collect validates a selection set on an object and returns its fields, merged by response key
+func (p *planner) collect(object *Object, set []Selection, depth int, meta bool) ([]*plan, error) {
+	var fields []*plan
+	byKey := map[string]*plan{}
+	// the selection sets of the fields of each key, their selections are collected once merged
+	subsets := map[*plan][]Selection{}
+
+	var visit func(set []Selection) error
+	visit = func(set []Selection) error {
+		for _, selection := range set {
+			switch selection := selection.(type) {
+			case *FieldNode:
+				if include, err := p.included(selection.Directives); err != nil {
+					return err
+				} else if !include {
+					continue
+				}
+				field, err := p.field(object, selection, depth, meta)
+				if err != nil {
+					return err
+				}
+				if existing, ok := byKey[field.key]; ok {
+					if existing.name != field.name || !reflect.DeepEqual(existing.args, field.args) {
+						return &Error{
+							Message:   "Fields \"" + field.key + "\" conflict because they are different fields or have different arguments",
+							Locations: []Location{existing.loc, field.loc},
+						}
+					}
+					field = existing
+				} else {
+					byKey[field.key] = field
+					fields = append(fields, field)
+				}
+				subsets[field] = append(subsets[field], selection.SelectionSet...)
+			case *InlineFragment:
+				if include, err := p.included(selection.Directives); err != nil {
+					return err
+				} else if !include {
+					continue
+				}
+				if err := p.checkCondition(object, selection.TypeCondition, selection.Loc); err != nil {
+					return err
+				}
+				if err := visit(selection.SelectionSet); err != nil {
+					return err
+				}
+			case *FragmentSpread:
+				if include, err := p.included(selection.Directives); err != nil {
+					return err
+				} else if !include {
+					continue
+				}
+				fragment := p.doc.Fragments[selection.Name]
+				if err := p.checkCondition(object, fragment.TypeCondition, fragment.Loc); err != nil {
+					return err
+				}
+				if err := visit(fragment.SelectionSet); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := visit(set); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		if field.field == nil {
+			continue
+		}
+		child, isObject := named(field.field.Type).(*Object)
+		switch {
+		case isObject && len(subsets[field]) == 0:
+			return nil, &Error{
+				Message:   "Field \"" + field.name + "\" of type \"" + field.field.Type.String() + "\" must have a selection of subfields",
+				Locations: []Location{field.loc},
+			}
+		case !isObject && len(subsets[field]) > 0:
+			return nil, &Error{
+				Message:   "Field \"" + field.name + "\" must not have a selection since type \"" + field.field.Type.String() + "\" has no subfields",
+				Locations: []Location{field.loc},
+			}
+		case isObject:
+			children, err := p.collect(child, subsets[field], depth+1, field.meta)
+			if err != nil {
+				return nil, err
+			}
+			field.children = children
+		}
+	}
+	return fields, nil
+}
+
+// field returns the plan of a field of object, its arguments coerced
+func (p *planner) field(object *Object, ast *FieldNode, depth int, meta bool) (*plan, error) {
+	field := &plan{key: ast.ResponseKey(), name: ast.Name, loc: ast.Loc, meta: meta, depth: depth}
+	if ast.Name == "__typename" {
+		if len(ast.Arguments) > 0 || len(ast.SelectionSet) > 0 {
+			return nil, &Error{Message: "Field \"__typename\" takes no arguments nor subfields", Locations: []Location{ast.Loc}}
+		}
+		field.meta = true
+		return field, nil
+	}
+	def, ok := object.Fields[ast.Name]
+	if !ok && object == p.schema.Query {
+		def, ok = p.schema.meta[ast.Name]
+		field.meta = ok
+	}
+	if !ok {
+		return nil, &Error{Message: "Cannot query field \"" + ast.Name + "\" on type \"" + object.Name + "\"", Locations: []Location{ast.Loc}}
+	}
+	field.field = def
+
+	raw := map[string]interface{}{}
+	for _, arg := range ast.Arguments {
+		if _, ok := raw[arg.Name]; ok {
+			return nil, &Error{Message: "There can be only one argument named \"" + arg.Name + "\"", Locations: []Location{arg.Loc}}
+		}
+		value, present, err := literal(arg.Value, p.variables)
+		if err != nil {
+			return nil, err
+		}
+		if present {
+			raw[arg.Name] = value
+		} else if _, declared := def.Args[arg.Name]; !declared {
+			raw[arg.Name] = nil
+		}
+	}
+	args, err := coerceArgs(def.Args, raw, "Argument \"")
+	if err != nil {
+		return nil, &Error{Message: fmt.Sprintf("Field \"%s\": %v", ast.Name, err), Locations: []Location{ast.Loc}, Extensions: badInput}
+	}
+	field.args = args
+	return field, nil
+}
+
+var badInput = map[string]interface{}{"code": "BAD_USER_INPUT"}
+
+// included evaluates the @skip and @include directives
+func (p *planner) included(directives []*Directive) (bool, error) {
+	for _, directive := range directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			return false, &Error{Message: "Unknown directive \"@" + directive.Name + "\"", Locations: []Location{directive.Loc}}
+		}
+		raw := map[string]interface{}{}
+		for _, arg := range directive.Arguments {
+			value, present, err := literal(arg.Value, p.variables)
+			if err != nil {
+				return false, err
+			}
+			if present {
+				raw[arg.Name] = value
+			}
+		}
+		args, err := coerceArgs(Args{"if": {Type: NewNonNull(Boolean)}}, raw, "Argument \"")
+		if err != nil {
+			return false, &Error{Message: "Directive \"@" + directive.Name + "\": " + err.Error(), Locations: []Location{directive.Loc}}
+		}
+		if args["if"].(bool) == (directive.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkCondition checks the type condition of a fragment, the schema has no interfaces so it names the object
+func (p *planner) checkCondition(object *Object, condition string, loc Location) error {
+	if condition == "" || condition == object.Name {
+		return nil
+	}
+	if _, ok := p.schema.types[condition]; !ok {
+		return &Error{Message: "Unknown type \"" + condition + "\"", Locations: []Location{loc}}
+	}
+	return &Error{Message: "Fragment cannot be spread here as objects of type \"" + object.Name + "\" can never be of type \"" + condition + "\"", Locations: []Location{loc}}
+}
+
+// checkLimits bounds the depth and the complexity of an operation
+func (p *planner) checkLimits(fields []*plan) error {
+	depth, complexity := measure(fields)
+	if p.schema.MaxDepth > 0 && depth > p.schema.MaxDepth {
+		return &Error{
+			Message:    fmt.Sprintf("Query depth %d exceeds the maximum depth of %d", depth, p.schema.MaxDepth),
+			Extensions: map[string]interface{}{"code": "QUERY_TOO_DEEP"},
+		}
+	}
+	if p.schema.MaxComplexity > 0 && complexity > p.schema.MaxComplexity {
+		return &Error{
+			Message:    fmt.Sprintf("Query complexity %d exceeds the maximum complexity of %d", complexity, p.schema.MaxComplexity),
+			Extensions: map[string]interface{}{"code": "QUERY_TOO_COMPLEX"},
+		}
+	}
+	return nil
+}
+
+// measure returns the depth and the complexity of fields, without the introspection fields
+func measure(fields []*plan) (depth, complexity int) {
+	for _, field := range fields {
+		if field.meta {
+			continue
+		}
+		childDepth, childComplexity := measure(field.children)
+		depth = max(depth, field.depth, childDepth)
+		if field.field.Complexity != nil {
+			complexity += field.field.Complexity(field.args, childComplexity)
+		} else {
+			complexity += 1 + childComplexity
+		}
+	}
+	return depth, complexity
+}
+
+// named unwraps the lists and non-null types
+func named(t Type) Type {
+	for {
+		switch wrapper := t.(type) {
+		case *List:
+			t = wrapper.Of
+		case *NonNull:
+			t = wrapper.Of
+		default:
+			return t
+		}
+	}
+}
+
+// object is the result of a selection set, its fields are written in order
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// the completion of a value: set, null, null because of an error, or null in a non-null position, which
+// nulls its parent
+const (
+	completed = iota
+	null
+	nulled
+	invalid
+)
+
+// errored marks a value whose resolver failed
+var errored = &struct{}{}
+
+// executor resolves the fields level by level, each field is resolved for all the objects of its level
+type executor struct {
+	schema *Schema
+	errors []*Error
+}
+
+func (e *executor) fail(ctx context.Context, err error, path []interface{}, loc Location) {
+	gqlErr, ok := err.(*Error)
+	if !ok {
+		gqlErr = &Error{Message: err.Error()}
+		if e.schema.PresentError != nil {
+			gqlErr = e.schema.PresentError(ctx, err)
+		}
+	}
+	e.errors = append(e.errors, &Error{
+		Message:    gqlErr.Message,
+		Locations:  []Location{loc},
+		Path:       path,
+		Extensions: gqlErr.Extensions,
+	})
+}
+
+// executeFields returns the objects of the fields of the sources, invalid for those that are null because
+// of a non-null field
+func (e *executor) executeFields(ctx context.Context, typ *Object, fields []*plan, sources []interface{}, paths [][]interface{}) ([]object, []bool) {
+	objects := make([]object, len(sources))
+	invalids := make([]bool, len(sources))
+	if len(sources) == 0 {
+		return objects, invalids
+	}
+	for _, field := range fields {
+		if field.field == nil {
+			for i := range objects {
+				objects[i] = append(objects[i], member{field.key, typ.Name})
+			}
+			continue
+		}
+		fieldPaths := make([][]interface{}, len(paths))
+		for i, path := range paths {
+			fieldPaths[i] = append(path[:len(path):len(path)], field.key)
+		}
+		values := e.resolve(ctx, field, sources, fieldPaths)
+		values, states := e.complete(ctx, field.field.Type, field, values, fieldPaths)
+		for i := range objects {
+			objects[i] = append(objects[i], member{field.key, values[i]})
+			if states[i] == invalid {
+				invalids[i] = true
+			}
+		}
+	}
+	return objects, invalids
+}
+
+// resolve returns the values of a field for every source
+func (e *executor) resolve(ctx context.Context, field *plan, sources []interface{}, paths [][]interface{}) []interface{} {
+	values := make([]interface{}, len(sources))
+	if field.field.Batch != nil {
+		batch, err := field.field.Batch(ctx, sources, field.args)
+		if err == nil && len(batch) != len(sources) {
+			err = fmt.Errorf("graphql: the batch of %s returned %d values for %d sources", field.name, len(batch), len(sources))
+		}
+		if err != nil {
+			for i := range values {
+				values[i] = errored
+				e.fail(ctx, err, paths[i], field.loc)
+			}
+			return values
+		}
+		return batch
+	}
+	for i, source := range sources {
+		value, err := field.field.Resolve(ctx, source, field.args)
+		if err != nil {
+			values[i] = errored
+			e.fail(ctx, err, paths[i], field.loc)
+			continue
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// complete turns the resolved values of a field into their results
+func (e *executor) complete(ctx context.Context, typ Type, field *plan, values []interface{}, paths [][]interface{}) ([]interface{}, []int) {
+	results := make([]interface{}, len(values))
+	states := make([]int, len(values))
+
+	if nonNull, ok := typ.(*NonNull); ok {
+		results, states = e.complete(ctx, nonNull.Of, field, values, paths)
+		for i, state := range states {
+			switch {
+			case values[i] == errored || state == nulled || state == invalid:
+				states[i] = invalid
+			case state == null:
+				e.fail(ctx, &Error{Message: "Cannot return null for non-nullable field " + field.name}, paths[i], field.loc)
+				states[i] = invalid
+			}
+		}
+		return results, states
+	}
+
+	for i, value := range values {
+		if value == errored {
+			states[i] = nulled
+		} else if isNil(value) {
+			states[i] = null
+		}
+	}
+
+	switch typ := typ.(type) {
+	case *Scalar, *Enum:
+		for i, value := range values {
+			if states[i] != completed {
+				continue
+			}
+			result, err := serialize(typ, value)
+			if err != nil {
+				e.fail(ctx, err, paths[i], field.loc)
+				states[i] = nulled
+				continue
+			}
+			results[i] = result
+		}
+	case *Object:
+		var sources []interface{}
+		var sourcePaths [][]interface{}
+		var owners []int
+		for i, value := range values {
+			if states[i] == completed {
+				sources = append(sources, value)
+				sourcePaths = append(sourcePaths, paths[i])
+				owners = append(owners, i)
+			}
+		}
+		objects, invalids := e.executeFields(ctx, typ, field.children, sources, sourcePaths)
+		for j, i := range owners {
+			if invalids[j] {
+				states[i] = nulled
+				continue
+			}
+			results[i] = objects[j]
+		}
+	case *List:
+		// the items of all the lists are completed at once
+		var items []interface{}
+		var itemPaths [][]interface{}
+		var owners []int
+		for i, value := range values {
+			if states[i] != completed {
+				continue
+			}
+			list := reflect.ValueOf(value)
+			if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+				e.fail(ctx, fmt.Errorf("Expected a list for field %s", field.name), paths[i], field.loc)
+				states[i] = nulled
+				continue
+			}
+			for j := 0; j < list.Len(); j++ {
+				items = append(items, list.Index(j).Interface())
+				itemPaths = append(itemPaths, append(paths[i][:len(paths[i]):len(paths[i])], j))
+				owners = append(owners, i)
+			}
+		}
+		itemResults, itemStates := e.complete(ctx, typ.Of, field, items, itemPaths)
+		lists := make([][]interface{}, len(values))
+		for j, i := range owners {
+			if itemStates[j] == invalid {
+				states[i] = nulled
+			}
+			lists[i] = append(lists[i], itemResults[j])
+		}
+		for i := range values {
+			if states[i] == completed {
+				if lists[i] == nil {
+					lists[i] = []interface{}{}
+				}
+				results[i] = lists[i]
+			}
+		}
+	}
+	return results, states
+}
+
+func serialize(typ Type, value interface{}) (interface{}, error) {
+	if enum, ok := typ.(*Enum); ok {
+		name := fmt.Sprint(value)
+		for _, v := range enum.Values {
+			if v == name {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("Enum %s cannot represent value: %v", enum.Name, value)
+	}
+	return typ.(*Scalar).Serialize(value)
+}
+
+// isNil tells whether a value is nil, a nil pointer or map included, a nil slice is an empty list
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
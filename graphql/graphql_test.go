@@ -0,0 +1,260 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testAuthor struct{ id, name string }
+
+type testPost struct {
+	id, title, authorID string
+}
+
+// testSchema serves posts whose authors are loaded in batches, counted in batches
+func testSchema(t *testing.T, batches *int) *Schema {
+	t.Helper()
+	authors := map[string]*testAuthor{"a": {"a", "Ann"}, "b": {"b", "Bob"}}
+	posts := []*testPost{{"1", "One", "a"}, {"2", "Two", "b"}, {"3", "Three", "a"}, {"4", "Four", "missing"}}
+
+	author := &Object{Name: "Author", Fields: Fields{
+		"name": {Type: NewNonNull(String), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(*testAuthor).name, nil
+		}},
+	}}
+	post := &Object{Name: "Post"}
+	post.Fields = Fields{
+		"id": {Type: NewNonNull(ID), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(*testPost).id, nil
+		}},
+		"title": {Type: String, Args: Args{"upper": {Type: Boolean, Default: false}}, Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			if args["upper"].(bool) {
+				return strings.ToUpper(source.(*testPost).title), nil
+			}
+			return source.(*testPost).title, nil
+		}},
+		"author": {Type: author, Batch: func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+			*batches++
+			values := make([]interface{}, len(sources))
+			for i, source := range sources {
+				if a, ok := authors[source.(*testPost).authorID]; ok {
+					values[i] = a
+				}
+			}
+			return values, nil
+		}},
+		"strictAuthor": {Type: NewNonNull(author), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return authors[source.(*testPost).authorID], nil
+		}},
+		"related": {Type: NewList(post), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return posts[:2], nil
+		}},
+		"broken": {Type: String, Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("disk on fire")
+		}},
+	}
+	input := &InputObject{Name: "PostInput", Fields: Args{
+		"title": {Type: NewNonNull(String)},
+		"tags":  {Type: NewList(NewNonNull(String))},
+	}}
+
+	schema, err := NewSchema(Schema{
+		Query: &Object{Name: "Query", Fields: Fields{
+			"posts": {
+				Type: NewNonNull(NewList(NewNonNull(post))),
+				Args: Args{"first": {Type: Int, Default: 10}},
+				Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+					return posts[:min(args["first"].(int), len(posts))], nil
+				},
+				Complexity: func(args map[string]interface{}, child int) int {
+					return 1 + args["first"].(int)*child
+				},
+			},
+			"echo": {
+				Type: String,
+				Args: Args{"input": {Type: NewNonNull(input)}},
+				Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+					data, err := json.Marshal(args["input"])
+					return string(data), err
+				},
+			},
+		}},
+		MaxDepth:      4,
+		MaxComplexity: 100,
+	})
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	return schema
+}
+
+func execute(t *testing.T, schema *Schema, query string, variables map[string]interface{}) (string, []*Error) {
+	t.Helper()
+	resp := schema.Execute(context.Background(), Request{Query: query, Variables: variables})
+	if resp.Data == nil {
+		return "", resp.Errors
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return string(data), resp.Errors
+}
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# a comment
+		query Posts($first: Int = 2, $tags: [String!]!) {
+			list: posts(first: $first) { id ...fields @include(if: true) }
+		}
+		fragment fields on Post { title(upper: true), author { ... on Author { name } } }
+		{ echo(input: {title: "say \"hi\"!", tags: ["a", "b"]}) }`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(doc.Operations) != 2 || len(doc.Fragments) != 1 {
+		t.Fatalf("expected 2 operations and a fragment, got %+v", doc)
+	}
+	op := doc.Operations[0]
+	if op.Name != "Posts" || len(op.Variables) != 2 || op.Variables[1].Type.String() != "[String!]!" {
+		t.Errorf("unexpected operation %+v", op)
+	}
+	field := op.SelectionSet[0].(*FieldNode)
+	if field.ResponseKey() != "list" || field.Loc != (Location{Line: 4, Column: 4}) {
+		t.Errorf("unexpected field %+v", field)
+	}
+	echo := doc.Operations[1].SelectionSet[0].(*FieldNode)
+	if title := echo.Arguments[0].Value.Fields[0].Value.Raw; title != `say "hi"!` {
+		t.Errorf("unexpected string %q", title)
+	}
+
+	for _, invalid := range []string{``, `{`, `{ posts(first: ) }`, `query { "x" }`, `{ a } fragment f on T { b } fragment f on T { c }`, `{ echo(s: "open) }`} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		} else if gqlErr, ok := err.(*Error); !ok || len(gqlErr.Locations) == 0 && invalid != "" {
+			t.Errorf("expected a located error for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+
+	data, errs := execute(t, schema, `query($n: Int) {
+		posts(first: $n) { id title(upper: true) ...f }
+		alias: posts(first: 1) { __typename id skipped: title @skip(if: true) }
+	}
+	fragment f on Post { author { name } related { id author { name } } }`, map[string]interface{}{"n": 2.0})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	want := `{"posts":[` +
+		`{"id":"1","title":"ONE","author":{"name":"Ann"},"related":[{"id":"1","author":{"name":"Ann"}},{"id":"2","author":{"name":"Bob"}}]},` +
+		`{"id":"2","title":"TWO","author":{"name":"Bob"},"related":[{"id":"1","author":{"name":"Ann"}},{"id":"2","author":{"name":"Bob"}}]}],` +
+		`"alias":[{"__typename":"Post","id":"1"}]}`
+	if data != want {
+		t.Errorf("unexpected data\n%s\nwant\n%s", data, want)
+	}
+	// the authors of each level are loaded at once
+	if batches != 2 {
+		t.Errorf("expected 2 batches, got %d", batches)
+	}
+
+	data, _ = execute(t, schema, `{ echo(input: {title: "x", tags: "single"}) }`, nil)
+	if data != `{"echo":"{\"tags\":[\"single\"],\"title\":\"x\"}"}` {
+		t.Errorf("expected the input to be coerced, got %s", data)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+
+	// a resolver error nulls its field, a null in a non-null field nulls the closest nullable parent
+	data, errs := execute(t, schema, `{ posts(first: 4) { id broken author { name } } }`, nil)
+	if len(errs) != 4 || errs[0].Message != "disk on fire" || len(errs[0].Path) != 3 || errs[0].Path[1] != 0 {
+		t.Errorf("expected an error per post, got %+v", errs)
+	}
+	if !strings.Contains(data, `{"id":"4","broken":null,"author":null}`) {
+		t.Errorf("expected the missing author to be null, got %s", data)
+	}
+	data, errs = execute(t, schema, `{ posts(first: 4) { id strictAuthor { name } } }`, nil)
+	if data != "null" || len(errs) != 1 || !strings.Contains(errs[0].Message, "non-nullable") {
+		t.Errorf("expected the null author to null the whole data, got %s %+v", data, errs)
+	}
+
+	schema.PresentError = func(ctx context.Context, err error) *Error {
+		return &Error{Message: "hidden", Extensions: map[string]interface{}{"code": "INTERNAL"}}
+	}
+	if _, errs := execute(t, schema, `{ posts(first: 1) { broken } }`, nil); len(errs) != 1 || errs[0].Message != "hidden" || errs[0].Extensions["code"] != "INTERNAL" {
+		t.Errorf("expected the error to be presented, got %+v", errs)
+	}
+
+	tests := []struct {
+		name, query string
+		variables   map[string]interface{}
+		want        string
+	}{
+		{"syntax", `{ posts { id }`, nil, "Syntax Error"},
+		{"unknown field", `{ posts { nope } }`, nil, `Cannot query field "nope" on type "Post"`},
+		{"missing selection", `{ posts }`, nil, "must have a selection of subfields"},
+		{"leaf selection", `{ posts { id { x } } }`, nil, "must not have a selection"},
+		{"unknown argument", `{ posts(last: 1) { id } }`, nil, `Argument "last" is not defined`},
+		{"wrong argument type", `{ posts(first: "2") { id } }`, nil, "Int cannot represent"},
+		{"missing required variable", `query($n: Int!) { posts(first: $n) { id } }`, nil, "was not provided"},
+		{"invalid variable", `query($n: Int) { posts(first: $n) { id } }`, map[string]interface{}{"n": "two"}, `Variable "$n" got invalid value`},
+		{"missing input field", `{ echo(input: {tags: []}) }`, nil, `Field "PostInput.title" of required type String! was not provided`},
+		{"conflicting fields", `{ posts { x: id x: title } }`, nil, "conflict"},
+		{"fragment cycle", `{ posts { ...a } } fragment a on Post { related { ...a } }`, nil, "within itself"},
+		{"wrong fragment type", `{ posts { ... on Author { name } } }`, nil, "can never be of type"},
+		{"unknown directive", `{ posts { id @deprecated } }`, nil, "Unknown directive"},
+		{"no mutations", `mutation { posts { id } }`, nil, "not configured for mutations"},
+		{"several operations", `query a { posts { id } } query b { posts { id } }`, nil, "Must provide operation name"},
+		{"too deep", `{ posts(first: 1) { related { related { related { id } } } } }`, nil, "exceeds the maximum depth of 4"},
+		{"too complex", `{ posts(first: 30) { related { id title author { name } } } }`, nil, "exceeds the maximum complexity of 100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, errs := execute(t, schema, tt.query, tt.variables)
+			if data != "" || len(errs) != 1 || !strings.Contains(errs[0].Message, tt.want) {
+				t.Errorf("expected a single error containing %q, got %s %+v", tt.want, data, errs)
+			}
+		})
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+
+	data, errs := execute(t, schema, `{
+		__schema { queryType { name } mutationType { name } directives { name } }
+		post: __type(name: "Post") { kind fields { name args { name defaultValue } type { kind ofType { name } } } }
+		input: __type(name: "PostInput") { kind inputFields { name } }
+		nothing: __type(name: "Nothing") { name }
+	}`, nil)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	for _, want := range []string{
+		`"queryType":{"name":"Query"},"mutationType":null`,
+		`"directives":[{"name":"include"},{"name":"skip"}]`,
+		`{"name":"id","args":[],"type":{"kind":"NON_NULL","ofType":{"name":"ID"}}}`,
+		`{"name":"title","args":[{"name":"upper","defaultValue":"false"}]`,
+		`"input":{"kind":"INPUT_OBJECT","inputFields":[{"name":"tags"},{"name":"title"}]}`,
+		`"nothing":null`,
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("expected %s in %s", want, data)
+		}
+	}
+
+	// the introspection does not count in the limits, deep as it is
+	if _, errs := execute(t, schema, `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`, nil); len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
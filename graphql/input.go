@@ -0,0 +1,169 @@
+package graphql
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// literal returns the raw value of an AST value, present is false for a variable that was not provided
+func literal(value *Value, variables map[string]interface{}) (raw interface{}, present bool, err error) {
+	switch value.Kind {
+	case VariableValue:
+		raw, present = variables[value.Raw]
+		return raw, present, nil
+	case IntValue:
+		n, err := strconv.ParseInt(value.Raw, 10, 64)
+		if err != nil {
+			return nil, true, &Error{Message: "Int cannot represent value: " + value.Raw, Locations: []Location{value.Loc}}
+		}
+		return n, true, nil
+	case FloatValue:
+		f, err := strconv.ParseFloat(value.Raw, 64)
+		if err != nil {
+			return nil, true, &Error{Message: "Float cannot represent value: " + value.Raw, Locations: []Location{value.Loc}}
+		}
+		return f, true, nil
+	case StringValue:
+		return value.Raw, true, nil
+	case BooleanValue:
+		return value.Raw == "true", true, nil
+	case NullValue:
+		return nil, true, nil
+	case EnumValue:
+		return enumLiteral(value.Raw), true, nil
+	case ListValue:
+		list := make([]interface{}, len(value.List))
+		for i, item := range value.List {
+			list[i], _, err = literal(item, variables)
+			if err != nil {
+				return nil, true, err
+			}
+		}
+		return list, true, nil
+	case ObjectValue:
+		object := make(map[string]interface{}, len(value.Fields))
+		for _, field := range value.Fields {
+			if _, ok := object[field.Name]; ok {
+				return nil, true, &Error{Message: "There can be only one input field named \"" + field.Name + "\"", Locations: []Location{field.Value.Loc}}
+			}
+			raw, present, err := literal(field.Value, variables)
+			if err != nil {
+				return nil, true, err
+			}
+			if present {
+				object[field.Name] = raw
+			}
+		}
+		return object, true, nil
+	}
+	return nil, false, fmt.Errorf("graphql: unknown value kind %d", value.Kind)
+}
+
+// enumLiteral is an enum value written in the document, a string value of a variable is accepted too
+type enumLiteral string
+
+// coerceInput checks a raw value against an input type and returns its Go value
+func coerceInput(t Type, raw interface{}) (interface{}, error) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if raw == nil {
+			return nil, fmt.Errorf("Expected a non-null value of type %s", t)
+		}
+		return coerceInput(nonNull.Of, raw)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items, ok := raw.([]interface{})
+		if !ok {
+			// a single value is a list of one
+			item, err := coerceInput(t.Of, raw)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			value, err := coerceInput(t.Of, item)
+			if err != nil {
+				return nil, fmt.Errorf("In element #%d: %w", i, err)
+			}
+			list[i] = value
+		}
+		return list, nil
+	case *InputObject:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected type %s to be an object", t)
+		}
+		return coerceArgs(t.Fields, object, "Field \""+t.Name+".")
+	case *Enum:
+		var name string
+		switch raw := raw.(type) {
+		case enumLiteral:
+			name = string(raw)
+		case string:
+			name = raw
+		}
+		for _, value := range t.Values {
+			if value == name {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("Value %v does not exist in enum %s", raw, t)
+	case *Scalar:
+		if _, ok := raw.(enumLiteral); ok {
+			return nil, fmt.Errorf("%s cannot represent an enum value: %v", t, raw)
+		}
+		if reflect.TypeOf(raw).Kind() == reflect.Slice || reflect.TypeOf(raw).Kind() == reflect.Map {
+			return nil, fmt.Errorf("%s cannot represent value: %v", t, raw)
+		}
+		return t.Parse(raw)
+	}
+	return nil, fmt.Errorf("%s is not an input type", t)
+}
+
+// coerceArgs coerces the raw values of arguments or input fields, the defaults fill the missing ones
+func coerceArgs(defs Args, raw map[string]interface{}, prefix string) (map[string]interface{}, error) {
+	for name := range raw {
+		if _, ok := defs[name]; !ok {
+			return nil, fmt.Errorf("%s%s\" is not defined", prefix, name)
+		}
+	}
+	values := make(map[string]interface{}, len(defs))
+	for _, name := range sortedNames(defs) {
+		def := defs[name]
+		value, ok := raw[name]
+		if !ok {
+			if def.Default != nil {
+				values[name] = def.Default
+			} else if _, nonNull := def.Type.(*NonNull); nonNull {
+				return nil, fmt.Errorf("%s%s\" of required type %s was not provided", prefix, name, def.Type)
+			}
+			continue
+		}
+		coerced, err := coerceInput(def.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s\": %w", prefix, name, err)
+		}
+		values[name] = coerced
+	}
+	return values, nil
+}
+
+// isInputType tells whether t can be the type of a variable
+func isInputType(t Type) bool {
+	switch t := t.(type) {
+	case *List:
+		return isInputType(t.Of)
+	case *NonNull:
+		return isInputType(t.Of)
+	case *Scalar, *Enum, *InputObject:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,335 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// the introspection types, they describe the schema to the clients and their tooling
+var (
+	introspectionSchema = &Object{Name: "__Schema"}
+	introspectionType   = &Object{Name: "__Type"}
+	introspectionField  = &Object{Name: "__Field"}
+	introspectionInput  = &Object{Name: "__InputValue"}
+	introspectionEnum   = &Object{Name: "__EnumValue"}
+	introspectionDir    = &Object{Name: "__Directive"}
+
+	typeKind = &Enum{
+		Name:   "__TypeKind",
+		Values: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"},
+	}
+	directiveLocation = &Enum{
+		Name:   "__DirectiveLocation",
+		Values: []string{"QUERY", "MUTATION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+	}
+)
+
+type namedField struct {
+	name string
+	*Field
+}
+
+type namedArgument struct {
+	name string
+	*Argument
+}
+
+type directive struct {
+	name, description string
+}
+
+// the directives, both take an if argument
+var directives = []directive{
+	{"include", "Directs the executor to include this field or fragment only when the `if` argument is true."},
+	{"skip", "Directs the executor to skip this field or fragment when the `if` argument is true."},
+}
+
+var directiveArgs = Args{"if": {Type: NewNonNull(Boolean), Description: "Included when true, skipped when false."}}
+
+func init() {
+	includeDeprecated := Args{"includeDeprecated": {Type: Boolean, Default: false}}
+
+	introspectionSchema.Fields = Fields{
+		"description": {Type: String, Resolve: constant(nil)},
+		"types": {
+			Type: NewNonNull(NewList(NewNonNull(introspectionType))),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				s := source.(*Schema)
+				types := make([]Type, 0, len(s.types))
+				for _, name := range sortedNames(s.types) {
+					types = append(types, s.types[name])
+				}
+				return types, nil
+			},
+		},
+		"queryType": {
+			Type: NewNonNull(introspectionType),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(*Schema).Query, nil
+			},
+		},
+		"mutationType": {
+			Type: introspectionType,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(*Schema).Mutation, nil
+			},
+		},
+		"subscriptionType": {Type: introspectionType, Resolve: constant(nil)},
+		"directives": {
+			Type: NewNonNull(NewList(NewNonNull(introspectionDir))),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return directives, nil
+			},
+		},
+	}
+
+	introspectionType.Fields = Fields{
+		"kind": {
+			Type: NewNonNull(typeKind),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				switch source.(type) {
+				case *Scalar:
+					return "SCALAR", nil
+				case *Object:
+					return "OBJECT", nil
+				case *Enum:
+					return "ENUM", nil
+				case *InputObject:
+					return "INPUT_OBJECT", nil
+				case *List:
+					return "LIST", nil
+				}
+				return "NON_NULL", nil
+			},
+		},
+		"name": {
+			Type: String,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				switch source.(type) {
+				case *List, *NonNull:
+					return nil, nil
+				}
+				return source.(Type).String(), nil
+			},
+		},
+		"description": {
+			Type: String,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				switch t := source.(type) {
+				case *Scalar:
+					return optional(t.Description), nil
+				case *Object:
+					return optional(t.Description), nil
+				case *Enum:
+					return optional(t.Description), nil
+				case *InputObject:
+					return optional(t.Description), nil
+				}
+				return nil, nil
+			},
+		},
+		"specifiedByURL": {Type: String, Resolve: constant(nil)},
+		"fields": {
+			Type: NewList(NewNonNull(introspectionField)),
+			Args: includeDeprecated,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				object, ok := source.(*Object)
+				if !ok {
+					return nil, nil
+				}
+				fields := make([]namedField, 0, len(object.Fields))
+				for _, name := range sortedNames(object.Fields) {
+					fields = append(fields, namedField{name, object.Fields[name]})
+				}
+				return fields, nil
+			},
+		},
+		"interfaces": {
+			Type: NewList(NewNonNull(introspectionType)),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if _, ok := source.(*Object); ok {
+					return []Type{}, nil
+				}
+				return nil, nil
+			},
+		},
+		"possibleTypes": {Type: NewList(NewNonNull(introspectionType)), Resolve: constant(nil)},
+		"enumValues": {
+			Type: NewList(NewNonNull(introspectionEnum)),
+			Args: includeDeprecated,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if enum, ok := source.(*Enum); ok {
+					return enum.Values, nil
+				}
+				return nil, nil
+			},
+		},
+		"inputFields": {
+			Type: NewList(NewNonNull(introspectionInput)),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if input, ok := source.(*InputObject); ok {
+					return argumentList(input.Fields), nil
+				}
+				return nil, nil
+			},
+		},
+		"ofType": {
+			Type: introspectionType,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				switch t := source.(type) {
+				case *List:
+					return t.Of, nil
+				case *NonNull:
+					return t.Of, nil
+				}
+				return nil, nil
+			},
+		},
+	}
+
+	introspectionField.Fields = Fields{
+		"name": {
+			Type: NewNonNull(String),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(namedField).name, nil
+			},
+		},
+		"description": {
+			Type: String,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return optional(source.(namedField).Description), nil
+			},
+		},
+		"args": {
+			Type: NewNonNull(NewList(NewNonNull(introspectionInput))),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return argumentList(source.(namedField).Args), nil
+			},
+		},
+		"type": {
+			Type: NewNonNull(introspectionType),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(namedField).Type, nil
+			},
+		},
+		"isDeprecated":      {Type: NewNonNull(Boolean), Resolve: constant(false)},
+		"deprecationReason": {Type: String, Resolve: constant(nil)},
+	}
+
+	introspectionInput.Fields = Fields{
+		"name": {
+			Type: NewNonNull(String),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(namedArgument).name, nil
+			},
+		},
+		"description": {
+			Type: String,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return optional(source.(namedArgument).Description), nil
+			},
+		},
+		"type": {
+			Type: NewNonNull(introspectionType),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(namedArgument).Type, nil
+			},
+		},
+		"defaultValue": {
+			Type: String,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				arg := source.(namedArgument)
+				if arg.Default == nil {
+					return nil, nil
+				}
+				// the scalars of the defaults are written the same in JSON and GraphQL
+				value, err := json.Marshal(arg.Default)
+				return string(value), err
+			},
+		},
+		"isDeprecated":      {Type: NewNonNull(Boolean), Resolve: constant(false)},
+		"deprecationReason": {Type: String, Resolve: constant(nil)},
+	}
+
+	introspectionEnum.Fields = Fields{
+		"name": {
+			Type: NewNonNull(String),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source, nil
+			},
+		},
+		"description":       {Type: String, Resolve: constant(nil)},
+		"isDeprecated":      {Type: NewNonNull(Boolean), Resolve: constant(false)},
+		"deprecationReason": {Type: String, Resolve: constant(nil)},
+	}
+
+	introspectionDir.Fields = Fields{
+		"name": {
+			Type: NewNonNull(String),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(directive).name, nil
+			},
+		},
+		"description": {
+			Type: String,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return source.(directive).description, nil
+			},
+		},
+		"locations": {
+			Type:    NewNonNull(NewList(NewNonNull(directiveLocation))),
+			Resolve: constant([]string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"}),
+		},
+		"args": {
+			Type: NewNonNull(NewList(NewNonNull(introspectionInput))),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return argumentList(directiveArgs), nil
+			},
+		},
+		"isRepeatable": {Type: NewNonNull(Boolean), Resolve: constant(false)},
+	}
+}
+
+// metaFields returns the __schema and __type fields of the query type of s
+func metaFields(s *Schema) Fields {
+	return Fields{
+		"__schema": {
+			Type: NewNonNull(introspectionSchema),
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return s, nil
+			},
+		},
+		"__type": {
+			Type: introspectionType,
+			Args: Args{"name": {Type: NewNonNull(String)}},
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if t, ok := s.types[args["name"].(string)]; ok {
+					return t, nil
+				}
+				return nil, nil
+			},
+		},
+	}
+}
+
+func constant(value interface{}) ResolveFunc {
+	return func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+		return value, nil
+	}
+}
+
+// optional returns a description, null when empty
+func optional(description string) interface{} {
+	if description == "" {
+		return nil
+	}
+	return description
+}
+
+func argumentList(args Args) []namedArgument {
+	list := make([]namedArgument, 0, len(args))
+	for _, name := range sortedNames(args) {
+		list = append(list, namedArgument{name, args[name]})
+	}
+	return list
+}
@@ -0,0 +1,580 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// the kinds of tokens
+const (
+	tokenEOF = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  int
+	value string
+	loc   Location
+}
+
+// lexer splits a document into tokens, skipping whitespace, commas and comments
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	// lineStart is the offset of the current line
+	lineStart int
+}
+
+func (l *lexer) loc() Location {
+	return Location{Line: l.line, Column: utf8.RuneCountInString(l.src[l.lineStart:l.pos]) + 1}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.lineStart = l.pos
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			goto scan
+		}
+	}
+	return token{kind: tokenEOF, loc: l.loc()}, nil
+
+scan:
+	loc := l.loc()
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$&()@:=[]{}|", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunctuator, value: string(c), loc: loc}, nil
+	case c == '.':
+		if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.pos += 3
+			return token{kind: tokenPunctuator, value: "...", loc: loc}, nil
+		}
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.src[start:l.pos], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case c == '"':
+		return l.string(loc)
+	}
+	return token{}, &Error{Message: fmt.Sprintf("Syntax Error: unexpected character %q", rune(c)), Locations: []Location{loc}}
+}
+
+func (l *lexer) number(loc Location) (token, error) {
+	start := l.pos
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	digits()
+	kind := tokenInt
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+	raw := l.src[start:l.pos]
+	if _, err := strconv.ParseFloat(raw, 64); err != nil {
+		return token{}, &Error{Message: "Syntax Error: invalid number " + raw, Locations: []Location{loc}}
+	}
+	return token{kind: kind, value: raw, loc: loc}, nil
+}
+
+// string scans a quoted string, block strings included, and unescapes it
+func (l *lexer) string(loc Location) (token, error) {
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, &Error{Message: "Syntax Error: unterminated string", Locations: []Location{loc}}
+		}
+		raw := l.src[l.pos+3 : l.pos+3+end]
+		l.line += strings.Count(raw, "\n")
+		if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+			l.lineStart = l.pos + 3 + i + 1
+		}
+		l.pos += end + 6
+		return token{kind: tokenString, value: blockString(raw), loc: loc}, nil
+	}
+
+	var b strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokenString, value: b.String(), loc: loc}, nil
+		case '\n':
+			return token{}, &Error{Message: "Syntax Error: unterminated string", Locations: []Location{loc}}
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, &Error{Message: "Syntax Error: unterminated string", Locations: []Location{loc}}
+			}
+			escape := l.src[l.pos+1]
+			if i := strings.IndexByte(`"\/bfnrt`, escape); i >= 0 {
+				b.WriteByte("\"\\/\b\f\n\r\t"[i])
+				l.pos += 2
+				continue
+			}
+			if escape == 'u' && l.pos+6 <= len(l.src) {
+				if code, err := strconv.ParseUint(l.src[l.pos+2:l.pos+6], 16, 32); err == nil {
+					b.WriteRune(rune(code))
+					l.pos += 6
+					continue
+				}
+			}
+			return token{}, &Error{Message: "Syntax Error: invalid escape sequence", Locations: []Location{l.loc()}}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, &Error{Message: "Syntax Error: unterminated string", Locations: []Location{loc}}
+}
+
+// blockString removes the common indentation and the blank first and last lines of a block string
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.ReplaceAll(strings.Join(lines, "\n"), `\"""`, `"""`)
+}
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// parser is a recursive descent parser of the executable documents, the type system definitions are not supported
+type parser struct {
+	lexer lexer
+	tok   token
+}
+
+// Parse parses a request document
+func Parse(src string) (*Document, error) {
+	p := &parser{lexer: lexer{src: strings.TrimPrefix(src, "\uFEFF"), line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &Document{Fragments: map[string]*FragmentDefinition{}}
+	if p.tok.kind == tokenEOF {
+		return nil, p.unexpected()
+	}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunctuator, "{"):
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &OperationDefinition{Type: "query", SelectionSet: set, Loc: set[0].location()})
+		case p.peek(tokenName, "query") || p.peek(tokenName, "mutation"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.peek(tokenName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[fragment.Name]; ok {
+				return nil, &Error{Message: "There can be only one fragment named \"" + fragment.Name + "\"", Locations: []Location{fragment.Loc}}
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) peek(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) unexpected() error {
+	found := "<EOF>"
+	if p.tok.kind != tokenEOF {
+		found = strconv.Quote(p.tok.value)
+	}
+	return &Error{Message: "Syntax Error: unexpected " + found, Locations: []Location{p.tok.loc}}
+}
+
+// expect consumes a punctuator
+func (p *parser) expect(value string) error {
+	if !p.peek(tokenPunctuator, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+// skip consumes a punctuator if it is next
+func (p *parser) skip(value string) (bool, error) {
+	if !p.peek(tokenPunctuator, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*OperationDefinition, error) {
+	op := &OperationDefinition{Type: p.tok.value, Loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if ok, err := p.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(tokenPunctuator, ")") {
+			variable, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.Variables = append(op.Variables, variable)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	set, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.SelectionSet = set
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (*VariableDefinition, error) {
+	variable := &VariableDefinition{Loc: p.tok.loc}
+	if err := p.expect("$"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	variable.Name = name
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if variable.Type, err = p.typeRef(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		if variable.Default, err = p.value(true); err != nil {
+			return nil, err
+		}
+	}
+	_, err = p.directives()
+	return variable, err
+}
+
+func (p *parser) typeRef() (*TypeRef, error) {
+	t := &TypeRef{}
+	if ok, err := p.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		if t.Elem, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	} else if t.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	var err error
+	t.NonNull, err = p.skip("!")
+	return t, err
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var set []Selection
+	for !p.peek(tokenPunctuator, "}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, selection)
+	}
+	if len(set) == 0 {
+		return nil, p.unexpected()
+	}
+	return set, p.advance()
+}
+
+func (p *parser) selection() (Selection, error) {
+	loc := p.tok.loc
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			spread := &FragmentSpread{Name: p.tok.value, Loc: loc}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			spread.Directives, err = p.directives()
+			return spread, err
+		}
+		inline := &InlineFragment{Loc: loc}
+		if p.peek(tokenName, "on") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if inline.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if inline.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		inline.SelectionSet, err = p.selectionSet()
+		return inline, err
+	}
+
+	field := &FieldNode{Loc: loc}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	field.Name = name
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		field.Alias = name
+		if field.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if field.Arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(tokenPunctuator, "{") {
+		if field.SelectionSet, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+func (p *parser) arguments(constant bool) ([]*ArgumentNode, error) {
+	if ok, err := p.skip("("); err != nil || !ok {
+		return nil, err
+	}
+	var arguments []*ArgumentNode
+	for !p.peek(tokenPunctuator, ")") {
+		argument := &ArgumentNode{Loc: p.tok.loc}
+		var err error
+		if argument.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if argument.Value, err = p.value(constant); err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+	}
+	if len(arguments) == 0 {
+		return nil, p.unexpected()
+	}
+	return arguments, p.advance()
+}
+
+func (p *parser) directives() ([]*Directive, error) {
+	var directives []*Directive
+	for p.peek(tokenPunctuator, "@") {
+		directive := &Directive{Loc: p.tok.loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err error
+		if directive.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if directive.Arguments, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+func (p *parser) fragment() (*FragmentDefinition, error) {
+	fragment := &FragmentDefinition{Loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if fragment.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, &Error{Message: "Syntax Error: unexpected \"on\"", Locations: []Location{fragment.Loc}}
+	}
+	if !p.peek(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	fragment.SelectionSet, err = p.selectionSet()
+	return fragment, err
+}
+
+// value parses a value, constant values cannot hold variables
+func (p *parser) value(constant bool) (*Value, error) {
+	tok := p.tok
+	value := &Value{Raw: tok.value, Loc: tok.loc}
+	switch {
+	case tok.kind == tokenPunctuator && tok.value == "$" && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		value.Kind, value.Raw = VariableValue, name
+		return value, nil
+	case tok.kind == tokenPunctuator && tok.value == "[":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		value.Kind, value.Raw = ListValue, ""
+		for !p.peek(tokenPunctuator, "]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			value.List = append(value.List, item)
+		}
+		return value, p.advance()
+	case tok.kind == tokenPunctuator && tok.value == "{":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		value.Kind, value.Raw = ObjectValue, ""
+		for !p.peek(tokenPunctuator, "}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			field, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			value.Fields = append(value.Fields, &ObjectField{Name: name, Value: field})
+		}
+		return value, p.advance()
+	case tok.kind == tokenInt:
+		value.Kind = IntValue
+	case tok.kind == tokenFloat:
+		value.Kind = FloatValue
+	case tok.kind == tokenString:
+		value.Kind = StringValue
+	case tok.kind == tokenName && (tok.value == "true" || tok.value == "false"):
+		value.Kind = BooleanValue
+	case tok.kind == tokenName && tok.value == "null":
+		value.Kind = NullValue
+	case tok.kind == tokenName:
+		value.Kind = EnumValue
+	default:
+		return nil, p.unexpected()
+	}
+	return value, p.advance()
+}
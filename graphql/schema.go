@@ -0,0 +1,345 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Type is a *Scalar, an *Enum, an *Object, an *InputObject, a *List or a *NonNull
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type, Serialize turns a resolved value into its JSON form and Parse checks an input value,
+// which is a string, an int64, a float64 or a bool
+type Scalar struct {
+	Name        string
+	Description string
+	Serialize   func(value interface{}) (interface{}, error)
+	Parse       func(value interface{}) (interface{}, error)
+}
+
+// Enum is a leaf type holding one of its values as a string
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+// Object is an output type made of fields
+type Object struct {
+	Name        string
+	Description string
+	Fields      Fields
+}
+
+// Fields maps the names of the fields of an object to their definition
+type Fields map[string]*Field
+
+// ResolveFunc returns the value of a field of source
+type ResolveFunc func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error)
+
+// BatchFunc returns the values of a field for every source at once, in the order of the sources
+type BatchFunc func(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+// Field is a field of an object, resolved by Resolve or, for all the objects of a level of the response
+// at once, by Batch
+type Field struct {
+	Type        Type
+	Description string
+	Args        Args
+	Resolve     ResolveFunc
+	Batch       BatchFunc
+	// Complexity returns the cost of the field given the cost of its selection, 1 plus that by default
+	Complexity func(args map[string]interface{}, childComplexity int) int
+}
+
+// Args maps the names of the arguments of a field to their definition
+type Args map[string]*Argument
+
+type Argument struct {
+	Type        Type
+	Description string
+	// Default is used when the argument is missing, nil for none
+	Default interface{}
+}
+
+// InputObject is an input type made of fields, its values are maps
+type InputObject struct {
+	Name        string
+	Description string
+	Fields      Args
+}
+
+// List is a list of its element type
+type List struct {
+	Of Type
+}
+
+// NonNull is its type without null
+type NonNull struct {
+	Of Type
+}
+
+func (t *Scalar) String() string      { return t.Name }
+func (t *Enum) String() string        { return t.Name }
+func (t *Object) String() string      { return t.Name }
+func (t *InputObject) String() string { return t.Name }
+func (t *List) String() string        { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string     { return t.Of.String() + "!" }
+
+// NewList returns a list of t
+func NewList(t Type) *List { return &List{Of: t} }
+
+// NewNonNull returns t without null
+func NewNonNull(t Type) *NonNull { return &NonNull{Of: t} }
+
+// Schema is the entry point of the types, its limits bound every operation
+type Schema struct {
+	Query    *Object
+	Mutation *Object
+	// MaxDepth bounds the nesting of the fields of an operation, 0 for no limit
+	MaxDepth int
+	// MaxComplexity bounds the sum of the costs of the fields of an operation, 0 for no limit
+	MaxComplexity int
+	// PresentError turns an error of a resolver that is not an *Error into the error of the response,
+	// its message is written as is by default
+	PresentError func(ctx context.Context, err error) *Error
+
+	types map[string]Type
+	// meta holds the introspection fields of the query type
+	meta Fields
+}
+
+// Error is a GraphQL error of the response
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// the built-in scalars
+var (
+	String = &Scalar{
+		Name:      "String",
+		Serialize: serializeString,
+		Parse: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("String cannot represent a non string value: %v", value)
+		},
+	}
+	ID = &Scalar{
+		Name:      "ID",
+		Serialize: serializeString,
+		Parse: func(value interface{}) (interface{}, error) {
+			switch value := value.(type) {
+			case string:
+				return value, nil
+			case int64:
+				return strconv.FormatInt(value, 10), nil
+			}
+			return nil, fmt.Errorf("ID cannot represent value: %v", value)
+		},
+	}
+	Int = &Scalar{
+		Name: "Int",
+		Serialize: func(value interface{}) (interface{}, error) {
+			switch value := value.(type) {
+			case int:
+				return value, nil
+			case int32:
+				return value, nil
+			case int64:
+				if value >= math.MinInt32 && value <= math.MaxInt32 {
+					return value, nil
+				}
+			}
+			return nil, fmt.Errorf("Int cannot represent value: %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if n, ok := value.(int64); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int(n), nil
+			}
+			return nil, fmt.Errorf("Int cannot represent value: %v", value)
+		},
+	}
+	Float = &Scalar{
+		Name: "Float",
+		Serialize: func(value interface{}) (interface{}, error) {
+			switch value := value.(type) {
+			case float64:
+				return value, nil
+			case float32:
+				return value, nil
+			case int:
+				return float64(value), nil
+			}
+			return nil, fmt.Errorf("Float cannot represent value: %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			switch value := value.(type) {
+			case float64:
+				return value, nil
+			case int64:
+				return float64(value), nil
+			}
+			return nil, fmt.Errorf("Float cannot represent value: %v", value)
+		},
+	}
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent value: %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent a non boolean value: %v", value)
+		},
+	}
+	// DateTime is a time.Time written in RFC 3339
+	DateTime = &Scalar{
+		Name:        "DateTime",
+		Description: "A date-time in RFC 3339 format",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if t, ok := value.(time.Time); ok {
+				return t.Format(time.RFC3339Nano), nil
+			}
+			return nil, fmt.Errorf("DateTime cannot represent value: %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				if t, err := time.Parse(time.RFC3339, s); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("DateTime cannot represent value: %v", value)
+		},
+	}
+)
+
+func serializeString(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case fmt.Stringer:
+		return value.String(), nil
+	}
+	return nil, fmt.Errorf("String cannot represent value: %v", value)
+}
+
+// NewSchema checks the types reachable from the query and mutation objects, their names must be unique
+func NewSchema(schema Schema) (*Schema, error) {
+	s := &schema
+	s.types = map[string]Type{}
+	s.meta = metaFields(s)
+	for _, scalar := range []*Scalar{String, ID, Int, Float, Boolean} {
+		s.types[scalar.Name] = scalar
+	}
+	roots := []Type{s.Query, introspectionSchema}
+	if s.Mutation != nil {
+		roots = append(roots, s.Mutation)
+	}
+	for _, root := range roots {
+		if err := s.register(root); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// register adds a type and the types it refers to
+func (s *Schema) register(t Type) error {
+	switch t := t.(type) {
+	case *List:
+		return s.register(t.Of)
+	case *NonNull:
+		return s.register(t.Of)
+	}
+	name := t.String()
+	if existing, ok := s.types[name]; ok {
+		if existing != t {
+			return fmt.Errorf("graphql: two types are named %s", name)
+		}
+		return nil
+	}
+	s.types[name] = t
+
+	switch t := t.(type) {
+	case *Object:
+		for fieldName, field := range t.Fields {
+			if field.Resolve == nil && field.Batch == nil {
+				return fmt.Errorf("graphql: %s.%s has no resolver", name, fieldName)
+			}
+			if err := s.register(field.Type); err != nil {
+				return err
+			}
+			for _, arg := range field.Args {
+				if err := s.register(arg.Type); err != nil {
+					return err
+				}
+			}
+		}
+	case *InputObject:
+		for _, field := range t.Fields {
+			if err := s.register(field.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sortedNames returns the keys of a map in order, the output of the introspection is stable
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonValue turns the decoded JSON of a variable into an input value, numbers become int64 or float64
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+			return int64(value)
+		}
+		return value
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = jsonValue(item)
+		}
+		return list
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(value))
+		for name, field := range value {
+			object[name] = jsonValue(field)
+		}
+		return object
+	}
+	return value
+}
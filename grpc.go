@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/handlers"
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/notespb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// newGRPCServer returns the server of the gRPC services, built on the handlers of the REST routes.
+// Every call but the auth ones needs a token, and reflection lets tools like grpcurl list the services.
+func newGRPCServer(cfg *config.Config, s services) *grpc.Server {
+	authHandler := handlers.NewAuthHandler(s.store, cfg.Auth, s.metrics)
+	auth := middleware.NewAuthenticator(cfg.Auth.JWTSecret, s.metrics)
+	public := []string{notespb.AuthService_ServiceDesc.ServiceName, "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(logUnaryCalls, auth.UnaryInterceptor(public...)),
+		grpc.ChainStreamInterceptor(logStreamCalls, auth.StreamInterceptor(public...)),
+	)
+	notespb.RegisterAuthServiceServer(server, handlers.NewAuthServer(authHandler))
+	notespb.RegisterNoteServiceServer(server, handlers.NewNoteServer(s.notes))
+	reflection.Register(server)
+	return server
+}
+
+// logUnaryCalls writes an access log line per call, like logRequests does for the http requests
+func logUnaryCalls(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = logging.WithFields(ctx)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func logStreamCalls(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := logging.WithFields(ss.Context())
+	start := time.Now()
+	err := handler(srv, &loggedStream{ServerStream: ss, ctx: ctx})
+	logCall(ctx, info.FullMethod, start, err)
+	return err
+}
+
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+	}
+	attrs = append(attrs, logging.Fields(ctx)...)
+
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		level = slog.LevelError
+	}
+	logging.FromContext(ctx).LogAttrs(ctx, level, "rpc", attrs...)
+}
+
+// loggedStream hands the context collecting the log fields to the stream handlers
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"example/rest-api/handlers"
+	"example/rest-api/metrics"
+	"example/rest-api/notespb"
+	"example/rest-api/repository"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestGRPCClient serves the gRPC services over store in memory and returns a connection to them
+func newTestGRPCClient(t *testing.T, store repository.Store) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	cfg, m := testConfig(), metrics.New()
+	server := newGRPCServer(cfg, services{store: store, notes: handlers.NewNoteHandler(store, nil, cfg.Attachments, m), metrics: m})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// expectCode fails the test unless err is a status with code
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	store := repository.NewMemoryStore()
+	srv := newTestServer(t, store, nil)
+	conn := newTestGRPCClient(t, store)
+	auth, notes := notespb.NewAuthServiceClient(conn), notespb.NewNoteServiceClient(conn)
+	ctx := context.Background()
+
+	register := &notespb.RegisterRequest{Username: "alice", Email: "alice@example.com", Password: "correct horse", FullName: "Alice Liddell"}
+	if _, err := auth.Register(ctx, register); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	_, err := auth.Register(ctx, register)
+	expectCode(t, err, codes.AlreadyExists)
+
+	_, err = auth.Register(ctx, &notespb.RegisterRequest{Username: "bob", Email: "bob@example.com", Password: "correct horse"})
+	expectCode(t, err, codes.InvalidArgument)
+	if details := status.Convert(err).Details(); len(details) != 1 ||
+		details[0].(*errdetails.BadRequest).FieldViolations[0].Field != "full_name" {
+		t.Errorf("expected the invalid field in the details, got %v", details)
+	}
+
+	_, err = auth.Login(ctx, &notespb.LoginRequest{Email: "alice@example.com", Password: "wrong"})
+	expectCode(t, err, codes.Unauthenticated)
+	login, err := auth.Login(ctx, &notespb.LoginRequest{Username: proto.String("alice"), Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	_, err = notes.CreateNote(ctx, &notespb.CreateNoteRequest{Title: "Anonymous", Content: "text"})
+	expectCode(t, err, codes.Unauthenticated)
+	_, err = notes.CreateNote(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer nope"), &notespb.CreateNoteRequest{Title: "Forged", Content: "text"})
+	expectCode(t, err, codes.Unauthenticated)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+login.Token)
+	var created []*notespb.Note
+	for _, title := range []string{"Groceries", "Books", "Movies"} {
+		note, err := notes.CreateNote(ctx, &notespb.CreateNoteRequest{Title: title, Content: "list of " + title, ContentFormat: "markdown"})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		created = append(created, note)
+	}
+	_, err = notes.CreateNote(ctx, &notespb.CreateNoteRequest{Title: "Groceries", Content: "again"})
+	expectCode(t, err, codes.AlreadyExists)
+	_, err = notes.CreateNote(ctx, &notespb.CreateNoteRequest{Title: "Html", Content: "<p>", ContentFormat: "html"})
+	expectCode(t, err, codes.InvalidArgument)
+
+	// the notes are the same through REST
+	var rest noteResponse
+	decode(t, srv.request("GET", "/api/notes/"+created[0].Id, login.Token, nil), &rest)
+	if rest.Data.Note.Title != "Groceries" || rest.Data.Note.UserID != created[0].UserId || created[0].CreatedAt.AsTime().IsZero() {
+		t.Errorf("unexpected note %+v, created %v", rest.Data.Note, created[0])
+	}
+
+	t.Run("list", func(t *testing.T) {
+		tests := []struct {
+			limit, offset int32
+			want          []string
+		}{
+			{0, 0, []string{"Groceries", "Books", "Movies"}},
+			{2, 1, []string{"Books", "Movies"}},
+			{1, 0, []string{"Groceries"}},
+			{0, 3, nil},
+		}
+		for _, tt := range tests {
+			stream, err := notes.ListNotes(ctx, &notespb.ListNotesRequest{Limit: tt.limit, Offset: tt.offset})
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			var titles []string
+			for {
+				note, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("receive: %v", err)
+				}
+				titles = append(titles, note.Title)
+			}
+			if len(titles) != len(tt.want) || len(titles) > 0 && titles[0] != tt.want[0] {
+				t.Errorf("limit %d offset %d: expected %v, got %v", tt.limit, tt.offset, tt.want, titles)
+			}
+		}
+
+		stream, err := notes.ListNotes(ctx, &notespb.ListNotesRequest{Limit: -1})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		expectCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		found, err := notes.SearchNotes(ctx, &notespb.SearchNotesRequest{Content: "list of b"})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		if len(found.Notes) != 1 || found.Notes[0].Id != created[1].Id {
+			t.Errorf("unexpected results %v", found.Notes)
+		}
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		updated, err := notes.UpdateNote(ctx, &notespb.UpdateNoteRequest{Id: created[2].Id, Category: "fun", Published: proto.Bool(true)})
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if updated.Title != "Movies" || updated.Category != "fun" || !updated.Published {
+			t.Errorf("unexpected update %v", updated)
+		}
+		_, err = notes.UpdateNote(ctx, &notespb.UpdateNoteRequest{Id: "missing", Title: "Gone"})
+		expectCode(t, err, codes.NotFound)
+
+		if _, err := notes.DeleteNote(ctx, &notespb.DeleteNoteRequest{Id: created[2].Id}); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		_, err = notes.GetNote(ctx, &notespb.GetNoteRequest{Id: created[2].Id})
+		expectCode(t, err, codes.NotFound)
+		expectStatus(t, srv.request("GET", "/api/notes/"+created[2].Id, login.Token, nil), http.StatusNotFound)
+	})
+}
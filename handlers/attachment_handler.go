@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+	"example/rest-api/storage"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+)
+
+const multipartMemory = 8 << 20 // parts above this size are buffered on disk
+
+// isAllowedType reports whether the detected type or one of its parents is allowed
+func isAllowedType(detected *mimetype.MIME, allowed []string) bool {
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is("application/octet-stream") {
+			break
+		}
+		for _, a := range allowed {
+			if m.Is(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func attachmentKey(noteID, attachmentID string) string {
+	return "notes/" + noteID + "/" + attachmentID
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// tooLarge is the problem of an attachment above maxSize bytes
+func tooLarge(maxSize int64) *problem.Problem {
+	return problem.New(http.StatusRequestEntityTooLarge, "Attachment exceeds the maximum size of "+strconv.FormatInt(maxSize, 10)+" bytes")
+}
+
+// storageUnavailable hides a blob store failure behind a 502, the cause is logged
+func storageUnavailable(err error) *problem.Problem {
+	p := problem.Internal(err)
+	p.Status = http.StatusBadGateway
+	p.Title = http.StatusText(http.StatusBadGateway)
+	p.Detail = "The attachment storage is unavailable, please retry later"
+	return p
+}
+
+// findNoteOr404 loads the note from the path when the user sees it and writes the error response when it fails
+func (h *NoteHandler) findNoteOr404(w http.ResponseWriter, r *http.Request) (*models.Note, bool) {
+	note, err := findVisibleNote(r.Context(), h.store, r.PathValue("noteId"))
+	if err != nil {
+		writeStoreError(w, r, err, noteNotFound)
+		return nil, false
+	}
+	return note, true
+}
+
+const attachmentNotFound = "No attachment with that ID exists"
+
+// ! UPLOAD
+func (h *NoteHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	// the file of another user is not read, the note is checked again when the attachment is saved
+	note, ok := h.findNoteOr404(w, r)
+	if !ok {
+		return
+	}
+	if note.UserID != middleware.UserID(r.Context()) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, noteNotFound))
+		return
+	}
+
+	maxSize := h.attachments.MaxSize
+
+	// leave some room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(w, r, tooLarge(maxSize))
+			return
+		}
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "The request body is not a valid multipart form"))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		problem.Write(w, r, problem.Validation([]*models.ErrorResponse{{Field: "file", Tag: "required", Message: "is required"}}))
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxSize {
+		problem.Write(w, r, tooLarge(maxSize))
+		return
+	}
+
+	// detect the type from the content, the client supplied header is not trusted
+	detected, err := mimetype.DetectReader(file)
+	if err != nil {
+		problem.Error(w, r, fmt.Errorf("detect attachment type: %w", err))
+		return
+	}
+	if !isAllowedType(detected, h.attachments.AllowedTypes) {
+		problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType, "Attachments of type "+detected.String()+" are not allowed"))
+		return
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		problem.Error(w, r, fmt.Errorf("rewind attachment: %w", err))
+		return
+	}
+
+	attachment := models.Attachment{
+		ID:          uuid.New().String(),
+		NoteID:      note.ID,
+		FileName:    filepath.Base(header.Filename),
+		ContentType: detected.String(),
+		Size:        header.Size,
+		CreatedAt:   time.Now(),
+	}
+	attachment.StorageKey = attachmentKey(note.ID, attachment.ID)
+
+	if err := h.blobs.Put(r.Context(), attachment.StorageKey, file, attachment.Size, attachment.ContentType); err != nil {
+		problem.Write(w, r, storageUnavailable(fmt.Errorf("store attachment: %w", err)))
+		return
+	}
+
+	// the note is locked while the attachment is saved, so it cannot be deleted or change hands in between
+	err = h.store.Transaction(r.Context(), func(tx repository.Store) error {
+		if _, err := findOwnNote(r.Context(), tx, note.ID); err != nil {
+			return err
+		}
+		return tx.Attachments().Create(r.Context(), &attachment)
+	})
+	if err != nil {
+		// the blob is removed even when the client is gone
+		h.deleteBlobs(context.WithoutCancel(r.Context()), []string{attachment.StorageKey})
+		writeStoreError(w, r, err, noteNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"attachment": attachment,
+		},
+	})
+}
+
+// ! GET ALL
+func (h *NoteHandler) FindAttachments(w http.ResponseWriter, r *http.Request) {
+	note, ok := h.findNoteOr404(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.store.Attachments().ListByNote(r.Context(), note.ID)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":      "success",
+		"results":     len(attachments),
+		"attachments": attachments,
+	})
+}
+
+// findAttachmentOr404 loads the attachment from the path of a note the user sees and writes the error response
+// when it fails
+func (h *NoteHandler) findAttachmentOr404(w http.ResponseWriter, r *http.Request) (*models.Attachment, bool) {
+	note, ok := h.findNoteOr404(w, r)
+	if !ok {
+		return nil, false
+	}
+	attachment, err := h.store.Attachments().FindByID(r.Context(), note.ID, r.PathValue("attachmentId"))
+	if err != nil {
+		writeStoreError(w, r, err, attachmentNotFound)
+		return nil, false
+	}
+	return attachment, true
+}
+
+// ! DOWNLOAD
+func (h *NoteHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := h.findAttachmentOr404(w, r)
+	if !ok {
+		return
+	}
+
+	blob, err := h.blobs.Open(r.Context(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Write(w, r, problem.New(http.StatusNotFound, "Attachment content is missing"))
+			return
+		}
+		problem.Write(w, r, storageUnavailable(fmt.Errorf("open attachment: %w", err)))
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent takes care of Range, If-Range and If-Modified-Since requests
+	http.ServeContent(w, r, attachment.FileName, attachment.CreatedAt, blob)
+}
+
+// ! DELETE
+func (h *NoteHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	notFound := noteNotFound
+	var attachment *models.Attachment
+	err := h.store.Transaction(ctx, func(tx repository.Store) error {
+		note, err := findOwnNote(ctx, tx, r.PathValue("noteId"))
+		if err != nil {
+			return err
+		}
+		notFound = attachmentNotFound
+		attachment, err = tx.Attachments().FindByID(ctx, note.ID, r.PathValue("attachmentId"))
+		if err != nil {
+			return err
+		}
+		return tx.Attachments().Delete(ctx, attachment.ID)
+	})
+	if err != nil {
+		writeStoreError(w, r, err, notFound)
+		return
+	}
+
+	h.deleteBlobs(ctx, []string{attachment.StorageKey})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// deleteBlobs removes blobs once the rows pointing to them are gone, failures are only logged
+func (h *NoteHandler) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("failed to delete blob", "key", key, "error", err)
+		}
+	}
+}
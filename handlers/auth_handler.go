@@ -1,59 +1,65 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
-	"example/rest-api/db"
+	"example/rest-api/config"
+	"example/rest-api/events"
+	"example/rest-api/metrics"
 	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
 	"example/rest-api/utils"
 
 	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+// AuthHandler serves the auth routes
+type AuthHandler struct {
+	store   repository.Store
+	users   repository.UserRepository
+	auth    config.AuthConfig
+	metrics *metrics.Metrics
+}
+
+func NewAuthHandler(store repository.Store, auth config.AuthConfig, m *metrics.Metrics) *AuthHandler {
+	return &AuthHandler{store: store, users: store.Users(), auth: auth, metrics: m}
+}
+
+func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var payload models.CreateUserSchema
 
 	// decode request body
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 
 	// validate payload
-	errors := models.ValidateStruct(&payload)
-	if errors != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(errors)
+	validationErrors := models.ValidateStruct(&payload)
+	if validationErrors != nil {
+		problem.Write(w, r, problem.Validation(validationErrors))
 		return
 	}
 
-	//hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	newUser, err := h.register(r.Context(), &payload)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// create new user
-	newUser := models.User{
-		Username: payload.Username,
-		Email:    payload.Email,
-		FullName: payload.FullName,
-		Password: string(hashedPassword),
-		Role:     payload.Role,
-	}
-
-	// save the user
-	if err := db.DB.Create(&newUser).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		var conflict *repository.ConflictError
+		if errors.As(err, &conflict) {
+			problem.Write(w, r, problem.Conflict(conflict.Field, "A user with this "+conflict.Field+" already exists"))
+			return
+		}
+		problem.Error(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "User created successfully",
@@ -61,38 +67,25 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var credentials struct {
-		Username *string `json:"username"`
-		Email    string  `json:"email"`
-		Password string  `json:"password"`
-	}
+func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var credentials models.LoginSchema
 
 	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
-		http.Error(w, "Invalid email or password", http.StatusBadRequest)
-		return
-	}
-
-	// find the user by email or username
-	var user models.User
-	if err := db.DB.Where("email = ? OR username = ?", credentials.Email, credentials.Username).First(&user).Error; err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 
-	//verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	token, err := h.login(r.Context(), &credentials)
+	if errors.Is(err, errInvalidCredentials) {
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Invalid credentials"))
 		return
 	}
-
-	// generate new jwt token
-	token, err := utils.GenerateJWT(user.ID, user.Username, user.Role)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Login successful",
@@ -100,33 +93,25 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the JWT token from the request
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		// No token provided
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "fail",
-			"message": "No token provided",
-		})
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "No token provided"))
 		return
 	}
 
 	// Parse and invalidate the token
-	tokenString := strings.Split(authHeader, " ")[1]
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	claims := &jwt.MapClaims{}
 	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte("your-secret-key"), nil
+		return []byte(h.auth.JWTSecret), nil
 	})
 
 	if err != nil {
 		// Invalid token
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "fail",
-			"message": "Invalid token",
-		})
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "Invalid token"))
 		return
 	}
 
@@ -134,9 +119,77 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	(*claims)["exp"] = time.Now().Unix() - 1
 
 	// Respond with a success message
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "success",
 		"message": "Logged out successfully",
 	})
 }
+
+// errInvalidCredentials is returned by login when the user does not exist or the password is wrong
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// register saves a new user along with its registration event, the payload is already validated
+func (h *AuthHandler) register(ctx context.Context, payload *models.CreateUserSchema) (*models.User, error) {
+	//hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// create new user
+	newUser := models.User{
+		Username: payload.Username,
+		Email:    payload.Email,
+		FullName: payload.FullName,
+		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+	}
+
+	// save the user, along with its registration event
+	err = h.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := tx.Users().Create(ctx, &newUser); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx, events.UserRegistered(newUser))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.metrics.UserRegistered()
+	return &newUser, nil
+}
+
+// login checks the credentials and returns a new token of the user
+func (h *AuthHandler) login(ctx context.Context, credentials *models.LoginSchema) (string, error) {
+	// find the user by email or username
+	username := ""
+	if credentials.Username != nil {
+		username = *credentials.Username
+	}
+	user, err := h.users.FindByLogin(ctx, credentials.Email, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return "", err
+	}
+	if err != nil {
+		h.metrics.Login(false)
+		return "", errInvalidCredentials
+	}
+
+	//verify password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
+		h.metrics.Login(false)
+		return "", errInvalidCredentials
+	}
+
+	// generate new jwt token
+	token, err := utils.GenerateJWT(h.auth.JWTSecret, h.auth.TokenTTL, user.ID, user.Username, user.Role)
+	if err != nil {
+		return "", err
+	}
+
+	h.metrics.Login(true)
+	return token, nil
+}
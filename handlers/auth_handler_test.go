@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	h := NewAuthHandler(repository.NewMemoryStore(), config.AuthConfig{JWTSecret: "test-secret", TokenTTL: time.Hour}, nil)
+	user := models.CreateUserSchema{
+		Username: "alice",
+		Email:    "alice@example.com",
+		Password: "correct horse",
+		FullName: "Alice Liddell",
+	}
+
+	if w := serve(h.RegisterHandler, http.MethodPost, "/api/auth/register", user, nil); w.Code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	if w := serve(h.RegisterHandler, http.MethodPost, "/api/auth/register", user, nil); w.Code != http.StatusConflict {
+		t.Fatalf("register twice: expected 409, got %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name        string
+		credentials map[string]string
+		want        int
+	}{
+		{"by email", map[string]string{"email": "alice@example.com", "password": "correct horse"}, http.StatusOK},
+		{"by username", map[string]string{"username": "alice", "password": "correct horse"}, http.StatusOK},
+		{"wrong password", map[string]string{"email": "alice@example.com", "password": "wrong"}, http.StatusUnauthorized},
+		{"unknown user", map[string]string{"email": "bob@example.com", "password": "correct horse"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h.LoginHandler, http.MethodPost, "/api/auth/login", tt.credentials, nil); w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+
+	"github.com/lib/pq"
+)
+
+// bulk modes
+const (
+	bulkAtomic     = "atomic"      // every item succeeds or the whole request is rolled back
+	bulkBestEffort = "best_effort" // failed items are rolled back on their own and the rest is committed
+)
+
+// maxBulkItems caps the number of notes touched by a single bulk request
+const maxBulkItems = 500
+
+var (
+	errBulkRolledBack = errors.New("bulk request rolled back")
+	errBulkItemFailed = errors.New("bulk item failed")
+)
+
+// BulkResult is the outcome of one note of a bulk request
+type BulkResult struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	ID      string       `json:"id,omitempty"`
+	Status  int          `json:"status"`
+	Message string       `json:"message,omitempty"`
+	Note    *models.Note `json:"note,omitempty"`
+}
+
+// bulkItem is a single note an operation is applied to
+type bulkItem struct {
+	index int
+	op    *models.BulkOperationSchema
+	id    string
+}
+
+// ! BULK
+func (h *NoteHandler) BulkNotes(w http.ResponseWriter, r *http.Request) {
+	var payload models.BulkNoteSchema
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		problem.Write(w, r, problem.Validation(validationErrors))
+		return
+	}
+	if payload.Mode == "" {
+		payload.Mode = bulkAtomic
+	}
+
+	// expand the operations into one item per note
+	var items []bulkItem
+	for i := range payload.Operations {
+		op := &payload.Operations[i]
+		if op.Op == "create" {
+			items = append(items, bulkItem{index: i, op: op})
+			continue
+		}
+		if len(op.IDs) == 0 {
+			problem.Write(w, r, problem.Validation([]*models.ErrorResponse{{
+				Field:   "operations[" + strconv.Itoa(i) + "].ids",
+				Tag:     "required",
+				Message: "is required by the " + op.Op + " operation",
+			}}))
+			return
+		}
+		for _, id := range op.IDs {
+			items = append(items, bulkItem{index: i, op: op, id: id})
+		}
+	}
+	if len(items) > maxBulkItems {
+		problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge, "A bulk request can touch at most "+strconv.Itoa(maxBulkItems)+" notes"))
+		return
+	}
+
+	userID := middleware.UserID(r.Context())
+	results := make([]BulkResult, len(items))
+	var blobKeys []string
+	failed := 0
+
+	err := h.store.Transaction(r.Context(), func(tx repository.Store) error {
+		for i, item := range items {
+			// every item runs in its own nested transaction so a failure does not abort the others
+			var keys []string
+			err := tx.Transaction(r.Context(), func(itemTx repository.Store) error {
+				results[i], keys = applyBulkItem(r.Context(), itemTx, userID, item)
+				if results[i].Status >= http.StatusBadRequest {
+					return errBulkItemFailed
+				}
+				return nil
+			})
+			if errors.Is(err, errBulkItemFailed) {
+				failed++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			blobKeys = append(blobKeys, keys...)
+		}
+
+		if failed > 0 && payload.Mode == bulkAtomic {
+			return errBulkRolledBack
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errBulkRolledBack) {
+		problem.Error(w, r, err)
+		return
+	}
+
+	if errors.Is(err, errBulkRolledBack) {
+		for i := range results {
+			if results[i].Status < http.StatusBadRequest {
+				results[i].Status = http.StatusFailedDependency
+				results[i].Message = "Rolled back because another item failed"
+				results[i].Note = nil
+			}
+		}
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "The bulk request was rolled back because "+strconv.Itoa(failed)+" item(s) failed").
+			With("mode", payload.Mode).
+			With("failed", failed).
+			With("results", results))
+		return
+	}
+
+	// the transaction is committed, drop what is stale now
+	created := 0
+	for _, result := range results {
+		if result.ID != "" && result.Status < http.StatusBadRequest {
+			h.renderCache.Invalidate(result.ID)
+		}
+		if result.Status == http.StatusCreated {
+			created++
+		}
+	}
+	h.metrics.NotesCreated("bulk", created)
+	h.deleteBlobs(r.Context(), blobKeys)
+
+	status := http.StatusOK
+	state := "success"
+	if failed > 0 {
+		status = http.StatusMultiStatus
+		state = "partial"
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"status":  state,
+		"mode":    payload.Mode,
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+// applyBulkItem runs one item inside the bulk transaction. It returns the result of the item and,
+// for deletes, the storage keys of attachment blobs to remove once the transaction is committed.
+func applyBulkItem(ctx context.Context, tx repository.Store, userID string, item bulkItem) (BulkResult, []string) {
+	result := BulkResult{Index: item.index, Op: item.op.Op, ID: item.id}
+
+	fail := func(status int, message string) (BulkResult, []string) {
+		result.Status = status
+		result.Message = message
+		return result, nil
+	}
+	failWith := func(err error) (BulkResult, []string) {
+		if p := storeProblem(err, noteNotFound); p != nil {
+			return fail(p.Status, p.Detail)
+		}
+		// the cause stays in the logs, like the problems of the other routes
+		logging.FromContext(ctx).Error("bulk item failed", "index", item.index, "op", item.op.Op, "error", err)
+		return fail(http.StatusInternalServerError, "An unexpected error occurred")
+	}
+
+	// the input of the operation is checked before the note is looked up, like the single note routes do
+	var change func(note *models.Note)
+	switch item.op.Op {
+	case "create":
+		var payload models.CreateNoteSchema
+		if err := decodeBulkData(item.op.Data, &payload); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+			return fail(http.StatusBadRequest, "Invalid note: "+validationErrors[0].Field+" "+validationErrors[0].Message)
+		}
+		note, err := createNoteIn(ctx, tx, userID, &payload)
+		if err != nil {
+			return failWith(err)
+		}
+		result.ID = note.ID
+		result.Status = http.StatusCreated
+		result.Note = note
+		return result, nil
+	case "delete":
+		keys, err := deleteNoteIn(ctx, tx, item.id)
+		if err != nil {
+			return failWith(err)
+		}
+		result.Status = http.StatusOK
+		return result, keys
+	case "update":
+		var payload models.UpdateNoteSchema
+		if err := decodeBulkData(item.op.Data, &payload); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+			return fail(http.StatusBadRequest, "Invalid note: "+validationErrors[0].Field+" "+validationErrors[0].Message)
+		}
+		change = func(note *models.Note) { applyNoteUpdates(note, &payload) }
+	case "publish":
+		published := true
+		if item.op.Published != nil {
+			published = *item.op.Published
+		}
+		change = func(note *models.Note) { note.Published = published }
+	case "tag":
+		if len(item.op.Tags) == 0 {
+			return fail(http.StatusBadRequest, "Operation tag requires a list of tags")
+		}
+		change = func(note *models.Note) { note.Tags = pq.StringArray(mergeTags(note.Tags, item.op.Tags)) }
+	case "move":
+		if item.op.Category == nil {
+			return fail(http.StatusBadRequest, "Operation move requires a category")
+		}
+		change = func(note *models.Note) { note.Category = *item.op.Category }
+	}
+
+	note, err := updateNoteIn(ctx, tx, item.id, change)
+	if err != nil {
+		return failWith(err)
+	}
+	result.Status = http.StatusOK
+	result.Note = note
+	return result, nil
+}
+
+// decodeBulkData decodes the data of an operation, unknown fields are rejected
+func decodeBulkData(data json.RawMessage, dst interface{}) error {
+	if len(data) == 0 {
+		return errors.New("Operation requires data")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(dst)
+}
+
+// mergeTags appends the tags that are not present yet, keeping the existing order
+func mergeTags(existing []string, tags []string) []string {
+	seen := make(map[string]bool, len(existing))
+	merged := make([]string, 0, len(existing)+len(tags))
+	for _, tag := range existing {
+		seen[tag] = true
+		merged = append(merged, tag)
+	}
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
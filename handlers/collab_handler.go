@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"example/rest-api/collab"
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds the write of a message to a client
+	writeWait = 10 * time.Second
+	// pongWait is how long a client can stay silent, it answers the pings sent every pingPeriod
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+// CollabHandler serves the WebSocket connections editing the notes collaboratively
+type CollabHandler struct {
+	store    repository.Store
+	hub      *collab.Hub
+	upgrader websocket.Upgrader
+	// maxMessageSize bounds the messages of the clients
+	maxMessageSize int64
+}
+
+// NewCollabHandler returns the handler of the rooms of hub, browsers can connect from the CORS allowed origins
+func NewCollabHandler(store repository.Store, hub *collab.Hub, allowedOrigins []string, maxMessageSize int64) *CollabHandler {
+	h := &CollabHandler{store: store, hub: hub, maxMessageSize: maxMessageSize}
+	h.upgrader = websocket.Upgrader{
+		HandshakeTimeout: writeWait,
+		CheckOrigin:      allowedOrigin(allowedOrigins),
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			problem.Write(w, r, problem.New(status, reason.Error()))
+		},
+	}
+	return h
+}
+
+// allowedOrigin accepts the connections of the clients other than browsers, which send no Origin, and the
+// ones from the same host or from the allowed origins
+func allowedOrigin(origins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin) {
+			return true
+		}
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+}
+
+// ! COLLAB
+// CollabNote upgrades to a WebSocket joining the room of the note, the operations of the client are
+// applied to the note and the ones of the others are sent to it until either side closes the connection.
+// The users other than the owner can only view the published notes, there is no sharing of edit rights yet.
+func (h *CollabHandler) CollabNote(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "Expected a WebSocket upgrade request"))
+		return
+	}
+
+	user, err := h.store.Users().FindByID(r.Context(), middleware.UserID(r.Context()))
+	if err != nil {
+		writeStoreError(w, r, err, "The user no longer exists")
+		return
+	}
+
+	note, err := findVisibleNote(r.Context(), h.store, r.PathValue("noteId"))
+	if err != nil {
+		writeStoreError(w, r, err, noteNotFound)
+		return
+	}
+
+	// the room outlives the request context, which ends with the handler
+	ctx := context.WithoutCancel(r.Context())
+	client, err := h.hub.Join(ctx, note.ID, collab.Peer{UserID: user.ID, Username: user.Username})
+	if err != nil {
+		writeStoreError(w, r, err, noteNotFound)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the error response is written already
+		client.Leave(ctx, "")
+		return
+	}
+
+	logger := logging.FromContext(r.Context()).With("note_id", r.PathValue("noteId"), "client_id", client.ID())
+	logger.Debug("joined a collaborative note")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.writePump(conn, client)
+	}()
+	reason := h.readPump(conn, client, note.UserID != user.ID)
+	client.Leave(ctx, reason)
+	<-done
+	logger.Debug("left a collaborative note", "reason", reason)
+}
+
+// readPump hands the messages of the client to its room until the connection fails, and returns the error
+// to send to the client when it sent an invalid message. A read only client only moves its cursor.
+func (h *CollabHandler) readPump(conn *websocket.Conn, client *collab.Client, readOnly bool) string {
+	conn.SetReadLimit(h.maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return ""
+		}
+		var msg collab.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return "Invalid message: " + err.Error()
+		}
+		// any message shows the client is alive, even when pongs are delayed behind it
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		switch msg.Type {
+		case collab.MessageOp:
+			if readOnly {
+				return "Only the owner of the note can edit it"
+			}
+			if msg.Op == nil {
+				return "An op message needs an op"
+			}
+			if err := client.Submit(msg.Revision, msg.Op, msg.Cursor); err != nil {
+				return err.Error()
+			}
+		case collab.MessageCursor:
+			client.MoveCursor(msg.Cursor)
+		default:
+			return "Unknown message type " + msg.Type
+		}
+	}
+}
+
+// writePump sends the messages of the room and the pings to the client, it closes the connection once the
+// client is dropped from the room or a write fails
+func (h *CollabHandler) writePump(conn *websocket.Conn, client *collab.Client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client.Send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example/rest-api/config"
+	"example/rest-api/graphql"
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+)
+
+const (
+	// defaultPageSize and maxPageSize bound the first argument of the connections
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// GraphQLHandler serves the GraphQL endpoint, its mutations go through the same code as the REST routes
+type GraphQLHandler struct {
+	notes  *NoteHandler
+	schema *graphql.Schema
+}
+
+func NewGraphQLHandler(notes *NoteHandler, cfg config.GraphQLConfig) *GraphQLHandler {
+	h := &GraphQLHandler{notes: notes}
+	note, user, tag, connection := h.types()
+	schema, err := graphql.NewSchema(graphql.Schema{
+		Query:         h.queryType(note, user, tag, connection),
+		Mutation:      h.mutationType(note),
+		MaxDepth:      cfg.MaxDepth,
+		MaxComplexity: cfg.MaxComplexity,
+		PresentError:  presentGraphQLError,
+	})
+	if err != nil {
+		// the schema does not depend on the input, this is a programming error
+		panic(err)
+	}
+	h.schema = schema
+	return h
+}
+
+// ! GRAPHQL
+func (h *GraphQLHandler) ServeGraphQL(w http.ResponseWriter, r *http.Request) {
+	var payload graphql.Request
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+
+	// the errors of the query are part of the response, as GraphQL clients expect
+	response := h.schema.Execute(r.Context(), payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// presentGraphQLError hides the unexpected errors of the resolvers behind a generic message, like the REST routes
+func presentGraphQLError(ctx context.Context, err error) *graphql.Error {
+	logging.FromContext(ctx).Error("graphql resolver failed", "error", err)
+	return &graphql.Error{
+		Message: "An unexpected error occurred, please retry later or report the request id",
+		Extensions: map[string]interface{}{
+			"code":      "INTERNAL_SERVER_ERROR",
+			"requestId": middleware.RequestID(ctx),
+		},
+	}
+}
+
+// graphqlStoreError turns a repository error into the error of a field, notFound is the message of a missing record
+func graphqlStoreError(err error, notFound string) error {
+	var conflict *repository.ConflictError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return &graphql.Error{Message: notFound, Extensions: map[string]interface{}{"code": "NOT_FOUND"}}
+	case errors.As(err, &conflict):
+		message := "A note with this title already exists"
+		if conflict.Field != "title" {
+			message = "Resource already exists"
+		}
+		return &graphql.Error{Message: message, Extensions: map[string]interface{}{"code": "CONFLICT", "field": conflict.Field}}
+	}
+	return err
+}
+
+// graphqlValidationError is the error of an input that failed the validation of the REST payload
+func graphqlValidationError(errs []*models.ErrorResponse) error {
+	return &graphql.Error{
+		Message:    problem.Validation(errs).Detail,
+		Extensions: map[string]interface{}{"code": "BAD_USER_INPUT", "errors": errs},
+	}
+}
+
+func badUserInput(message string) error {
+	return &graphql.Error{Message: message, Extensions: map[string]interface{}{"code": "BAD_USER_INPUT"}}
+}
+
+// decodeInput copies an input object into the REST payload it mirrors, their fields have the same names
+func decodeInput(input interface{}, dst interface{}) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// page is a window of a list of notes, after is the offset of the note it starts after
+type page struct {
+	first int
+	after int
+}
+
+var connectionArgs = graphql.Args{
+	"first": {Type: graphql.Int, Default: defaultPageSize, Description: "The number of notes, at most 100"},
+	"after": {Type: graphql.String, Description: "The cursor of the note the page starts after"},
+}
+
+// connectionComplexity costs a connection as many times its selection as the notes it can hold
+func connectionComplexity(args map[string]interface{}, childComplexity int) int {
+	first, ok := args["first"].(int)
+	if !ok || first < 1 {
+		first = 1
+	}
+	return 1 + min(first, maxPageSize)*childComplexity
+}
+
+func pageOf(args map[string]interface{}) (page, error) {
+	p := page{first: defaultPageSize, after: -1}
+	if first, ok := args["first"].(int); ok {
+		if first < 0 || first > maxPageSize {
+			return p, badUserInput("first must be between 0 and " + strconv.Itoa(maxPageSize))
+		}
+		p.first = first
+	}
+	if after, ok := args["after"].(string); ok {
+		offset, err := decodeCursor(after)
+		if err != nil {
+			return p, badUserInput("after is not a valid cursor")
+		}
+		p.after = offset
+	}
+	return p, nil
+}
+
+// the cursors are opaque to the clients, they hold the offset of a note in its list
+const cursorPrefix = "offset:"
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(data), cursorPrefix))
+	if err != nil || !strings.HasPrefix(string(data), cursorPrefix) || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
+
+// noteConnection is a page of notes, offset is the position of its first note in the whole list
+type noteConnection struct {
+	notes   []models.Note
+	offset  int
+	hasNext bool
+}
+
+// slicePage cuts a page out of a whole list of notes
+func slicePage(notes []models.Note, p page) *noteConnection {
+	start := min(p.after+1, len(notes))
+	end := min(start+p.first, len(notes))
+	return &noteConnection{notes: notes[start:end], offset: start, hasNext: end < len(notes)}
+}
+
+type noteEdge struct {
+	cursor string
+	node   *models.Note
+}
+
+func noteField(t graphql.Type, get func(note *models.Note) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+		return get(source.(*models.Note)), nil
+	}}
+}
+
+func userField(t graphql.Type, get func(user *models.User) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+		return get(source.(*models.User)), nil
+	}}
+}
+
+// types returns the object types of the schema, they refer to each other
+func (h *GraphQLHandler) types() (note, user, tag, connection *graphql.Object) {
+	nonNull := graphql.NewNonNull
+	note = &graphql.Object{Name: "Note"}
+	user = &graphql.Object{Name: "User"}
+	tag = &graphql.Object{Name: "Tag", Description: "A tag along with the number of notes carrying it"}
+	pageInfo := &graphql.Object{Name: "PageInfo", Fields: graphql.Fields{
+		"hasNextPage": {Type: nonNull(graphql.Boolean), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(*noteConnection).hasNext, nil
+		}},
+		"hasPreviousPage": {Type: nonNull(graphql.Boolean), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(*noteConnection).offset > 0, nil
+		}},
+		"startCursor": {Type: graphql.String, Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			c := source.(*noteConnection)
+			if len(c.notes) == 0 {
+				return nil, nil
+			}
+			return encodeCursor(c.offset), nil
+		}},
+		"endCursor": {Type: graphql.String, Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			c := source.(*noteConnection)
+			if len(c.notes) == 0 {
+				return nil, nil
+			}
+			return encodeCursor(c.offset + len(c.notes) - 1), nil
+		}},
+	}}
+	edge := &graphql.Object{Name: "NoteEdge", Fields: graphql.Fields{
+		"cursor": {Type: nonNull(graphql.String), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(noteEdge).cursor, nil
+		}},
+		"node": {Type: nonNull(note), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(noteEdge).node, nil
+		}},
+	}}
+	connection = &graphql.Object{Name: "NoteConnection", Fields: graphql.Fields{
+		"edges": {Type: nonNull(graphql.NewList(nonNull(edge))), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			c := source.(*noteConnection)
+			edges := make([]noteEdge, len(c.notes))
+			for i := range c.notes {
+				edges[i] = noteEdge{cursor: encodeCursor(c.offset + i), node: &c.notes[i]}
+			}
+			return edges, nil
+		}},
+		"nodes": {Type: nonNull(graphql.NewList(nonNull(note))), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			c := source.(*noteConnection)
+			nodes := make([]*models.Note, len(c.notes))
+			for i := range c.notes {
+				nodes[i] = &c.notes[i]
+			}
+			return nodes, nil
+		}},
+		"pageInfo": {Type: nonNull(pageInfo), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source, nil
+		}},
+	}}
+
+	note.Fields = graphql.Fields{
+		"id":            noteField(nonNull(graphql.ID), func(n *models.Note) interface{} { return n.ID }),
+		"title":         noteField(nonNull(graphql.String), func(n *models.Note) interface{} { return n.Title }),
+		"content":       noteField(nonNull(graphql.String), func(n *models.Note) interface{} { return n.Content }),
+		"contentFormat": noteField(nonNull(graphql.String), func(n *models.Note) interface{} { return n.ContentFormat }),
+		"category":      noteField(nonNull(graphql.String), func(n *models.Note) interface{} { return n.Category }),
+		"published":     noteField(nonNull(graphql.Boolean), func(n *models.Note) interface{} { return n.Published }),
+		"tags":          noteField(nonNull(graphql.NewList(nonNull(graphql.String))), func(n *models.Note) interface{} { return []string(n.Tags) }),
+		"createdAt":     noteField(nonNull(graphql.DateTime), func(n *models.Note) interface{} { return n.CreatedAt }),
+		"updatedAt":     noteField(nonNull(graphql.DateTime), func(n *models.Note) interface{} { return n.UpdatedAt }),
+		"author":        {Type: user, Description: "The user who wrote the note", Batch: h.noteAuthors},
+	}
+
+	user.Fields = graphql.Fields{
+		"id":       userField(nonNull(graphql.ID), func(u *models.User) interface{} { return u.ID }),
+		"username": userField(nonNull(graphql.String), func(u *models.User) interface{} { return u.Username }),
+		"fullName": userField(nonNull(graphql.String), func(u *models.User) interface{} { return u.FullName }),
+		"email": {
+			Type:        graphql.String,
+			Description: "The email of the user, only visible to the user themself",
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				if u := source.(*models.User); u.ID == middleware.UserID(ctx) {
+					return u.Email, nil
+				}
+				return nil, nil
+			},
+		},
+		"createdAt": userField(nonNull(graphql.DateTime), func(u *models.User) interface{} { return u.CreatedAt }),
+		"notes": {
+			Type:        nonNull(connection),
+			Description: "The notes of the user in creation order",
+			Args:        connectionArgs,
+			Batch:       h.userNotes,
+			Complexity:  connectionComplexity,
+		},
+	}
+
+	tag.Fields = graphql.Fields{
+		"name": {Type: nonNull(graphql.String), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(repository.TagCount).Name, nil
+		}},
+		"count": {Type: nonNull(graphql.Int), Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+			return source.(repository.TagCount).Count, nil
+		}},
+		"notes": {
+			Type:        nonNull(connection),
+			Description: "The notes carrying the tag in creation order",
+			Args:        connectionArgs,
+			Batch:       h.tagNotes,
+			Complexity:  connectionComplexity,
+		},
+	}
+	return note, user, tag, connection
+}
+
+func (h *GraphQLHandler) queryType(note, user, tag, connection *graphql.Object) *graphql.Object {
+	nonNull := graphql.NewNonNull
+
+	searchArgs := graphql.Args{
+		"title":    {Type: graphql.String, Description: "A case insensitive substring of the title"},
+		"content":  {Type: graphql.String, Description: "A case insensitive substring of the content"},
+		"category": {Type: graphql.String, Description: "A case insensitive substring of the category"},
+		"tag":      {Type: graphql.String, Description: "A tag of the notes"},
+	}
+	for name, arg := range connectionArgs {
+		searchArgs[name] = arg
+	}
+
+	return &graphql.Object{Name: "Query", Fields: graphql.Fields{
+		"me": {
+			Type:        nonNull(user),
+			Description: "The authenticated user",
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				u, err := h.notes.store.Users().FindByID(ctx, middleware.UserID(ctx))
+				if err != nil {
+					return nil, graphqlStoreError(err, "No user with that ID exists")
+				}
+				return u, nil
+			},
+		},
+		"user": {
+			Type: user,
+			Args: graphql.Args{"id": {Type: nonNull(graphql.ID)}},
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				u, err := h.notes.store.Users().FindByID(ctx, args["id"].(string))
+				if err != nil {
+					return nil, graphqlStoreError(err, "No user with that ID exists")
+				}
+				return u, nil
+			},
+		},
+		"note": {
+			Type: note,
+			Args: graphql.Args{"id": {Type: nonNull(graphql.ID)}},
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				n, err := findVisibleNote(ctx, h.notes.store, args["id"].(string))
+				if err != nil {
+					return nil, graphqlStoreError(err, noteNotFound)
+				}
+				return n, nil
+			},
+		},
+		"notes": {
+			Type:        nonNull(connection),
+			Description: "Every note the user sees, their own ones and the published ones, in creation order",
+			Args:        connectionArgs,
+			Complexity:  connectionComplexity,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				p, err := pageOf(args)
+				if err != nil {
+					return nil, err
+				}
+				// one more note tells whether there is a next page
+				filter := repository.NoteFilter{VisibleTo: middleware.UserID(ctx)}
+				notes, err := h.notes.store.Notes().List(ctx, filter, p.first+1, p.after+1)
+				if err != nil {
+					return nil, err
+				}
+				c := &noteConnection{notes: notes, offset: p.after + 1}
+				if len(notes) > p.first {
+					c.notes, c.hasNext = notes[:p.first], true
+				}
+				return c, nil
+			},
+		},
+		"searchNotes": {
+			Type:        nonNull(connection),
+			Description: "The notes the user sees matching every given filter in creation order",
+			Args:        searchArgs,
+			Complexity:  connectionComplexity,
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				p, err := pageOf(args)
+				if err != nil {
+					return nil, err
+				}
+				filter := repository.NoteFilter{VisibleTo: middleware.UserID(ctx)}
+				filter.Title, _ = args["title"].(string)
+				filter.Content, _ = args["content"].(string)
+				filter.Category, _ = args["category"].(string)
+				if tag, ok := args["tag"].(string); ok {
+					filter.Tags = []string{tag}
+				}
+				notes, err := h.notes.store.Notes().Search(ctx, filter)
+				if err != nil {
+					return nil, err
+				}
+				return slicePage(notes, p), nil
+			},
+		},
+		"tags": {
+			Type:        nonNull(graphql.NewList(nonNull(tag))),
+			Description: "The tags of the notes the user sees ordered by name",
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return h.notes.store.Notes().Tags(ctx, middleware.UserID(ctx))
+			},
+		},
+	}}
+}
+
+func (h *GraphQLHandler) mutationType(note *graphql.Object) *graphql.Object {
+	nonNull := graphql.NewNonNull
+
+	createInput := &graphql.InputObject{Name: "CreateNoteInput", Fields: graphql.Args{
+		"title":         {Type: nonNull(graphql.String)},
+		"content":       {Type: nonNull(graphql.String)},
+		"contentFormat": {Type: graphql.String, Description: "plain or markdown, plain by default"},
+		"category":      {Type: graphql.String},
+		"published":     {Type: graphql.Boolean},
+	}}
+	updateInput := &graphql.InputObject{Name: "UpdateNoteInput", Description: "The fields to change, the missing ones are kept", Fields: graphql.Args{
+		"title":         {Type: graphql.String},
+		"content":       {Type: graphql.String},
+		"contentFormat": {Type: graphql.String, Description: "plain or markdown"},
+		"category":      {Type: graphql.String},
+		"published":     {Type: graphql.Boolean},
+	}}
+
+	return &graphql.Object{Name: "Mutation", Fields: graphql.Fields{
+		"createNote": {
+			Type: nonNull(note),
+			Args: graphql.Args{"input": {Type: nonNull(createInput)}},
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				var payload models.CreateNoteSchema
+				if err := decodeInput(args["input"], &payload); err != nil {
+					return nil, err
+				}
+				if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+					return nil, graphqlValidationError(validationErrors)
+				}
+				n, err := h.notes.createNote(ctx, middleware.UserID(ctx), &payload)
+				if err != nil {
+					return nil, graphqlStoreError(err, noteNotFound)
+				}
+				h.notes.metrics.NotesCreated("graphql", 1)
+				return n, nil
+			},
+		},
+		"updateNote": {
+			Type: nonNull(note),
+			Args: graphql.Args{"id": {Type: nonNull(graphql.ID)}, "input": {Type: nonNull(updateInput)}},
+			Resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				var payload models.UpdateNoteSchema
+				if err := decodeInput(args["input"], &payload); err != nil {
+					return nil, err
+				}
+				if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+					return nil, graphqlValidationError(validationErrors)
+				}
+				n, err := h.notes.updateNote(ctx, args["id"].(string), &payload)
+				if err != nil {
+					return nil, graphqlStoreError(err, noteNotFound)
+				}
+				return n, nil
+			},
+		},
+	}}
+}
+
+// noteAuthors loads the authors of all the notes of a level of the response at once
+func (h *GraphQLHandler) noteAuthors(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	ids := make([]string, 0, len(sources))
+	seen := map[string]bool{}
+	for _, source := range sources {
+		if id := source.(*models.Note).UserID; !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	users, err := h.notes.store.Users().FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	authors := make([]interface{}, len(sources))
+	for i, source := range sources {
+		// a missing author is null rather than a typed nil pointer
+		if author, ok := byID[source.(*models.Note).UserID]; ok {
+			authors[i] = author
+		}
+	}
+	return authors, nil
+}
+
+// userNotes loads the notes of all the users of a level of the response in a single search, the notes of the
+// other users are limited to the published ones
+func (h *GraphQLHandler) userNotes(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	p, err := pageOf(args)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(sources))
+	for i, source := range sources {
+		ids[i] = source.(*models.User).ID
+	}
+	notes, err := h.notes.store.Notes().Search(ctx, repository.NoteFilter{UserIDs: ids, VisibleTo: middleware.UserID(ctx)})
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := map[string][]models.Note{}
+	for _, note := range notes {
+		byUser[note.UserID] = append(byUser[note.UserID], note)
+	}
+	connections := make([]interface{}, len(sources))
+	for i, id := range ids {
+		connections[i] = slicePage(byUser[id], p)
+	}
+	return connections, nil
+}
+
+// tagNotes loads the notes the user sees of all the tags of a level of the response in a single search
+func (h *GraphQLHandler) tagNotes(ctx context.Context, sources []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	p, err := pageOf(args)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.(repository.TagCount).Name
+	}
+	notes, err := h.notes.store.Notes().Search(ctx, repository.NoteFilter{Tags: names, VisibleTo: middleware.UserID(ctx)})
+	if err != nil {
+		return nil, err
+	}
+
+	byTag := map[string][]models.Note{}
+	for _, note := range notes {
+		for _, tag := range note.Tags {
+			byTag[tag] = append(byTag[tag], note)
+		}
+	}
+	connections := make([]interface{}, len(sources))
+	for i, name := range names {
+		connections[i] = slicePage(byTag[name], p)
+	}
+	return connections, nil
+}
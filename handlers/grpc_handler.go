@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/notespb"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// listBatchSize is how many notes ListNotes loads at once while streaming
+const listBatchSize = 100
+
+// NoteServer serves the gRPC note service with the logic of the note routes
+type NoteServer struct {
+	notespb.UnimplementedNoteServiceServer
+	notes *NoteHandler
+}
+
+func NewNoteServer(notes *NoteHandler) *NoteServer {
+	return &NoteServer{notes: notes}
+}
+
+// ! CREATE
+func (s *NoteServer) CreateNote(ctx context.Context, req *notespb.CreateNoteRequest) (*notespb.Note, error) {
+	payload := models.CreateNoteSchema{
+		Title:         req.GetTitle(),
+		Content:       req.GetContent(),
+		ContentFormat: req.GetContentFormat(),
+		Category:      req.GetCategory(),
+		Published:     req.GetPublished(),
+	}
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		return nil, grpcValidationError(validationErrors)
+	}
+
+	note, err := s.notes.createNote(ctx, middleware.UserID(ctx), &payload)
+	if err != nil {
+		return nil, grpcStoreError(ctx, err, noteNotFound)
+	}
+	s.notes.metrics.NotesCreated("grpc", 1)
+	return noteMessage(note), nil
+}
+
+// ! GET ONE
+func (s *NoteServer) GetNote(ctx context.Context, req *notespb.GetNoteRequest) (*notespb.Note, error) {
+	note, err := findVisibleNote(ctx, s.notes.store, req.GetId())
+	if err != nil {
+		return nil, grpcStoreError(ctx, err, noteNotFound)
+	}
+	return noteMessage(note), nil
+}
+
+// ! GET ALL
+func (s *NoteServer) ListNotes(req *notespb.ListNotesRequest, stream notespb.NoteService_ListNotesServer) error {
+	for field, value := range map[string]int32{"limit": req.GetLimit(), "offset": req.GetOffset()} {
+		if value < 0 {
+			return grpcValidationError([]*models.ErrorResponse{{Field: field, Tag: "min", Value: "0", Message: "must be at least 0"}})
+		}
+	}
+
+	ctx := stream.Context()
+	filter := repository.NoteFilter{VisibleTo: middleware.UserID(ctx)}
+	remaining, offset := int(req.GetLimit()), int(req.GetOffset())
+	for {
+		size := listBatchSize
+		if remaining > 0 {
+			size = min(size, remaining)
+		}
+		notes, err := s.notes.store.Notes().List(ctx, filter, size, offset)
+		if err != nil {
+			return grpcStoreError(ctx, err, noteNotFound)
+		}
+		for i := range notes {
+			if err := stream.Send(noteMessage(&notes[i])); err != nil {
+				return err
+			}
+		}
+		if len(notes) < size {
+			return nil
+		}
+		offset += len(notes)
+		if remaining > 0 {
+			remaining -= len(notes)
+			if remaining == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// ! PUT
+func (s *NoteServer) UpdateNote(ctx context.Context, req *notespb.UpdateNoteRequest) (*notespb.Note, error) {
+	payload := models.UpdateNoteSchema{
+		Title:         req.GetTitle(),
+		Content:       req.GetContent(),
+		ContentFormat: req.GetContentFormat(),
+		Category:      req.GetCategory(),
+		Published:     req.Published,
+	}
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		return nil, grpcValidationError(validationErrors)
+	}
+
+	note, err := s.notes.updateNote(ctx, req.GetId(), &payload)
+	if err != nil {
+		return nil, grpcStoreError(ctx, err, noteNotFound)
+	}
+	return noteMessage(note), nil
+}
+
+// ! DELETE
+func (s *NoteServer) DeleteNote(ctx context.Context, req *notespb.DeleteNoteRequest) (*emptypb.Empty, error) {
+	if err := s.notes.deleteNote(ctx, req.GetId()); err != nil {
+		return nil, grpcStoreError(ctx, err, noteNotFound)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *NoteServer) SearchNotes(ctx context.Context, req *notespb.SearchNotesRequest) (*notespb.SearchNotesResponse, error) {
+	notes, err := s.notes.store.Notes().Search(ctx, repository.NoteFilter{
+		Title:     req.GetTitle(),
+		Content:   req.GetContent(),
+		Category:  req.GetCategory(),
+		Tags:      req.GetTags(),
+		VisibleTo: middleware.UserID(ctx),
+	})
+	if err != nil {
+		return nil, grpcStoreError(ctx, err, noteNotFound)
+	}
+
+	response := &notespb.SearchNotesResponse{Notes: make([]*notespb.Note, len(notes))}
+	for i := range notes {
+		response.Notes[i] = noteMessage(&notes[i])
+	}
+	return response, nil
+}
+
+// AuthServer serves the gRPC auth service with the logic of the auth routes
+type AuthServer struct {
+	notespb.UnimplementedAuthServiceServer
+	auth *AuthHandler
+}
+
+func NewAuthServer(auth *AuthHandler) *AuthServer {
+	return &AuthServer{auth: auth}
+}
+
+func (s *AuthServer) Register(ctx context.Context, req *notespb.RegisterRequest) (*notespb.User, error) {
+	payload := models.CreateUserSchema{
+		Username: req.GetUsername(),
+		Email:    req.GetEmail(),
+		Password: req.GetPassword(),
+		FullName: req.GetFullName(),
+	}
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		return nil, grpcValidationError(validationErrors)
+	}
+
+	user, err := s.auth.register(ctx, &payload)
+	var conflict *repository.ConflictError
+	if errors.As(err, &conflict) {
+		return nil, status.Error(codes.AlreadyExists, "A user with this "+conflict.Field+" already exists")
+	}
+	if err != nil {
+		return nil, grpcStoreError(ctx, err, "")
+	}
+	return &notespb.User{
+		Id:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FullName:  user.FullName,
+		Role:      user.Role,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}, nil
+}
+
+func (s *AuthServer) Login(ctx context.Context, req *notespb.LoginRequest) (*notespb.LoginResponse, error) {
+	token, err := s.auth.login(ctx, &models.LoginSchema{
+		Username: req.Username,
+		Email:    req.GetEmail(),
+		Password: req.GetPassword(),
+	})
+	if errors.Is(err, errInvalidCredentials) {
+		return nil, status.Error(codes.Unauthenticated, "Invalid credentials")
+	}
+	if err != nil {
+		return nil, grpcStoreError(ctx, err, "")
+	}
+	return &notespb.LoginResponse{Token: token}, nil
+}
+
+// noteMessage converts a note to its protobuf message
+func noteMessage(note *models.Note) *notespb.Note {
+	return &notespb.Note{
+		Id:            note.ID,
+		UserId:        note.UserID,
+		Title:         note.Title,
+		Content:       note.Content,
+		ContentFormat: note.ContentFormat,
+		Category:      note.Category,
+		Published:     note.Published,
+		Tags:          note.Tags,
+		CreatedAt:     timestamppb.New(note.CreatedAt),
+		UpdatedAt:     timestamppb.New(note.UpdatedAt),
+	}
+}
+
+// grpcStoreError converts a repository error to its status like writeStoreError, notFound is the message of a
+// NOT_FOUND. The unexpected errors are logged and hidden behind an INTERNAL status.
+func grpcStoreError(ctx context.Context, err error, notFound string) error {
+	var conflict *repository.ConflictError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return status.Error(codes.NotFound, notFound)
+	case errors.As(err, &conflict):
+		message := "A note with this title already exists"
+		if conflict.Field != "title" {
+			message = "Resource already exists"
+		}
+		return status.Error(codes.AlreadyExists, message)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	logging.FromContext(ctx).Error("rpc failed", "error", err)
+	return status.Error(codes.Internal, "An unexpected error occurred, please retry later")
+}
+
+// protoFieldName turns the json name of a field, like contentFormat, into its protobuf name
+func protoFieldName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// grpcValidationError is the INVALID_ARGUMENT status of a message that failed the validation of the REST payload,
+// the invalid fields are in its BadRequest details
+func grpcValidationError(errs []*models.ErrorResponse) error {
+	details := &errdetails.BadRequest{}
+	for _, e := range errs {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       protoFieldName(e.Field),
+			Description: e.Message,
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, problem.Validation(errs).Detail).WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, problem.Validation(errs).Detail)
+	}
+	return st.Err()
+}
@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"example/rest-api/events"
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/render"
+	"example/rest-api/repository"
+	"example/rest-api/utils"
+
+	"github.com/lib/pq"
+)
+
+// MaxImportSize is the size limit of an import request body
+const MaxImportSize = 32 << 20 // 32 MB
+
+const (
+	maxImportNoteSize = 4 << 20 // a single note inside an import
+	maxImportNotes    = 1000
+)
+
+// duplicate title policies of an import
+const (
+	onDuplicateSkip      = "skip"
+	onDuplicateRename    = "rename"
+	onDuplicateOverwrite = "overwrite"
+	onDuplicateFail      = "fail"
+)
+
+var (
+	errImportAborted    = errors.New("import aborted")
+	errImportItemFailed = errors.New("import item failed")
+)
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// invalidImportError is an upload that cannot be read as an import, it is answered with a 400 while the other
+// errors of the readers are failures of the server
+type invalidImportError struct {
+	message string
+}
+
+func (e *invalidImportError) Error() string { return e.message }
+
+func invalidImport(format string, args ...interface{}) error {
+	return &invalidImportError{message: fmt.Sprintf(format, args...)}
+}
+
+// noteFrontMatter is the YAML header of an exported markdown note
+type noteFrontMatter struct {
+	Title         string    `yaml:"title"`
+	Category      string    `yaml:"category,omitempty"`
+	Published     bool      `yaml:"published"`
+	Tags          []string  `yaml:"tags,omitempty"`
+	ContentFormat string    `yaml:"contentFormat,omitempty"`
+	CreatedAt     time.Time `yaml:"createdAt,omitempty"`
+	UpdatedAt     time.Time `yaml:"updatedAt,omitempty"`
+}
+
+// importRecord is a note read from an import before it is stored
+type importRecord struct {
+	source string
+	note   models.Note
+	err    error
+}
+
+// ImportItem is the outcome of one note of an import
+type ImportItem struct {
+	Source  string `json:"source"`
+	Title   string `json:"title,omitempty"`
+	Status  string `json:"status"`
+	NoteID  string `json:"noteId,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ImportReport sums up an import
+type ImportReport struct {
+	Total       int          `json:"total"`
+	Created     int          `json:"created"`
+	Renamed     int          `json:"renamed"`
+	Overwritten int          `json:"overwritten"`
+	Skipped     int          `json:"skipped"`
+	Failed      int          `json:"failed"`
+	Items       []ImportItem `json:"items"`
+}
+
+func (report *ImportReport) add(item ImportItem) {
+	report.Total++
+	switch item.Status {
+	case "created":
+		report.Created++
+	case "renamed":
+		report.Renamed++
+	case "overwritten":
+		report.Overwritten++
+	case "skipped":
+		report.Skipped++
+	case "failed":
+		report.Failed++
+	}
+	report.Items = append(report.Items, item)
+}
+
+// ! EXPORT
+func (h *NoteHandler) ExportNotes(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+
+	notes := h.store.Notes()
+	stamp := time.Now().UTC().Format("20060102-150405")
+
+	switch format {
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "notes-" + stamp + ".zip"}))
+
+		archive := zip.NewWriter(w)
+		err := notes.StreamByUser(r.Context(), userID, func(note *models.Note) error {
+			file, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     exportFileName(note),
+				Method:   zip.Deflate,
+				Modified: note.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			return utils.WriteFrontMatter(file, noteFrontMatter{
+				Title:         note.Title,
+				Category:      note.Category,
+				Published:     note.Published,
+				Tags:          note.Tags,
+				ContentFormat: note.ContentFormat,
+				CreatedAt:     note.CreatedAt,
+				UpdatedAt:     note.UpdatedAt,
+			}, note.Content)
+		})
+		if err != nil {
+			// the headers are gone already, a truncated archive is all we can signal
+			logging.FromContext(r.Context()).Error("failed to export notes", "error", err)
+			return
+		}
+		if err := archive.Close(); err != nil {
+			logging.FromContext(r.Context()).Error("failed to export notes", "error", err)
+		}
+
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "notes-" + stamp + ".ndjson"}))
+
+		encoder := json.NewEncoder(w)
+		err := notes.StreamByUser(r.Context(), userID, func(note *models.Note) error {
+			return encoder.Encode(note)
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to export notes", "error", err)
+		}
+
+	default:
+		problem.Write(w, r, problem.InvalidParameter("format", "must be one of zip, ndjson"))
+	}
+}
+
+// exportFileName builds a stable file name for a note inside an export archive
+func exportFileName(note *models.Note) string {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(note.Title), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	if slug == "" {
+		slug = "note"
+	}
+	return slug + "-" + note.ID[:8] + ".md"
+}
+
+// ! IMPORT
+func (h *NoteHandler) ImportNotes(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	onDuplicate := r.URL.Query().Get("onDuplicate")
+	switch onDuplicate {
+	case "":
+		onDuplicate = onDuplicateSkip
+	case onDuplicateSkip, onDuplicateRename, onDuplicateOverwrite, onDuplicateFail:
+	default:
+		problem.Write(w, r, problem.InvalidParameter("onDuplicate", "must be one of skip, rename, overwrite, fail"))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = importFormat(r.Header.Get("Content-Type"))
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+
+	var records []importRecord
+	var err error
+	switch format {
+	case "zip":
+		records, err = readZipImport(r.Body)
+	case "ndjson":
+		records, err = readNDJSONImport(r.Body)
+	case "markdown":
+		records, err = readMarkdownImport(r.Body)
+	default:
+		problem.Write(w, r, problem.New(http.StatusUnsupportedMediaType, "Unsupported import format, send a zip archive, NDJSON or a markdown file"))
+		return
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(w, r, problem.New(http.StatusRequestEntityTooLarge, "Import exceeds the maximum size of 32 MB"))
+			return
+		}
+		var invalid *invalidImportError
+		if errors.As(err, &invalid) {
+			problem.Write(w, r, problem.New(http.StatusBadRequest, invalid.message))
+			return
+		}
+		problem.Error(w, r, fmt.Errorf("read import: %w", err))
+		return
+	}
+
+	report := ImportReport{Items: []ImportItem{}}
+	var overwritten []string
+	err = h.store.Transaction(r.Context(), func(tx repository.Store) error {
+		for _, record := range records {
+			// every note runs in its own nested transaction so a failure does not abort the others
+			var item ImportItem
+			err := tx.Transaction(r.Context(), func(itemTx repository.Store) error {
+				item = importNote(r.Context(), itemTx, userID, record, onDuplicate)
+				if item.Status == "failed" {
+					return errImportItemFailed
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errImportItemFailed) {
+				return err
+			}
+
+			report.add(item)
+			if item.Status == "overwritten" {
+				overwritten = append(overwritten, item.NoteID)
+			}
+			if item.Status == "failed" && onDuplicate == onDuplicateFail {
+				return errImportAborted
+			}
+		}
+		return nil
+	})
+
+	if errors.Is(err, errImportAborted) {
+		problem.Write(w, r, problem.New(http.StatusConflict, "Import rolled back because a note could not be imported").With("report", report))
+		return
+	}
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	for _, id := range overwritten {
+		h.renderCache.Invalidate(id)
+	}
+	h.metrics.NotesCreated("import", report.Created+report.Renamed)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"report": report,
+	})
+}
+
+// importFormat maps the content type of an import request to its format
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/zip", "application/x-zip-compressed":
+		return "zip"
+	case "application/x-ndjson", "application/json":
+		return "ndjson"
+	case "text/markdown", "text/plain":
+		return "markdown"
+	}
+	return ""
+}
+
+// importNote stores one record following the duplicate title policy
+func importNote(ctx context.Context, tx repository.Store, userID string, record importRecord, onDuplicate string) ImportItem {
+	item := ImportItem{Source: record.source, Title: record.note.Title}
+	failed := func(message string) ImportItem {
+		item.Status = "failed"
+		item.Message = message
+		return item
+	}
+	// store errors are logged and hidden, like in the problems of the other routes
+	failedInternal := func(err error) ImportItem {
+		logging.FromContext(ctx).Error("import item failed", "source", record.source, "error", err)
+		return failed("An unexpected error occurred")
+	}
+
+	if record.err != nil {
+		return failed(record.err.Error())
+	}
+
+	note := record.note
+	if validationErrors := models.ValidateStruct(&models.CreateNoteSchema{
+		Title:         note.Title,
+		Content:       note.Content,
+		ContentFormat: note.ContentFormat,
+		Category:      note.Category,
+	}); validationErrors != nil {
+		return failed("Invalid note: " + validationErrors[0].Field + " " + validationErrors[0].Message)
+	}
+
+	now := time.Now()
+	if note.ContentFormat == "" {
+		note.ContentFormat = render.FormatPlain
+	}
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = now
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = now
+	}
+	note.ID = ""
+	note.UserID = userID
+
+	existing, err := tx.Notes().FindByTitle(ctx, userID, note.Title)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return failedInternal(err)
+	}
+
+	status := "created"
+	if existing != nil {
+		switch onDuplicate {
+		case onDuplicateSkip:
+			item.Status = "skipped"
+			item.NoteID = existing.ID
+			item.Message = "A note with this title already exists"
+			return item
+		case onDuplicateFail:
+			return failed("A note with this title already exists")
+		case onDuplicateRename:
+			title, err := freeTitle(ctx, tx, userID, note.Title)
+			if err != nil {
+				return failedInternal(err)
+			}
+			note.Title = title
+			item.Title = title
+			status = "renamed"
+		case onDuplicateOverwrite:
+			before := *existing
+			existing.Content = note.Content
+			existing.ContentFormat = note.ContentFormat
+			existing.Category = note.Category
+			existing.Published = note.Published
+			existing.Tags = note.Tags
+			existing.UpdatedAt = now
+			if err := tx.Notes().Update(ctx, existing); err != nil {
+				return failedInternal(err)
+			}
+			if err := events.Record(ctx, tx, events.NoteEvents(&before, existing)...); err != nil {
+				return failedInternal(err)
+			}
+			item.Status = "overwritten"
+			item.NoteID = existing.ID
+			return item
+		}
+	}
+
+	if err := tx.Notes().Create(ctx, &note); err != nil {
+		var conflict *repository.ConflictError
+		if errors.As(err, &conflict) {
+			return failed("A note with this title already exists")
+		}
+		return failedInternal(err)
+	}
+	if err := events.Record(ctx, tx, events.NoteEvents(nil, &note)...); err != nil {
+		return failedInternal(err)
+	}
+
+	item.Status = status
+	item.NoteID = note.ID
+	return item
+}
+
+// freeTitle appends a counter to title until no note of the user uses it
+func freeTitle(ctx context.Context, tx repository.Store, userID, title string) (string, error) {
+	for i := 2; i < 1000; i++ {
+		candidate := fmt.Sprintf("%s (%d)", title, i)
+		_, err := tx.Notes().FindByTitle(ctx, userID, candidate)
+		if errors.Is(err, repository.ErrNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free title found for %q", title)
+}
+
+// readZipImport reads every markdown file of a zip archive
+func readZipImport(body io.Reader) ([]importRecord, error) {
+	// zip needs random access, spool the upload to a temporary file
+	tmp, err := os.CreateTemp("", "notes-import-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, invalidImport("invalid zip archive: %v", err)
+	}
+
+	var records []importRecord
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".md") {
+			continue
+		}
+		if len(records) == maxImportNotes {
+			return nil, invalidImport("an import can hold at most %d notes", maxImportNotes)
+		}
+
+		record := importRecord{source: file.Name}
+		data, err := readZipFile(file)
+		if err != nil {
+			record.err = err
+		} else {
+			record.note, record.err = parseMarkdownNote(file.Name, data)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// readZipFile reads a file of an archive without trusting its declared size
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxImportNoteSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportNoteSize {
+		return nil, errors.New("note exceeds the maximum size of 4 MB")
+	}
+	return data, nil
+}
+
+// readNDJSONImport reads one note per line
+func readNDJSONImport(body io.Reader) ([]importRecord, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportNoteSize)
+
+	var records []importRecord
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(records) == maxImportNotes {
+			return nil, invalidImport("an import can hold at most %d notes", maxImportNotes)
+		}
+
+		record := importRecord{source: fmt.Sprintf("line %d", line)}
+		if err := json.Unmarshal([]byte(text), &record.note); err != nil {
+			record.err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, invalidImport("line %d exceeds the maximum size of 4 MB", line+1)
+		}
+		return nil, err
+	}
+	return records, nil
+}
+
+// readMarkdownImport reads a single markdown document
+func readMarkdownImport(body io.Reader) ([]importRecord, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	record := importRecord{source: "body"}
+	record.note, record.err = parseMarkdownNote("", data)
+	return []importRecord{record}, nil
+}
+
+// parseMarkdownNote turns a markdown document with front matter into a note,
+// the file name is used as title when the front matter has none
+func parseMarkdownNote(name string, data []byte) (models.Note, error) {
+	var meta noteFrontMatter
+	content, err := utils.SplitFrontMatter(data, &meta)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	if meta.Title == "" && name != "" {
+		meta.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	if meta.ContentFormat == "" {
+		meta.ContentFormat = render.FormatMarkdown
+	}
+
+	return models.Note{
+		Title:         meta.Title,
+		Content:       strings.TrimRight(content, "\n"),
+		ContentFormat: meta.ContentFormat,
+		Category:      meta.Category,
+		Published:     meta.Published,
+		Tags:          pq.StringArray(meta.Tags),
+		CreatedAt:     meta.CreatedAt,
+		UpdatedAt:     meta.UpdatedAt,
+	}, nil
+}
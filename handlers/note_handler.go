@@ -1,72 +1,70 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
-	"example/rest-api/db"
+	"example/rest-api/config"
+	"example/rest-api/events"
+	"example/rest-api/metrics"
+	"example/rest-api/middleware"
 	"example/rest-api/models"
-
-	"gorm.io/gorm"
+	"example/rest-api/problem"
+	"example/rest-api/render"
+	"example/rest-api/repository"
+	"example/rest-api/storage"
 )
 
+// NoteHandler serves the note, attachment, bulk and import/export routes
+type NoteHandler struct {
+	store repository.Store
+	blobs storage.BlobStore
+	// attachments holds the size and type limits of uploads
+	attachments config.AttachmentConfig
+	metrics     *metrics.Metrics
+	// renderCache keeps the html of rendered notes until they are updated
+	renderCache *render.Cache
+}
+
+func NewNoteHandler(store repository.Store, blobs storage.BlobStore, attachments config.AttachmentConfig, m *metrics.Metrics) *NoteHandler {
+	return &NoteHandler{
+		store:       store,
+		blobs:       blobs,
+		attachments: attachments,
+		metrics:     m,
+		renderCache: render.NewCache(1000),
+	}
+}
+
 // ! CREATE
-func CreateNoteHandler(w http.ResponseWriter, r *http.Request) {
+func (h *NoteHandler) CreateNoteHandler(w http.ResponseWriter, r *http.Request) {
 	var payload models.CreateNoteSchema
 
 	// Decode JSON request body
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "fail",
-			"message": err.Error(),
-		})
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 	// validate payload struct
-	errors := models.ValidateStruct(&payload)
-	if errors != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(errors)
+	validationErrors := models.ValidateStruct(&payload)
+	if validationErrors != nil {
+		problem.Write(w, r, problem.Validation(validationErrors))
 		return
 	}
 
-	now := time.Now()
-	newNote := models.Note{
-		Title:     payload.Title,
-		Content:   payload.Content,
-		Category:  payload.Category,
-		Published: payload.Published,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-
-	// save new note
-	result := db.DB.Create(&newNote)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "UNIQUE constraint field") {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":  "fail",
-				"message": "Title already exists!",
-			})
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadGateway)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "error",
-			"message": result.Error.Error(),
-		})
+	newNote, err := h.createNote(r.Context(), middleware.UserID(r.Context()), &payload)
+	if err != nil {
+		writeStoreError(w, r, err, noteNotFound)
 		return
 	}
 
+	h.metrics.NotesCreated("api", 1)
+
 	//Return success
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -79,7 +77,7 @@ func CreateNoteHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // ! GET ALL
-func FindNotes(w http.ResponseWriter, r *http.Request) {
+func (h *NoteHandler) FindNotes(w http.ResponseWriter, r *http.Request) {
 	page := r.URL.Query().Get("page")
 	limit := r.URL.Query().Get("limit")
 
@@ -92,20 +90,20 @@ func FindNotes(w http.ResponseWriter, r *http.Request) {
 
 	intPage, err := strconv.Atoi(page)
 	if err != nil {
-		http.Error(w, "Invalid page parameter", http.StatusBadRequest)
+		problem.Write(w, r, problem.InvalidParameter("page", "must be a number"))
 		return
 	}
 	intLimit, err := strconv.Atoi(limit)
 	if err != nil {
-		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		problem.Write(w, r, problem.InvalidParameter("limit", "must be a number"))
 		return
 	}
 	offset := (intPage - 1) * intLimit
 
-	var notes []models.Note
-	results := db.DB.Limit(intLimit).Offset(offset).Find(&notes)
-	if results.Error != nil {
-		http.Error(w, results.Error.Error(), http.StatusBadGateway)
+	filter := repository.NoteFilter{VisibleTo: middleware.UserID(r.Context())}
+	notes, err := h.store.Notes().List(r.Context(), filter, intLimit, offset)
+	if err != nil {
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -120,64 +118,53 @@ func FindNotes(w http.ResponseWriter, r *http.Request) {
 }
 
 // ! GET ONE
-func FindNoteById(w http.ResponseWriter, r *http.Request) {
+func (h *NoteHandler) FindNoteById(w http.ResponseWriter, r *http.Request) {
 	noteID := r.PathValue("noteId")
 
-	var note models.Note
-	result := db.DB.First(&note, "id = ?", noteID)
-	if err := result.Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusNotFound)
-			response := map[string]interface{}{
-				"status":  "fail",
-				"message": "No note with that ID exists",
+	note, err := findVisibleNote(r.Context(), h.store, noteID)
+	if err != nil {
+		writeStoreError(w, r, err, noteNotFound)
+		return
+	}
+
+	data := map[string]interface{}{
+		"note": note,
+	}
+
+	// render the note content to sanitized html when asked for
+	if r.URL.Query().Get("render") == "html" {
+		rendered, ok := h.renderCache.Get(note.ID, note.UpdatedAt)
+		if !ok {
+			rendered, err = render.Render(note.Content, note.ContentFormat)
+			if err != nil {
+				problem.Error(w, r, fmt.Errorf("render note: %w", err))
+				return
 			}
-			json.NewEncoder(w).Encode(response)
-			return
+			h.renderCache.Set(note.ID, note.UpdatedAt, rendered)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadGateway)
-		response := map[string]interface{}{
-			"status":  "fail",
-			"message": err.Error(),
-		}
-		json.NewEncoder(w).Encode(response)
-		return
+		data["rendered"] = rendered
 	}
 
 	response := map[string]interface{}{
 		"status": "success",
-		"data": map[string]interface{}{
-			"note": note,
-		},
+		"data":   data,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func SearchNote(w http.ResponseWriter, r *http.Request) {
-	title := r.URL.Query().Get("title")
-	content := r.URL.Query().Get("content")
-	category := r.URL.Query().Get("category")
-
-	var notes []models.Note
-	query := db.DB.Model(&models.Note{})
-	if title != "" {
-		query = query.Where("title ILIKE ?", "%"+title+"%")
-	}
-
-	if content != "" {
-		query = query.Where("content ILIKE ?", "%"+content+"%")
+func (h *NoteHandler) SearchNote(w http.ResponseWriter, r *http.Request) {
+	filter := repository.NoteFilter{
+		Title:     r.URL.Query().Get("title"),
+		Content:   r.URL.Query().Get("content"),
+		Category:  r.URL.Query().Get("category"),
+		VisibleTo: middleware.UserID(r.Context()),
 	}
 
-	if category != "" {
-		query = query.Where("category ILIKE ?", "%"+category+"%")
-	}
-
-	if err := query.Find(&notes).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	notes, err := h.store.Notes().Search(r.Context(), filter)
+	if err != nil {
+		problem.Error(w, r, err)
 		return
 	}
 
@@ -187,49 +174,26 @@ func SearchNote(w http.ResponseWriter, r *http.Request) {
 }
 
 // ! PUT
-func UpdateNote(w http.ResponseWriter, r *http.Request) {
+func (h *NoteHandler) UpdateNote(w http.ResponseWriter, r *http.Request) {
 	noteID := r.PathValue("noteId")
 
 	var payload models.UpdateNoteSchema
 	err := json.NewDecoder(r.Body).Decode(&payload)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, problem.InvalidBody(err))
 		return
 	}
 
-	var note models.Note
-	result := db.DB.First(&note, "id = ?", noteID)
-	if err := result.Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			errorResponse := map[string]interface{}{
-				"status":  "fail",
-				"message": "No note with that ID exists",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(errorResponse)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusBadGateway)
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		problem.Write(w, r, problem.Validation(validationErrors))
 		return
 	}
 
-	updates := make(map[string]interface{})
-	if payload.Title != "" {
-		updates["title"] = payload.Title
-	}
-	if payload.Category != "" {
-		updates["category"] = payload.Category
-	}
-	if payload.Content != "" {
-		updates["content"] = payload.Content
-	}
-	if payload.Published != nil {
-		updates["published"] = payload.Published
+	note, err := h.updateNote(r.Context(), noteID, &payload)
+	if err != nil {
+		writeStoreError(w, r, err, noteNotFound)
+		return
 	}
-	updates["updated_at"] = time.Now()
-
-	db.DB.Model(&note).Updates(updates)
 
 	response := map[string]interface{}{
 		"status": "success",
@@ -243,28 +207,11 @@ func UpdateNote(w http.ResponseWriter, r *http.Request) {
 }
 
 // ! DELETE
-func DeleteNote(w http.ResponseWriter, r *http.Request) {
+func (h *NoteHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
 	noteID := r.PathValue("noteId")
 
-	result := db.DB.Delete(&models.Note{}, "id = ?", noteID)
-
-	if result.RowsAffected == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		response := map[string]interface{}{
-			"status":  "fail",
-			"message": "No note with that ID exists",
-		}
-		json.NewEncoder(w).Encode(response)
-		return
-	} else if result.Error != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadGateway)
-		response := map[string]interface{}{
-			"status":  "error",
-			"message": result.Error.Error(),
-		}
-		json.NewEncoder(w).Encode(response)
+	if err := h.deleteNote(r.Context(), noteID); err != nil {
+		writeStoreError(w, r, err, noteNotFound)
 		return
 	}
 
@@ -276,3 +223,191 @@ func DeleteNote(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+// createNote saves a new note of the user along with its events, the payload is already validated
+func (h *NoteHandler) createNote(ctx context.Context, userID string, payload *models.CreateNoteSchema) (*models.Note, error) {
+	var note *models.Note
+	err := h.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		note, err = createNoteIn(ctx, tx, userID, payload)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// updateNote applies a validated payload to a note of the user and saves it along with its events
+func (h *NoteHandler) updateNote(ctx context.Context, id string, payload *models.UpdateNoteSchema) (*models.Note, error) {
+	var note *models.Note
+	err := h.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		note, err = updateNoteIn(ctx, tx, id, func(note *models.Note) { applyNoteUpdates(note, payload) })
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.renderCache.Invalidate(note.ID)
+	return note, nil
+}
+
+// deleteNote deletes a note of the user along with its attachments and their blobs
+func (h *NoteHandler) deleteNote(ctx context.Context, id string) error {
+	var blobKeys []string
+	err := h.store.Transaction(ctx, func(tx repository.Store) error {
+		var err error
+		blobKeys, err = deleteNoteIn(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	h.renderCache.Invalidate(id)
+	h.deleteBlobs(ctx, blobKeys)
+	return nil
+}
+
+// createNoteIn saves a new note of the user in tx along with its events, the payload is already validated
+func createNoteIn(ctx context.Context, tx repository.Store, userID string, payload *models.CreateNoteSchema) (*models.Note, error) {
+	if payload.ContentFormat == "" {
+		payload.ContentFormat = render.FormatPlain
+	}
+
+	now := time.Now()
+	note := &models.Note{
+		UserID:        userID,
+		Title:         payload.Title,
+		Content:       payload.Content,
+		ContentFormat: payload.ContentFormat,
+		Category:      payload.Category,
+		Published:     payload.Published,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := tx.Notes().Create(ctx, note); err != nil {
+		return nil, err
+	}
+	if err := events.Record(ctx, tx, events.NoteEvents(nil, note)...); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// updateNoteIn locks a note of the user in tx, applies change to it and saves it along with its events
+func updateNoteIn(ctx context.Context, tx repository.Store, id string, change func(note *models.Note)) (*models.Note, error) {
+	note, err := findOwnNote(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *note
+	change(note)
+	note.UpdatedAt = time.Now()
+	if err := tx.Notes().Update(ctx, note); err != nil {
+		return nil, err
+	}
+	if err := events.Record(ctx, tx, events.NoteEvents(&before, note)...); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// deleteNoteIn deletes a note of the user in tx along with its attachments, it returns the keys of their blobs
+// to remove once tx is committed
+func deleteNoteIn(ctx context.Context, tx repository.Store, id string) ([]string, error) {
+	note, err := findOwnNote(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	// the attachments go first, the foreign key would delete their rows along with the note
+	blobKeys, err := tx.Attachments().DeleteByNote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Notes().Delete(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := events.Record(ctx, tx, events.NoteEvents(note, nil)...); err != nil {
+		return nil, err
+	}
+	return blobKeys, nil
+}
+
+// applyNoteUpdates copies the fields set in the payload to the note
+func applyNoteUpdates(note *models.Note, payload *models.UpdateNoteSchema) {
+	if payload.Title != "" {
+		note.Title = payload.Title
+	}
+	if payload.Category != "" {
+		note.Category = payload.Category
+	}
+	if payload.Content != "" {
+		note.Content = payload.Content
+	}
+	if payload.ContentFormat != "" {
+		note.ContentFormat = payload.ContentFormat
+	}
+	if payload.Published != nil {
+		note.Published = *payload.Published
+	}
+}
+
+// noteNotFound is the detail of the 404 of a missing note
+const noteNotFound = "No note with that ID exists"
+
+// canSeeNote reports whether a user sees a note, their own ones and the published ones
+func canSeeNote(note *models.Note, userID string) bool {
+	return note.UserID == userID || note.Published
+}
+
+// findVisibleNote returns a note the user of ctx sees, the other notes are not found
+func findVisibleNote(ctx context.Context, store repository.Store, id string) (*models.Note, error) {
+	note, err := store.Notes().FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canSeeNote(note, middleware.UserID(ctx)) {
+		return nil, repository.ErrNotFound
+	}
+	return note, nil
+}
+
+// findOwnNote returns a note of the user of ctx to change it, locked until the transaction ends. The notes of
+// other users are not found even when published.
+func findOwnNote(ctx context.Context, store repository.Store, id string) (*models.Note, error) {
+	note, err := store.Notes().FindByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if note.UserID != middleware.UserID(ctx) {
+		return nil, repository.ErrNotFound
+	}
+	return note, nil
+}
+
+// writeStoreError answers a repository error with its problem, notFound is the detail of a 404
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	if p := storeProblem(err, notFound); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	problem.Error(w, r, err)
+}
+
+// storeProblem is the problem of a missing row or of a unique violation, nil for the unexpected errors
+func storeProblem(err error, notFound string) *problem.Problem {
+	var conflict *repository.ConflictError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return problem.New(http.StatusNotFound, notFound)
+	case errors.As(err, &conflict):
+		detail := "A note with this title already exists"
+		if conflict.Field != "title" {
+			detail = "Resource already exists"
+		}
+		return problem.Conflict(conflict.Field, detail)
+	}
+	return nil
+}
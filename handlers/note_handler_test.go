@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+	"example/rest-api/storage"
+)
+
+func newTestNoteHandler(t *testing.T) *NoteHandler {
+	t.Helper()
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	return NewNoteHandler(repository.NewMemoryStore(), blobs, config.Default().Attachments, nil)
+}
+
+// serve calls a handler the way the router does, with path values and an authenticated user
+func serve(handler http.HandlerFunc, method, target string, body interface{}, pathValues map[string]string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+
+	r := httptest.NewRequest(method, target, &buf)
+	r = r.WithContext(middleware.WithUserID(r.Context(), "user-1"))
+	for name, value := range pathValues {
+		r.SetPathValue(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func decodeNote(t *testing.T, w *httptest.ResponseRecorder) models.Note {
+	t.Helper()
+
+	var response struct {
+		Data struct {
+			Note models.Note `json:"note"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return response.Data.Note
+}
+
+func TestCreateNoteHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload interface{}
+		want    int
+	}{
+		{"valid", models.CreateNoteSchema{Title: "Groceries", Content: "Milk"}, http.StatusCreated},
+		{"markdown", models.CreateNoteSchema{Title: "Readme", Content: "# Hi", ContentFormat: "markdown"}, http.StatusCreated},
+		{"missing content", models.CreateNoteSchema{Title: "Empty"}, http.StatusBadRequest},
+		{"unknown format", models.CreateNoteSchema{Title: "Odd", Content: "x", ContentFormat: "rtf"}, http.StatusBadRequest},
+		{"invalid json", "not a note", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestNoteHandler(t)
+			w := serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/", tt.payload, nil)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestCreateNoteHandlerDuplicateTitle(t *testing.T) {
+	h := newTestNoteHandler(t)
+	payload := models.CreateNoteSchema{Title: "Groceries", Content: "Milk"}
+
+	serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/", payload, nil)
+	w := serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/", payload, nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body)
+	}
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["field"] != "title" {
+		t.Errorf("expected the conflicting field to be title, got %v", response["field"])
+	}
+}
+
+// pausingStore holds the first request reading a note until resume is closed, read is closed once it did
+type pausingStore struct {
+	repository.Store
+	once   *sync.Once
+	read   chan struct{}
+	resume chan struct{}
+}
+
+func (s pausingStore) Notes() repository.NoteRepository {
+	return pausingNotes{s.Store.Notes(), s}
+}
+
+func (s pausingStore) Transaction(ctx context.Context, fn func(tx repository.Store) error) error {
+	return s.Store.Transaction(ctx, func(tx repository.Store) error {
+		return fn(pausingStore{tx, s.once, s.read, s.resume})
+	})
+}
+
+type pausingNotes struct {
+	repository.NoteRepository
+	store pausingStore
+}
+
+func (n pausingNotes) pause() {
+	n.store.once.Do(func() {
+		close(n.store.read)
+		<-n.store.resume
+	})
+}
+
+func (n pausingNotes) FindByID(ctx context.Context, id string) (*models.Note, error) {
+	defer n.pause()
+	return n.NoteRepository.FindByID(ctx, id)
+}
+
+func (n pausingNotes) FindByIDForUpdate(ctx context.Context, id string) (*models.Note, error) {
+	defer n.pause()
+	return n.NoteRepository.FindByIDForUpdate(ctx, id)
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	h := newTestNoteHandler(t)
+	created := decodeNote(t, serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/", models.CreateNoteSchema{Title: "Groceries", Content: "Milk"}, nil))
+	path := map[string]string{"noteId": created.ID}
+	store := pausingStore{h.store, &sync.Once{}, make(chan struct{}), make(chan struct{})}
+	h.store = store
+
+	// the first PATCH is held once it read the note, while the second one is sent
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	patch := func(i int, payload models.UpdateNoteSchema) {
+		defer wg.Done()
+		codes[i] = serve(h.UpdateNote, http.MethodPatch, "/api/notes/"+created.ID, payload, path).Code
+	}
+	wg.Add(2)
+	go patch(0, models.UpdateNoteSchema{Title: "Weekly groceries"})
+	<-store.read
+	go patch(1, models.UpdateNoteSchema{Content: "Milk and eggs"})
+	time.Sleep(50 * time.Millisecond)
+	close(store.resume)
+	wg.Wait()
+
+	note := decodeNote(t, serve(h.FindNoteById, http.MethodGet, "/api/notes/"+created.ID, nil, path))
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Fatalf("expected both updates to succeed, got %v", codes)
+	}
+	if note.Title != "Weekly groceries" || note.Content != "Milk and eggs" {
+		t.Errorf("expected both updates to be kept, got %q %q", note.Title, note.Content)
+	}
+}
+
+// deletingStore deletes a note before every transaction, like a request deleting it concurrently
+type deletingStore struct {
+	repository.Store
+	noteID string
+}
+
+func (s deletingStore) Transaction(ctx context.Context, fn func(tx repository.Store) error) error {
+	s.Store.Notes().Delete(ctx, s.noteID)
+	return s.Store.Transaction(ctx, fn)
+}
+
+func TestUploadAttachmentDeletedNote(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := storage.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	h := NewNoteHandler(repository.NewMemoryStore(), blobs, config.Default().Attachments, nil)
+	created := decodeNote(t, serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/", models.CreateNoteSchema{Title: "Groceries", Content: "Milk"}, nil))
+	h.store = deletingStore{h.store, created.ID}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("Milk and eggs"))
+	form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/notes/"+created.ID+"/attachments", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r = r.WithContext(middleware.WithUserID(r.Context(), "user-1"))
+	r.SetPathValue("noteId", created.ID)
+	w := httptest.NewRecorder()
+	h.UploadAttachment(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 once the note is gone, got %d: %s", w.Code, w.Body)
+	}
+	// the blob stored before the note was found gone is removed
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			t.Errorf("expected the blob to be deleted, found %s", path)
+		}
+		return nil
+	})
+}
+
+func TestNoteLifecycle(t *testing.T) {
+	h := newTestNoteHandler(t)
+
+	created := decodeNote(t, serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/",
+		models.CreateNoteSchema{Title: "Readme", Content: "# Intro\n\n<script>alert(1)</script>", ContentFormat: "markdown"}, nil))
+	path := map[string]string{"noteId": created.ID}
+
+	w := serve(h.FindNoteById, http.MethodGet, "/api/notes/"+created.ID+"?render=html", nil, path)
+	if w.Code != http.StatusOK {
+		t.Fatalf("find: expected 200, got %d", w.Code)
+	}
+	if body := w.Body.String(); !bytes.Contains([]byte(body), []byte(`id=\"intro\"`)) || bytes.Contains([]byte(body), []byte("<script>")) {
+		t.Errorf("unexpected rendered note: %s", body)
+	}
+
+	published := true
+	w = serve(h.UpdateNote, http.MethodPatch, "/api/notes/"+created.ID, models.UpdateNoteSchema{Content: "# Changed", Published: &published}, path)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d", w.Code)
+	}
+	if updated := decodeNote(t, w); updated.Content != "# Changed" || !updated.Published {
+		t.Errorf("update was not applied: %+v", updated)
+	}
+
+	// the rendered html must follow the update
+	w = serve(h.FindNoteById, http.MethodGet, "/api/notes/"+created.ID+"?render=html", nil, path)
+	if !bytes.Contains(w.Body.Bytes(), []byte(`id=\"changed\"`)) {
+		t.Errorf("rendered note is stale: %s", w.Body)
+	}
+
+	if w := serve(h.DeleteNote, http.MethodDelete, "/api/notes/"+created.ID, nil, path); w.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", w.Code)
+	}
+	if w := serve(h.FindNoteById, http.MethodGet, "/api/notes/"+created.ID, nil, path); w.Code != http.StatusNotFound {
+		t.Fatalf("find deleted: expected 404, got %d", w.Code)
+	}
+	if w := serve(h.DeleteNote, http.MethodDelete, "/api/notes/"+created.ID, nil, path); w.Code != http.StatusNotFound {
+		t.Fatalf("delete again: expected 404, got %d", w.Code)
+	}
+}
+
+func TestBulkNotesModes(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		wantStatus int
+		wantNotes  int
+	}{
+		{"atomic rolls back everything", "atomic", http.StatusUnprocessableEntity, 1},
+		{"best effort keeps the successes", "best_effort", http.StatusMultiStatus, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestNoteHandler(t)
+			existing := decodeNote(t, serve(h.CreateNoteHandler, http.MethodPost, "/api/notes/",
+				models.CreateNoteSchema{Title: "Existing", Content: "x"}, nil))
+
+			payload := map[string]interface{}{
+				"mode": tt.mode,
+				"operations": []map[string]interface{}{
+					{"op": "create", "data": map[string]interface{}{"title": "New", "content": "y"}},
+					{"op": "tag", "ids": []string{existing.ID}, "tags": []string{"home"}},
+					{"op": "delete", "ids": []string{"missing"}},
+				},
+			}
+			w := serve(h.BulkNotes, http.MethodPost, "/api/notes/bulk", payload, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+
+			var response struct {
+				Results []BulkResult `json:"results"`
+			}
+			json.NewDecoder(w.Body).Decode(&response)
+			if len(response.Results) != 3 || response.Results[2].Status != http.StatusNotFound {
+				t.Errorf("unexpected results: %+v", response.Results)
+			}
+
+			notes, _ := h.store.Notes().List(context.Background(), repository.NoteFilter{}, 10, 0)
+			if len(notes) != tt.wantNotes {
+				t.Errorf("expected %d notes, got %d", tt.wantNotes, len(notes))
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/events"
+	"example/rest-api/logging"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+)
+
+// streamBuffer is how many events a stream can lag behind before it is closed, the client resumes it
+const streamBuffer = 64
+
+// StreamHandler serves the Server-Sent Events stream of the note changes
+type StreamHandler struct {
+	bus       *events.Bus
+	heartbeat time.Duration
+}
+
+func NewStreamHandler(bus *events.Bus, cfg config.StreamConfig) *StreamHandler {
+	return &StreamHandler{bus: bus, heartbeat: cfg.Heartbeat}
+}
+
+// noteVisible reports whether a user sees the note of an event, the ones of the user and the published ones
+func noteVisible(event events.Event, userID string) bool {
+	switch event.Type {
+	case models.EventNoteCreated, models.EventNoteUpdated, models.EventNoteDeleted:
+	default:
+		return false
+	}
+	if event.UserID == userID {
+		return true
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return false
+	}
+	var payload struct {
+		Note models.Note `json:"note"`
+	}
+	return json.Unmarshal(data, &payload) == nil && payload.Note.Published
+}
+
+// writeEvent writes an event in the text/event-stream format, its id is the sequence Last-Event-ID resumes from
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+	return err
+}
+
+// ! STREAM
+// StreamNoteEvents streams the changes to the notes the user sees until the client goes away
+func (h *StreamHandler) StreamNoteEvents(w http.ResponseWriter, r *http.Request) {
+	var lastID int64
+	if raw := r.Header.Get("Last-Event-ID"); raw != "" {
+		var err error
+		if lastID, err = strconv.ParseInt(raw, 10, 64); err != nil || lastID < 0 {
+			problem.Write(w, r, problem.InvalidParameter("Last-Event-ID", "must be the id of an event of the stream"))
+			return
+		}
+	}
+
+	// the stream outlives the write timeout of the server
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		problem.Error(w, r, err)
+		return
+	}
+
+	sub := h.bus.Subscribe(lastID, streamBuffer)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keep nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	logger := logging.FromContext(r.Context())
+	userID := middleware.UserID(r.Context())
+	send := func(event events.Event) bool {
+		if !noteVisible(event, userID) {
+			return true
+		}
+		if err := writeEvent(w, event); err != nil {
+			logger.Debug("event stream closed", "error", err)
+			return false
+		}
+		return true
+	}
+
+	if sub.Gap {
+		// some changes are lost to the client, it reloads the notes
+		io.WriteString(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range sub.Missed {
+		if !send(event) {
+			return
+		}
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// lagging behind or shutting down, the client resumes from the last event it got
+				return
+			}
+			if !send(event) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
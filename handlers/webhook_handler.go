@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+	"example/rest-api/webhooks"
+
+	"github.com/lib/pq"
+)
+
+// the page size of the delivery log
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 100
+)
+
+// webhookNotFound is the detail of the 404 of a missing webhook, or of one owned by someone else
+const webhookNotFound = "No webhook with that ID exists"
+
+// WebhookHandler serves the webhook subscription and delivery log routes
+type WebhookHandler struct {
+	store repository.Store
+}
+
+func NewWebhookHandler(store repository.Store) *WebhookHandler {
+	return &WebhookHandler{store: store}
+}
+
+// isAdmin reports whether the authenticated user manages the system-wide webhooks
+func isAdmin(r *http.Request) bool {
+	return middleware.Role(r.Context()) == models.RoleAdmin
+}
+
+// findWebhookOr404 loads the webhook from the path when the user may see it and writes the error response otherwise
+func (h *WebhookHandler) findWebhookOr404(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	webhook, err := h.store.Webhooks().FindByID(r.Context(), r.PathValue("webhookId"))
+	if err != nil {
+		writeStoreError(w, r, err, webhookNotFound)
+		return nil, false
+	}
+	owned := webhook.UserID == middleware.UserID(r.Context())
+	if !owned && !(webhook.UserID == "" && isAdmin(r)) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, webhookNotFound))
+		return nil, false
+	}
+	return webhook, true
+}
+
+// invalidURL checks that a webhook URL is absolute http or https
+func invalidURL(raw string) *problem.Problem {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return problem.Validation([]*models.ErrorResponse{{Field: "url", Tag: "url", Message: "must be an http or https URL"}})
+	}
+	return nil
+}
+
+// ! CREATE
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload models.CreateWebhookSchema
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		problem.Write(w, r, problem.Validation(validationErrors))
+		return
+	}
+	if p := invalidURL(payload.URL); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	webhook := models.Webhook{
+		UserID: middleware.UserID(r.Context()),
+		URL:    payload.URL,
+		Events: pq.StringArray(payload.Events),
+		Secret: payload.Secret,
+		Active: true,
+	}
+	if payload.SystemWide {
+		if !isAdmin(r) {
+			problem.Write(w, r, problem.New(http.StatusForbidden, "Only the admins can create system-wide webhooks"))
+			return
+		}
+		webhook.UserID = ""
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = webhooks.NewSecret()
+	}
+
+	if err := h.store.Webhooks().Create(r.Context(), &webhook); err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	// the secret is sent back this once
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"webhook": webhook,
+		},
+	})
+}
+
+// ! GET ALL
+func (h *WebhookHandler) FindWebhooks(w http.ResponseWriter, r *http.Request) {
+	list, err := h.store.Webhooks().ListByUser(r.Context(), middleware.UserID(r.Context()))
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if isAdmin(r) {
+		systemWide, err := h.store.Webhooks().ListByUser(r.Context(), "")
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		list = append(list, systemWide...)
+	}
+
+	for i := range list {
+		list[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "success",
+		"results":  len(list),
+		"webhooks": list,
+	})
+}
+
+// ! GET ONE
+func (h *WebhookHandler) FindWebhookById(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.findWebhookOr404(w, r)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"webhook": webhook,
+		},
+	})
+}
+
+// ! PATCH
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload models.UpdateWebhookSchema
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.Write(w, r, problem.InvalidBody(err))
+		return
+	}
+	if validationErrors := models.ValidateStruct(&payload); validationErrors != nil {
+		problem.Write(w, r, problem.Validation(validationErrors))
+		return
+	}
+
+	webhook, ok := h.findWebhookOr404(w, r)
+	if !ok {
+		return
+	}
+
+	if payload.URL != nil {
+		if p := invalidURL(*payload.URL); p != nil {
+			problem.Write(w, r, p)
+			return
+		}
+		webhook.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		webhook.Events = pq.StringArray(payload.Events)
+	}
+	if payload.Active != nil {
+		webhook.Active = *payload.Active
+	}
+
+	if err := h.store.Webhooks().Update(r.Context(), webhook); err != nil {
+		writeStoreError(w, r, err, webhookNotFound)
+		return
+	}
+
+	webhook.Secret = ""
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"webhook": webhook,
+		},
+	})
+}
+
+// ! DELETE
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.findWebhookOr404(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Webhooks().Delete(r.Context(), webhook.ID); err != nil {
+		writeStoreError(w, r, err, webhookNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// ! DELIVERY LOG
+func (h *WebhookHandler) FindDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveryLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 1 || limit > maxDeliveryLimit {
+			problem.Write(w, r, problem.InvalidParameter("limit", "must be a number between 1 and "+strconv.Itoa(maxDeliveryLimit)))
+			return
+		}
+	}
+
+	webhook, ok := h.findWebhookOr404(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.store.WebhookDeliveries().ListByWebhook(r.Context(), webhook.ID, limit)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"results":    len(deliveries),
+		"deliveries": deliveries,
+	})
+}
+
+// ! REDELIVER
+// Redeliver queues the event of a delivery again, as a new delivery sharing its event id
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.findWebhookOr404(w, r)
+	if !ok {
+		return
+	}
+
+	original, err := h.store.WebhookDeliveries().FindByID(r.Context(), webhook.ID, r.PathValue("deliveryId"))
+	if err != nil {
+		writeStoreError(w, r, err, "No delivery with that ID exists")
+		return
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := h.store.WebhookDeliveries().Create(r.Context(), &delivery); err != nil {
+		writeStoreError(w, r, err, webhookNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"delivery": delivery,
+		},
+	})
+}
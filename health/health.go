@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example/rest-api/logging"
+)
+
+// Check is a dependency the service needs to handle requests
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a check as reported by /readyz
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Checker serves the liveness and readiness probes
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// New returns a checker running checks with the given timeout each
+func New(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// Drain makes the service report not ready, so load balancers stop sending it traffic before it shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run runs every check concurrently and reports whether they all passed
+func (c *Checker) Run(ctx context.Context) (map[string]CheckResult, bool) {
+	results := make(map[string]CheckResult, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := c.run(ctx, check)
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Status != "ok" {
+			return results, false
+		}
+	}
+	return results, true
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := CheckResult{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivenessHandler reports that the process is up, it checks no dependency so a database outage does not get it restarted
+func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// ReadinessHandler reports whether the service can handle requests, with the result of every check
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if c.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "draining",
+			"checks": map[string]CheckResult{},
+		})
+		return
+	}
+
+	results, ok := c.Run(r.Context())
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "unavailable", http.StatusServiceUnavailable
+		logging.FromContext(r.Context()).Warn("readiness check failed", "checks", results)
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	// probes must never see a cached answer
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
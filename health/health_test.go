@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	var body readiness
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return rec.Code, body
+}
+
+func TestReadiness(t *testing.T) {
+	ok := Check{Name: "database", Run: func(ctx context.Context) error { return nil }}
+	failing := Check{Name: "migrations", Run: func(ctx context.Context) error { return errors.New("2 pending migrations") }}
+	hanging := Check{Name: "slow", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	code, body := probe(t, New(time.Second, ok).ReadinessHandler)
+	if code != http.StatusOK || body.Status != "ok" || body.Checks["database"].Status != "ok" {
+		t.Errorf("expected ready, got %d %+v", code, body)
+	}
+
+	code, body = probe(t, New(time.Second, ok, failing).ReadinessHandler)
+	if code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+		t.Errorf("expected not ready, got %d %+v", code, body)
+	}
+	if result := body.Checks["migrations"]; result.Status != "failed" || result.Error != "2 pending migrations" {
+		t.Errorf("unexpected migrations result %+v", result)
+	}
+	if body.Checks["database"].Status != "ok" {
+		t.Errorf("the passing check should still be reported ok: %+v", body.Checks)
+	}
+
+	start := time.Now()
+	code, body = probe(t, New(20*time.Millisecond, hanging).ReadinessHandler)
+	if code != http.StatusServiceUnavailable || body.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected the slow check to time out, got %d %+v", code, body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the check timeout was not applied, took %s", elapsed)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	checker := New(time.Second)
+	if code, _ := probe(t, checker.ReadinessHandler); code != http.StatusOK {
+		t.Fatalf("expected ready before draining, got %d", code)
+	}
+
+	checker.Drain()
+	if code, body := probe(t, checker.ReadinessHandler); code != http.StatusServiceUnavailable || body.Status != "draining" {
+		t.Errorf("expected draining, got %d %+v", code, body)
+	}
+	if code, _ := probe(t, checker.LivenessHandler); code != http.StatusOK {
+		t.Errorf("liveness should not depend on draining, got %d", code)
+	}
+}
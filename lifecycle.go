@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/repository"
+
+	"google.golang.org/grpc"
+)
+
+// worker is a background job that runs until its context is cancelled
+type worker func(ctx context.Context)
+
+// newServer returns the http server with the configured timeouts
+func newServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:        handler,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+}
+
+// serverWorker runs a secondary server, like the admin one, until the workers are stopped
+func serverWorker(name string, server *http.Server, listener net.Listener) worker {
+	return func(ctx context.Context) {
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server failed", "server", name, "error", err)
+		}
+	}
+}
+
+// grpcWorker runs the gRPC server until the workers are stopped, letting the calls in flight finish
+func grpcWorker(server *grpc.Server, listener net.Listener) worker {
+	return func(ctx context.Context) {
+		go func() {
+			<-ctx.Done()
+			server.GracefulStop()
+		}()
+		if err := server.Serve(listener); err != nil {
+			slog.Error("Server failed", "server", "grpc", "error", err)
+		}
+	}
+}
+
+// purgeWorker deletes the expired idempotency keys every interval
+func purgeWorker(keys repository.IdempotencyRepository, interval time.Duration) worker {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				deleted, err := keys.DeleteExpired(ctx, now)
+				if err != nil {
+					slog.Error("Failed to purge the expired idempotency keys", "error", err)
+					continue
+				}
+				slog.Debug("Purged the expired idempotency keys", "deleted", deleted)
+			}
+		}
+	}
+}
+
+// drain returns a context cancelled delay after ctx is, onDrain is called as soon as ctx is done.
+// It gives load balancers the time to see the service not ready before it stops accepting connections.
+func drain(ctx context.Context, delay time.Duration, onDrain func()) context.Context {
+	drained, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		<-ctx.Done()
+		onDrain()
+		if delay > 0 {
+			slog.Info("Draining, reporting not ready before shutting down", "delay", delay.String())
+			time.Sleep(delay)
+		}
+	}()
+	return drained
+}
+
+// isAddrInUse reports whether listening failed because the port is taken,
+// 10048 is WSAEADDRINUSE which windows returns instead of EADDRINUSE
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.Errno(10048))
+}
+
+// serve runs the server and the workers until ctx is cancelled, then stops accepting connections,
+// waits for the in-flight requests and the workers, and gives up after shutdownTimeout
+func serve(ctx context.Context, server *http.Server, listener net.Listener, shutdownTimeout time.Duration, workers ...worker) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			w(workerCtx)
+		}(w)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// the server failed on its own, stop the workers before reporting it
+		stopWorkers()
+		wg.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	stopWorkers()
+
+	// the workers share the shutdown deadline with the requests
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		if err == nil {
+			err = errors.New("background workers did not stop in time")
+		}
+	}
+
+	// Serve returns ErrServerClosed as soon as Shutdown is called
+	<-serveErr
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"example/rest-api/config"
+)
+
+func testListener(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return listener
+}
+
+func TestServeDrainsRequestsOnShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	workerStopped := make(chan struct{})
+	work := func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	}
+
+	listener := testListener(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, newServer(config.Default().Server, handler), listener, 5*time.Second, work)
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responses <- string(body)
+	}()
+
+	// shut down while the request is in flight
+	<-started
+	cancel()
+
+	if body := <-responses; body != "done" {
+		t.Errorf("expected the in-flight request to complete, got %q", body)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+	select {
+	case <-workerStopped:
+	default:
+		t.Error("expected the worker to be stopped")
+	}
+
+	if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+		t.Error("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	listener := testListener(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, newServer(config.Default().Server, handler), listener, 50*time.Millisecond)
+	}()
+
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+	cancel()
+
+	if err := <-served; err != context.DeadlineExceeded {
+		t.Errorf("expected the shutdown to time out, got %v", err)
+	}
+}
+
+func TestIsAddrInUse(t *testing.T) {
+	listener := testListener(t)
+	defer listener.Close()
+
+	_, err := net.Listen("tcp", listener.Addr().String())
+	if err == nil || !isAddrInUse(err) {
+		t.Errorf("expected an address in use error, got %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	serveCtx := drain(ctx, 50*time.Millisecond, func() { close(drained) })
+
+	cancel()
+	start := time.Now()
+	<-drained
+	select {
+	case <-serveCtx.Done():
+		t.Fatal("the server context was cancelled before the drain delay")
+	default:
+	}
+
+	<-serveCtx.Done()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the drain delay to be waited, took %s", elapsed)
+	}
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQuery is the duration above which a query is logged as a warning
+const slowQuery = 200 * time.Millisecond
+
+// GormLogger sends the gorm logs to slog, queries are logged at debug level with the logger of their context.
+// Query parameters are never logged because they carry passwords and note content.
+type GormLogger struct {
+	logger *slog.Logger
+	level  gormlogger.LogLevel
+}
+
+func NewGormLogger(logger *slog.Logger) *GormLogger {
+	return &GormLogger{logger: logger, level: gormlogger.Info}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return &GormLogger{logger: l.logger, level: level}
+}
+
+// from prefers the request logger, so queries carry the request id
+func (l *GormLogger) from(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return l.logger
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.from(ctx).InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.from(ctx).WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.from(ctx).ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	logger := l.from(ctx)
+	attrs := func() []any {
+		sql, rows := fc()
+		return []any{slog.String("sql", sql), slog.Int64("rows", rows), slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000)}
+	}
+
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		logger.ErrorContext(ctx, "query failed", append(attrs(), slog.Any("error", err))...)
+	case elapsed > slowQuery && l.level >= gormlogger.Warn:
+		logger.WarnContext(ctx, "slow query", attrs()...)
+	case l.level >= gormlogger.Info && logger.Enabled(ctx, slog.LevelDebug):
+		logger.DebugContext(ctx, "query", attrs()...)
+	}
+}
+
+// ParamsFilter keeps the placeholders in the logged SQL instead of the values
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the value of attributes whose key looks like a secret
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched against the lowercased attribute keys
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key", "apikey", "access_key"}
+
+// New returns a logger writing records from level on to w, as JSON or, when format is "text", as key=value pairs
+func New(w io.Writer, level slog.Level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	if format == "text" {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+// redact hides the value of attributes carrying credentials
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// IsSensitive reports whether a key names a credential
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the request, or the default logger outside of requests
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// fields are the attributes added to the access log of a request while it is handled
+type fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx collecting the attributes passed to AddFields
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{})
+}
+
+// AddFields adds attributes to the access log of the request, it does nothing outside of requests
+func AddFields(ctx context.Context, attrs ...slog.Attr) {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.attrs = append(f.attrs, attrs...)
+		f.mu.Unlock()
+	}
+}
+
+// Fields returns the attributes added to the request so far
+func Fields(ctx context.Context) []slog.Attr {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr(nil), f.attrs...)
+}
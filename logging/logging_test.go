@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, "json")
+
+	logger.Info("login", "password", "hunter22", "Authorization", "Bearer abc", "jwt_token", "abc", "user_id", "42",
+		slog.Group("s3", slog.String("secret_key", "minio")))
+
+	record := decodeRecords(t, &buf)[0]
+	for _, key := range []string{"password", "Authorization", "jwt_token"} {
+		if record[key] != Redacted {
+			t.Errorf("expected %s to be redacted, got %v", key, record[key])
+		}
+	}
+	if group, _ := record["s3"].(map[string]interface{}); group["secret_key"] != Redacted {
+		t.Errorf("expected the grouped secret to be redacted, got %v", record["s3"])
+	}
+	if record["user_id"] != "42" {
+		t.Errorf("expected user_id to be kept, got %v", record["user_id"])
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn, "json")
+	logger.Info("dropped")
+	logger.Warn("kept")
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 1 || records[0]["msg"] != "kept" {
+		t.Errorf("expected only the warning, got %v", records)
+	}
+}
+
+func TestContextLoggerAndFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, "json").With("request_id", "abc")
+
+	ctx := WithFields(WithLogger(context.Background(), logger))
+	AddFields(ctx, slog.String("user_id", "42"))
+	FromContext(ctx).Info("hello")
+
+	if records := decodeRecords(t, &buf); records[0]["request_id"] != "abc" {
+		t.Errorf("expected the context logger, got %v", records[0])
+	}
+	if fields := Fields(ctx); len(fields) != 1 || fields[0].Value.String() != "42" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	// outside of a request there is nothing to collect
+	AddFields(context.Background(), slog.String("user_id", "42"))
+	if Fields(context.Background()) != nil {
+		t.Error("expected no fields without WithFields")
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	var buf bytes.Buffer
+	base := New(&buf, slog.LevelDebug, "json")
+	gormLog := NewGormLogger(base)
+
+	ctx := WithLogger(context.Background(), base.With("request_id", "abc"))
+	sql, params := gormLog.ParamsFilter(ctx, "INSERT INTO users (password) VALUES ($1)", "$2a$10$hash")
+	if params != nil || strings.Contains(sql, "hash") {
+		t.Fatalf("expected the parameters to be dropped, got %q %v", sql, params)
+	}
+	gormLog.Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, nil)
+
+	record := decodeRecords(t, &buf)[0]
+	if record["msg"] != "query" || record["request_id"] != "abc" || record["sql"] != sql {
+		t.Errorf("unexpected query log %v", record)
+	}
+
+	buf.Reset()
+	gormLog.LogMode(gormlogger.Silent).Trace(ctx, time.Now(), func() (string, int64) { return sql, 1 }, nil)
+	if buf.Len() != 0 {
+		t.Errorf("expected the silent logger to drop queries, got %s", buf.String())
+	}
+}
@@ -1,86 +1,337 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"example/rest-api/collab"
+	"example/rest-api/config"
 	"example/rest-api/db"
+	"example/rest-api/events"
 	"example/rest-api/handlers"
+	"example/rest-api/health"
+	"example/rest-api/logging"
+	"example/rest-api/metrics"
 	"example/rest-api/middleware"
-	"log"
+	"example/rest-api/openapi"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+	"example/rest-api/storage"
+	"example/rest-api/tracing"
+	"example/rest-api/webhooks"
+	"flag"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/rs/cors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
-func init() {
+func main() {
+	// log as JSON from the start, the configured level and format apply once the config is loaded
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo, "json"))
+
+	// load the configuration from the environment, the config file and the flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format))
+
 	// init database
-	err := db.ConnectDB()
+	err = db.ConnectDB(cfg.Database)
+	if err != nil {
+		fatal("Failed to connect to database", "error", err)
+	}
+
+	migrator, err := db.NewMigrator(db.DB)
+	if err != nil {
+		fatal("Failed to load migrations", "error", err)
+	}
+
+	// manage the schema when started as "migrate up|down|status"
+	if len(args) > 0 && args[0] == "migrate" {
+		runMigrate(migrator, args[1:])
+		db.Close()
+		return
+	}
+
+	// refuse to serve requests against an outdated schema
+	if err := migrator.CheckMigrations(context.Background()); err != nil {
+		fatal("Refusing to start, run \""+os.Args[0]+" migrate up\" first", "error", err)
+	}
+
+	// init attachment storage
+	blobs, err := storage.NewStore(cfg.Storage)
+	if err != nil {
+		fatal("Failed to set up attachment storage", "error", err)
+	}
+
+	tp, shutdownTracing, err := tracing.NewProvider(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(tracing.Propagator())
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Tracing error", "error", err)
+	}))
+	if err := db.DB.Use(tracing.NewGormPlugin(tp, cfg.Database.Name)); err != nil {
+		fatal("Failed to trace the database queries", "error", err)
+	}
+
+	store := repository.NewGormStore(db.DB)
+
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		m = metrics.New()
+	}
+
+	sqlDB, err := db.DB.DB()
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to get the database connection pool", "error", err)
+	}
+	if m != nil {
+		m.RegisterDB(sqlDB, cfg.Database.Name)
+	}
+	checker := health.New(cfg.Server.HealthCheckTimeout,
+		health.Check{Name: "database", Run: sqlDB.PingContext},
+		health.Check{Name: "migrations", Run: migrator.CheckMigrations},
+	)
+
+	// stop on ctrl-c and on the SIGTERM sent by container runtimes, after reporting not ready for the drain delay
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = drain(ctx, cfg.Server.DrainDelay, checker.Drain)
+
+	listener := listen(cfg.Server.Port)
+	slog.Info("Starting server", "port", cfg.Server.Port)
+
+	// the events written to the outbox are relayed to the webhooks, to the buses of every replica through
+	// LISTEN/NOTIFY and to the NDJSON file
+	bus := events.NewBus(cfg.Stream.ReplaySize)
+	sinks := []events.Sink{webhooks.Sink{}, events.Notifier{}}
+	if cfg.Outbox.File != "" {
+		file, err := events.NewFileSink(cfg.Outbox.File)
+		if err != nil {
+			fatal("Failed to open the outbox file", "error", err)
+		}
+		defer file.Close()
+		sinks = append(sinks, file)
 	}
 
+	// the notes edited collaboratively are saved by the hub, and once more when it stops
+	hub := collab.NewHub(store, cfg.Collab)
+
+	workers := []worker{
+		purgeWorker(store.IdempotencyKeys(), time.Hour),
+		hub.Run,
+		events.NewRelay(store, cfg.Outbox, m, sinks...).Run,
+		events.NewListener(cfg.Database.DSN(), store, bus).Run,
+		webhooks.NewDispatcher(store, cfg.Webhooks, m).Run,
+	}
+	if m != nil && cfg.Metrics.Port != 0 {
+		admin := http.NewServeMux()
+		admin.Handle("GET /metrics", m.Handler())
+		workers = append(workers, serverWorker("admin", newServer(cfg.Server, admin), listen(cfg.Metrics.Port)))
+		slog.Info("Serving metrics on the admin port", "port", cfg.Metrics.Port)
+	}
+
+	s := services{
+		store:   store,
+		notes:   handlers.NewNoteHandler(store, blobs, cfg.Attachments, m),
+		metrics: m,
+		tracer:  tp,
+		health:  checker,
+		bus:     bus,
+		hub:     hub,
+	}
+	if cfg.GRPC.Port != 0 {
+		workers = append(workers, grpcWorker(newGRPCServer(cfg, s), listen(cfg.GRPC.Port)))
+		slog.Info("Serving gRPC", "port", cfg.GRPC.Port)
+	}
+
+	server := newServer(cfg.Server, newRouter(cfg, s))
+	// the event streams never end on their own, they are closed for the shutdown to wait for the other requests
+	server.RegisterOnShutdown(bus.Close)
+	if err := serve(ctx, server, listener, cfg.Server.ShutdownTimeout, workers...); err != nil {
+		slog.Error("Server did not shut down cleanly", "error", err)
+	}
+
+	// export the spans still buffered
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush the spans", "error", err)
+	}
+	cancel()
+
+	// the pool is closed once no request can use it anymore
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close the database connections", "error", err)
+	}
+	slog.Info("Server stopped")
 }
 
-func main() {
+// listen opens the port or exits
+func listen(port int) net.Listener {
+	addr := ":" + strconv.Itoa(port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		// Check if the error is due to the port already being in use
+		if isAddrInUse(err) {
+			fatal("Port is already in use, please choose a different port", "port", port)
+		}
+		fatal("Failed to listen", "addr", addr, "error", err)
+	}
+	return listener
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// services are what the routes are built on
+type services struct {
+	store repository.Store
+	// notes serves the notes over REST, GraphQL and gRPC, which share its render cache
+	notes *handlers.NoteHandler
+	// metrics is nil when metrics are disabled
+	metrics *metrics.Metrics
+	tracer  trace.TracerProvider
+	health  *health.Checker
+	// bus streams the events to the clients
+	bus *events.Bus
+	// hub holds the notes edited collaboratively
+	hub *collab.Hub
+}
+
+// newRouter registers every route and wraps them with the rate limiting, logging, tracing and CORS middlewares
+func newRouter(cfg *config.Config, s services) http.Handler {
+	m := s.metrics
+	authHandler := handlers.NewAuthHandler(s.store, cfg.Auth, m)
+	noteHandler := s.notes
+	webhookHandler := handlers.NewWebhookHandler(s.store)
+	streamHandler := handlers.NewStreamHandler(s.bus, cfg.Stream)
+	collabHandler := handlers.NewCollabHandler(s.store, s.hub, cfg.CORS.AllowedOrigins, cfg.Server.MaxBodySize)
+	graphqlHandler := handlers.NewGraphQLHandler(noteHandler, cfg.GraphQL)
+	auth := middleware.NewAuthenticator(cfg.Auth.JWTSecret, m)
 
 	// create new rate limiter
-	rl := middleware.NewRateLimiter(1, 5) // 1 request per second and a burst size of 5
-	router := http.NewServeMux()
+	rl := middleware.NewRateLimiter(rate.Limit(cfg.RateLimit.RPS), cfg.RateLimit.Burst, m)
 
-	// auth routes
-	router.Handle("POST /api/auth/register", http.HandlerFunc(handlers.RegisterHandler))
-	router.Handle("POST /api/auth/login", http.HandlerFunc(handlers.LoginHandler))
-	router.Handle("POST /api/auth/logout", middleware.AuthMiddleware(http.HandlerFunc(handlers.LogoutHandler)))
+	router := http.NewServeMux()
 
-	// note routes
-	router.Handle("PATCH /api/notes/{noteId}", middleware.AuthMiddleware(http.HandlerFunc(handlers.UpdateNote)))
-	router.Handle("GET /api/notes/{noteId}", middleware.AuthMiddleware(http.HandlerFunc(handlers.FindNoteById)))
-	router.Handle("DELETE /api/notes/{noteId}", middleware.AuthMiddleware(http.HandlerFunc(handlers.DeleteNote)))
-	router.Handle("POST /api/notes/", middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateNoteHandler)))
-	router.Handle("GET /api/notes/", middleware.AuthMiddleware(http.HandlerFunc(handlers.FindNotes)))
-	router.Handle("GET /api/notes/search", middleware.AuthMiddleware(http.HandlerFunc(handlers.SearchNote)))
+	// requests are validated against the document generated from the route table, once authenticated
+	table := routes(authHandler, noteHandler, webhookHandler, streamHandler, collabHandler, graphqlHandler)
+	spec := apiSpec(table)
+	validator := middleware.NewValidator(spec, cfg.Server.MaxBodySize, cfg.Env == config.EnvDevelopment)
+	// idempotent bodies are read up front to fingerprint them, up to the largest limit of the routes
+	idempotency := middleware.NewIdempotency(s.store.IdempotencyKeys(), cfg.Idempotency.TTL,
+		max(cfg.Server.MaxBodySize, cfg.Attachments.MaxSize+1<<20, handlers.MaxImportSize))
+	for _, r := range table {
+		handler := validator.Middleware(r.pattern, r.handler)
+		if r.idempotent {
+			handler = idempotency.Middleware(handler)
+		}
+		if r.auth {
+			handler = auth.AuthMiddleware(handler)
+		}
+		router.Handle(r.pattern, handler)
+	}
 
-	router.HandleFunc("GET /api/healthchecker", HealthCheckHandler)
+	router.Handle("GET "+specPath, spec.Handler())
+	router.Handle("GET "+docsPath, openapi.DocsHandler("Notes API", specPath))
 
 	// Custom CORS configuration
 	corsConfig := cors.New(cors.Options{
-		AllowedHeaders:   []string{"Origin", "Authorization", "Accept", "Content-Type"},
-		AllowedOrigins:   []string{"http://localhost:3000"},
+		AllowedHeaders:   []string{"Origin", "Authorization", "Accept", "Content-Type", "Last-Event-ID", middleware.RequestIDHeader, middleware.IdempotencyKeyHeader},
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE"},
+		ExposedHeaders:   []string{middleware.RequestIDHeader, middleware.IdempotentReplayedHeader},
 		AllowCredentials: true,
 	})
 
 	// Wrap the router with the rate limiting middleware
-	rateLimitedRouter := rl.RateLimiterMiddleware(router)
-
-	// Wrap the rate limited router with the logRequests middleware
-	loggedRouter := logRequests(rateLimitedRouter)
+	rateLimitedRouter := rl.RateLimiterMiddleware(unmatchedProblems(router))
 
 	// Create a new CORS handler
-	corsHandler := corsConfig.Handler(loggedRouter)
+	corsRouter := corsConfig.Handler(rateLimitedRouter)
 
-	server := http.Server{
-		Addr:    ":8750",
-		Handler: corsHandler,
+	// Trace, log and measure every request, preflights included, under its request id
+	tracer := middleware.NewTracer(s.tracer, router)
+	handler := middleware.RequestIDMiddleware(tracer.TracingMiddleware(logRequests(router, m, corsRouter)))
+
+	// probes and scrapes bypass the rate limiter and stay out of the access log
+	root := http.NewServeMux()
+	root.HandleFunc("GET /livez", s.health.LivenessHandler)
+	root.HandleFunc("GET /readyz", s.health.ReadinessHandler)
+	if m != nil && cfg.Metrics.Port == 0 {
+		root.Handle("GET /metrics", m.Handler())
 	}
-	err := server.ListenAndServe()
-	if err != nil {
-		// Check if the error is due to the port already being in use
-		if err.Error() == "listen tcp :8750: bind: Only one usage of each socket address (protocol/network address/port) is normally permitted." {
-			log.Fatalf("Error: Port 8750 is already in use. Please choose a different port.")
-		} else {
-			log.Fatal(err)
+	root.Handle("/", handler)
+	return root
+}
+
+// unmatchedProblems answers the requests no route matches with a problem instead of the plain text of ServeMux,
+// keeping its status and headers like the Allow of a 405
+func unmatchedProblems(router *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, pattern := router.Handler(r)
+		if pattern != "" {
+			router.ServeHTTP(w, r)
+			return
 		}
-	}
 
-	log.Println("Starting server on port: 8750")
+		recorder := &statusRecorder{header: w.Header()}
+		handler.ServeHTTP(recorder, r)
+		detail := "No route matches " + r.URL.Path
+		if recorder.status == http.StatusMethodNotAllowed {
+			detail = "Method " + r.Method + " is not allowed on " + r.URL.Path
+		}
+		problem.Write(w, r, problem.New(recorder.status, detail))
+	})
+}
+
+// statusRecorder keeps the status and headers a handler writes and drops its body
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (w *statusRecorder) Header() http.Header { return w.header }
 
-	server.ListenAndServe()
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
 }
 
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// wrappedWriter records the status and the size of a response
 type wrappedWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (w *wrappedWriter) WriteHeader(statusCode int) {
@@ -88,7 +339,28 @@ func (w *wrappedWriter) WriteHeader(statusCode int) {
 	w.statusCode = statusCode
 }
 
-func logRequests(next http.Handler) http.Handler {
+func (w *wrappedWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to another protocol like WebSocket, which answered 101 on it
+func (w *wrappedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// logRequests writes an access log line per request and records its metrics, router resolves the route pattern
+func logRequests(router *http.ServeMux, m *metrics.Metrics, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -98,9 +370,28 @@ func logRequests(next http.Handler) http.Handler {
 		}
 
 		next.ServeHTTP(wrapped, r)
-
 		elapsed := time.Since(start)
-		log.Printf("Received request: %d %s %s %s", wrapped.statusCode, r.Method, r.URL.Path, elapsed)
+
+		_, route := router.Handler(r)
+		m.ObserveRequest(route, r.Method, wrapped.statusCode, elapsed)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", wrapped.statusCode),
+			slog.Int64("bytes", wrapped.bytes),
+			slog.Float64("latency_ms", float64(elapsed.Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		attrs = append(attrs, logging.Fields(r.Context())...)
+
+		level := slog.LevelInfo
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
 	})
 }
 
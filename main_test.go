@@ -0,0 +1,707 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example/rest-api/collab"
+	"example/rest-api/config"
+	"example/rest-api/db"
+	"example/rest-api/events"
+	"example/rest-api/handlers"
+	"example/rest-api/health"
+	"example/rest-api/logging"
+	"example/rest-api/metrics"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+	"example/rest-api/storage"
+
+	"github.com/dgrijalva/jwt-go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testStore opens an empty store for a single test
+type testStore struct {
+	name string
+	open func(t *testing.T) repository.Store
+}
+
+var (
+	postgresOnce sync.Once
+	postgresDB   *gorm.DB
+	postgresErr  error
+)
+
+// testStores returns the in-memory store and, when TEST_DATABASE_URL points to a
+// disposable Postgres database, a GORM store on top of it
+func testStores(t *testing.T) []testStore {
+	stores := []testStore{{
+		name: "memory",
+		open: func(t *testing.T) repository.Store { return repository.NewMemoryStore() },
+	}}
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		return stores
+	}
+
+	return append(stores, testStore{
+		name: "postgres",
+		open: func(t *testing.T) repository.Store {
+			postgresOnce.Do(func() {
+				postgresDB, postgresErr = db.Open(dsn)
+				if postgresErr != nil {
+					return
+				}
+				postgresDB.Logger = logger.Default.LogMode(logger.Silent)
+
+				var migrator *db.Migrator
+				if migrator, postgresErr = db.NewMigrator(postgresDB); postgresErr == nil {
+					_, postgresErr = migrator.Up(context.Background())
+				}
+			})
+			if postgresErr != nil {
+				t.Fatalf("connect to TEST_DATABASE_URL: %v", postgresErr)
+			}
+			if err := postgresDB.Exec("TRUNCATE attachments, notes, users, idempotency_keys, webhooks, webhook_deliveries, outbox_events").Error; err != nil {
+				t.Fatalf("truncate tables: %v", err)
+			}
+			return repository.NewGormStore(postgresDB)
+		},
+	})
+}
+
+// testServer runs the full router, middlewares included
+type testServer struct {
+	*httptest.Server
+	t         *testing.T
+	blobsDir  string
+	health    *health.Checker
+	bus       *events.Bus
+	hub       *collab.Hub
+	userCount int
+}
+
+// testConfig is the configuration of the test servers, with a rate limit tests do not hit
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.RateLimit.RPS = 1000
+	cfg.RateLimit.Burst = 1000
+	// every response of the suite is checked against the API schema
+	cfg.Env = config.EnvDevelopment
+	return cfg
+}
+
+func newTestServer(t *testing.T, store repository.Store, cfg *config.Config) *testServer {
+	t.Helper()
+	return newTracedTestServer(t, store, cfg, noop.NewTracerProvider())
+}
+
+// newTracedTestServer starts a test server recording its spans with tp
+func newTracedTestServer(t *testing.T, store repository.Store, cfg *config.Config, tp trace.TracerProvider) *testServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	blobs, err := storage.NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("blob store: %v", err)
+	}
+	if cfg == nil {
+		cfg = testConfig()
+	}
+
+	checker := health.New(time.Second)
+	bus := events.NewBus(cfg.Stream.ReplaySize)
+	hub := collab.NewHub(store, cfg.Collab)
+	// the server has the configured timeouts
+	server := httptest.NewUnstartedServer(nil)
+	m := metrics.New()
+	server.Config = newServer(cfg.Server, newRouter(cfg, services{
+		store:   store,
+		notes:   handlers.NewNoteHandler(store, blobs, cfg.Attachments, m),
+		metrics: m,
+		tracer:  tp,
+		health:  checker,
+		bus:     bus,
+		hub:     hub,
+	}))
+	server.Start()
+	t.Cleanup(server.Close)
+	t.Cleanup(bus.Close)
+	t.Cleanup(func() { hub.Close(context.Background()) })
+	return &testServer{Server: server, t: t, blobsDir: dir, health: checker, bus: bus, hub: hub}
+}
+
+// forEachStore runs the test against every available store
+func forEachStore(t *testing.T, test func(t *testing.T, srv *testServer)) {
+	for _, store := range testStores(t) {
+		t.Run(store.name, func(t *testing.T) {
+			test(t, newTestServer(t, store.open(t), nil))
+		})
+	}
+}
+
+// request sends a request, body is encoded as JSON unless it is an io.Reader
+func (s *testServer) request(method, path, token string, body interface{}, headers ...string) *http.Response {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+	default:
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(b)
+		reader = &buf
+	}
+
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatalf("new request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// login registers a new user and returns its token
+func (s *testServer) login() string {
+	s.t.Helper()
+
+	s.userCount++
+	name := "user" + string(rune('a'+s.userCount))
+	user := models.CreateUserSchema{
+		Username: name,
+		Email:    name + "@example.com",
+		Password: "correct horse",
+		FullName: "Test " + name,
+	}
+	if resp := s.request("POST", "/api/auth/register", "", user); resp.StatusCode != http.StatusCreated {
+		s.t.Fatalf("register: expected 201, got %d", resp.StatusCode)
+	}
+
+	resp := s.request("POST", "/api/auth/login", "", map[string]string{"email": user.Email, "password": user.Password})
+	var body struct {
+		Token string `json:"token"`
+	}
+	decode(s.t, resp, &body)
+	if body.Token == "" {
+		s.t.Fatalf("login returned no token")
+	}
+	return body.Token
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decode %s response: %v", resp.Request.URL.Path, err)
+	}
+}
+
+// decodeProblem decodes an error response, checking it is a problem+json document
+func decodeProblem(t *testing.T, resp *http.Response) *problem.Problem {
+	t.Helper()
+	if got := resp.Header.Get("Content-Type"); got != problem.ContentType {
+		t.Fatalf("%s %s: expected a problem, got %q", resp.Request.Method, resp.Request.URL.Path, got)
+	}
+	var p problem.Problem
+	decode(t, resp, &p)
+	if p.Status != resp.StatusCode || p.Title == "" || p.Instance != resp.Request.URL.Path {
+		t.Errorf("incomplete problem %+v", p)
+	}
+	return &p
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, want, resp.StatusCode, body)
+	}
+}
+
+func signToken(t *testing.T, secret string, exp time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "someone", "exp": exp.Unix()})
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestHealthChecker(t *testing.T) {
+	srv := newTestServer(t, repository.NewMemoryStore(), nil)
+
+	resp := srv.request("GET", "/api/healthchecker", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+
+	var body map[string]string
+	decode(t, resp, &body)
+	if body["status"] != "ok" {
+		t.Errorf("unexpected health response: %v", body)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit.RPS = 0.001
+	cfg.RateLimit.Burst = 1
+	srv := newTestServer(t, repository.NewMemoryStore(), cfg)
+
+	// probes are not rate limited
+	for i := 0; i < 3; i++ {
+		expectStatus(t, srv.request("GET", "/livez", "", nil), http.StatusOK)
+		expectStatus(t, srv.request("GET", "/readyz", "", nil), http.StatusOK)
+	}
+
+	srv.health.Drain()
+	resp := srv.request("GET", "/readyz", "", nil)
+	expectStatus(t, resp, http.StatusServiceUnavailable)
+	var body map[string]interface{}
+	decode(t, resp, &body)
+	if body["status"] != "draining" {
+		t.Errorf("expected draining, got %v", body)
+	}
+	expectStatus(t, srv.request("GET", "/livez", "", nil), http.StatusOK)
+}
+
+func TestRegisterValidation(t *testing.T) {
+	valid := map[string]string{
+		"username": "alice",
+		"email":    "alice@example.com",
+		"password": "correct horse",
+		"fullName": "Alice Liddell",
+	}
+	with := func(field, value string) map[string]string {
+		payload := map[string]string{}
+		for k, v := range valid {
+			payload[k] = v
+		}
+		payload[field] = value
+		return payload
+	}
+
+	tests := []struct {
+		name    string
+		payload interface{}
+		want    int
+		field   string
+	}{
+		{"valid", valid, http.StatusCreated, ""},
+		{"short username", with("username", "al"), http.StatusBadRequest, "username"},
+		{"invalid email", with("email", "alice"), http.StatusBadRequest, "email"},
+		{"short password", with("password", "short"), http.StatusBadRequest, "password"},
+		{"missing full name", with("fullName", ""), http.StatusBadRequest, "fullName"},
+		{"role", with("role", models.RoleAdmin), http.StatusBadRequest, "role"},
+		{"malformed json", strings.NewReader("{"), http.StatusBadRequest, ""},
+	}
+
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp := srv.request("POST", "/api/auth/register", "", tt.payload)
+				expectStatus(t, resp, tt.want)
+
+				if tt.field == "" {
+					return
+				}
+				p := decodeProblem(t, resp)
+				if p.Type != problem.TypeValidation || len(p.Errors) != 1 || p.Errors[0].Field != tt.field {
+					t.Errorf("expected a single error on %s, got %+v", tt.field, p)
+				}
+			})
+		}
+
+		t.Run("duplicate", func(t *testing.T) {
+			expectStatus(t, srv.request("POST", "/api/auth/register", "", with("email", "other@example.com")), http.StatusConflict)
+			expectStatus(t, srv.request("POST", "/api/auth/register", "", with("username", "other")), http.StatusConflict)
+		})
+	})
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		srv.request("POST", "/api/auth/register", "", models.CreateUserSchema{
+			Username: "alice",
+			Email:    "alice@example.com",
+			Password: "correct horse",
+			FullName: "Alice Liddell",
+		})
+
+		tests := []struct {
+			name        string
+			credentials interface{}
+			want        int
+		}{
+			{"by email", map[string]string{"email": "alice@example.com", "password": "correct horse"}, http.StatusOK},
+			{"by username", map[string]string{"username": "alice", "password": "correct horse"}, http.StatusOK},
+			{"wrong password", map[string]string{"email": "alice@example.com", "password": "wrong horse"}, http.StatusUnauthorized},
+			{"unknown user", map[string]string{"email": "bob@example.com", "password": "correct horse"}, http.StatusUnauthorized},
+			{"malformed json", strings.NewReader("["), http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				expectStatus(t, srv.request("POST", "/api/auth/login", "", tt.credentials), tt.want)
+			})
+		}
+
+		t.Run("logout", func(t *testing.T) {
+			token := srv.login()
+			expectStatus(t, srv.request("POST", "/api/auth/logout", token, nil), http.StatusOK)
+		})
+	})
+}
+
+func TestAuthFailures(t *testing.T) {
+	srv := newTestServer(t, repository.NewMemoryStore(), nil)
+
+	authorizations := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", ""},
+		{"not a bearer token", "Token abc"},
+		{"bearer without token", "Bearer"},
+		{"garbage token", "Bearer not.a.jwt"},
+		{"wrong secret", "Bearer " + signToken(t, "another-secret", time.Now().Add(time.Hour))},
+		{"expired token", "Bearer " + signToken(t, testConfig().Auth.JWTSecret, time.Now().Add(-time.Minute))},
+	}
+	routes := []struct{ method, path string }{
+		{"POST", "/api/auth/logout"},
+		{"GET", "/api/notes/"},
+		{"POST", "/api/notes/"},
+		{"GET", "/api/notes/search"},
+		{"GET", "/api/notes/some-id"},
+		{"PATCH", "/api/notes/some-id"},
+		{"DELETE", "/api/notes/some-id"},
+		{"POST", "/api/notes/bulk"},
+		{"GET", "/api/notes/export"},
+		{"POST", "/api/notes/import"},
+		{"POST", "/api/notes/some-id/attachments"},
+		{"GET", "/api/notes/some-id/attachments"},
+		{"GET", "/api/notes/some-id/attachments/other-id"},
+		{"DELETE", "/api/notes/some-id/attachments/other-id"},
+	}
+
+	for _, route := range routes {
+		for _, auth := range authorizations {
+			t.Run(route.method+" "+route.path+"/"+auth.name, func(t *testing.T) {
+				var headers []string
+				if auth.header != "" {
+					headers = []string{"Authorization", auth.header}
+				}
+				expectStatus(t, srv.request(route.method, route.path, "", nil, headers...), http.StatusUnauthorized)
+			})
+		}
+	}
+}
+
+func TestRateLimiting(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit.RPS = 0.001
+	cfg.RateLimit.Burst = 3
+	srv := newTestServer(t, repository.NewMemoryStore(), cfg)
+
+	for i := 0; i < 3; i++ {
+		expectStatus(t, srv.request("GET", "/api/healthchecker", "", nil), http.StatusOK)
+	}
+	resp := srv.request("GET", "/api/healthchecker", "", nil)
+	expectStatus(t, resp, http.StatusTooManyRequests)
+	// a token comes back every 1000 seconds
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "1000" {
+		t.Errorf("expected to retry after 1000 seconds, got %q", retryAfter)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	srv := newTestServer(t, repository.NewMemoryStore(), nil)
+
+	tests := []struct {
+		name        string
+		origin      string
+		method      string
+		headers     string
+		wantAllowed bool
+	}{
+		{"allowed origin", "http://localhost:3000", "PATCH", "authorization,content-type", true},
+		{"unknown origin", "http://evil.example", "PATCH", "", false},
+		{"method not allowed", "http://localhost:3000", "PUT", "", false},
+		{"header not allowed", "http://localhost:3000", "GET", "X-Custom", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := []string{"Origin", tt.origin, "Access-Control-Request-Method", tt.method}
+			if tt.headers != "" {
+				headers = append(headers, "Access-Control-Request-Headers", tt.headers)
+			}
+			resp := srv.request("OPTIONS", "/api/notes/", "", nil, headers...)
+
+			allowedOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+			if tt.wantAllowed {
+				if resp.StatusCode != http.StatusNoContent || allowedOrigin != tt.origin {
+					t.Fatalf("expected an allowed preflight, got %d with origin %q", resp.StatusCode, allowedOrigin)
+				}
+				if resp.Header.Get("Access-Control-Allow-Credentials") != "true" {
+					t.Errorf("credentials are not allowed")
+				}
+				return
+			}
+			if allowedOrigin != "" {
+				t.Fatalf("expected the preflight to be refused, got origin %q", allowedOrigin)
+			}
+		})
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	srv := newTestServer(t, repository.NewMemoryStore(), nil)
+	token := srv.login()
+
+	resp := srv.request("GET", "/api/notes/missing", token, nil, middleware.RequestIDHeader, "trace-123")
+	expectStatus(t, resp, http.StatusNotFound)
+	if got := resp.Header.Get(middleware.RequestIDHeader); got != "trace-123" {
+		t.Errorf("expected the request id to be echoed, got %q", got)
+	}
+
+	resp = srv.request("GET", "/api/healthchecker", "", nil, middleware.RequestIDHeader, "not a valid id")
+	if got := resp.Header.Get(middleware.RequestIDHeader); got == "" || got == "not a valid id" {
+		t.Errorf("expected a generated request id, got %q", got)
+	}
+
+	if strings.Contains(buf.String(), token) {
+		t.Fatal("the bearer token was logged")
+	}
+
+	var access map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		json.Unmarshal([]byte(line), &record)
+		if record["msg"] == "request" && record["request_id"] == "trace-123" {
+			access = record
+		}
+	}
+	if access == nil {
+		t.Fatalf("no access log for the request in:\n%s", buf.String())
+	}
+	if access["route"] != "GET /api/notes/{noteId}" || access["status"] != float64(http.StatusNotFound) {
+		t.Errorf("unexpected route or status in %v", access)
+	}
+	if access["user_id"] == nil || access["user_id"] == "" {
+		t.Errorf("expected the user id in %v", access)
+	}
+	if bytes, _ := access["bytes"].(float64); bytes <= 0 {
+		t.Errorf("expected the response size in %v", access)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit.RPS = 0.001
+	cfg.RateLimit.Burst = 5
+	srv := newTestServer(t, repository.NewMemoryStore(), cfg)
+
+	token := srv.login()
+	expectStatus(t, srv.request("POST", "/api/notes/", token, map[string]string{"title": "metered", "content": "body"}), http.StatusCreated)
+	expectStatus(t, srv.request("GET", "/api/notes/", "", nil), http.StatusUnauthorized)
+	expectStatus(t, srv.request("POST", "/api/auth/login", "", map[string]string{"email": "nobody@example.com", "password": "wrong password"}), http.StatusUnauthorized)
+	expectStatus(t, srv.request("GET", "/api/healthchecker", "", nil), http.StatusTooManyRequests)
+
+	// scrapes are not rate limited
+	resp := srv.request("GET", "/metrics", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		`notes_api_http_requests_total{method="POST",route="/api/notes/",status="201"} 1`,
+		`notes_api_http_request_duration_seconds_count{method="POST",route="/api/notes/",status="201"} 1`,
+		`notes_api_rate_limited_requests_total 1`,
+		`notes_api_auth_failures_total{reason="missing_token"} 1`,
+		`notes_api_notes_created_total{source="api"} 1`,
+		`notes_api_logins_total{result="success"} 1`,
+		`notes_api_logins_total{result="failure"} 1`,
+		`notes_api_users_registered_total 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	srv := newTracedTestServer(t, repository.NewMemoryStore(), nil, tp)
+	token := srv.login()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	traceparent := "00-" + traceID + "-00f067aa0ba902b7-01"
+	resp := srv.request("GET", "/api/notes/missing", token, nil, "traceparent", traceparent)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	var span sdktrace.ReadOnlySpan
+	for _, ended := range recorder.Ended() {
+		if ended.SpanContext().TraceID().String() == traceID {
+			span = ended
+		}
+	}
+	if span == nil {
+		t.Fatal("no span continues the trace of the traceparent header")
+	}
+	if span.Name() != "GET /api/notes/{noteId}" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("unexpected span %q of kind %s", span.Name(), span.SpanKind())
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" || !span.Parent().IsRemote() {
+		t.Errorf("expected the remote parent of the header, got %v", span.Parent())
+	}
+
+	attrs := map[string]string{}
+	for _, attr := range span.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["http.route"] != "/api/notes/{noteId}" || attrs["http.response.status_code"] != "404" || attrs["enduser.id"] == "" {
+		t.Errorf("unexpected span attributes %v", attrs)
+	}
+	if attrs["http.request.id"] != resp.Header.Get(middleware.RequestIDHeader) {
+		t.Errorf("expected the request id in %v", attrs)
+	}
+
+	// the access log links to the trace
+	if !strings.Contains(buf.String(), `"trace_id":"`+traceID+`"`) {
+		t.Errorf("no log line carries the trace id in:\n%s", buf.String())
+	}
+}
+
+// brokenNotes fails every listing with an error the clients must not see
+type brokenNotes struct {
+	repository.NoteRepository
+}
+
+func (brokenNotes) List(ctx context.Context, filter repository.NoteFilter, limit, offset int) ([]models.Note, error) {
+	return nil, errors.New(`pq: relation "notes" does not exist`)
+}
+
+type brokenStore struct {
+	repository.Store
+}
+
+func (s brokenStore) Notes() repository.NoteRepository {
+	return brokenNotes{s.Store.Notes()}
+}
+
+func TestProblems(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	srv := newTestServer(t, brokenStore{repository.NewMemoryStore()}, nil)
+	token := srv.login()
+
+	t.Run("unknown route", func(t *testing.T) {
+		resp := srv.request("GET", "/api/nothing", "", nil)
+		expectStatus(t, resp, http.StatusNotFound)
+		decodeProblem(t, resp)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		resp := srv.request("PUT", "/api/notes/some-id", token, nil)
+		expectStatus(t, resp, http.StatusMethodNotAllowed)
+		if resp.Header.Get("Allow") == "" {
+			t.Error("expected the Allow header of the 405")
+		}
+		decodeProblem(t, resp)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp := srv.request("GET", "/api/notes/", "", nil)
+		expectStatus(t, resp, http.StatusUnauthorized)
+		if resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("expected the bearer challenge, got %q", resp.Header.Get("WWW-Authenticate"))
+		}
+		p := decodeProblem(t, resp)
+		if p.Type != problem.TypeBlank || p.Detail == "" {
+			t.Errorf("unexpected problem %+v", p)
+		}
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		resp := srv.request("POST", "/api/notes/", token, strings.NewReader(`{"title": 12}`))
+		expectStatus(t, resp, http.StatusBadRequest)
+		// the missing content is reported along with the type error
+		p := decodeProblem(t, resp)
+		if len(p.Errors) != 2 || p.Errors[0].Field != "title" || p.Errors[0].Tag != "type" || p.Errors[1].Field != "content" {
+			t.Errorf("expected a type error on title and a missing content, got %+v", p.Errors)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		srv.createNote(token, map[string]interface{}{"title": "Taken", "content": "text"})
+		resp := srv.request("POST", "/api/notes/", token, map[string]string{"title": "Taken", "content": "text"})
+		expectStatus(t, resp, http.StatusConflict)
+		p := decodeProblem(t, resp)
+		if p.Type != problem.TypeConflict || p.Extensions["field"] != "title" {
+			t.Errorf("unexpected conflict %+v", p)
+		}
+	})
+
+	t.Run("internal error", func(t *testing.T) {
+		resp := srv.request("GET", "/api/notes/", token, nil)
+		expectStatus(t, resp, http.StatusInternalServerError)
+		p := decodeProblem(t, resp)
+		if strings.Contains(p.Detail, "relation") {
+			t.Errorf("the database error leaked: %q", p.Detail)
+		}
+		if p.RequestID == "" || p.RequestID != resp.Header.Get(middleware.RequestIDHeader) {
+			t.Errorf("expected the request id %q as correlation id, got %q", resp.Header.Get(middleware.RequestIDHeader), p.RequestID)
+		}
+		if !strings.Contains(buf.String(), `"request_id":"`+p.RequestID+`"`) || !strings.Contains(buf.String(), "does not exist") {
+			t.Errorf("the cause is not logged under the request id:\n%s", buf.String())
+		}
+	})
+}
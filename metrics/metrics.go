@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "notes_api"
+
+// Metrics holds the collectors of the service, a nil *Metrics records nothing
+type Metrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	rateLimited  prometheus.Counter
+	authFailures *prometheus.CounterVec
+	notesCreated *prometheus.CounterVec
+	logins       *prometheus.CounterVec
+	users        prometheus.Counter
+	webhooks     *prometheus.CounterVec
+	outbox       *prometheus.CounterVec
+}
+
+// New registers the collectors in a registry of their own, along with the go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests by route pattern, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests rejected by the rate limiter.",
+		}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "Rejected authentications by reason.",
+		}, []string{"reason"}),
+		notesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notes_created_total",
+			Help:      "Notes created by source: api, graphql, grpc, bulk or import.",
+		}, []string{"source"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		users: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_registered_total",
+			Help:      "Users registered.",
+		}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_attempts_total",
+			Help:      "Webhook delivery attempts by result: success, retry or failure.",
+		}, []string{"result"}),
+		outbox: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "outbox_events_relayed_total",
+			Help:      "Outbox relay attempts by result: published or retry.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.latency, m.rateLimited, m.authFailures, m.notesCreated, m.logins, m.users, m.webhooks, m.outbox,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RegisterDB exports the connection pool statistics of db
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRequest records a handled request, pattern is the ServeMux pattern that matched it
+func (m *Metrics) ObserveRequest(pattern, method string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+
+	// the method has a label of its own, unmatched paths share one label to bound the cardinality
+	route := pattern
+	if i := strings.IndexByte(route, ' '); i >= 0 {
+		route = route[i+1:]
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+
+	labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+	m.requests.With(labels).Inc()
+	m.latency.With(labels).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) RateLimited() {
+	if m != nil {
+		m.rateLimited.Inc()
+	}
+}
+
+// AuthFailed counts a rejected token, reason is a short snake_case code
+func (m *Metrics) AuthFailed(reason string) {
+	if m != nil {
+		m.authFailures.WithLabelValues(reason).Inc()
+	}
+}
+
+func (m *Metrics) NotesCreated(source string, count int) {
+	if m != nil && count > 0 {
+		m.notesCreated.WithLabelValues(source).Add(float64(count))
+	}
+}
+
+// Login counts a login attempt
+func (m *Metrics) Login(success bool) {
+	if m == nil {
+		return
+	}
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) UserRegistered() {
+	if m != nil {
+		m.users.Inc()
+	}
+}
+
+// WebhookAttempt counts a delivery attempt, result is success, retry or failure
+func (m *Metrics) WebhookAttempt(result string) {
+	if m != nil {
+		m.webhooks.WithLabelValues(result).Inc()
+	}
+}
+
+// OutboxRelayed counts an attempt to relay an event, result is published or retry
+func (m *Metrics) OutboxRelayed(result string) {
+	if m != nil {
+		m.outbox.WithLabelValues(result).Inc()
+	}
+}
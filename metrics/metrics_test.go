@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest("GET /api/notes/{noteId}", "GET", 404, time.Millisecond)
+	m.ObserveRequest("", "GET", 404, time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		`notes_api_http_requests_total{method="GET",route="/api/notes/{noteId}",status="404"} 1`,
+		`notes_api_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("GET /", "GET", 200, time.Millisecond)
+	m.RateLimited()
+	m.AuthFailed("missing_token")
+	m.NotesCreated("api", 1)
+	m.Login(true)
+	m.UserRegistered()
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor authenticates the gRPC calls like AuthMiddleware, with the bearer token of the authorization
+// metadata. The methods of the public services, given by their full name, are called without a token.
+func (a *Authenticator) UnaryInterceptor(public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isPublic(info.FullMethod, public) {
+			return handler(ctx, req)
+		}
+		ctx, err := a.authenticateRPC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor authenticates the streaming gRPC calls like UnaryInterceptor
+func (a *Authenticator) StreamInterceptor(public ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isPublic(info.FullMethod, public) {
+			return handler(srv, ss)
+		}
+		ctx, err := a.authenticateRPC(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticateRPC returns a copy of ctx carrying the user of the call, or an UNAUTHENTICATED status
+func (a *Authenticator) authenticateRPC(ctx context.Context) (context.Context, error) {
+	authHeader := ""
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		authHeader = values[0]
+	}
+	ctx, detail := a.authenticate(ctx, authHeader)
+	if detail != "" {
+		return nil, status.Error(codes.Unauthenticated, detail)
+	}
+	return ctx, nil
+}
+
+// isPublic reports whether method, like /notes.v1.AuthService/Login, belongs to one of the services
+func isPublic(method string, services []string) bool {
+	for _, service := range services {
+		if strings.HasPrefix(method, "/"+service+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticatedStream hands the context carrying the user to the stream handlers
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -1,66 +1,146 @@
 package middleware
 
 import (
-	"encoding/json"
-	"log"
-	"os"
-
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"example/rest-api/logging"
+	"example/rest-api/metrics"
+	"example/rest-api/problem"
+
 	"github.com/dgrijalva/jwt-go"
-	"github.com/joho/godotenv"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const (
+	userIDKey contextKey = "userID"
+	roleKey   contextKey = "role"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// UserID returns the id of the user authenticated by AuthMiddleware
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
+
+// WithUserID returns a copy of ctx carrying the id of the authenticated user
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// Role returns the role of the user authenticated by AuthMiddleware
+func Role(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey).(string)
+	return role
+}
+
+// WithRole returns a copy of ctx carrying the role of the authenticated user
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey, role)
+}
+
+// Authenticator checks the jwt tokens signed with the configured secret
+type Authenticator struct {
+	secret  []byte
+	metrics *metrics.Metrics
+}
+
+// NewAuthenticator returns an authenticator for tokens signed with secret, failures are counted in m
+func NewAuthenticator(secret string, m *metrics.Metrics) *Authenticator {
+	return &Authenticator{secret: []byte(secret), metrics: m}
+}
+
+// fail logs and counts a rejected authentication
+func (a *Authenticator) fail(ctx context.Context, reason string, args ...any) {
+	a.metrics.AuthFailed(reason)
+	logging.FromContext(ctx).Info("authentication failed", append([]any{"reason", reason}, args...)...)
+}
 
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+// tokenFailure classifies a token that did not validate
+func tokenFailure(err error) string {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) {
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+			return "expired_token"
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return "invalid_signature"
+		case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+			return "malformed_token"
+		}
 	}
+	return "invalid_token"
+}
 
-	JWT_SECRET := os.Getenv("JWT_SECRET")
+// unauthorized answers 401 with a problem and the bearer challenge
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	problem.Write(w, r, problem.New(http.StatusUnauthorized, detail))
+}
 
+// AuthMiddleware rejects requests without a valid bearer token
+func (a *Authenticator) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get jwt token form the auth header
 		authHeader := r.Header.Get("Authorization")
-
-		if authHeader == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"message": "Unauthorized! Please login.",
-			})
-			return
+		// browsers cannot set headers on a WebSocket handshake, the token comes in the query instead
+		if token := r.URL.Query().Get("access_token"); authHeader == "" && token != "" && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			authHeader = "Bearer " + token
 		}
 
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"message": "Invalid token format",
-			})
+		ctx, detail := a.authenticate(r.Context(), authHeader)
+		if detail != "" {
+			unauthorized(w, r, detail)
 			return
 		}
 
-		tokenString := tokenParts[1]
-		log.Println("tokenString: ", tokenString)
+		// call the next handler
+		next.ServeHTTP(w, r.WithContext(ctx))
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWT_SECRET), nil
-		})
+	})
+}
 
-		if err != nil || !token.Valid {
-			log.Println("Token error:", err)
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"message": "Invalid token. Unauthorized.",
-			})
-			return
-		}
+// authenticate checks the value of an Authorization header and returns a copy of ctx carrying the user, or the
+// detail of the failure when it is rejected
+func (a *Authenticator) authenticate(ctx context.Context, authHeader string) (context.Context, string) {
+	if authHeader == "" {
+		a.fail(ctx, "missing_token")
+		return ctx, "Unauthorized! Please login."
+	}
 
-		// call the next handler
-		next.ServeHTTP(w, r)
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		a.fail(ctx, "malformed_header")
+		return ctx, "Invalid token format"
+	}
+
+	tokenString := tokenParts[1]
 
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return a.secret, nil
 	})
+
+	if err != nil || !token.Valid {
+		// the error never contains the token itself
+		a.fail(ctx, tokenFailure(err), "error", err)
+		return ctx, "Invalid token. Unauthorized."
+	}
+
+	// make the user id available to the handlers
+	userID, role := "", ""
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		userID, _ = claims["user_id"].(string)
+		role, _ = claims["role"].(string)
+	}
+	ctx = WithRole(WithUserID(ctx, userID), role)
+	logging.AddFields(ctx, slog.String("user_id", userID))
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", userID))
+	trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(userID))
+	return ctx, ""
 }
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/rest-api/logging"
+	"example/rest-api/models"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header naming a request that is safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on the responses replayed from a previous request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// inFlightTimeout bounds how long a request that never completed, because the server died, holds its key
+	inFlightTimeout = 5 * time.Minute
+)
+
+// Idempotency runs the requests sent with an Idempotency-Key once per user and key, the stored response
+// is replayed to the retries of the request
+type Idempotency struct {
+	keys repository.IdempotencyRepository
+	// ttl is how long a response is replayed
+	ttl time.Duration
+	// maxBodySize bounds the bodies read up front to fingerprint the requests
+	maxBodySize int64
+}
+
+// NewIdempotency returns an idempotency middleware storing the responses in keys for ttl
+func NewIdempotency(keys repository.IdempotencyRepository, ttl time.Duration, maxBodySize int64) *Idempotency {
+	return &Idempotency{keys: keys, ttl: ttl, maxBodySize: maxBodySize}
+}
+
+// Middleware handles the Idempotency-Key of the requests, requests without one go straight to next.
+// A retry with the same method, path and body gets the stored response back, another request with the
+// same key gets 422 and a retry sent while the first request is still running gets 409.
+// Server errors are not stored, the request can be retried with the same key.
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyValue := r.Header.Get(IdempotencyKeyHeader)
+		if keyValue == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(keyValue) > maxIdempotencyKeyLength {
+			problem.Write(w, r, problem.InvalidParameter(IdempotencyKeyHeader, "must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" characters long"))
+			return
+		}
+
+		fingerprint, p := i.fingerprint(w, r)
+		if p != nil {
+			problem.Write(w, r, p)
+			return
+		}
+
+		// the key outlives the request, a client that gives up must not leave it in flight
+		ctx := context.WithoutCancel(r.Context())
+		now := time.Now()
+		key := &models.IdempotencyKey{
+			UserID:      UserID(r.Context()),
+			Key:         keyValue,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(inFlightTimeout),
+		}
+		existing, err := i.keys.Reserve(ctx, key)
+		if err != nil {
+			problem.Error(w, r, err)
+			return
+		}
+		if existing != nil {
+			replay(w, r, existing, fingerprint)
+			return
+		}
+
+		recorder := &teeRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			if !completed {
+				// the handler panicked or failed, the request can be sent again
+				if err := i.keys.Release(ctx, key.UserID, key.Key); err != nil {
+					logging.FromContext(ctx).Error("failed to release the idempotency key", "error", err)
+				}
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		key.StatusCode = status
+		key.ContentType = recorder.Header().Get("Content-Type")
+		key.Body = recorder.body.Bytes()
+		key.ExpiresAt = time.Now().Add(i.ttl)
+		if err := i.keys.Complete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("failed to store the idempotent response", "error", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// fingerprint hashes the method, the path and the body of a request and puts the body back for the handler
+func (i *Idempotency) fingerprint(w http.ResponseWriter, r *http.Request) (string, *problem.Problem) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, i.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return "", problem.New(http.StatusRequestEntityTooLarge, "The request body exceeds the maximum size of "+strconv.FormatInt(i.maxBodySize, 10)+" bytes")
+		}
+		return "", problem.New(http.StatusBadRequest, "The request body could not be read")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// the multipart boundary is picked at random by the clients, a retry would not match with it
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+		contentType = mediaType
+	}
+
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n"+contentType+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// replay answers a request whose key is already used
+func replay(w http.ResponseWriter, r *http.Request, key *models.IdempotencyKey, fingerprint string) {
+	switch {
+	case key.Fingerprint != fingerprint:
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, "The Idempotency-Key was already used for a different request"))
+	case key.InFlight():
+		problem.Write(w, r, problem.New(http.StatusConflict, "A request with this Idempotency-Key is still being processed"))
+	default:
+		if key.ContentType != "" {
+			w.Header().Set("Content-Type", key.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(key.StatusCode)
+		w.Write(key.Body)
+	}
+}
+
+// teeRecorder copies the response it writes through to be stored
+type teeRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *teeRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *teeRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *teeRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example/rest-api/repository"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/slow":
+			<-release
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"created"}`))
+	})
+
+	send := func(middleware http.Handler, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		middleware.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("in flight", func(t *testing.T) {
+		calls.Store(0)
+		idempotency := NewIdempotency(repository.NewMemoryStore().IdempotencyKeys(), time.Hour, 1024).Middleware(handler)
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- send(idempotency, "/slow", "key") }()
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if rec := send(idempotency, "/slow", "key"); rec.Code != http.StatusConflict {
+			t.Errorf("expected a conflict while the first request runs, got %d", rec.Code)
+		}
+		close(release)
+		if rec := <-done; rec.Code != http.StatusCreated {
+			t.Errorf("expected the first request to complete, got %d", rec.Code)
+		}
+		if rec := send(idempotency, "/slow", "key"); rec.Code != http.StatusCreated || rec.Header().Get(IdempotentReplayedHeader) != "true" {
+			t.Errorf("expected the response to be replayed, got %d", rec.Code)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("expected the handler to run once, ran %d times", calls.Load())
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		calls.Store(0)
+		idempotency := NewIdempotency(repository.NewMemoryStore().IdempotencyKeys(), time.Hour, 1024).Middleware(handler)
+
+		send(idempotency, "/fail", "key")
+		send(idempotency, "/fail", "key")
+		if calls.Load() != 2 {
+			t.Errorf("expected server errors to be retried, the handler ran %d times", calls.Load())
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		calls.Store(0)
+		idempotency := NewIdempotency(repository.NewMemoryStore().IdempotencyKeys(), 10*time.Millisecond, 1024).Middleware(handler)
+
+		send(idempotency, "/fast", "key")
+		time.Sleep(20 * time.Millisecond)
+		if rec := send(idempotency, "/fast", "key"); rec.Header().Get(IdempotentReplayedHeader) != "" {
+			t.Error("expected an expired key to run the request again")
+		}
+		if calls.Load() != 2 {
+			t.Errorf("expected the handler to run twice, ran %d times", calls.Load())
+		}
+	})
+}
@@ -1,33 +1,42 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+
+	"example/rest-api/metrics"
+	"example/rest-api/problem"
 
 	"golang.org/x/time/rate"
 )
 
-// rate limiter struct to hold the rate limiter and a mutex
+// rate limiter struct to hold the rate limiter, rate.Limiter is safe for concurrent use
 type RateLimiter struct {
 	limiter *rate.Limiter
-	mu      sync.Mutex
+	metrics *metrics.Metrics
 }
 
-// NewRateLimiter returns a new rate limiter
-func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
+// NewRateLimiter returns a new rate limiter, rejections are counted in m
+func NewRateLimiter(r rate.Limit, b int, m *metrics.Metrics) *RateLimiter {
 	return &RateLimiter{
 		limiter: rate.NewLimiter(r, b),
+		metrics: m,
 	}
 }
 
-// RateLimiterMiddleware limits the number of requests
+// RateLimiterMiddleware limits the number of requests, the rejected ones get a Retry-After in seconds
 func (rl *RateLimiter) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		rl.mu.Lock()
-		defer rl.mu.Unlock()
-
-		if !rl.limiter.Allow() {
-			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		reservation := rl.limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			// hand the token back and tell the client when the next one is available instead
+			reservation.Cancel()
+			if reservation.OK() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			}
+			rl.metrics.RateLimited()
+			problem.Write(w, r, problem.New(http.StatusTooManyRequests, "Too many requests, please slow down"))
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"example/rest-api/logging"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the id of a request from the client or a proxy, it is echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey contextKey = "requestID"
+
+// maxRequestIDLength bounds the ids accepted from clients
+const maxRequestIDLength = 128
+
+// RequestID returns the id given to the request by RequestIDMiddleware
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// validRequestID accepts printable ascii ids of a reasonable length
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware keeps the X-Request-ID of the request or generates one, and puts a logger
+// tagged with it in the request context
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("request_id", requestID))
+		ctx = logging.WithFields(ctx)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
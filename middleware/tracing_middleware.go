@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"example/rest-api/logging"
+	"example/rest-api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDAttribute links the span to the X-Request-ID of the request
+const requestIDAttribute = attribute.Key("http.request.id")
+
+// Tracer starts a server span per request, continuing the trace given by the W3C traceparent header
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	router     *http.ServeMux
+}
+
+// NewTracer returns a tracer naming the spans after the route pattern that router matches
+func NewTracer(tp trace.TracerProvider, router *http.ServeMux) *Tracer {
+	return &Tracer{
+		tracer:     tracing.Tracer(tp),
+		propagator: tracing.Propagator(),
+		router:     router,
+	}
+}
+
+// TracingMiddleware puts the span in the request context, so the queries of the request become its children,
+// and tags the request logger with the trace id
+func (t *Tracer) TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		_, pattern := t.router.Handler(r)
+		name := pattern
+		if name == "" {
+			name = r.Method
+		}
+		ctx, span := t.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.HTTPRoute(route(pattern)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.ServerAddress(r.Host),
+			),
+		)
+		defer span.End()
+		if requestID := RequestID(ctx); requestID != "" {
+			span.SetAttributes(requestIDAttribute.String(requestID))
+		}
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			logger := logging.FromContext(ctx).With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+			ctx = logging.WithLogger(ctx, logger)
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// route strips the method of a pattern, "GET /api/notes/{noteId}" is the route /api/notes/{noteId}
+func route(pattern string) string {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		return pattern[i+1:]
+	}
+	return pattern
+}
+
+// statusRecorder keeps the status of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to another protocol like WebSocket, which answered 101 on it
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && !w.wroteHeader {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,260 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example/rest-api/logging"
+	"example/rest-api/models"
+	"example/rest-api/openapi"
+	"example/rest-api/problem"
+)
+
+// Validator checks the requests of the routes against their operation in the OpenAPI document
+// before the handlers run, and optionally the responses the handlers write
+type Validator struct {
+	spec *openapi.Spec
+	// maxBodySize bounds the JSON request bodies, the other bodies are bounded by their handler
+	maxBodySize int64
+	// responses turns on the validation of the responses, which buffers them
+	responses bool
+}
+
+// NewValidator returns a validator of the operations of spec
+func NewValidator(spec *openapi.Spec, maxBodySize int64, validateResponses bool) *Validator {
+	return &Validator{spec: spec, maxBodySize: maxBodySize, responses: validateResponses}
+}
+
+// Middleware validates the requests of the route registered under pattern, routes without operation are not checked.
+// JSON bodies must have a JSON Content-Type and match their schema, unknown fields included, other bodies are left
+// to their handler. Every invalid parameter and field is reported in a single validation problem.
+func (v *Validator) Middleware(pattern string, next http.Handler) http.Handler {
+	op := v.spec.Operation(pattern)
+	if op == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errs := v.validateParameters(op, r)
+
+		if schema := jsonBody(op); schema != nil {
+			body, p := v.readBody(w, r, op.RequestBody.Required)
+			if p != nil {
+				problem.Write(w, r, p)
+				return
+			}
+			if body != nil {
+				errs = append(errs, v.spec.Validate(schema, body, "")...)
+			}
+		}
+
+		if len(errs) > 0 {
+			problem.Write(w, r, problem.Validation(errs))
+			return
+		}
+
+		if !v.responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		v.checkResponse(op, recorder, r)
+	})
+}
+
+// validateParameters checks the path and query parameters of the operation
+func (v *Validator) validateParameters(op *openapi.Operation, r *http.Request) []*models.ErrorResponse {
+	var errs []*models.ErrorResponse
+	query := r.URL.Query()
+	for _, parameter := range op.Parameters {
+		var raw string
+		switch parameter.In {
+		case "path":
+			raw = r.PathValue(parameter.Name)
+		case "query":
+			raw = query.Get(parameter.Name)
+		default:
+			continue
+		}
+
+		if raw == "" {
+			if parameter.Required {
+				errs = append(errs, &models.ErrorResponse{Field: parameter.Name, Tag: "required", Message: "is required"})
+			}
+			continue
+		}
+		errs = append(errs, v.spec.ValidateParameter(parameter, raw)...)
+	}
+	return errs
+}
+
+// readBody decodes a JSON request body and puts it back for the handler, a nil body means there was none
+func (v *Validator) readBody(w http.ResponseWriter, r *http.Request, required bool) (interface{}, *problem.Problem) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, v.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, problem.New(http.StatusRequestEntityTooLarge, "The request body exceeds the maximum size of "+strconv.FormatInt(v.maxBodySize, 10)+" bytes")
+		}
+		return nil, problem.New(http.StatusBadRequest, "The request body could not be read")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if required {
+			return nil, problem.InvalidBody(io.EOF)
+		}
+		return nil, nil
+	}
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return nil, problem.New(http.StatusUnsupportedMediaType, "The request body must be sent as application/json")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, problem.InvalidBody(err)
+	}
+	if decoder.More() {
+		return nil, problem.InvalidBody(errors.New("trailing data after the JSON value"))
+	}
+	return body, nil
+}
+
+// checkResponse validates the response written by the handler and sends it, a response that does not
+// match its operation is replaced by a problem listing the mismatches
+func (v *Validator) checkResponse(op *openapi.Operation, recorder *responseRecorder, r *http.Request) {
+	status := recorder.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	contentType := recorder.Header().Get("Content-Type")
+
+	var errs []*models.ErrorResponse
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = op.Responses["default"]
+	}
+	switch {
+	case !ok:
+		errs = append(errs, &models.ErrorResponse{Field: "status", Tag: "documented", Value: strconv.Itoa(status), Message: "is not documented"})
+	case len(response.Content) > 0:
+		schema, documented := responseSchema(response, contentType)
+		switch {
+		case !documented:
+			errs = append(errs, &models.ErrorResponse{Field: "Content-Type", Tag: "documented", Value: contentType, Message: "is not documented for status " + strconv.Itoa(status)})
+		case recorder.buffer != nil && schema != nil:
+			decoder := json.NewDecoder(bytes.NewReader(recorder.buffer.Bytes()))
+			decoder.UseNumber()
+			var body interface{}
+			if err := decoder.Decode(&body); err != nil {
+				errs = append(errs, &models.ErrorResponse{Field: "body", Tag: "json", Message: "is not valid JSON: " + err.Error()})
+				break
+			}
+			errs = append(errs, v.spec.Validate(schema, body, "")...)
+		}
+	}
+
+	if recorder.buffer == nil {
+		// the body is streamed already, the mismatch can only be logged
+		if len(errs) > 0 {
+			logging.FromContext(r.Context()).Error("response does not match the API schema", "status", status, "errors", errs)
+		}
+		return
+	}
+	if len(errs) > 0 {
+		p := problem.Internal(fmt.Errorf("response with status %d does not match the API schema", status))
+		p.Detail = "The response does not match the API schema"
+		p.Errors = errs
+		problem.Write(recorder.ResponseWriter, r, p)
+		return
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+	recorder.ResponseWriter.Write(recorder.buffer.Bytes())
+}
+
+// jsonBody returns the schema of the JSON request body of an operation, nil when it takes none
+func jsonBody(op *openapi.Operation) *openapi.Schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	if media, ok := op.RequestBody.Content["application/json"]; ok {
+		return media.Schema
+	}
+	return nil
+}
+
+// responseSchema returns the schema documented for a response content type
+func responseSchema(response *openapi.Response, contentType string) (*openapi.Schema, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if media, ok := response.Content[mediaType]; ok {
+		return media.Schema, true
+	}
+	if media, ok := response.Content["*/*"]; ok {
+		return media.Schema, true
+	}
+	return nil, false
+}
+
+// isJSON reports whether a content type is application/json or a +json type like application/problem+json
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// responseRecorder holds back JSON responses until they are validated, the others are passed through
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	// buffer holds the body of a JSON response, it is nil for the others
+	buffer *bytes.Buffer
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if isJSON(w.Header().Get("Content-Type")) {
+		w.buffer = &bytes.Buffer{}
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffer != nil {
+		return w.buffer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to another protocol like WebSocket, which answered 101 on it
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
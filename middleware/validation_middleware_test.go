@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example/rest-api/openapi"
+	"example/rest-api/problem"
+)
+
+func TestResponseValidation(t *testing.T) {
+	spec := openapi.New(openapi.Info{Title: "test", Version: "1"})
+	spec.Add("GET /items", openapi.Operation{
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "ok", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{"status": {Type: "string"}}))},
+		},
+	})
+
+	tests := []struct {
+		name        string
+		validate    bool
+		contentType string
+		status      int
+		body        string
+		want        int
+	}{
+		{"valid", true, "application/json", http.StatusOK, `{"status":"ok"}`, http.StatusOK},
+		{"wrong type", true, "application/json", http.StatusOK, `{"status":1}`, http.StatusInternalServerError},
+		{"undocumented status", true, "application/json", http.StatusCreated, `{"status":"ok"}`, http.StatusInternalServerError},
+		// streamed bodies can only be logged
+		{"undocumented content type", true, "text/plain", http.StatusOK, "ok", http.StatusOK},
+		{"not validated", false, "application/json", http.StatusOK, `{"status":1}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewValidator(spec, 1024, tt.validate).Middleware("GET /items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/items", nil))
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body)
+			}
+			if tt.want == http.StatusOK {
+				if w.Body.String() != tt.body {
+					t.Errorf("expected the body to be passed through, got %q", w.Body)
+				}
+				return
+			}
+
+			var p problem.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || len(p.Errors) == 0 {
+				t.Fatalf("expected a problem listing the mismatches, got %s", w.Body)
+			}
+			if !strings.Contains(w.Header().Get("Content-Type"), "problem+json") {
+				t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
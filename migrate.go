@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"example/rest-api/db"
+)
+
+const migrateUsage = `usage: rest-api migrate <command>
+
+commands:
+  up          apply every pending migration
+  down [n]    revert the last n applied migrations, 1 by default
+  status      list the migrations and whether they are applied`
+
+// runMigrate runs the migrate subcommand
+func runMigrate(migrator *db.Migrator, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			fatal("Migration failed", "error", err)
+		}
+		if len(applied) == 0 {
+			slog.Info("Database schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			slog.Info("Reverted migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			fatal("Migration failed", "error", err)
+		}
+		if len(reverted) == 0 {
+			slog.Info("No migration to revert")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fatal("Failed to read migration status", "error", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", ""
+			if status.Applied {
+				state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Attachment struct {
+	ID          string    `gorm:"type:char(36);primary_key" json:"id,omitempty"`
+	NoteID      string    `gorm:"type:char(36);index:idx_attachments_note_id;not null" json:"noteId,omitempty"`
+	FileName    string    `gorm:"type:varchar(255);not null" json:"fileName,omitempty"`
+	ContentType string    `gorm:"type:varchar(255);not null" json:"contentType,omitempty"`
+	Size        int64     `gorm:"not null" json:"size"`
+	StorageKey  string    `gorm:"type:varchar(512);not null" json:"-"`
+	CreatedAt   time.Time `gorm:"not null;default:'1970-01-01 00:00:01'" json:"createdAt,omitempty"`
+}
+
+// the id is generated up front by the upload handler because it is part of the storage key
+func (attachment *Attachment) BeforeCreate(tx *gorm.DB) (err error) {
+	if attachment.ID == "" {
+		attachment.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// IdempotencyKey is the response to the first request sent with an Idempotency-Key, retries of the
+// request get it back instead of running again
+type IdempotencyKey struct {
+	UserID string `gorm:"type:varchar(36);primaryKey"`
+	Key    string `gorm:"type:varchar(255);primaryKey"`
+	// Fingerprint is the hex SHA-256 of the method, path and body of the request
+	Fingerprint string `gorm:"type:char(64);not null"`
+	// StatusCode is 0 while the first request is in flight
+	StatusCode  int       `gorm:"not null;default:0"`
+	ContentType string    `gorm:"type:varchar(255)"`
+	Body        []byte    `gorm:"type:bytea"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// InFlight reports whether the response to the first request is not stored yet
+func (key *IdempotencyKey) InFlight() bool {
+	return key.StatusCode == 0
+}
@@ -1,61 +1,60 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
-var validate = validator.New()
-
 func (note *Note) BeforeCreate(tx *gorm.DB) (err error) {
 	note.ID = uuid.New().String()
 	return nil
 }
 
-func ValidateStruct[T any](payload T) []*ErrorResponse {
-	var errors []*ErrorResponse
-	err := validate.Struct(payload)
-	if err != nil {
-		for _, err := range err.(validator.ValidationErrors) {
-			var element ErrorResponse
-			element.Field = err.StructNamespace()
-			element.Tag = err.Tag()
-			element.Value = err.Param()
-			errors = append(errors, &element)
-		}
-	}
-	return errors
+type Note struct {
+	ID            string         `gorm:"type:char(36);primary_key" json:"id,omitempty"`
+	UserID        string         `gorm:"type:char(36);uniqueIndex:idx_notes_user_title,priority:1;not null" json:"userId,omitempty"`
+	Title         string         `gorm:"type:varchar(255);uniqueIndex:idx_notes_user_title,priority:2;not null" json:"title,omitempty"`
+	Content       string         `gorm:"not null" json:"content,omitempty"`
+	ContentFormat string         `gorm:"type:varchar(20);default:'plain';not null" json:"contentFormat,omitempty"`
+	Category      string         `gorm:"varchar(100)" json:"category,omitempty"`
+	Published     bool           `gorm:"default:false;not null" json:"published"`
+	Tags          pq.StringArray `gorm:"type:text[]" json:"tags,omitempty"`
+	CreatedAt     time.Time      `gorm:"not null;default:'1970-01-01 00:00:01'" json:"createdAt,omitempty"`
+	UpdatedAt     time.Time      `gorm:"not null;default:'1970-01-01 00:00:01';ON UPDATE CURRENT_TIMESTAMP" json:"updatedAt,omitempty"`
 }
 
-type Note struct {
-	ID        string    `gorm:"type:char(36);primary_key" json:"id,omitempty"`
-	Title     string    `gorm:"type:varchar(255);uniqueIndex:idx_notes_title,LENGTH(255);not null" json:"title,omitempty"`
-	Content   string    `gorm:"not null" json:"content,omitempty"`
-	Category  string    `gorm:"varchar(100)" json:"category,omitempty"`
-	Published bool      `gorm:"default:false;not null" json:"published"`
-	CreatedAt time.Time `gorm:"not null;default:'1970-01-01 00:00:01'" json:"createdAt,omitempty"`
-	UpdatedAt time.Time `gorm:"not null;default:'1970-01-01 00:00:01';ON UPDATE CURRENT_TIMESTAMP" json:"updatedAt,omitempty"`
+type CreateNoteSchema struct {
+	Title         string `json:"title" validate:"required"`
+	Content       string `json:"content" validate:"required"`
+	ContentFormat string `json:"contentFormat,omitempty" validate:"omitempty,oneof=plain markdown"`
+	Category      string `json:"category,omitempty"`
+	Published     bool   `json:"published,omitempty"`
 }
 
-type ErrorResponse struct {
-	Field string `json:"field"`
-	Tag   string `json:"tag"`
-	Value string `json:"value,omitempty"`
+type UpdateNoteSchema struct {
+	Title         string `json:"title,omitempty"`
+	Content       string `json:"content,omitempty"`
+	ContentFormat string `json:"contentFormat,omitempty" validate:"omitempty,oneof=plain markdown"`
+	Category      string `json:"category,omitempty"`
+	Published     *bool  `json:"published,omitempty"`
 }
 
-type CreateNoteSchema struct {
-	Title     string `json:"title" validate:"required"`
-	Content   string `json:"content" validate:"required"`
-	Category  string `json:"category,omitempty"`
-	Published bool   `json:"published,omitempty"`
+type BulkNoteSchema struct {
+	Mode       string                `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Operations []BulkOperationSchema `json:"operations" validate:"required,min=1,max=100,dive"`
 }
 
-type UpdateNoteSchema struct {
-	Title     string `json:"title,omitempty"`
-	Content   string `json:"content,omitempty"`
-	Category  string `json:"category,omitempty"`
-	Published *bool  `json:"published,omitempty"`
+// BulkOperationSchema is one operation of a bulk request, Data holds a CreateNoteSchema for create
+// and an UpdateNoteSchema for update while IDs lists the notes every other operation applies to
+type BulkOperationSchema struct {
+	Op        string          `json:"op" validate:"required,oneof=create update delete publish tag move"`
+	IDs       []string        `json:"ids,omitempty" validate:"max=500"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Published *bool           `json:"published,omitempty"`
+	Tags      []string        `json:"tags,omitempty" validate:"dive,required,max=50"`
+	Category  *string         `json:"category,omitempty" validate:"omitempty,max=100"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is a domain event written in the transaction of the change it is about, the relay
+// publishes it to the sinks once the transaction commits
+type OutboxEvent struct {
+	// ID orders the events in the order they were written
+	ID      int64  `gorm:"primaryKey;autoIncrement"`
+	EventID string `gorm:"type:char(36);uniqueIndex;not null"`
+	Type    string `gorm:"type:varchar(50);not null"`
+	// UserID is the user the event is about
+	UserID string `gorm:"type:varchar(36);not null;default:''"`
+	// Payload is the JSON data of the event
+	Payload   json.RawMessage `gorm:"type:bytea;not null"`
+	CreatedAt time.Time       `gorm:"not null"`
+	// PublishedAt is nil until every sink got the event
+	PublishedAt *time.Time
+	Attempts    int `gorm:"not null;default:0"`
+	// NextAttemptAt is when a pending event is relayed
+	NextAttemptAt time.Time `gorm:"not null"`
+	LastError     string    `gorm:"type:text"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+// newValidator names the fields after their json name, so errors point at what the client sent
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// ErrorResponse describes a field that failed validation
+type ErrorResponse struct {
+	// Field is the json path of the field, like title or operations[0].op
+	Field string `json:"field"`
+	// Tag is the validation rule that failed
+	Tag string `json:"tag"`
+	// Value is the parameter of the rule, like 8 for min=8
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+func ValidateStruct[T any](payload T) []*ErrorResponse {
+	var errors []*ErrorResponse
+	err := validate.Struct(payload)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			var element ErrorResponse
+			// drop the name of the struct itself
+			_, element.Field, _ = strings.Cut(err.Namespace(), ".")
+			element.Tag = err.Tag()
+			element.Value = err.Param()
+			element.Message = validationMessage(err)
+			errors = append(errors, &element)
+		}
+	}
+	return errors
+}
+
+// validationMessage explains a failed rule in plain words
+func validationMessage(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(err.Param(), " ", ", ")
+	case "min", "max":
+		bound := "at least"
+		if err.Tag() == "max" {
+			bound = "at most"
+		}
+		switch err.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters long", bound, err.Param())
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return fmt.Sprintf("must have %s %s items", bound, err.Param())
+		}
+		return fmt.Sprintf("must be %s %s", bound, err.Param())
+	}
+	return "failed on the " + err.Tag() + " rule"
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// the webhook event types
+const (
+	EventNoteCreated    = "note.created"
+	EventNoteUpdated    = "note.updated"
+	EventNotePublished  = "note.published"
+	EventNoteDeleted    = "note.deleted"
+	EventUserRegistered = "user.registered"
+)
+
+// the states of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription to the events, they are delivered to URL
+type Webhook struct {
+	ID string `gorm:"type:char(36);primary_key" json:"id,omitempty"`
+	// UserID is the owner of the webhook, empty for a system-wide webhook receiving the events of every user
+	UserID string `gorm:"type:varchar(36);index:idx_webhooks_user_id;not null;default:''" json:"userId,omitempty"`
+	URL    string `gorm:"type:varchar(2048);not null" json:"url"`
+	// Events filters the event types delivered, empty means all of them
+	Events pq.StringArray `gorm:"type:text[]" json:"events"`
+	// Secret signs the deliveries, it is only sent back when the webhook is created
+	Secret    string    `gorm:"type:varchar(255);not null" json:"secret,omitempty"`
+	Active    bool      `gorm:"not null" json:"active"`
+	CreatedAt time.Time `gorm:"not null" json:"createdAt,omitempty"`
+	UpdatedAt time.Time `gorm:"not null" json:"updatedAt,omitempty"`
+}
+
+func (webhook *Webhook) BeforeCreate(tx *gorm.DB) (err error) {
+	if webhook.ID == "" {
+		webhook.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// Subscribed reports whether the webhook receives the events of type event
+func (webhook *Webhook) Subscribed(event string) bool {
+	if !webhook.Active {
+		return false
+	}
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateWebhookSchema struct {
+	URL    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events,omitempty" validate:"max=10,dive,oneof=note.created note.updated note.published note.deleted user.registered"`
+	// Secret is generated when it is not given
+	Secret string `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+	// SystemWide subscribes to the events of every user, it is reserved to the admins
+	SystemWide bool `json:"systemWide,omitempty"`
+}
+
+type UpdateWebhookSchema struct {
+	URL *string `json:"url,omitempty" validate:"omitempty,url,max=2048"`
+	// Events replaces the event filter when it is set, an empty list subscribes to every event
+	Events []string `json:"events,omitempty" validate:"max=10,dive,oneof=note.created note.updated note.published note.deleted user.registered"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// WebhookDelivery is an event queued for a webhook, along with the outcome of its last attempt
+type WebhookDelivery struct {
+	ID        string `gorm:"type:char(36);primary_key" json:"id,omitempty"`
+	WebhookID string `gorm:"type:char(36);index:idx_webhook_deliveries_webhook_id;not null" json:"webhookId"`
+	// EventID is shared by the redeliveries of an event
+	EventID string          `gorm:"type:char(36);not null" json:"eventId"`
+	Event   string          `gorm:"type:varchar(50);not null" json:"event"`
+	Payload json.RawMessage `gorm:"type:bytea;not null" json:"payload"`
+	// Status is pending until the delivery succeeds or runs out of attempts
+	Status   string `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	Attempts int    `gorm:"not null;default:0" json:"attempts"`
+	// NextAttemptAt is when a pending delivery is sent
+	NextAttemptAt  time.Time  `gorm:"not null" json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty"`
+	ResponseStatus int        `gorm:"not null;default:0" json:"responseStatus,omitempty"`
+	// ResponseBody is the beginning of the body the receiver answered with
+	ResponseBody string    `gorm:"type:text" json:"responseBody,omitempty"`
+	Error        string    `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt    time.Time `gorm:"not null" json:"createdAt,omitempty"`
+}
+
+func (delivery *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	if delivery.ID == "" {
+		delivery.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+// Package notespb holds the protobuf messages and the gRPC services of the notes API, generated from the
+// .proto files of this directory
+package notespb
+
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative notespb/auth.proto notespb/notes.proto
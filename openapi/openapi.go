@@ -0,0 +1,224 @@
+package openapi
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Version is the OpenAPI version of the generated documents
+const Version = "3.1.0"
+
+// Document is an OpenAPI document, only the parts the API uses are modelled
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps the lower case methods of a path to their operation
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Query returns an optional query parameter
+func Query(name, description string, schema *Schema) *Parameter {
+	return &Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// Header returns an optional header parameter
+func Header(name, description string, schema *Schema) *Parameter {
+	return &Parameter{Name: name, In: "header", Description: description, Schema: schema}
+}
+
+// JSON returns a body of the given schema with media type application/json
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// Spec builds the document of an API route by route
+type Spec struct {
+	doc Document
+}
+
+// New returns a spec without any path
+func New(info Info) *Spec {
+	return &Spec{doc: Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}}
+}
+
+// Component registers a named schema and returns a reference to it
+func (s *Spec) Component(name string, schema *Schema) *Schema {
+	s.resolve(schema)
+	s.doc.Components.Schemas[name] = schema
+	return Ref(name)
+}
+
+// SecurityScheme registers a security scheme operations can require
+func (s *Spec) SecurityScheme(name string, scheme *SecurityScheme) {
+	s.doc.Components.SecuritySchemes[name] = scheme
+}
+
+var pathParameter = regexp.MustCompile(`{([^}.]+)(\.\.\.)?}`)
+
+// Add documents the route of a ServeMux pattern like "GET /api/notes/{noteId}", its path parameters
+// are added to the operation unless it declares them, the schemas of Go types become components
+func (s *Spec) Add(pattern string, op Operation) {
+	method, path := splitPattern(pattern)
+
+	for _, match := range pathParameter.FindAllStringSubmatch(path, -1) {
+		if !hasParameter(op.Parameters, match[1], "path") {
+			op.Parameters = append(op.Parameters, &Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	for _, parameter := range op.Parameters {
+		s.resolve(parameter.Schema)
+	}
+	if op.RequestBody != nil {
+		for _, media := range op.RequestBody.Content {
+			s.resolve(media.Schema)
+		}
+	}
+	for _, response := range op.Responses {
+		for _, media := range response.Content {
+			s.resolve(media.Schema)
+		}
+	}
+
+	item, ok := s.doc.Paths[path]
+	if !ok {
+		item = PathItem{}
+		s.doc.Paths[path] = item
+	}
+	item[method] = &op
+}
+
+// Operation returns the operation documenting the route of a ServeMux pattern, nil when there is none
+func (s *Spec) Operation(pattern string) *Operation {
+	method, path := splitPattern(pattern)
+	return s.doc.Paths[path][method]
+}
+
+// splitPattern returns the lower case method and the OpenAPI path of a ServeMux pattern,
+// a pattern without method matches them all and is documented as a GET
+func splitPattern(pattern string) (string, string) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = http.MethodGet, pattern
+	}
+	return strings.ToLower(method), pathParameter.ReplaceAllString(path, "{$1}")
+}
+
+func hasParameter(parameters []*Parameter, name, in string) bool {
+	for _, parameter := range parameters {
+		if parameter.Name == name && parameter.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// Document returns the document built so far
+func (s *Spec) Document() *Document {
+	return &s.doc
+}
+
+// Handler serves the document as JSON, it is encoded once so the spec must be complete
+func (s *Spec) Handler() http.Handler {
+	body, err := json.MarshalIndent(s.doc, "", "  ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: {{.SpecURL}}, dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`))
+
+// DocsHandler serves a Swagger UI page browsing the document served at specURL
+func DocsHandler(title, specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		docsPage.Execute(w, struct{ Title, SpecURL string }{title, specURL})
+	})
+}
@@ -0,0 +1,93 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type testItem struct {
+	Name     string     `json:"name" validate:"required,max=20"`
+	Tags     []string   `json:"tags,omitempty" validate:"max=5,dive,required,max=10"`
+	Priority int        `json:"priority" validate:"omitempty,min=1,max=3"`
+	Due      *time.Time `json:"due,omitempty"`
+	Parent   *testItem  `json:"parent,omitempty"`
+	Owner    string     `json:"owner" validate:"omitempty,email"`
+	Secret   string     `json:"-"`
+	internal string
+}
+
+func TestAdd(t *testing.T) {
+	spec := New(Info{Title: "test", Version: "1"})
+	spec.Add("PUT /items/{itemId}/files/{path...}", Operation{
+		Summary:     "Put a file",
+		RequestBody: &RequestBody{Content: JSON(TypeOf(testItem{}))},
+		Responses: map[string]*Response{
+			"200": {Description: "ok", Content: JSON(ArrayOf(TypeOf(testItem{})))},
+		},
+	})
+	doc := spec.Document()
+
+	op := doc.Paths["/items/{itemId}/files/{path}"]["put"]
+	if op == nil {
+		t.Fatalf("expected the operation under its OpenAPI path, got %v", doc.Paths)
+	}
+	var names []string
+	for _, parameter := range op.Parameters {
+		if parameter.In != "path" || !parameter.Required {
+			t.Errorf("expected a required path parameter, got %+v", parameter)
+		}
+		names = append(names, parameter.Name)
+	}
+	if strings.Join(names, ",") != "itemId,path" {
+		t.Errorf("expected the path parameters itemId and path, got %v", names)
+	}
+
+	if ref := op.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/testItem" {
+		t.Errorf("expected the body to reference the component, got %q", ref)
+	}
+	if items := op.Responses["200"].Content["application/json"].Schema.Items; items == nil || items.Ref == "" {
+		t.Errorf("expected a list of references, got %+v", items)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	spec := New(Info{Title: "test", Version: "1"})
+	spec.Component("Wrapper", Object(map[string]*Schema{"item": TypeOf(testItem{})}))
+
+	item := spec.Document().Components.Schemas["testItem"]
+	if item == nil {
+		t.Fatal("expected the struct to be registered as a component")
+	}
+	if strings.Join(item.Required, ",") != "name" {
+		t.Errorf("expected only name to be required, got %v", item.Required)
+	}
+	if _, ok := item.Properties["Secret"]; ok {
+		t.Error("expected the fields ignored by json to be left out")
+	}
+	if len(item.Properties) != 6 {
+		t.Errorf("expected 6 properties, got %d", len(item.Properties))
+	}
+
+	name := item.Properties["name"]
+	if name.Type != "string" || *name.MinLength != 1 || *name.MaxLength != 20 {
+		t.Errorf("unexpected name schema %+v", name)
+	}
+	tags := item.Properties["tags"]
+	if tags.Type != "array" || *tags.MaxItems != 5 || *tags.Items.MinLength != 1 || *tags.Items.MaxLength != 10 {
+		t.Errorf("expected the rules after dive to apply to the items, got %+v", tags)
+	}
+	priority := item.Properties["priority"]
+	if priority.Type != "integer" || *priority.Minimum != 1 || *priority.Maximum != 3 {
+		t.Errorf("unexpected priority schema %+v", priority)
+	}
+	if due := item.Properties["due"]; due.Type != "string" || due.Format != "date-time" {
+		t.Errorf("expected a date-time, got %+v", due)
+	}
+	if parent := item.Properties["parent"]; parent.Ref != "#/components/schemas/testItem" {
+		t.Errorf("expected a recursive reference, got %+v", parent)
+	}
+	if owner := item.Properties["owner"]; owner.Format != "email" {
+		t.Errorf("expected an email format, got %+v", owner)
+	}
+}
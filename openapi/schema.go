@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+
+	// goType is replaced by its schema once the schema is added to a spec
+	goType reflect.Type
+	// order lists the properties in the order of the struct fields
+	order []string
+}
+
+// Ref returns a reference to a component schema
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// TypeOf returns the schema of the Go type of v. It is derived from the json and validate tags of
+// the fields when the schema is added to a spec, named structs become components of the spec.
+func TypeOf(v interface{}) *Schema {
+	return &Schema{goType: reflect.TypeOf(v)}
+}
+
+// Object returns the schema of an object with the given properties, all of them required
+func Object(properties map[string]*Schema) *Schema {
+	schema := &Schema{Type: "object", Properties: properties}
+	for name := range properties {
+		schema.Required = append(schema.Required, name)
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// ArrayOf returns the schema of a list of items
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// resolve replaces the Go types of a schema and of its subschemas by their schema
+func (s *Spec) resolve(schema *Schema) {
+	if schema == nil {
+		return
+	}
+	if schema.goType != nil {
+		*schema = *s.schemaOf(schema.goType)
+		return
+	}
+	for _, property := range schema.Properties {
+		s.resolve(property)
+	}
+	s.resolve(schema.Items)
+	s.resolve(schema.AdditionalProperties)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf returns the schema of t, named structs are registered as components and referenced
+func (s *Spec) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		// any JSON value
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(s.schemaOf(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if _, ok := s.doc.Components.Schemas[t.Name()]; !ok {
+			// registered before its fields are walked so recursive types terminate
+			s.doc.Components.Schemas[t.Name()] = &Schema{}
+			*s.doc.Components.Schemas[t.Name()] = *s.structSchema(t)
+		}
+		return Ref(t.Name())
+	}
+	return &Schema{}
+}
+
+// structSchema returns the object schema of the exported fields of a struct
+func (s *Spec) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.schemaOf(field.Type)
+		if applyRules(property, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+		schema.order = append(schema.order, name)
+	}
+	return schema
+}
+
+// applyRules maps the validate rules of a field to schema keywords, it reports whether the field is required.
+// The rules after dive apply to the items of a list.
+func applyRules(schema *Schema, tag string) bool {
+	required := false
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" {
+			if schema.Items != nil && schema.Items.Ref == "" {
+				applyRules(schema.Items, strings.Join(rules[i+1:], ","))
+			}
+			break
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+			if schema.Type == "string" && schema.MinLength == nil {
+				schema.MinLength = intPtr(1)
+			}
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			setBound(schema, name == "min", n)
+		}
+	}
+	return required
+}
+
+// setBound sets the bound of min and max rules, which applies to the length of strings and lists
+func setBound(schema *Schema, lower bool, n int) {
+	switch schema.Type {
+	case "string":
+		if lower {
+			schema.MinLength = intPtr(n)
+		} else {
+			schema.MaxLength = intPtr(n)
+		}
+	case "array":
+		if lower {
+			schema.MinItems = intPtr(n)
+		} else {
+			schema.MaxItems = intPtr(n)
+		}
+	case "integer", "number":
+		bound := float64(n)
+		if lower {
+			schema.Minimum = &bound
+		} else {
+			schema.Maximum = &bound
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,220 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example/rest-api/models"
+)
+
+// typeNames are the types of the schemas as written in the error messages
+var typeNames = map[string]string{
+	"string":  "a string",
+	"integer": "an integer",
+	"number":  "a number",
+	"boolean": "a boolean",
+	"array":   "a list",
+	"object":  "an object",
+}
+
+// Validate checks a value decoded with json.Decoder.UseNumber against schema, errors are reported under
+// the json path of the invalid values, path being the one of value. The rules and messages follow the
+// validate tags the schemas are generated from, and the fields of objects without additionalProperties
+// are the only ones allowed.
+func (s *Spec) Validate(schema *Schema, value interface{}, path string) []*models.ErrorResponse {
+	var errs []*models.ErrorResponse
+	s.validate(schema, value, path, &errs)
+	return errs
+}
+
+// ValidateParameter checks the raw value of a path or query parameter, which is first converted to the type of its schema
+func (s *Spec) ValidateParameter(parameter *Parameter, raw string) []*models.ErrorResponse {
+	var value interface{} = raw
+	var err error
+	switch parameter.Schema.Type {
+	case "integer":
+		_, err = strconv.ParseInt(raw, 10, 64)
+		value = json.Number(raw)
+	case "number":
+		_, err = strconv.ParseFloat(raw, 64)
+		value = json.Number(raw)
+	case "boolean":
+		value, err = strconv.ParseBool(raw)
+	}
+	if err != nil {
+		return []*models.ErrorResponse{{Field: parameter.Name, Tag: "type", Value: parameter.Schema.Type, Message: "must be " + typeNames[parameter.Schema.Type]}}
+	}
+	return s.Validate(parameter.Schema, value, parameter.Name)
+}
+
+func (s *Spec) validate(schema *Schema, value interface{}, path string, errs *[]*models.ErrorResponse) {
+	schema = s.deref(schema)
+	// null stands for a missing value, the required rule of the parent object reports it
+	if schema == nil || value == nil {
+		return
+	}
+	fail := func(tag, param, message string) {
+		*errs = append(*errs, &models.ErrorResponse{Field: path, Tag: tag, Value: param, Message: message})
+	}
+
+	if schema.Type != "" && !hasType(schema.Type, value) {
+		fail("type", schema.Type, "must be "+typeNames[schema.Type])
+		return
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(value)
+		switch {
+		case value == "" && schema.MinLength != nil && *schema.MinLength > 0:
+			// the required rule of list items
+			fail("required", "", "is required")
+		case len(schema.Enum) > 0 && !contains(schema.Enum, value):
+			fail("oneof", strings.Join(schema.Enum, " "), "must be one of "+strings.Join(schema.Enum, ", "))
+		case schema.MinLength != nil && length < *schema.MinLength:
+			fail("min", strconv.Itoa(*schema.MinLength), fmt.Sprintf("must be at least %d characters long", *schema.MinLength))
+		case schema.MaxLength != nil && length > *schema.MaxLength:
+			fail("max", strconv.Itoa(*schema.MaxLength), fmt.Sprintf("must be at most %d characters long", *schema.MaxLength))
+		case schema.Format == "email" && !isEmail(value):
+			fail("email", "", "must be a valid email address")
+		case schema.Format == "date-time" && !isDateTime(value):
+			fail("datetime", time.RFC3339, "must be an RFC 3339 date-time")
+		}
+
+	case json.Number:
+		n, _ := value.Float64()
+		switch {
+		case schema.Minimum != nil && n < *schema.Minimum:
+			fail("min", formatBound(*schema.Minimum), "must be at least "+formatBound(*schema.Minimum))
+		case schema.Maximum != nil && n > *schema.Maximum:
+			fail("max", formatBound(*schema.Maximum), "must be at most "+formatBound(*schema.Maximum))
+		}
+
+	case []interface{}:
+		switch {
+		case schema.MinItems != nil && len(value) < *schema.MinItems:
+			fail("min", strconv.Itoa(*schema.MinItems), fmt.Sprintf("must have at least %d items", *schema.MinItems))
+		case schema.MaxItems != nil && len(value) > *schema.MaxItems:
+			fail("max", strconv.Itoa(*schema.MaxItems), fmt.Sprintf("must have at most %d items", *schema.MaxItems))
+		}
+		for i, item := range value {
+			s.validate(schema.Items, item, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+
+	case map[string]interface{}:
+		s.validateObject(schema, value, path, errs)
+	}
+}
+
+// validateObject checks the required, known and additional properties of an object
+func (s *Spec) validateObject(schema *Schema, object map[string]interface{}, path string, errs *[]*models.ErrorResponse) {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	for _, name := range schema.propertyNames() {
+		value, ok := object[name]
+		// like the validate tags, an empty string is a missing value
+		if !ok || value == nil || value == "" {
+			if required[name] {
+				*errs = append(*errs, &models.ErrorResponse{Field: join(path, name), Tag: "required", Message: "is required"})
+			}
+			continue
+		}
+		s.validate(schema.Properties[name], value, join(path, name), errs)
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		if _, ok := schema.Properties[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case schema.AdditionalProperties != nil:
+			s.validate(schema.AdditionalProperties, object[name], join(path, name), errs)
+		case schema.Properties != nil:
+			*errs = append(*errs, &models.ErrorResponse{Field: join(path, name), Tag: "unknown", Message: "is not a known field"})
+		}
+	}
+}
+
+// deref returns the component a schema refers to
+func (s *Spec) deref(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// propertyNames returns the properties in the order of the struct fields they come from
+func (schema *Schema) propertyNames() []string {
+	if len(schema.order) == len(schema.Properties) {
+		return schema.order
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasType(schemaType string, value interface{}) bool {
+	switch value := value.(type) {
+	case string:
+		return schemaType == "string"
+	case bool:
+		return schemaType == "boolean"
+	case json.Number:
+		if schemaType == "integer" {
+			_, err := value.Int64()
+			return err == nil
+		}
+		return schemaType == "number"
+	case []interface{}:
+		return schemaType == "array"
+	case map[string]interface{}:
+		return schemaType == "object"
+	}
+	return false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+func isDateTime(value string) bool {
+	_, err := time.Parse(time.RFC3339, value)
+	return err == nil
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
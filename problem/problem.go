@@ -0,0 +1,221 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"example/rest-api/logging"
+	"example/rest-api/models"
+)
+
+// ContentType is the media type of the error responses
+const ContentType = "application/problem+json"
+
+// the problem types that say more than their status code, the others are about:blank
+const (
+	TypeBlank      = "about:blank"
+	TypeValidation = "/problems/validation-error"
+	TypeConflict   = "/problems/conflict"
+)
+
+// requestIDHeader is set on every response by middleware.RequestIDMiddleware
+const requestIDHeader = "X-Request-ID"
+
+// Problem is an RFC 7807 problem details object, the body of every error response
+type Problem struct {
+	// Type is a URI reference identifying the kind of problem
+	Type   string
+	Title  string
+	Status int
+	Detail string
+	// Instance is the path of the request that failed
+	Instance string
+	// RequestID correlates the problem with the logs of the request
+	RequestID string
+	// Errors lists the invalid fields of a validation problem
+	Errors []*models.ErrorResponse
+	// Extensions are additional members, like the field of a conflict
+	Extensions map[string]interface{}
+
+	// cause is logged and never sent
+	cause error
+}
+
+// New returns a problem that its status code describes
+func New(status int, detail string) *Problem {
+	return &Problem{Type: TypeBlank, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Validation returns the problem of a request whose fields failed validation
+func Validation(errs []*models.ErrorResponse) *Problem {
+	detail := "1 field is invalid"
+	if len(errs) != 1 {
+		detail = strconv.Itoa(len(errs)) + " fields are invalid"
+	}
+	return &Problem{Type: TypeValidation, Title: "Validation failed", Status: http.StatusBadRequest, Detail: detail, Errors: errs}
+}
+
+// InvalidParameter returns the validation problem of a single query or path parameter
+func InvalidParameter(name, message string) *Problem {
+	return Validation([]*models.ErrorResponse{{Field: name, Tag: "format", Message: message}})
+}
+
+// InvalidBody returns the problem of a request body that could not be decoded as JSON
+func InvalidBody(err error) *Problem {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return New(http.StatusBadRequest, "The request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return New(http.StatusBadRequest, "The request body is truncated JSON")
+	case errors.As(err, &syntaxErr):
+		return New(http.StatusBadRequest, fmt.Sprintf("The request body is malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return Validation([]*models.ErrorResponse{{
+			Field:   typeErr.Field,
+			Tag:     "type",
+			Value:   typeErr.Type.String(),
+			Message: "must be a " + jsonType(typeErr.Type.Kind()),
+		}})
+	}
+	return New(http.StatusBadRequest, "The request body is not valid JSON")
+}
+
+// jsonType names a go kind after its json counterpart
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct, reflect.Pointer:
+		return "object"
+	}
+	return "number"
+}
+
+// Conflict returns the problem of a write violating a unique constraint on field
+func Conflict(field, detail string) *Problem {
+	p := &Problem{Type: TypeConflict, Title: "Resource already exists", Status: http.StatusConflict, Detail: detail}
+	if field != "" {
+		p.Extensions = map[string]interface{}{"field": field}
+	}
+	return p
+}
+
+// Internal hides err behind a generic message, the client quotes the request id to find it in the logs
+func Internal(err error) *Problem {
+	p := New(http.StatusInternalServerError, "An unexpected error occurred, please retry later or report the request id")
+	p.cause = err
+	return p
+}
+
+// With adds an extension member to the problem
+func (p *Problem) With(key string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = map[string]interface{}{}
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.cause != nil {
+		return p.Title + ": " + p.cause.Error()
+	}
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// MarshalJSON puts the extensions next to the standard members
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+7)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+	if p.RequestID != "" {
+		members["requestId"] = p.RequestID
+	}
+	if len(p.Errors) > 0 {
+		members["errors"] = p.Errors
+	}
+	return json.Marshal(members)
+}
+
+// UnmarshalJSON reads the standard members, the other ones end up in the extensions
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	*p = Problem{}
+	fields := map[string]interface{}{
+		"type": &p.Type, "title": &p.Title, "status": &p.Status, "detail": &p.Detail,
+		"instance": &p.Instance, "requestId": &p.RequestID, "errors": &p.Errors,
+	}
+	for key, raw := range members {
+		if dst, ok := fields[key]; ok {
+			if err := json.Unmarshal(raw, dst); err != nil {
+				return fmt.Errorf("problem member %s: %w", key, err)
+			}
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		p.With(key, value)
+	}
+	return nil
+}
+
+// Write sends the problem, internal errors are logged with their cause
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = w.Header().Get(requestIDHeader)
+	}
+	if p.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("request failed", "status", p.Status, "error", p.cause)
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error sends err as a problem, errors that are not a *Problem are internal
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	if !errors.As(err, &p) {
+		p = Internal(err)
+	}
+	Write(w, r, p)
+}
@@ -0,0 +1,89 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(requestIDHeader, "req-1")
+	Write(rec, httptest.NewRequest("POST", "/api/notes/", nil), Conflict("title", "A note with this title already exists"))
+
+	if rec.Code != http.StatusConflict || rec.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var body map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	want := map[string]interface{}{
+		"type":      TypeConflict,
+		"title":     "Resource already exists",
+		"status":    float64(http.StatusConflict),
+		"detail":    "A note with this title already exists",
+		"instance":  "/api/notes/",
+		"requestId": "req-1",
+		"field":     "title",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s: expected %v, got %v", key, value, body[key])
+		}
+	}
+
+	var decoded Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Status != http.StatusConflict || decoded.RequestID != "req-1" || decoded.Extensions["field"] != "title" {
+		t.Errorf("unexpected round trip %+v", decoded)
+	}
+}
+
+func TestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Error(rec, httptest.NewRequest("GET", "/", nil), errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "10.0.0.5") {
+		t.Errorf("expected a generic 500, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	wrapped := errors.Join(errors.New("context"), New(http.StatusNotFound, "No note with that ID exists"))
+	Error(rec, httptest.NewRequest("GET", "/", nil), wrapped)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected the wrapped problem to be written, got %d", rec.Code)
+	}
+}
+
+func TestInvalidBody(t *testing.T) {
+	decode := func(body string) error {
+		var v struct {
+			Title string `json:"title"`
+		}
+		return json.NewDecoder(strings.NewReader(body)).Decode(&v)
+	}
+
+	tests := []struct {
+		body   string
+		detail string
+		field  string
+	}{
+		{"", "The request body is empty", ""},
+		{`{"title":`, "The request body is truncated JSON", ""},
+		{`{"title" 1}`, "The request body is malformed JSON at offset 10", ""},
+		{`{"title": 1}`, "1 field is invalid", "title"},
+	}
+	for _, tt := range tests {
+		p := InvalidBody(decode(tt.body))
+		if p.Status != http.StatusBadRequest || p.Detail != tt.detail {
+			t.Errorf("%q: unexpected problem %+v", tt.body, p)
+		}
+		if tt.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.field || p.Errors[0].Message != "must be a string") {
+			t.Errorf("%q: expected an error on %s, got %+v", tt.body, tt.field, p.Errors)
+		}
+	}
+}
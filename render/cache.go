@@ -0,0 +1,61 @@
+package render
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	updatedAt time.Time
+	result    *Result
+}
+
+// Cache keeps rendered notes in memory keyed by note id
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+	size    int
+}
+
+// NewCache returns a cache holding at most size rendered notes
+func NewCache(size int) *Cache {
+	return &Cache{
+		entries: make(map[string]cacheEntry),
+		size:    size,
+	}
+}
+
+// Get returns the cached result for a note if it was rendered from the same revision
+func (c *Cache) Get(noteID string, updatedAt time.Time) (*Result, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[noteID]
+	if !ok || !entry.updatedAt.Equal(updatedAt) {
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// Set stores the rendered result of a note revision
+func (c *Cache) Set(noteID string, updatedAt time.Time, result *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// drop an arbitrary entry once the cache is full
+	if _, ok := c.entries[noteID]; !ok && len(c.entries) >= c.size {
+		for id := range c.entries {
+			delete(c.entries, id)
+			break
+		}
+	}
+	c.entries[noteID] = cacheEntry{updatedAt: updatedAt, result: result}
+}
+
+// Invalidate removes a note from the cache
+func (c *Cache) Invalidate(noteID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, noteID)
+}
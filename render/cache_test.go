@@ -0,0 +1,36 @@
+package render
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2)
+	revision := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	result := &Result{HTML: "<p>v1</p>"}
+	cache.Set("a", revision, result)
+
+	if got, ok := cache.Get("a", revision); !ok || got != result {
+		t.Fatalf("expected the cached result, got %v %v", got, ok)
+	}
+	// an update changes UpdatedAt, the previous rendering is not served
+	if _, ok := cache.Get("a", revision.Add(time.Millisecond)); ok {
+		t.Errorf("expected a new revision to miss the cache")
+	}
+
+	cache.Invalidate("a")
+	if _, ok := cache.Get("a", revision); ok {
+		t.Errorf("expected the invalidated entry to be gone")
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		cache.Set(id, revision, result)
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("expected the cache to hold 2 entries, got %d", len(cache.entries))
+	}
+	if _, ok := cache.Get("c", revision); !ok {
+		t.Errorf("expected the last entry to be cached")
+	}
+}
@@ -0,0 +1,132 @@
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// supported content formats
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// TocEntry is a single heading in the generated table of contents
+type TocEntry struct {
+	Level  int    `json:"level"`
+	Title  string `json:"title"`
+	Anchor string `json:"anchor"`
+}
+
+// Result holds the sanitized html and the table of contents of a note
+type Result struct {
+	HTML string     `json:"html"`
+	Toc  []TocEntry `json:"toc"`
+}
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+var policy = newPolicy()
+
+// newPolicy builds the sanitizer policy used for every rendered note.
+// It allows the elements markdown renders to and ids on headings only. The user generated content policy of
+// bluemonday is not used as it allows loosely matched ids on every element.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowElements("h1", "h2", "h3", "h4", "h5", "h6", "p", "br", "hr", "blockquote", "pre", "code", "em", "strong", "del")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[A-Za-z0-9_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("title").Matching(bluemonday.Paragraph).OnElements("a", "img")
+	p.AllowImages()
+	p.AllowLists()
+	p.AllowTables()
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}
+
+// Render converts content in the given format to sanitized html
+func Render(content, format string) (*Result, error) {
+	if format != FormatMarkdown {
+		return renderPlain(content), nil
+	}
+
+	source := []byte(content)
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, source, doc); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		HTML: policy.Sanitize(buf.String()),
+		Toc:  tableOfContents(doc, source),
+	}, nil
+}
+
+// renderPlain escapes plain text and keeps its line breaks
+func renderPlain(content string) *Result {
+	return &Result{
+		HTML: "<pre>" + html.EscapeString(content) + "</pre>",
+		Toc:  []TocEntry{},
+	}
+}
+
+// tableOfContents collects every heading of the document in order
+func tableOfContents(doc ast.Node, source []byte) []TocEntry {
+	toc := []TocEntry{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		anchor := ""
+		if id, ok := heading.AttributeString("id"); ok {
+			if b, ok := id.([]byte); ok {
+				anchor = string(b)
+			}
+		}
+
+		toc = append(toc, TocEntry{
+			Level:  heading.Level,
+			Title:  strings.TrimSpace(nodeText(heading, source)),
+			Anchor: anchor,
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
+
+// nodeText returns the plain text of an inline node tree
+func nodeText(n ast.Node, source []byte) string {
+	var sb strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.Text:
+			sb.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(t.Value)
+		default:
+			sb.WriteString(nodeText(c, source))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// forbidden must not appear in the html, lowercased
+		forbidden []string
+		want      string
+	}{
+		{"script", "<script>alert(1)</script>\n\ntext", []string{"<script", "alert"}, "<p>text</p>"},
+		{"javascript link", "[click](javascript:alert(1))", []string{"href", "javascript"}, "click"},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD4=)", []string{"href", "data:"}, "click"},
+		{"data image", "![x](data:image/svg+xml;base64,PHN2Zz4=)", []string{"src", "data:"}, `alt="x"`},
+		{"event attribute", `<a href="/notes" onclick="alert(1)">x</a>`, []string{"onclick", "alert"}, ""},
+		{"iframe", `<iframe src="https://example.com"></iframe>`, []string{"<iframe"}, ""},
+		{"image onerror", `<img src="x" onerror="alert(1)">`, []string{"onerror", "alert"}, ""},
+		{"inline image onerror", `text <img src="x" onerror="alert(1)"> text`, []string{"onerror", "alert"}, "text"},
+		{"safe link", "[notes](https://example.com/notes)", nil, `<a href="https://example.com/notes" rel="nofollow noopener" target="_blank">notes</a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Render(tt.content, FormatMarkdown)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			html := strings.ToLower(result.HTML)
+			for _, forbidden := range tt.forbidden {
+				if strings.Contains(html, forbidden) {
+					t.Errorf("expected %q to be removed from %q", forbidden, result.HTML)
+				}
+			}
+			if !strings.Contains(result.HTML, tt.want) {
+				t.Errorf("expected %q in %q", tt.want, result.HTML)
+			}
+		})
+	}
+}
+
+func TestPolicyHeadingIDs(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{`<h2 id="intro_1-a">Intro</h2>`, `<h2 id="intro_1-a">Intro</h2>`},
+		{`<h2 id="two words">Intro</h2>`, `<h2>Intro</h2>`},
+		{`<h2 id="a:b.c">Intro</h2>`, `<h2>Intro</h2>`},
+		{`<h3 id="x&quot;onclick=&quot;y">Intro</h3>`, `<h3>Intro</h3>`},
+		{`<p id="intro">text</p>`, `<p>text</p>`},
+	}
+	for _, tt := range tests {
+		if got := policy.Sanitize(tt.html); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.html, tt.want, got)
+		}
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	result, err := Render("# Notes API\n\n## Getting started\n\n### Ünïcode héading\n\n## Getting started\n", FormatMarkdown)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	want := []TocEntry{
+		{Level: 1, Title: "Notes API"},
+		{Level: 2, Title: "Getting started"},
+		{Level: 3, Title: "Ünïcode héading"},
+		{Level: 2, Title: "Getting started"},
+	}
+	if len(result.Toc) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), result.Toc)
+	}
+	ids := regexp.MustCompile(`<h\d id="([^"]+)"`).FindAllStringSubmatch(result.HTML, -1)
+	for i, entry := range result.Toc {
+		if entry.Level != want[i].Level || entry.Title != want[i].Title {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entry)
+		}
+		// every anchor links to the id of its heading
+		if i >= len(ids) || entry.Anchor != ids[i][1] {
+			t.Errorf("entry %d: anchor %q does not match the heading ids %v", i, entry.Anchor, ids)
+		}
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	result, err := Render("<b>bold</b>\nline", FormatPlain)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if result.HTML != "<pre>&lt;b&gt;bold&lt;/b&gt;\nline</pre>" || len(result.Toc) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
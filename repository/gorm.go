@@ -0,0 +1,492 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"example/rest-api/db"
+	"example/rest-api/models"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const streamBatchSize = 100
+
+// GormStore implements the repositories on top of a gorm connection
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Notes() NoteRepository {
+	return &gormNoteRepository{db: s.db}
+}
+
+func (s *GormStore) Users() UserRepository {
+	return &gormUserRepository{db: s.db}
+}
+
+func (s *GormStore) Attachments() AttachmentRepository {
+	return &gormAttachmentRepository{db: s.db}
+}
+
+func (s *GormStore) IdempotencyKeys() IdempotencyRepository {
+	return &gormIdempotencyRepository{db: s.db}
+}
+
+func (s *GormStore) Webhooks() WebhookRepository {
+	return &gormWebhookRepository{db: s.db}
+}
+
+func (s *GormStore) WebhookDeliveries() WebhookDeliveryRepository {
+	return &gormWebhookDeliveryRepository{db: s.db}
+}
+
+func (s *GormStore) Outbox() OutboxRepository {
+	return &gormOutboxRepository{db: s.db}
+}
+
+// Transaction uses a savepoint when the store is already bound to a transaction
+func (s *GormStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormStore{db: tx})
+	})
+}
+
+// translate maps gorm and postgres errors to the repository errors
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if field, ok := db.UniqueViolation(err); ok {
+		return &ConflictError{Field: field}
+	}
+	return err
+}
+
+type gormNoteRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormNoteRepository) Create(ctx context.Context, note *models.Note) error {
+	return translate(r.db.WithContext(ctx).Create(note).Error)
+}
+
+func (r *gormNoteRepository) FindByID(ctx context.Context, id string) (*models.Note, error) {
+	var note models.Note
+	if err := r.db.WithContext(ctx).First(&note, "id = ?", id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &note, nil
+}
+
+func (r *gormNoteRepository) FindByIDForUpdate(ctx context.Context, id string) (*models.Note, error) {
+	var note models.Note
+	if err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&note, "id = ?", id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &note, nil
+}
+
+func (r *gormNoteRepository) FindByTitle(ctx context.Context, userID, title string) (*models.Note, error) {
+	var note models.Note
+	if err := r.db.WithContext(ctx).First(&note, "user_id = ? AND title = ?", userID, title).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &note, nil
+}
+
+func (r *gormNoteRepository) List(ctx context.Context, filter NoteFilter, limit, offset int) ([]models.Note, error) {
+	var notes []models.Note
+	err := filterNotes(r.db.WithContext(ctx), filter).Order("created_at, id").Limit(limit).Offset(offset).Find(&notes).Error
+	return notes, translate(err)
+}
+
+func (r *gormNoteRepository) Search(ctx context.Context, filter NoteFilter) ([]models.Note, error) {
+	var notes []models.Note
+	err := filterNotes(r.db.WithContext(ctx), filter).Order("created_at, id").Find(&notes).Error
+	return notes, translate(err)
+}
+
+// filterNotes adds the conditions of filter to a query on the notes
+func filterNotes(db *gorm.DB, filter NoteFilter) *gorm.DB {
+	query := db.Model(&models.Note{})
+	if filter.Title != "" {
+		query = query.Where("title ILIKE ?", "%"+filter.Title+"%")
+	}
+	if filter.Content != "" {
+		query = query.Where("content ILIKE ?", "%"+filter.Content+"%")
+	}
+	if filter.Category != "" {
+		query = query.Where("category ILIKE ?", "%"+filter.Category+"%")
+	}
+	if len(filter.UserIDs) > 0 {
+		query = query.Where("user_id IN ?", filter.UserIDs)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("tags && ?", pq.StringArray(filter.Tags))
+	}
+	if filter.VisibleTo != "" {
+		query = query.Where("(user_id = ? OR published)", filter.VisibleTo)
+	}
+	return query
+}
+
+func (r *gormNoteRepository) Tags(ctx context.Context, visibleTo string) ([]TagCount, error) {
+	tags := []TagCount{}
+	err := filterNotes(r.db.WithContext(ctx), NoteFilter{VisibleTo: visibleTo}).
+		Select("unnest(tags) AS name, count(*) AS count").
+		Group("name").Order("name").Scan(&tags).Error
+	return tags, translate(err)
+}
+
+// StreamByUser reads the notes a page at a time, every page starting after the last note of the previous one.
+// FindInBatches pages by id alone, which skips notes since the ids are random.
+func (r *gormNoteRepository) StreamByUser(ctx context.Context, userID string, fn func(note *models.Note) error) error {
+	var lastCreatedAt time.Time
+	var lastID string
+	for {
+		query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+		if lastID != "" {
+			query = query.Where("(created_at, id) > (?, ?)", lastCreatedAt, lastID)
+		}
+		var batch []models.Note
+		if err := query.Order("created_at, id").Limit(streamBatchSize).Find(&batch).Error; err != nil {
+			return translate(err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		lastCreatedAt, lastID = batch[len(batch)-1].CreatedAt, batch[len(batch)-1].ID
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < streamBatchSize {
+			return nil
+		}
+	}
+}
+
+func (r *gormNoteRepository) Update(ctx context.Context, note *models.Note) error {
+	result := r.db.WithContext(ctx).Model(note).Select("*").Omit("id", "created_at").Updates(note)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormNoteRepository) Delete(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Delete(&models.Note{}, "id = ?", id)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return translate(r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r *gormUserRepository) FindByID(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error
+	return users, translate(err)
+}
+
+func (r *gormUserRepository) FindByLogin(ctx context.Context, email, username string) (*models.User, error) {
+	query := r.db.WithContext(ctx).Where("email = ?", email)
+	if username != "" {
+		query = query.Or("username = ?", username)
+	}
+
+	var user models.User
+	if err := query.First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+type gormAttachmentRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	return translate(r.db.WithContext(ctx).Create(attachment).Error)
+}
+
+func (r *gormAttachmentRepository) FindByID(ctx context.Context, noteID, id string) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := r.db.WithContext(ctx).First(&attachment, "id = ? AND note_id = ?", id, noteID).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &attachment, nil
+}
+
+func (r *gormAttachmentRepository) ListByNote(ctx context.Context, noteID string) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.WithContext(ctx).Where("note_id = ?", noteID).Order("created_at, id").Find(&attachments).Error
+	return attachments, translate(err)
+}
+
+func (r *gormAttachmentRepository) Delete(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Delete(&models.Attachment{}, "id = ?", id)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormAttachmentRepository) DeleteByNote(ctx context.Context, noteID string) ([]string, error) {
+	var keys []string
+	err := r.db.WithContext(ctx).Model(&models.Attachment{}).Where("note_id = ?", noteID).Pluck("storage_key", &keys).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	if err := r.db.WithContext(ctx).Delete(&models.Attachment{}, "note_id = ?", noteID).Error; err != nil {
+		return nil, translate(err)
+	}
+	return keys, nil
+}
+
+type gormIdempotencyRepository struct {
+	db *gorm.DB
+}
+
+// Reserve relies on the primary key, of two concurrent requests only one inserts the key
+func (r *gormIdempotencyRepository) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"fingerprint", "status_code", "content_type", "body", "created_at", "expires_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Lte{Column: clause.Column{Table: "idempotency_keys", Name: "expires_at"}, Value: key.CreatedAt},
+		}},
+	}).Create(key)
+	if result.Error != nil {
+		return nil, translate(result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := r.db.WithContext(ctx).First(&existing, "user_id = ? AND key = ?", key.UserID, key.Key).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &existing, nil
+}
+
+func (r *gormIdempotencyRepository) Complete(ctx context.Context, key *models.IdempotencyKey) error {
+	result := r.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", key.UserID, key.Key).
+		Updates(map[string]interface{}{"status_code": key.StatusCode, "content_type": key.ContentType, "body": key.Body})
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormIdempotencyRepository) Release(ctx context.Context, userID, key string) error {
+	err := r.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, "user_id = ? AND key = ? AND status_code = 0", userID, key).Error
+	return translate(err)
+}
+
+func (r *gormIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&models.IdempotencyKey{}, "expires_at <= ?", now)
+	return result.RowsAffected, translate(result.Error)
+}
+
+type gormWebhookRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormWebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	return translate(r.db.WithContext(ctx).Create(webhook).Error)
+}
+
+func (r *gormWebhookRepository) FindByID(ctx context.Context, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := r.db.WithContext(ctx).First(&webhook, "id = ?", id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &webhook, nil
+}
+
+func (r *gormWebhookRepository) ListByUser(ctx context.Context, userID string) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at, id").Find(&webhooks).Error
+	return webhooks, translate(err)
+}
+
+func (r *gormWebhookRepository) Subscribed(ctx context.Context, userID, event string) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := r.db.WithContext(ctx).
+		Where("active AND user_id IN (?, '')", userID).
+		Where("(events IS NULL OR cardinality(events) = 0 OR ? = ANY(events))", event).
+		Order("created_at, id").Find(&webhooks).Error
+	return webhooks, translate(err)
+}
+
+func (r *gormWebhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	result := r.db.WithContext(ctx).Model(webhook).Select("url", "events", "secret", "active", "updated_at").Updates(webhook)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete relies on the foreign key of the deliveries to delete them
+func (r *gormWebhookRepository) Delete(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Delete(&models.Webhook{}, "id = ?", id)
+	if result.Error != nil {
+		return translate(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormWebhookDeliveryRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormWebhookDeliveryRepository) Create(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return translate(r.db.WithContext(ctx).Create(delivery).Error)
+}
+
+func (r *gormWebhookDeliveryRepository) FindByID(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := r.db.WithContext(ctx).First(&delivery, "id = ? AND webhook_id = ?", id, webhookID).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &delivery, nil
+}
+
+func (r *gormWebhookDeliveryRepository) ListByWebhook(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.WithContext(ctx).Where("webhook_id = ?", webhookID).Order("created_at DESC, id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, translate(err)
+}
+
+// Claim locks the due deliveries with SKIP LOCKED, concurrent dispatchers claim distinct deliveries
+func (r *gormWebhookDeliveryRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+			Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]string, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+			deliveries[i].NextAttemptAt = now.Add(lease)
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return deliveries, translate(err)
+}
+
+func (r *gormWebhookDeliveryRepository) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return translate(r.db.WithContext(ctx).Save(delivery).Error)
+}
+
+type gormOutboxRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOutboxRepository) Append(ctx context.Context, event *models.OutboxEvent) error {
+	return translate(r.db.WithContext(ctx).Create(event).Error)
+}
+
+func (r *gormOutboxRepository) FindByID(ctx context.Context, id int64) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	if err := r.db.WithContext(ctx).First(&event, "id = ?", id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &event, nil
+}
+
+// Claim locks the due events with SKIP LOCKED, concurrent relays claim distinct events
+func (r *gormOutboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error) {
+	events := []models.OutboxEvent{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").Limit(limit).Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]int64, len(events))
+		for i := range events {
+			ids[i] = events[i].ID
+			events[i].NextAttemptAt = now.Add(lease)
+		}
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return events, translate(err)
+}
+
+func (r *gormOutboxRepository) Update(ctx context.Context, event *models.OutboxEvent) error {
+	return translate(r.db.WithContext(ctx).Save(event).Error)
+}
+
+func (r *gormOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Delete(&models.OutboxEvent{}, "published_at < ?", before)
+	return result.RowsAffected, translate(result.Error)
+}
+
+// Notify uses pg_notify, the notification is sent when the transaction of r commits
+func (r *gormOutboxRepository) Notify(ctx context.Context, id int64) error {
+	return translate(r.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", NotifyChannel, strconv.FormatInt(id, 10)).Error)
+}
@@ -0,0 +1,771 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example/rest-api/models"
+)
+
+// memoryData is the content of an in-memory store
+type memoryData struct {
+	notes       map[string]models.Note
+	users       map[string]models.User
+	attachments map[string]models.Attachment
+	// idempotencyKeys are indexed by user id and key
+	idempotencyKeys map[[2]string]models.IdempotencyKey
+	webhooks        map[string]models.Webhook
+	deliveries      map[string]models.WebhookDelivery
+	outbox          map[int64]models.OutboxEvent
+	// outboxSeq is the ID of the last event appended to the outbox
+	outboxSeq int64
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		notes:           make(map[string]models.Note, len(d.notes)),
+		users:           make(map[string]models.User, len(d.users)),
+		attachments:     make(map[string]models.Attachment, len(d.attachments)),
+		idempotencyKeys: make(map[[2]string]models.IdempotencyKey, len(d.idempotencyKeys)),
+		webhooks:        make(map[string]models.Webhook, len(d.webhooks)),
+		deliveries:      make(map[string]models.WebhookDelivery, len(d.deliveries)),
+		outbox:          make(map[int64]models.OutboxEvent, len(d.outbox)),
+		outboxSeq:       d.outboxSeq,
+	}
+	for id, note := range d.notes {
+		c.notes[id] = note
+	}
+	for id, user := range d.users {
+		c.users[id] = user
+	}
+	for id, attachment := range d.attachments {
+		c.attachments[id] = attachment
+	}
+	for id, key := range d.idempotencyKeys {
+		c.idempotencyKeys[id] = key
+	}
+	for id, webhook := range d.webhooks {
+		c.webhooks[id] = webhook
+	}
+	for id, delivery := range d.deliveries {
+		c.deliveries[id] = delivery
+	}
+	for id, event := range d.outbox {
+		c.outbox[id] = event
+	}
+	return c
+}
+
+// MemoryStore keeps everything in memory, it is meant for tests and local development.
+// Transactions are serialized and work on a copy of the data that replaces the original on commit.
+type MemoryStore struct {
+	mu   *sync.Mutex
+	data *memoryData
+	inTx bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.Mutex{},
+		data: &memoryData{
+			notes:           make(map[string]models.Note),
+			users:           make(map[string]models.User),
+			attachments:     make(map[string]models.Attachment),
+			idempotencyKeys: make(map[[2]string]models.IdempotencyKey),
+			webhooks:        make(map[string]models.Webhook),
+			deliveries:      make(map[string]models.WebhookDelivery),
+			outbox:          make(map[int64]models.OutboxEvent),
+		},
+	}
+}
+
+// lock guards a single operation, inside a transaction the lock is already held
+func (s *MemoryStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (s *MemoryStore) Notes() NoteRepository {
+	return &memoryNoteRepository{store: s}
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return &memoryUserRepository{store: s}
+}
+
+func (s *MemoryStore) Attachments() AttachmentRepository {
+	return &memoryAttachmentRepository{store: s}
+}
+
+func (s *MemoryStore) IdempotencyKeys() IdempotencyRepository {
+	return &memoryIdempotencyRepository{store: s}
+}
+
+func (s *MemoryStore) Webhooks() WebhookRepository {
+	return &memoryWebhookRepository{store: s}
+}
+
+func (s *MemoryStore) WebhookDeliveries() WebhookDeliveryRepository {
+	return &memoryWebhookDeliveryRepository{store: s}
+}
+
+func (s *MemoryStore) Outbox() OutboxRepository {
+	return &memoryOutboxRepository{store: s}
+}
+
+func (s *MemoryStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	defer s.lock()()
+
+	tx := &MemoryStore{mu: s.mu, data: s.data.clone(), inTx: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	*s.data = *tx.data
+	return nil
+}
+
+// copyNote detaches the tags of a note from the stored copy
+func copyNote(note models.Note) models.Note {
+	if note.Tags != nil {
+		note.Tags = append(note.Tags[:0:0], note.Tags...)
+	}
+	return note
+}
+
+// sortNotes orders notes like the gorm repository does
+func sortNotes(notes []models.Note) {
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].CreatedAt.Equal(notes[j].CreatedAt) {
+			return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+		}
+		return notes[i].ID < notes[j].ID
+	})
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type memoryNoteRepository struct {
+	store *MemoryStore
+}
+
+// titleTaken enforces the unique (user_id, title) index
+func (r *memoryNoteRepository) titleTaken(note *models.Note) bool {
+	for id, other := range r.store.data.notes {
+		if id != note.ID && other.UserID == note.UserID && other.Title == note.Title {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryNoteRepository) Create(ctx context.Context, note *models.Note) error {
+	defer r.store.lock()()
+
+	note.BeforeCreate(nil)
+	if r.titleTaken(note) {
+		return &ConflictError{Field: "title"}
+	}
+
+	now := time.Now()
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = now
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = now
+	}
+	if note.ContentFormat == "" {
+		note.ContentFormat = "plain"
+	}
+
+	r.store.data.notes[note.ID] = copyNote(*note)
+	return nil
+}
+
+func (r *memoryNoteRepository) FindByID(ctx context.Context, id string) (*models.Note, error) {
+	defer r.store.lock()()
+
+	note, ok := r.store.data.notes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	note = copyNote(note)
+	return &note, nil
+}
+
+// FindByIDForUpdate returns the note, the transactions are serialized so it is locked already
+func (r *memoryNoteRepository) FindByIDForUpdate(ctx context.Context, id string) (*models.Note, error) {
+	return r.FindByID(ctx, id)
+}
+
+func (r *memoryNoteRepository) FindByTitle(ctx context.Context, userID, title string) (*models.Note, error) {
+	defer r.store.lock()()
+
+	for _, note := range r.store.data.notes {
+		if note.UserID == userID && note.Title == title {
+			note = copyNote(note)
+			return &note, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// filter returns the sorted notes matching keep, the lock must be held
+func (r *memoryNoteRepository) filter(keep func(note *models.Note) bool) []models.Note {
+	notes := []models.Note{}
+	for _, note := range r.store.data.notes {
+		if keep(&note) {
+			notes = append(notes, copyNote(note))
+		}
+	}
+	sortNotes(notes)
+	return notes
+}
+
+func (r *memoryNoteRepository) List(ctx context.Context, filter NoteFilter, limit, offset int) ([]models.Note, error) {
+	defer r.store.lock()()
+
+	notes := r.filter(func(note *models.Note) bool { return matchesFilter(note, filter) })
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(notes) {
+		return []models.Note{}, nil
+	}
+	notes = notes[offset:]
+	if limit >= 0 && limit < len(notes) {
+		notes = notes[:limit]
+	}
+	return notes, nil
+}
+
+func (r *memoryNoteRepository) Search(ctx context.Context, filter NoteFilter) ([]models.Note, error) {
+	defer r.store.lock()()
+
+	return r.filter(func(note *models.Note) bool { return matchesFilter(note, filter) }), nil
+}
+
+// matchesFilter reports whether a note matches every condition of filter
+func matchesFilter(note *models.Note, filter NoteFilter) bool {
+	return containsFold(note.Title, filter.Title) &&
+		containsFold(note.Content, filter.Content) &&
+		containsFold(note.Category, filter.Category) &&
+		(len(filter.UserIDs) == 0 || slices.Contains(filter.UserIDs, note.UserID)) &&
+		(len(filter.Tags) == 0 || slices.ContainsFunc(note.Tags, func(tag string) bool {
+			return slices.Contains(filter.Tags, tag)
+		})) &&
+		(filter.VisibleTo == "" || note.UserID == filter.VisibleTo || note.Published)
+}
+
+func (r *memoryNoteRepository) Tags(ctx context.Context, visibleTo string) ([]TagCount, error) {
+	defer r.store.lock()()
+
+	counts := map[string]int{}
+	for _, note := range r.store.data.notes {
+		if !matchesFilter(&note, NoteFilter{VisibleTo: visibleTo}) {
+			continue
+		}
+		for _, tag := range note.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (r *memoryNoteRepository) StreamByUser(ctx context.Context, userID string, fn func(note *models.Note) error) error {
+	unlock := r.store.lock()
+	notes := r.filter(func(note *models.Note) bool { return note.UserID == userID })
+	unlock()
+
+	for i := range notes {
+		if err := fn(&notes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryNoteRepository) Update(ctx context.Context, note *models.Note) error {
+	defer r.store.lock()()
+
+	existing, ok := r.store.data.notes[note.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if r.titleTaken(note) {
+		return &ConflictError{Field: "title"}
+	}
+
+	note.CreatedAt = existing.CreatedAt
+	note.UpdatedAt = time.Now()
+	r.store.data.notes[note.ID] = copyNote(*note)
+	return nil
+}
+
+func (r *memoryNoteRepository) Delete(ctx context.Context, id string) error {
+	defer r.store.lock()()
+
+	if _, ok := r.store.data.notes[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.data.notes, id)
+	return nil
+}
+
+type memoryUserRepository struct {
+	store *MemoryStore
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	defer r.store.lock()()
+
+	for _, other := range r.store.data.users {
+		if other.Username == user.Username {
+			return &ConflictError{Field: "username"}
+		}
+		if other.Email == user.Email {
+			return &ConflictError{Field: "email"}
+		}
+	}
+
+	user.BeforeCreate(nil)
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	r.store.data.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) FindByID(ctx context.Context, id string) (*models.User, error) {
+	defer r.store.lock()()
+
+	user, ok := r.store.data.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) FindByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	defer r.store.lock()()
+
+	users := []models.User{}
+	for _, id := range ids {
+		if user, ok := r.store.data.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepository) FindByLogin(ctx context.Context, email, username string) (*models.User, error) {
+	defer r.store.lock()()
+
+	for _, user := range r.store.data.users {
+		if user.Email == email || (username != "" && user.Username == username) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+type memoryAttachmentRepository struct {
+	store *MemoryStore
+}
+
+func (r *memoryAttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	defer r.store.lock()()
+
+	// the note must exist, like the foreign key of the attachments table requires
+	if _, ok := r.store.data.notes[attachment.NoteID]; !ok {
+		return ErrNotFound
+	}
+	attachment.BeforeCreate(nil)
+	if attachment.CreatedAt.IsZero() {
+		attachment.CreatedAt = time.Now()
+	}
+
+	r.store.data.attachments[attachment.ID] = *attachment
+	return nil
+}
+
+func (r *memoryAttachmentRepository) FindByID(ctx context.Context, noteID, id string) (*models.Attachment, error) {
+	defer r.store.lock()()
+
+	attachment, ok := r.store.data.attachments[id]
+	if !ok || attachment.NoteID != noteID {
+		return nil, ErrNotFound
+	}
+	return &attachment, nil
+}
+
+func (r *memoryAttachmentRepository) ListByNote(ctx context.Context, noteID string) ([]models.Attachment, error) {
+	defer r.store.lock()()
+
+	attachments := []models.Attachment{}
+	for _, attachment := range r.store.data.attachments {
+		if attachment.NoteID == noteID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments, nil
+}
+
+func (r *memoryAttachmentRepository) Delete(ctx context.Context, id string) error {
+	defer r.store.lock()()
+
+	if _, ok := r.store.data.attachments[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.data.attachments, id)
+	return nil
+}
+
+func (r *memoryAttachmentRepository) DeleteByNote(ctx context.Context, noteID string) ([]string, error) {
+	defer r.store.lock()()
+
+	var keys []string
+	for id, attachment := range r.store.data.attachments {
+		if attachment.NoteID == noteID {
+			keys = append(keys, attachment.StorageKey)
+			delete(r.store.data.attachments, id)
+		}
+	}
+	return keys, nil
+}
+
+type memoryIdempotencyRepository struct {
+	store *MemoryStore
+}
+
+func (r *memoryIdempotencyRepository) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	defer r.store.lock()()
+
+	id := [2]string{key.UserID, key.Key}
+	if existing, ok := r.store.data.idempotencyKeys[id]; ok && existing.ExpiresAt.After(key.CreatedAt) {
+		return &existing, nil
+	}
+	r.store.data.idempotencyKeys[id] = *key
+	return nil, nil
+}
+
+func (r *memoryIdempotencyRepository) Complete(ctx context.Context, key *models.IdempotencyKey) error {
+	defer r.store.lock()()
+
+	id := [2]string{key.UserID, key.Key}
+	if _, ok := r.store.data.idempotencyKeys[id]; !ok {
+		return ErrNotFound
+	}
+	r.store.data.idempotencyKeys[id] = *key
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) Release(ctx context.Context, userID, key string) error {
+	defer r.store.lock()()
+
+	id := [2]string{userID, key}
+	if existing, ok := r.store.data.idempotencyKeys[id]; ok && existing.InFlight() {
+		delete(r.store.data.idempotencyKeys, id)
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	defer r.store.lock()()
+
+	var deleted int64
+	for id, key := range r.store.data.idempotencyKeys {
+		if !key.ExpiresAt.After(now) {
+			delete(r.store.data.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// copyWebhook detaches the events of a webhook from the stored copy
+func copyWebhook(webhook models.Webhook) models.Webhook {
+	if webhook.Events != nil {
+		webhook.Events = append(webhook.Events[:0:0], webhook.Events...)
+	}
+	return webhook
+}
+
+type memoryWebhookRepository struct {
+	store *MemoryStore
+}
+
+func (r *memoryWebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	defer r.store.lock()()
+
+	webhook.BeforeCreate(nil)
+	now := time.Now()
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = now
+	}
+	if webhook.UpdatedAt.IsZero() {
+		webhook.UpdatedAt = now
+	}
+
+	r.store.data.webhooks[webhook.ID] = copyWebhook(*webhook)
+	return nil
+}
+
+func (r *memoryWebhookRepository) FindByID(ctx context.Context, id string) (*models.Webhook, error) {
+	defer r.store.lock()()
+
+	webhook, ok := r.store.data.webhooks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	webhook = copyWebhook(webhook)
+	return &webhook, nil
+}
+
+// filter returns the webhooks matching keep in creation order, the lock must be held
+func (r *memoryWebhookRepository) filter(keep func(webhook *models.Webhook) bool) []models.Webhook {
+	webhooks := []models.Webhook{}
+	for _, webhook := range r.store.data.webhooks {
+		if keep(&webhook) {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+func (r *memoryWebhookRepository) ListByUser(ctx context.Context, userID string) ([]models.Webhook, error) {
+	defer r.store.lock()()
+
+	return r.filter(func(webhook *models.Webhook) bool { return webhook.UserID == userID }), nil
+}
+
+func (r *memoryWebhookRepository) Subscribed(ctx context.Context, userID, event string) ([]models.Webhook, error) {
+	defer r.store.lock()()
+
+	return r.filter(func(webhook *models.Webhook) bool {
+		return (webhook.UserID == "" || webhook.UserID == userID) && webhook.Subscribed(event)
+	}), nil
+}
+
+func (r *memoryWebhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	defer r.store.lock()()
+
+	existing, ok := r.store.data.webhooks[webhook.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	webhook.CreatedAt = existing.CreatedAt
+	webhook.UpdatedAt = time.Now()
+	r.store.data.webhooks[webhook.ID] = copyWebhook(*webhook)
+	return nil
+}
+
+func (r *memoryWebhookRepository) Delete(ctx context.Context, id string) error {
+	defer r.store.lock()()
+
+	if _, ok := r.store.data.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.data.webhooks, id)
+	for deliveryID, delivery := range r.store.data.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.store.data.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+type memoryWebhookDeliveryRepository struct {
+	store *MemoryStore
+}
+
+func (r *memoryWebhookDeliveryRepository) Create(ctx context.Context, delivery *models.WebhookDelivery) error {
+	defer r.store.lock()()
+
+	if _, ok := r.store.data.webhooks[delivery.WebhookID]; !ok {
+		return ErrNotFound
+	}
+	delivery.BeforeCreate(nil)
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	if delivery.Status == "" {
+		delivery.Status = models.DeliveryPending
+	}
+
+	r.store.data.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (r *memoryWebhookDeliveryRepository) FindByID(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	defer r.store.lock()()
+
+	delivery, ok := r.store.data.deliveries[id]
+	if !ok || delivery.WebhookID != webhookID {
+		return nil, ErrNotFound
+	}
+	return &delivery, nil
+}
+
+func (r *memoryWebhookDeliveryRepository) ListByWebhook(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	defer r.store.lock()()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range r.store.data.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	if limit >= 0 && limit < len(deliveries) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *memoryWebhookDeliveryRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	defer r.store.lock()()
+
+	due := []models.WebhookDelivery{}
+	for _, delivery := range r.store.data.deliveries {
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if limit < len(due) {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].NextAttemptAt = now.Add(lease)
+		r.store.data.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (r *memoryWebhookDeliveryRepository) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	defer r.store.lock()()
+
+	if _, ok := r.store.data.deliveries[delivery.ID]; !ok {
+		return ErrNotFound
+	}
+	r.store.data.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+type memoryOutboxRepository struct {
+	store *MemoryStore
+}
+
+func (r *memoryOutboxRepository) Append(ctx context.Context, event *models.OutboxEvent) error {
+	defer r.store.lock()()
+
+	for _, existing := range r.store.data.outbox {
+		if existing.EventID == event.EventID {
+			return &ConflictError{Field: "eventId"}
+		}
+	}
+	r.store.data.outboxSeq++
+	event.ID = r.store.data.outboxSeq
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	r.store.data.outbox[event.ID] = *event
+	return nil
+}
+
+func (r *memoryOutboxRepository) FindByID(ctx context.Context, id int64) (*models.OutboxEvent, error) {
+	defer r.store.lock()()
+
+	event, ok := r.store.data.outbox[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &event, nil
+}
+
+func (r *memoryOutboxRepository) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error) {
+	defer r.store.lock()()
+
+	due := []models.OutboxEvent{}
+	for _, event := range r.store.data.outbox {
+		if event.PublishedAt == nil && !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if limit < len(due) {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].NextAttemptAt = now.Add(lease)
+		r.store.data.outbox[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (r *memoryOutboxRepository) Update(ctx context.Context, event *models.OutboxEvent) error {
+	defer r.store.lock()()
+
+	if _, ok := r.store.data.outbox[event.ID]; !ok {
+		return ErrNotFound
+	}
+	r.store.data.outbox[event.ID] = *event
+	return nil
+}
+
+func (r *memoryOutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	defer r.store.lock()()
+
+	var deleted int64
+	for id, event := range r.store.data.outbox {
+		if event.PublishedAt != nil && event.PublishedAt.Before(before) {
+			delete(r.store.data.outbox, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Notify does nothing, nothing listens to a memory store
+func (r *memoryOutboxRepository) Notify(ctx context.Context, id int64) error {
+	return nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"example/rest-api/models"
+)
+
+func TestMemoryNoteTitleIsUniquePerUser(t *testing.T) {
+	ctx := context.Background()
+	notes := NewMemoryStore().Notes()
+
+	if err := notes.Create(ctx, &models.Note{UserID: "alice", Title: "Groceries"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := notes.Create(ctx, &models.Note{UserID: "bob", Title: "Groceries"}); err != nil {
+		t.Fatalf("same title for another user: %v", err)
+	}
+
+	err := notes.Create(ctx, &models.Note{UserID: "alice", Title: "Groceries"})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Field != "title" {
+		t.Fatalf("expected a title conflict, got %v", err)
+	}
+}
+
+func TestMemoryTransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	errFailed := errors.New("failed")
+
+	var kept, dropped models.Note
+	err := store.Transaction(ctx, func(tx Store) error {
+		kept = models.Note{UserID: "alice", Title: "kept"}
+		if err := tx.Notes().Create(ctx, &kept); err != nil {
+			return err
+		}
+
+		// a failing nested transaction only rolls back its own writes
+		err := tx.Transaction(ctx, func(nested Store) error {
+			dropped = models.Note{UserID: "alice", Title: "dropped"}
+			if err := nested.Notes().Create(ctx, &dropped); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			t.Fatalf("nested transaction returned %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	if _, err := store.Notes().FindByID(ctx, kept.ID); err != nil {
+		t.Errorf("committed note is missing: %v", err)
+	}
+	if _, err := store.Notes().FindByID(ctx, dropped.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rolled back note is still there: %v", err)
+	}
+
+	err = store.Transaction(ctx, func(tx Store) error {
+		if err := tx.Notes().Delete(ctx, kept.ID); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("transaction returned %v", err)
+	}
+	if _, err := store.Notes().FindByID(ctx, kept.ID); err != nil {
+		t.Errorf("delete was not rolled back: %v", err)
+	}
+}
+
+func TestMemoryNoteListAndSearch(t *testing.T) {
+	ctx := context.Background()
+	notes := NewMemoryStore().Notes()
+
+	for _, note := range []models.Note{
+		{UserID: "alice", Title: "Groceries", Content: "Milk and eggs", Category: "Home", Tags: []string{"shopping"}},
+		{UserID: "alice", Title: "Sprint planning", Content: "Estimate tickets", Category: "Work", Tags: []string{"work", "weekly"}},
+		{UserID: "bob", Title: "Garden", Content: "Buy seeds", Category: "home", Tags: []string{"shopping", "weekly"}, Published: true},
+	} {
+		if err := notes.Create(ctx, &note); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	page, err := notes.List(ctx, NoteFilter{}, 2, 2)
+	if err != nil || len(page) != 1 {
+		t.Fatalf("expected 1 note on the second page, got %d (%v)", len(page), err)
+	}
+	page, err = notes.List(ctx, NoteFilter{VisibleTo: "carol"}, 10, 0)
+	if err != nil || len(page) != 1 || page[0].Title != "Garden" {
+		t.Fatalf("expected carol to see the published note only, got %v (%v)", page, err)
+	}
+
+	tests := []struct {
+		name   string
+		filter NoteFilter
+		want   int
+	}{
+		{"everything", NoteFilter{}, 3},
+		{"category ignores case", NoteFilter{Category: "HOME"}, 2},
+		{"content substring", NoteFilter{Content: "seed"}, 1},
+		{"all fields", NoteFilter{Title: "gro", Category: "home"}, 1},
+		{"no match", NoteFilter{Title: "nothing"}, 0},
+		{"users", NoteFilter{UserIDs: []string{"bob", "carol"}}, 1},
+		{"any tag", NoteFilter{Tags: []string{"work", "shopping"}}, 3},
+		{"tag and user", NoteFilter{Tags: []string{"weekly"}, UserIDs: []string{"alice"}}, 1},
+		{"own and published", NoteFilter{VisibleTo: "alice"}, 3},
+		{"published of others", NoteFilter{VisibleTo: "carol", Category: "home"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := notes.Search(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			if len(found) != tt.want {
+				t.Errorf("expected %d notes, got %d", tt.want, len(found))
+			}
+		})
+	}
+
+	tags, err := notes.Tags(ctx, "")
+	if err != nil {
+		t.Fatalf("tags: %v", err)
+	}
+	want := []TagCount{{"shopping", 2}, {"weekly", 2}, {"work", 1}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected tags %v, got %v", want, tags)
+	}
+	tags, _ = notes.Tags(ctx, "carol")
+	if want := []TagCount{{"shopping", 1}, {"weekly", 1}}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected the tags of the published note %v, got %v", want, tags)
+	}
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example/rest-api/models"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ConflictError is returned when a write violates a unique constraint
+type ConflictError struct {
+	// Field is the json name of the conflicting field, empty when unknown
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return "unique constraint violation"
+	}
+	return "unique constraint violation on " + e.Field
+}
+
+// NoteFilter holds the case insensitive substrings a search matches on, empty fields match everything
+type NoteFilter struct {
+	Title    string
+	Content  string
+	Category string
+	// UserIDs keeps the notes of any of the users
+	UserIDs []string
+	// Tags keeps the notes carrying any of the tags, which match exactly
+	Tags []string
+	// VisibleTo keeps the notes the user sees, their own ones and the published ones
+	VisibleTo string
+}
+
+// TagCount is a tag along with the number of notes carrying it
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type NoteRepository interface {
+	Create(ctx context.Context, note *models.Note) error
+	FindByID(ctx context.Context, id string) (*models.Note, error)
+	// FindByIDForUpdate returns a note and locks it until the transaction ends, so that the concurrent writes
+	// are applied one after the other instead of overwriting each other
+	FindByIDForUpdate(ctx context.Context, id string) (*models.Note, error)
+	FindByTitle(ctx context.Context, userID, title string) (*models.Note, error)
+	// List returns a page of the notes matching filter ordered by creation time
+	List(ctx context.Context, filter NoteFilter, limit, offset int) ([]models.Note, error)
+	Search(ctx context.Context, filter NoteFilter) ([]models.Note, error)
+	// Tags returns the tags of the notes visibleTo sees ordered by name, every note when it is empty
+	Tags(ctx context.Context, visibleTo string) ([]TagCount, error)
+	// StreamByUser hands every note of the user to fn in creation order without loading them all at once
+	StreamByUser(ctx context.Context, userID string, fn func(note *models.Note) error) error
+	// Update writes every field of the note
+	Update(ctx context.Context, note *models.Note) error
+	Delete(ctx context.Context, id string) error
+}
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id string) (*models.User, error)
+	// FindByIDs returns the users with the given ids in no particular order, the missing ones are left out
+	FindByIDs(ctx context.Context, ids []string) ([]models.User, error)
+	// FindByLogin finds the user with the email or, when it is not empty, the username
+	FindByLogin(ctx context.Context, email, username string) (*models.User, error)
+}
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *models.Attachment) error
+	FindByID(ctx context.Context, noteID, id string) (*models.Attachment, error)
+	ListByNote(ctx context.Context, noteID string) ([]models.Attachment, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteByNote deletes the attachments of a note and returns the storage keys of their blobs
+	DeleteByNote(ctx context.Context, noteID string) ([]string, error)
+}
+
+// IdempotencyRepository keeps the responses to the requests sent with an Idempotency-Key
+type IdempotencyRepository interface {
+	// Reserve stores key as in flight and returns nil, unless a key of the same user that has not
+	// expired at key.CreatedAt exists, which is returned instead. Expired keys are replaced.
+	Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	// Complete stores the response of a reserved key
+	Complete(ctx context.Context, key *models.IdempotencyKey) error
+	// Release deletes a key that is still in flight so the request can be sent again
+	Release(ctx context.Context, userID, key string) error
+	// DeleteExpired deletes the keys expired at now and returns how many there were
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	FindByID(ctx context.Context, id string) (*models.Webhook, error)
+	// ListByUser returns the webhooks of a user in creation order, an empty userID lists the system-wide ones
+	ListByUser(ctx context.Context, userID string) ([]models.Webhook, error)
+	// Subscribed returns the active webhooks of the user and the system-wide ones receiving event
+	Subscribed(ctx context.Context, userID, event string) ([]models.Webhook, error)
+	Update(ctx context.Context, webhook *models.Webhook) error
+	// Delete deletes a webhook along with its deliveries
+	Delete(ctx context.Context, id string) error
+}
+
+type WebhookDeliveryRepository interface {
+	Create(ctx context.Context, delivery *models.WebhookDelivery) error
+	FindByID(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error)
+	// ListByWebhook returns the latest deliveries of a webhook, newest first
+	ListByWebhook(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error)
+	// Claim returns up to limit pending deliveries due at now and pushes their next attempt lease later,
+	// so that no other dispatcher picks them up while they are sent
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	// Update writes the outcome of an attempt
+	Update(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// NotifyChannel is the Postgres channel announcing the relayed events to every replica
+const NotifyChannel = "outbox_events"
+
+// OutboxRepository holds the domain events waiting to be relayed
+type OutboxRepository interface {
+	// Append writes an event and sets its ID, which orders the events
+	Append(ctx context.Context, event *models.OutboxEvent) error
+	FindByID(ctx context.Context, id int64) (*models.OutboxEvent, error)
+	// Claim returns up to limit unpublished events due at now in order and pushes their next attempt
+	// lease later, so that no other relay picks them up while they are published
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.OutboxEvent, error)
+	// Update writes the outcome of a relay attempt
+	Update(ctx context.Context, event *models.OutboxEvent) error
+	// DeletePublished deletes the events published before and returns how many there were
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+	// Notify announces the event with the given id on NotifyChannel once the transaction commits
+	Notify(ctx context.Context, id int64) error
+}
+
+// Store gives access to every repository
+type Store interface {
+	Notes() NoteRepository
+	Users() UserRepository
+	Attachments() AttachmentRepository
+	IdempotencyKeys() IdempotencyRepository
+	Webhooks() WebhookRepository
+	WebhookDeliveries() WebhookDeliveryRepository
+	Outbox() OutboxRepository
+	// Transaction runs fn with repositories bound to a single transaction that is committed when fn returns nil.
+	// Calling Transaction on the store handed to fn opens a nested transaction that can be rolled back on its own.
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"net/http"
+
+	"example/rest-api/handlers"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/openapi"
+	"example/rest-api/problem"
+	"example/rest-api/render"
+)
+
+// route is an entry of the route table, op documents it in the OpenAPI document
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	// auth requires a valid bearer token
+	auth bool
+	// idempotent accepts an Idempotency-Key, auth routes are left out as their responses hold credentials
+	idempotent bool
+	op         openapi.Operation
+}
+
+// the paths of the documentation, which are not part of the route table
+const (
+	specPath = "/openapi.json"
+	docsPath = "/docs"
+)
+
+// schemas shared by the operations, registered as components by apiSpec
+var (
+	messageSchema  = openapi.Ref("Message")
+	noteSchema     = openapi.Ref("NoteResponse")
+	bearerSecurity = []map[string][]string{{"bearerAuth": {}}}
+)
+
+// routes is the route table of the API, every route is registered and documented from it
+func routes(authHandler *handlers.AuthHandler, noteHandler *handlers.NoteHandler, webhookHandler *handlers.WebhookHandler, streamHandler *handlers.StreamHandler, collabHandler *handlers.CollabHandler, graphqlHandler *handlers.GraphQLHandler) []route {
+	noteID := "The id of the note"
+	attachmentID := "The id of the attachment"
+	webhookID := "The id of the webhook"
+	webhookSchema := openapi.Object(map[string]*openapi.Schema{
+		"status": {Type: "string"},
+		"data": openapi.Object(map[string]*openapi.Schema{
+			"webhook": openapi.TypeOf(models.Webhook{}),
+		}),
+	})
+	one := 1.0
+	maxDeliveries := 100.0
+
+	return []route{
+		// auth routes
+		{pattern: "POST /api/auth/register", handler: authHandler.RegisterHandler, op: openapi.Operation{
+			OperationID: "register",
+			Summary:     "Register a new user",
+			Description: "Every user registers with the USER role. The role field was removed from the request, " +
+				"a body with it is rejected with a 400.",
+			Tags:        []string{"auth"},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.CreateUserSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"201": {Description: "The user is created", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"message": {Type: "string"},
+					"data":    openapi.TypeOf(models.User{}),
+				}))},
+				"409": problemResponse("A user with this username or email already exists"),
+			},
+		}},
+		{pattern: "POST /api/auth/login", handler: authHandler.LoginHandler, op: openapi.Operation{
+			OperationID: "login",
+			Summary:     "Log in with an email or a username and get a bearer token",
+			Tags:        []string{"auth"},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.LoginSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The credentials are valid", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"message": {Type: "string"},
+					"token":   {Type: "string"},
+				}))},
+				"401": problemResponse("The credentials are invalid"),
+			},
+		}},
+		{pattern: "POST /api/auth/logout", handler: authHandler.LogoutHandler, auth: true, op: openapi.Operation{
+			OperationID: "logout",
+			Summary:     "Log out",
+			Tags:        []string{"auth"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "Logged out", Content: openapi.JSON(messageSchema)},
+			},
+		}},
+
+		// note routes
+		{pattern: "PATCH /api/notes/{noteId}", handler: noteHandler.UpdateNote, auth: true, op: openapi.Operation{
+			OperationID: "updateNote",
+			Summary:     "Update the fields of a note that are set",
+			Tags:        []string{"notes"},
+			Parameters:  []*openapi.Parameter{pathParameter("noteId", noteID)},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.UpdateNoteSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The updated note", Content: openapi.JSON(noteSchema)},
+				"404": problemResponse("No note with that id exists"),
+				"409": problemResponse("A note with this title already exists"),
+			},
+		}},
+		{pattern: "GET /api/notes/{noteId}", handler: noteHandler.FindNoteById, auth: true, op: openapi.Operation{
+			OperationID: "getNote",
+			Summary:     "Get a note",
+			Tags:        []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				pathParameter("noteId", noteID),
+				openapi.Query("render", "Set to html to get the content rendered to sanitized html", &openapi.Schema{Type: "string", Enum: []string{"html"}}),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The note, with its rendered content when asked for", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status": {Type: "string"},
+					"data": {Type: "object", Required: []string{"note"}, Properties: map[string]*openapi.Schema{
+						"note":     openapi.TypeOf(models.Note{}),
+						"rendered": openapi.TypeOf(render.Result{}),
+					}},
+				}))},
+				"404": problemResponse("No note with that id exists"),
+			},
+		}},
+		{pattern: "DELETE /api/notes/{noteId}", handler: noteHandler.DeleteNote, auth: true, op: openapi.Operation{
+			OperationID: "deleteNote",
+			Summary:     "Delete a note and its attachments",
+			Tags:        []string{"notes"},
+			Parameters:  []*openapi.Parameter{pathParameter("noteId", noteID)},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The note is deleted", Content: openapi.JSON(messageSchema)},
+				"404": problemResponse("No note with that id exists"),
+			},
+		}},
+		{pattern: "POST /api/notes/", handler: noteHandler.CreateNoteHandler, auth: true, idempotent: true, op: openapi.Operation{
+			OperationID: "createNote",
+			Summary:     "Create a note",
+			Tags:        []string{"notes"},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.CreateNoteSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"201": {Description: "The created note", Content: openapi.JSON(noteSchema)},
+				"409": problemResponse("A note with this title already exists"),
+			},
+		}},
+		{pattern: "GET /api/notes/", handler: noteHandler.FindNotes, auth: true, op: openapi.Operation{
+			OperationID: "listNotes",
+			Summary:     "List the notes of the user and the published notes a page at a time",
+			Tags:        []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				openapi.Query("page", "The page, starting at 1", &openapi.Schema{Type: "integer", Minimum: &one}),
+				openapi.Query("limit", "The size of a page, 10 by default", &openapi.Schema{Type: "integer", Minimum: &one}),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "A page of notes", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status":  {Type: "string"},
+					"results": {Type: "integer"},
+					"notes":   openapi.ArrayOf(openapi.TypeOf(models.Note{})),
+				}))},
+			},
+		}},
+		{pattern: "GET /api/notes/search", handler: noteHandler.SearchNote, auth: true, op: openapi.Operation{
+			OperationID: "searchNotes",
+			Summary:     "Search the notes by title, content and category",
+			Tags:        []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				openapi.Query("title", "Matches the notes whose title contains it", &openapi.Schema{Type: "string"}),
+				openapi.Query("content", "Matches the notes whose content contains it", &openapi.Schema{Type: "string"}),
+				openapi.Query("category", "Matches the notes of the category", &openapi.Schema{Type: "string"}),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The matching notes", Content: openapi.JSON(openapi.ArrayOf(openapi.TypeOf(models.Note{})))},
+			},
+		}},
+		{pattern: "GET /api/notes/events", handler: streamHandler.StreamNoteEvents, auth: true, op: openapi.Operation{
+			OperationID: "streamNoteEvents",
+			Summary:     "Stream the changes to the notes the user sees as Server-Sent Events",
+			Description: "Sends the note.created, note.updated and note.deleted events of the notes of the user and of the published notes. " +
+				"The id of an event resumes the stream after it, a reset event tells the client its changes since the Last-Event-ID are lost.",
+			Tags: []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				openapi.Header("Last-Event-ID", "The id of the last event received, sent by EventSource when it reconnects", &openapi.Schema{Type: "string"}),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The event stream, with a comment as heartbeat", Content: map[string]openapi.MediaType{
+					"text/event-stream": {Schema: &openapi.Schema{Type: "string"}},
+				}},
+				"400": problemResponse("The Last-Event-ID is not the id of an event"),
+			},
+		}},
+		{pattern: "POST /api/notes/bulk", handler: noteHandler.BulkNotes, auth: true, idempotent: true, op: openapi.Operation{
+			OperationID: "bulkNotes",
+			Summary:     "Apply many operations in one transaction",
+			Tags:        []string{"notes"},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.BulkNoteSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"200": bulkResponse("Every item succeeded"),
+				"207": bulkResponse("Some items failed in best_effort mode, the others are committed"),
+				"413": problemResponse("The request touches too many notes"),
+				"422": problemResponse("An item failed in atomic mode and the request is rolled back, the problem holds the results"),
+			},
+		}},
+		{pattern: "GET /api/notes/export", handler: noteHandler.ExportNotes, auth: true, op: openapi.Operation{
+			OperationID: "exportNotes",
+			Summary:     "Download the notes of the user",
+			Tags:        []string{"import/export"},
+			Parameters: []*openapi.Parameter{
+				openapi.Query("format", "zip of markdown files or ndjson, zip by default", &openapi.Schema{Type: "string", Enum: []string{"zip", "ndjson"}}),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The exported notes", Content: map[string]openapi.MediaType{
+					"application/zip":      {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+					"application/x-ndjson": {Schema: openapi.TypeOf(models.Note{})},
+				}},
+			},
+		}},
+		{pattern: "POST /api/notes/import", handler: noteHandler.ImportNotes, auth: true, idempotent: true, op: openapi.Operation{
+			OperationID: "importNotes",
+			Summary:     "Import a zip archive, ndjson or a single markdown file",
+			Tags:        []string{"import/export"},
+			Parameters: []*openapi.Parameter{
+				openapi.Query("format", "Overrides the format picked from the Content-Type", &openapi.Schema{Type: "string", Enum: []string{"zip", "ndjson", "markdown"}}),
+				openapi.Query("onDuplicate", "What to do with a note whose title is taken, skip by default", &openapi.Schema{Type: "string", Enum: []string{"skip", "rename", "overwrite", "fail"}}),
+			},
+			RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"application/zip":      {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				"application/x-ndjson": {Schema: openapi.TypeOf(models.Note{})},
+				"text/markdown":        {Schema: &openapi.Schema{Type: "string"}},
+			}},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The report of the import", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status": {Type: "string"},
+					"report": openapi.TypeOf(handlers.ImportReport{}),
+				}))},
+				"409": problemResponse("A title is taken with onDuplicate=fail, the problem holds the report"),
+				"413": problemResponse("The import is too large"),
+				"415": problemResponse("The format is not supported"),
+			},
+		}},
+
+		// attachment routes
+		{pattern: "POST /api/notes/{noteId}/attachments", handler: noteHandler.UploadAttachment, auth: true, idempotent: true, op: openapi.Operation{
+			OperationID: "uploadAttachment",
+			Summary:     "Upload an attachment to a note",
+			Tags:        []string{"attachments"},
+			Parameters:  []*openapi.Parameter{pathParameter("noteId", noteID)},
+			RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+				"multipart/form-data": {Schema: openapi.Object(map[string]*openapi.Schema{
+					"file": {Type: "string", Format: "binary"},
+				})},
+			}},
+			Responses: map[string]*openapi.Response{
+				"201": {Description: "The stored attachment", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status": {Type: "string"},
+					"data": openapi.Object(map[string]*openapi.Schema{
+						"attachment": openapi.TypeOf(models.Attachment{}),
+					}),
+				}))},
+				"404": problemResponse("No note with that id exists"),
+				"413": problemResponse("The file is too large"),
+				"415": problemResponse("The type of the file is not allowed"),
+			},
+		}},
+		{pattern: "GET /api/notes/{noteId}/attachments", handler: noteHandler.FindAttachments, auth: true, op: openapi.Operation{
+			OperationID: "listAttachments",
+			Summary:     "List the attachments of a note",
+			Tags:        []string{"attachments"},
+			Parameters:  []*openapi.Parameter{pathParameter("noteId", noteID)},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The attachments of the note", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status":      {Type: "string"},
+					"results":     {Type: "integer"},
+					"attachments": openapi.ArrayOf(openapi.TypeOf(models.Attachment{})),
+				}))},
+				"404": problemResponse("No note with that id exists"),
+			},
+		}},
+		{pattern: "GET /api/notes/{noteId}/attachments/{attachmentId}", handler: noteHandler.DownloadAttachment, auth: true, op: openapi.Operation{
+			OperationID: "downloadAttachment",
+			Summary:     "Download an attachment, Range requests are supported",
+			Tags:        []string{"attachments"},
+			Parameters:  []*openapi.Parameter{pathParameter("noteId", noteID), pathParameter("attachmentId", attachmentID)},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The content of the attachment", Content: map[string]openapi.MediaType{
+					"*/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+				}},
+				"206": {Description: "The requested range of the attachment"},
+				"304": {Description: "The attachment did not change since If-Modified-Since"},
+				"416": {Description: "The requested range is not satisfiable"},
+				"404": problemResponse("No attachment with that id exists"),
+			},
+		}},
+		{pattern: "DELETE /api/notes/{noteId}/attachments/{attachmentId}", handler: noteHandler.DeleteAttachment, auth: true, op: openapi.Operation{
+			OperationID: "deleteAttachment",
+			Summary:     "Delete an attachment",
+			Tags:        []string{"attachments"},
+			Parameters:  []*openapi.Parameter{pathParameter("noteId", noteID), pathParameter("attachmentId", attachmentID)},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The attachment is deleted", Content: openapi.JSON(messageSchema)},
+				"404": problemResponse("No attachment with that id exists"),
+			},
+		}},
+
+		// collaborative editing
+		{pattern: "GET /api/notes/{noteId}/collab", handler: collabHandler.CollabNote, auth: true, op: openapi.Operation{
+			OperationID: "collabNote",
+			Summary:     "Edit the content of a note from several clients, or follow the edits of a published note, over a WebSocket",
+			Description: "The client gets an init message with the content, its revision and the other clients, then sends op messages " +
+				"made on a revision and cursor messages. Operations are arrays where a positive number retains characters, a string " +
+				"inserts it and a negative number deletes characters. They are acknowledged with an ack message and sent to the other " +
+				"clients as op messages, with join, leave and cursor messages for the presence. The content is saved to the note " +
+				"every COLLAB_SNAPSHOT_INTERVAL. Only the owner sends op messages, the other users can only view the published notes. An error " +
+				"message is sent before the server closes the connection on an invalid message.",
+			Tags: []string{"notes"},
+			Parameters: []*openapi.Parameter{
+				pathParameter("noteId", noteID),
+				openapi.Query("access_token", "The bearer token, for the browsers which cannot set the Authorization header of a WebSocket", &openapi.Schema{Type: "string"}),
+			},
+			Responses: map[string]*openapi.Response{
+				"101": {Description: "Switched to the WebSocket protocol"},
+				"400": problemResponse("The request is not a WebSocket handshake"),
+				"403": problemResponse("The origin is not allowed"),
+				"404": problemResponse("No note with that id exists"),
+			},
+		}},
+
+		// graphql
+		{pattern: "POST /graphql", handler: graphqlHandler.ServeGraphQL, auth: true, op: openapi.Operation{
+			OperationID: "graphql",
+			Summary:     "Query the notes, users and tags or create and update notes with GraphQL",
+			Description: "The schema is served by introspection. The connections take first, at most 100, and after, the cursor of " +
+				"an edge. Queries deeper than GRAPHQL_MAX_DEPTH or costing more than GRAPHQL_MAX_COMPLEXITY, where a connection " +
+				"costs its page size times its selection, are rejected. Errors are in the errors member of a 200 response, their " +
+				"extensions hold a code: BAD_USER_INPUT with the invalid fields, NOT_FOUND, CONFLICT or INTERNAL_SERVER_ERROR.",
+			Tags: []string{"graphql"},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(&openapi.Schema{
+				Type:     "object",
+				Required: []string{"query"},
+				Properties: map[string]*openapi.Schema{
+					"query":         {Type: "string"},
+					"variables":     {Type: "object"},
+					"operationName": {Type: "string"},
+				},
+			})},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The result of the operation along with its errors", Content: openapi.JSON(&openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"data":   {Type: "object", Description: "Missing when the request is invalid"},
+						"errors": openapi.ArrayOf(&openapi.Schema{Type: "object"}),
+					},
+				})},
+			},
+		}},
+
+		// webhook routes
+		{pattern: "POST /api/webhooks", handler: webhookHandler.CreateWebhook, auth: true, op: openapi.Operation{
+			OperationID: "createWebhook",
+			Summary:     "Subscribe a URL to the events of the user, or of every user for a system-wide webhook",
+			Description: "The events are POSTed as JSON signed with the secret, the secret is only returned by this call.",
+			Tags:        []string{"webhooks"},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.CreateWebhookSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"201": {Description: "The created webhook, with its secret", Content: openapi.JSON(webhookSchema)},
+				"403": problemResponse("Only the admins can create system-wide webhooks"),
+			},
+		}},
+		{pattern: "GET /api/webhooks", handler: webhookHandler.FindWebhooks, auth: true, op: openapi.Operation{
+			OperationID: "listWebhooks",
+			Summary:     "List the webhooks of the user, and the system-wide ones for the admins",
+			Tags:        []string{"webhooks"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The webhooks", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status":   {Type: "string"},
+					"results":  {Type: "integer"},
+					"webhooks": openapi.ArrayOf(openapi.TypeOf(models.Webhook{})),
+				}))},
+			},
+		}},
+		{pattern: "GET /api/webhooks/{webhookId}", handler: webhookHandler.FindWebhookById, auth: true, op: openapi.Operation{
+			OperationID: "getWebhook",
+			Summary:     "Get a webhook",
+			Tags:        []string{"webhooks"},
+			Parameters:  []*openapi.Parameter{pathParameter("webhookId", webhookID)},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The webhook", Content: openapi.JSON(webhookSchema)},
+				"404": problemResponse("No webhook with that id exists"),
+			},
+		}},
+		{pattern: "PATCH /api/webhooks/{webhookId}", handler: webhookHandler.UpdateWebhook, auth: true, op: openapi.Operation{
+			OperationID: "updateWebhook",
+			Summary:     "Change the URL or the events of a webhook, or pause it",
+			Tags:        []string{"webhooks"},
+			Parameters:  []*openapi.Parameter{pathParameter("webhookId", webhookID)},
+			RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(openapi.TypeOf(models.UpdateWebhookSchema{}))},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The updated webhook", Content: openapi.JSON(webhookSchema)},
+				"404": problemResponse("No webhook with that id exists"),
+			},
+		}},
+		{pattern: "DELETE /api/webhooks/{webhookId}", handler: webhookHandler.DeleteWebhook, auth: true, op: openapi.Operation{
+			OperationID: "deleteWebhook",
+			Summary:     "Delete a webhook and its delivery log",
+			Tags:        []string{"webhooks"},
+			Parameters:  []*openapi.Parameter{pathParameter("webhookId", webhookID)},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The webhook is deleted", Content: openapi.JSON(messageSchema)},
+				"404": problemResponse("No webhook with that id exists"),
+			},
+		}},
+		{pattern: "GET /api/webhooks/{webhookId}/deliveries", handler: webhookHandler.FindDeliveries, auth: true, op: openapi.Operation{
+			OperationID: "listDeliveries",
+			Summary:     "List the latest deliveries of a webhook with the outcome of their last attempt",
+			Tags:        []string{"webhooks"},
+			Parameters: []*openapi.Parameter{
+				pathParameter("webhookId", webhookID),
+				openapi.Query("limit", "The number of deliveries, newest first", &openapi.Schema{Type: "integer", Minimum: &one, Maximum: &maxDeliveries}),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The delivery log", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status":     {Type: "string"},
+					"results":    {Type: "integer"},
+					"deliveries": openapi.ArrayOf(openapi.TypeOf(models.WebhookDelivery{})),
+				}))},
+				"404": problemResponse("No webhook with that id exists"),
+			},
+		}},
+		{pattern: "POST /api/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver", handler: webhookHandler.Redeliver, auth: true, op: openapi.Operation{
+			OperationID: "redeliver",
+			Summary:     "Queue the event of a delivery again",
+			Tags:        []string{"webhooks"},
+			Parameters:  []*openapi.Parameter{pathParameter("webhookId", webhookID), pathParameter("deliveryId", "The id of the delivery")},
+			Responses: map[string]*openapi.Response{
+				"202": {Description: "The new delivery, sent by the next poll of the queue", Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+					"status": {Type: "string"},
+					"data": openapi.Object(map[string]*openapi.Schema{
+						"delivery": openapi.TypeOf(models.WebhookDelivery{}),
+					}),
+				}))},
+				"404": problemResponse("No webhook or delivery with that id exists"),
+			},
+		}},
+
+		{pattern: "GET /api/healthchecker", handler: HealthCheckHandler, op: openapi.Operation{
+			OperationID: "healthChecker",
+			Summary:     "Report that the server runs, kept for existing clients of /livez",
+			Tags:        []string{"health"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The server runs", Content: openapi.JSON(messageSchema)},
+			},
+		}},
+	}
+}
+
+// apiSpec documents the routes of the table
+func apiSpec(table []route) *openapi.Spec {
+	spec := openapi.New(openapi.Info{
+		Title:       "Notes API",
+		Version:     "1.0.0",
+		Description: "A REST API to manage notes, their attachments and their import and export. Every error is an RFC 7807 problem.",
+	})
+	spec.SecurityScheme("bearerAuth", &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"})
+
+	spec.Component("Message", openapi.Object(map[string]*openapi.Schema{
+		"status":  {Type: "string"},
+		"message": {Type: "string"},
+	}))
+	spec.Component("NoteResponse", openapi.Object(map[string]*openapi.Schema{
+		"status": {Type: "string"},
+		"data": openapi.Object(map[string]*openapi.Schema{
+			"note": openapi.TypeOf(models.Note{}),
+		}),
+	}))
+	// problem.Problem flattens its extensions when encoded, so its schema is written by hand
+	spec.Component("Problem", &openapi.Schema{
+		Type:     "object",
+		Required: []string{"type", "title", "status"},
+		// the extension members, like the field of a conflict
+		AdditionalProperties: &openapi.Schema{},
+		Properties: map[string]*openapi.Schema{
+			"type":      {Type: "string", Format: "uri-reference", Description: "about:blank, /problems/validation-error or /problems/conflict"},
+			"title":     {Type: "string"},
+			"status":    {Type: "integer"},
+			"detail":    {Type: "string"},
+			"instance":  {Type: "string", Description: "The path of the request"},
+			"requestId": {Type: "string", Description: "The X-Request-ID of the request, to find it in the logs"},
+			"errors":    openapi.ArrayOf(openapi.TypeOf(models.ErrorResponse{})),
+		},
+	})
+
+	for _, r := range table {
+		op := r.op
+		responses := make(map[string]*openapi.Response, len(op.Responses)+4)
+		for status, response := range op.Responses {
+			responses[status] = response
+		}
+		if op.RequestBody != nil {
+			setDefault(responses, "400", problemResponse("The request is malformed or fails validation"))
+		}
+		if r.idempotent {
+			maxLength := 255
+			op.Parameters = append(op.Parameters[:len(op.Parameters):len(op.Parameters)], openapi.Header(
+				middleware.IdempotencyKeyHeader,
+				"A unique key, like a UUID, making the request safe to retry: the response to the first request is replayed to the retries with the Idempotent-Replayed header",
+				&openapi.Schema{Type: "string", MaxLength: &maxLength},
+			))
+			addProblem(responses, "409", "A request with this Idempotency-Key is still being processed")
+			addProblem(responses, "422", "The Idempotency-Key was already used for a different request")
+		}
+		if r.auth {
+			op.Security = bearerSecurity
+			setDefault(responses, "401", problemResponse("The bearer token is missing or invalid"))
+		}
+		setDefault(responses, "429", problemResponse("Too many requests, the Retry-After header holds the seconds to wait"))
+		setDefault(responses, "default", problemResponse("An unexpected error, the problem holds the request id"))
+		op.Responses = responses
+		spec.Add(r.pattern, op)
+	}
+	return spec
+}
+
+func setDefault(responses map[string]*openapi.Response, status string, response *openapi.Response) {
+	if _, ok := responses[status]; !ok {
+		responses[status] = response
+	}
+}
+
+// addProblem documents another cause of a problem response
+func addProblem(responses map[string]*openapi.Response, status, description string) {
+	if response, ok := responses[status]; ok {
+		description = response.Description + ". " + description
+	}
+	responses[status] = problemResponse(description)
+}
+
+func problemResponse(description string) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{problem.ContentType: {Schema: openapi.Ref("Problem")}},
+	}
+}
+
+func bulkResponse(description string) *openapi.Response {
+	return &openapi.Response{Description: description, Content: openapi.JSON(openapi.Object(map[string]*openapi.Schema{
+		"status":  {Type: "string", Enum: []string{"success", "partial"}},
+		"mode":    {Type: "string"},
+		"failed":  {Type: "integer"},
+		"results": openapi.ArrayOf(openapi.TypeOf(handlers.BulkResult{})),
+	}))}
+}
+
+func pathParameter(name, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &openapi.Schema{Type: "string"}}
+}
@@ -0,0 +1,1411 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example/rest-api/collab"
+	"example/rest-api/config"
+	"example/rest-api/events"
+	"example/rest-api/handlers"
+	"example/rest-api/middleware"
+	"example/rest-api/models"
+	"example/rest-api/openapi"
+	"example/rest-api/problem"
+	"example/rest-api/repository"
+	"example/rest-api/utils"
+	"example/rest-api/webhooks"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// noteResponse is the body of the single note routes
+type noteResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Note     models.Note `json:"note"`
+		Rendered *struct {
+			HTML string `json:"HTML"`
+		} `json:"rendered"`
+	} `json:"data"`
+}
+
+func (s *testServer) createNote(token string, note map[string]interface{}) models.Note {
+	s.t.Helper()
+
+	resp := s.request("POST", "/api/notes/", token, note)
+	expectStatus(s.t, resp, http.StatusCreated)
+
+	var body noteResponse
+	decode(s.t, resp, &body)
+	return body.Data.Note
+}
+
+func TestNoteCRUD(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+
+		note := srv.createNote(token, map[string]interface{}{
+			"title":         "Groceries",
+			"content":       "# Shopping\n\n- milk",
+			"contentFormat": "markdown",
+			"category":      "home",
+		})
+		if note.ID == "" || note.UserID == "" || note.ContentFormat != "markdown" {
+			t.Fatalf("unexpected note %+v", note)
+		}
+
+		t.Run("get", func(t *testing.T) {
+			resp := srv.request("GET", "/api/notes/"+note.ID+"?render=html", token, nil)
+			expectStatus(t, resp, http.StatusOK)
+
+			var body noteResponse
+			decode(t, resp, &body)
+			if body.Data.Note.Title != "Groceries" {
+				t.Errorf("expected the created note, got %+v", body.Data.Note)
+			}
+			if body.Data.Rendered == nil || !strings.Contains(body.Data.Rendered.HTML, "<h1") {
+				t.Errorf("expected rendered markdown, got %+v", body.Data.Rendered)
+			}
+		})
+
+		t.Run("update", func(t *testing.T) {
+			resp := srv.request("PATCH", "/api/notes/"+note.ID, token, map[string]interface{}{
+				"title":     "Weekly groceries",
+				"published": true,
+			})
+			expectStatus(t, resp, http.StatusOK)
+
+			var body noteResponse
+			decode(t, resp, &body)
+			if body.Data.Note.Title != "Weekly groceries" || !body.Data.Note.Published || body.Data.Note.Category != "home" {
+				t.Errorf("unexpected updated note %+v", body.Data.Note)
+			}
+		})
+
+		t.Run("duplicate title", func(t *testing.T) {
+			other := srv.createNote(token, map[string]interface{}{"title": "Other", "content": "text"})
+			expectStatus(t, srv.request("PATCH", "/api/notes/"+other.ID, token, map[string]string{"title": "Weekly groceries"}), http.StatusConflict)
+			expectStatus(t, srv.request("POST", "/api/notes/", token, map[string]string{"title": "Other", "content": "again"}), http.StatusConflict)
+		})
+
+		t.Run("delete", func(t *testing.T) {
+			expectStatus(t, srv.request("DELETE", "/api/notes/"+note.ID, token, nil), http.StatusOK)
+			expectStatus(t, srv.request("GET", "/api/notes/"+note.ID, token, nil), http.StatusNotFound)
+			expectStatus(t, srv.request("PATCH", "/api/notes/"+note.ID, token, map[string]string{"title": "Gone"}), http.StatusNotFound)
+			expectStatus(t, srv.request("DELETE", "/api/notes/"+note.ID, token, nil), http.StatusNotFound)
+		})
+	})
+}
+
+func TestNoteOwnership(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		alice, bob := srv.login(), srv.login()
+		private := srv.createNote(alice, map[string]interface{}{"title": "Diary", "content": "secret"})
+		public := srv.createNote(alice, map[string]interface{}{"title": "Blog post", "content": "hello", "published": true})
+		own := srv.createNote(bob, map[string]interface{}{"title": "Bob's note", "content": "text"})
+		content := []byte("plain text attachment")
+		for _, note := range []models.Note{private, public} {
+			expectStatus(t, srv.uploadFile(alice, note.ID, "notes.txt", content), http.StatusCreated)
+		}
+		var listed struct {
+			Attachments []models.Attachment `json:"attachments"`
+		}
+		decode(t, srv.request("GET", "/api/notes/"+public.ID+"/attachments", alice, nil), &listed)
+		publicAttachment := "/api/notes/" + public.ID + "/attachments/" + listed.Attachments[0].ID
+		decode(t, srv.request("GET", "/api/notes/"+private.ID+"/attachments", alice, nil), &listed)
+		privateAttachment := "/api/notes/" + private.ID + "/attachments/" + listed.Attachments[0].ID
+
+		t.Run("reads", func(t *testing.T) {
+			expectStatus(t, srv.request("GET", "/api/notes/"+private.ID, bob, nil), http.StatusNotFound)
+			expectStatus(t, srv.request("GET", "/api/notes/"+public.ID, bob, nil), http.StatusOK)
+			expectStatus(t, srv.request("GET", "/api/notes/"+private.ID+"/attachments", bob, nil), http.StatusNotFound)
+			expectStatus(t, srv.request("GET", privateAttachment, bob, nil), http.StatusNotFound)
+			expectStatus(t, srv.request("GET", publicAttachment, bob, nil), http.StatusOK)
+
+			var body struct {
+				Notes []models.Note `json:"notes"`
+			}
+			decode(t, srv.request("GET", "/api/notes/", bob, nil), &body)
+			if len(body.Notes) != 2 || body.Notes[0].ID != public.ID || body.Notes[1].ID != own.ID {
+				t.Errorf("expected bob to list the published note and his own, got %+v", body.Notes)
+			}
+			for query, want := range map[string]int{"secret": 0, "hello": 1} {
+				var found []models.Note
+				decode(t, srv.request("GET", "/api/notes/search?content="+query, bob, nil), &found)
+				if len(found) != want {
+					t.Errorf("%s: expected bob to find %d notes, got %+v", query, want, found)
+				}
+			}
+		})
+
+		t.Run("writes", func(t *testing.T) {
+			for _, note := range []models.Note{private, public} {
+				path := "/api/notes/" + note.ID
+				expectStatus(t, srv.request("PATCH", path, bob, map[string]string{"title": "Mine now"}), http.StatusNotFound)
+				expectStatus(t, srv.request("DELETE", path, bob, nil), http.StatusNotFound)
+				expectStatus(t, srv.uploadFile(bob, note.ID, "notes.txt", content), http.StatusNotFound)
+			}
+			expectStatus(t, srv.request("DELETE", publicAttachment, bob, nil), http.StatusNotFound)
+			expectStatus(t, srv.request("GET", publicAttachment, alice, nil), http.StatusOK)
+
+			resp := srv.request("POST", "/api/notes/bulk", bob, map[string]interface{}{
+				"mode":       "best_effort",
+				"operations": []map[string]interface{}{{"op": "delete", "ids": []string{public.ID, own.ID}}},
+			})
+			var bulk struct {
+				Results []handlers.BulkResult `json:"results"`
+			}
+			decode(t, resp, &bulk)
+			if len(bulk.Results) != 2 || bulk.Results[0].Status != http.StatusNotFound || bulk.Results[1].Status != http.StatusOK {
+				t.Errorf("expected bob to delete his own note only, got %+v", bulk.Results)
+			}
+
+			var body noteResponse
+			decode(t, srv.request("GET", "/api/notes/"+public.ID, alice, nil), &body)
+			if body.Data.Note.Title != "Blog post" {
+				t.Errorf("expected the note of alice to be untouched, got %+v", body.Data.Note)
+			}
+		})
+	})
+}
+
+func TestNoteValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   interface{}
+		want   int
+		field  string
+	}{
+		{"missing title", "POST", map[string]string{"content": "text"}, http.StatusBadRequest, "title"},
+		{"missing content", "POST", map[string]string{"title": "Title"}, http.StatusBadRequest, "content"},
+		{"unknown format", "POST", map[string]string{"title": "Title", "content": "text", "contentFormat": "html"}, http.StatusBadRequest, "contentFormat"},
+		{"malformed json", "POST", strings.NewReader(`{"title":`), http.StatusBadRequest, ""},
+		{"update unknown format", "PATCH", map[string]string{"contentFormat": "html"}, http.StatusBadRequest, ""},
+		{"update malformed json", "PATCH", strings.NewReader(`[`), http.StatusBadRequest, ""},
+	}
+
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		note := srv.createNote(token, map[string]interface{}{"title": "Existing", "content": "text"})
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				path := "/api/notes/"
+				if tt.method == "PATCH" {
+					path += note.ID
+				}
+				resp := srv.request(tt.method, path, token, tt.body)
+				expectStatus(t, resp, tt.want)
+
+				if tt.field == "" {
+					return
+				}
+				p := decodeProblem(t, resp)
+				if p.Type != problem.TypeValidation || len(p.Errors) != 1 || p.Errors[0].Field != tt.field {
+					t.Errorf("expected a single error on %s, got %+v", tt.field, p)
+				}
+			})
+		}
+	})
+}
+
+func TestNotePagination(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		for i := 0; i < 25; i++ {
+			srv.createNote(token, map[string]interface{}{"title": fmt.Sprintf("Note %02d", i), "content": "text"})
+		}
+
+		tests := []struct {
+			query string
+			want  int
+			first string
+		}{
+			{"", 10, "Note 00"},
+			{"?page=2", 10, "Note 10"},
+			{"?page=3", 5, "Note 20"},
+			{"?page=4", 0, ""},
+			{"?page=2&limit=20", 5, "Note 20"},
+		}
+		for _, tt := range tests {
+			t.Run("page"+tt.query, func(t *testing.T) {
+				resp := srv.request("GET", "/api/notes/"+tt.query, token, nil)
+				expectStatus(t, resp, http.StatusOK)
+
+				var body struct {
+					Results int           `json:"results"`
+					Notes   []models.Note `json:"notes"`
+				}
+				decode(t, resp, &body)
+				if body.Results != tt.want || len(body.Notes) != tt.want {
+					t.Fatalf("expected %d notes, got %d", tt.want, len(body.Notes))
+				}
+				if tt.want > 0 && body.Notes[0].Title != tt.first {
+					t.Errorf("expected the page to start with %q, got %q", tt.first, body.Notes[0].Title)
+				}
+			})
+		}
+
+		for _, query := range []string{"?page=first", "?limit=ten"} {
+			t.Run("invalid"+query, func(t *testing.T) {
+				expectStatus(t, srv.request("GET", "/api/notes/"+query, token, nil), http.StatusBadRequest)
+			})
+		}
+	})
+}
+
+func TestNoteSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		srv.createNote(token, map[string]interface{}{"title": "Go generics", "content": "Type parameters", "category": "programming"})
+		srv.createNote(token, map[string]interface{}{"title": "Sourdough", "content": "Flour, water and salt", "category": "cooking"})
+		srv.createNote(token, map[string]interface{}{"title": "Go concurrency", "content": "Channels and WATER pipes", "category": "programming"})
+
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"title=go", []string{"Go generics", "Go concurrency"}},
+			{"content=water", []string{"Sourdough", "Go concurrency"}},
+			{"category=COOK", []string{"Sourdough"}},
+			{"title=go&content=water", []string{"Go concurrency"}},
+			{"title=rust", []string{}},
+			{"", []string{"Go generics", "Sourdough", "Go concurrency"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				resp := srv.request("GET", "/api/notes/search?"+tt.query, token, nil)
+				expectStatus(t, resp, http.StatusOK)
+
+				var notes []models.Note
+				decode(t, resp, &notes)
+				titles := []string{}
+				for _, note := range notes {
+					titles = append(titles, note.Title)
+				}
+				if strings.Join(titles, ",") != strings.Join(tt.want, ",") {
+					t.Errorf("expected %v, got %v", tt.want, titles)
+				}
+			})
+		}
+	})
+}
+
+func TestBulkRoute(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		note := srv.createNote(token, map[string]interface{}{"title": "Draft", "content": "text"})
+
+		resp := srv.request("POST", "/api/notes/bulk", token, map[string]interface{}{
+			"mode": "best_effort",
+			"operations": []map[string]interface{}{
+				{"op": "create", "data": map[string]string{"title": "Created in bulk", "content": "text"}},
+				{"op": "publish", "ids": []string{note.ID, "missing"}, "published": true},
+			},
+		})
+		expectStatus(t, resp, http.StatusMultiStatus)
+
+		resp = srv.request("GET", "/api/notes/"+note.ID, token, nil)
+		var body noteResponse
+		decode(t, resp, &body)
+		if !body.Data.Note.Published {
+			t.Errorf("expected the note to be published")
+		}
+
+		expectStatus(t, srv.request("POST", "/api/notes/bulk", token, map[string]interface{}{"mode": "sometimes"}), http.StatusBadRequest)
+	})
+}
+
+func TestExportImportRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		owner := srv.login()
+		srv.createNote(owner, map[string]interface{}{"title": "First", "content": "one", "category": "a"})
+		srv.createNote(owner, map[string]interface{}{"title": "Second", "content": "two", "contentFormat": "markdown"})
+
+		exports := map[string][]byte{}
+		for _, format := range []string{"zip", "ndjson"} {
+			resp := srv.request("GET", "/api/notes/export?format="+format, owner, nil)
+			expectStatus(t, resp, http.StatusOK)
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("read %s export: %v", format, err)
+			}
+			exports[format] = data
+		}
+		expectStatus(t, srv.request("GET", "/api/notes/export?format=csv", owner, nil), http.StatusBadRequest)
+
+		tests := []struct {
+			name        string
+			format      string
+			contentType string
+			onDuplicate string
+			want        int
+			created     int
+			skipped     int
+			renamed     int
+		}{
+			{"zip into an empty account", "zip", "application/zip", "", http.StatusOK, 2, 0, 0},
+			{"ndjson skips duplicates", "ndjson", "application/x-ndjson", "skip", http.StatusOK, 0, 2, 0},
+			{"ndjson renames duplicates", "ndjson", "application/x-ndjson", "rename", http.StatusOK, 0, 0, 2},
+			{"fail on duplicates", "zip", "application/zip", "fail", http.StatusConflict, 0, 0, 0},
+			{"unknown policy", "zip", "application/zip", "merge", http.StatusBadRequest, 0, 0, 0},
+			{"not a zip archive", "ndjson", "application/zip", "", http.StatusBadRequest, 0, 0, 0},
+		}
+
+		importer := srv.login()
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				path := "/api/notes/import"
+				if tt.onDuplicate != "" {
+					path += "?onDuplicate=" + tt.onDuplicate
+				}
+				resp := srv.request("POST", path, importer, bytes.NewReader(exports[tt.format]), "Content-Type", tt.contentType)
+				expectStatus(t, resp, tt.want)
+				if tt.want != http.StatusOK {
+					return
+				}
+
+				var body struct {
+					Report struct {
+						Created int `json:"created"`
+						Skipped int `json:"skipped"`
+						Renamed int `json:"renamed"`
+					} `json:"report"`
+				}
+				decode(t, resp, &body)
+				if body.Report.Created != tt.created || body.Report.Skipped != tt.skipped || body.Report.Renamed != tt.renamed {
+					t.Errorf("unexpected report %+v", body.Report)
+				}
+			})
+		}
+
+		resp := srv.request("GET", "/api/notes/search?title=First", importer, nil)
+		var notes []models.Note
+		decode(t, resp, &notes)
+		// the imported copy and the renamed copy, the note of the owner is not published
+		if len(notes) != 2 {
+			t.Errorf("expected 2 notes titled First, got %d", len(notes))
+		}
+	})
+}
+
+func TestExportManyNotes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		// more notes than a page of the stream, created in two bulk requests
+		const count = 150
+		for start := 0; start < count; start += 75 {
+			var operations []map[string]interface{}
+			for i := start; i < start+75; i++ {
+				operations = append(operations, map[string]interface{}{"op": "create", "data": map[string]string{"title": "Note " + strconv.Itoa(i), "content": "text"}})
+			}
+			expectStatus(t, srv.request("POST", "/api/notes/bulk", token, map[string]interface{}{"operations": operations}), http.StatusOK)
+		}
+
+		resp := srv.request("GET", "/api/notes/export?format=ndjson", token, nil)
+		expectStatus(t, resp, http.StatusOK)
+		defer resp.Body.Close()
+		titles := map[string]bool{}
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var note models.Note
+			if err := json.Unmarshal(scanner.Bytes(), &note); err != nil {
+				t.Fatalf("decode exported note: %v", err)
+			}
+			titles[note.Title] = true
+		}
+		if len(titles) != count {
+			t.Errorf("expected the %d notes to be exported, got %d", count, len(titles))
+		}
+	})
+}
+
+// uploadFile sends content as the file field of a multipart form, with a random boundary
+func (s *testServer) uploadFile(token, noteID, fileName string, content []byte, headers ...string) *http.Response {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", fileName)
+	part.Write(content)
+	form.Close()
+
+	return s.request("POST", "/api/notes/"+noteID+"/attachments", token, &body, append([]string{"Content-Type", form.FormDataContentType()}, headers...)...)
+}
+
+func TestAttachmentRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		note := srv.createNote(token, map[string]interface{}{"title": "With files", "content": "text"})
+		content := []byte("plain text attachment with enough bytes to request a range")
+
+		resp := srv.uploadFile(token, note.ID, "notes.txt", content)
+		expectStatus(t, resp, http.StatusCreated)
+		var uploaded struct {
+			Data struct {
+				Attachment models.Attachment `json:"attachment"`
+			} `json:"data"`
+		}
+		decode(t, resp, &uploaded)
+		attachment := uploaded.Data.Attachment
+		attachmentPath := "/api/notes/" + note.ID + "/attachments/" + attachment.ID
+
+		t.Run("rejected types", func(t *testing.T) {
+			elf := append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 64)...)
+			expectStatus(t, srv.uploadFile(token, note.ID, "tool", elf), http.StatusUnsupportedMediaType)
+			expectStatus(t, srv.uploadFile(token, "missing", "notes.txt", content), http.StatusNotFound)
+		})
+
+		t.Run("list", func(t *testing.T) {
+			resp := srv.request("GET", "/api/notes/"+note.ID+"/attachments", token, nil)
+			expectStatus(t, resp, http.StatusOK)
+
+			var body struct {
+				Results int `json:"results"`
+			}
+			decode(t, resp, &body)
+			if body.Results != 1 {
+				t.Errorf("expected 1 attachment, got %d", body.Results)
+			}
+		})
+
+		t.Run("download range", func(t *testing.T) {
+			resp := srv.request("GET", attachmentPath, token, nil, "Range", "bytes=0-9")
+			expectStatus(t, resp, http.StatusPartialContent)
+
+			data, _ := io.ReadAll(resp.Body)
+			if string(data) != string(content[:10]) {
+				t.Errorf("expected %q, got %q", content[:10], data)
+			}
+		})
+
+		t.Run("delete", func(t *testing.T) {
+			expectStatus(t, srv.request("DELETE", attachmentPath, token, nil), http.StatusOK)
+			expectStatus(t, srv.request("GET", attachmentPath, token, nil), http.StatusNotFound)
+			expectStatus(t, srv.request("DELETE", attachmentPath, token, nil), http.StatusNotFound)
+		})
+
+		t.Run("deleting the note removes its blobs", func(t *testing.T) {
+			expectStatus(t, srv.uploadFile(token, note.ID, "again.txt", content), http.StatusCreated)
+			expectStatus(t, srv.request("DELETE", "/api/notes/"+note.ID, token, nil), http.StatusOK)
+
+			entries, err := os.ReadDir(filepath.Join(srv.blobsDir, "notes", note.ID))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatalf("read blob directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("expected the blobs to be deleted, found %d", len(entries))
+			}
+		})
+	})
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := newTestServer(t, repository.NewMemoryStore(), nil)
+
+	resp := srv.request("GET", specPath, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	var doc openapi.Document
+	decode(t, resp, &doc)
+
+	if doc.OpenAPI != openapi.Version {
+		t.Errorf("expected OpenAPI %s, got %q", openapi.Version, doc.OpenAPI)
+	}
+
+	// every registered route is documented and every documented operation is registered
+	registered := map[string]bool{}
+	for _, r := range routes(nil, nil, nil, nil, nil, nil) {
+		method, path, _ := strings.Cut(r.pattern, " ")
+		registered[strings.ToLower(method)+" "+path] = true
+
+		op := doc.Paths[path][strings.ToLower(method)]
+		if op == nil {
+			t.Errorf("route %s is missing from the OpenAPI document", r.pattern)
+			continue
+		}
+		if op.Summary == "" || !hasSuccess(op.Responses) {
+			t.Errorf("route %s has no summary or success response in the OpenAPI document", r.pattern)
+		}
+		if r.auth && len(op.Security) == 0 {
+			t.Errorf("route %s requires a token but its operation has no security", r.pattern)
+		}
+		// the spec falls back to undocumented parameters, the route table describes every one of them
+		for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+			if !hasPathParameter(r.op.Parameters, match[1]) {
+				t.Errorf("route %s does not declare its path parameter %s", r.pattern, match[1])
+			}
+		}
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !registered[method+" "+path] {
+				t.Errorf("operation %s %s is documented but not registered", method, path)
+			}
+		}
+	}
+
+	t.Run("schemas follow the validate tags", func(t *testing.T) {
+		note := doc.Components.Schemas["CreateNoteSchema"]
+		if note == nil {
+			t.Fatal("CreateNoteSchema is missing from the components")
+		}
+		if strings.Join(note.Required, ",") != "title,content" {
+			t.Errorf("expected title and content to be required, got %v", note.Required)
+		}
+		if format := note.Properties["contentFormat"]; format == nil || strings.Join(format.Enum, ",") != "plain,markdown" {
+			t.Errorf("expected the content formats as enum, got %+v", format)
+		}
+
+		user := doc.Components.Schemas["CreateUserSchema"]
+		if user == nil {
+			t.Fatal("CreateUserSchema is missing from the components")
+		}
+		if email := user.Properties["email"]; email == nil || email.Format != "email" {
+			t.Errorf("expected an email format, got %+v", email)
+		}
+		if username := user.Properties["username"]; username == nil || *username.MinLength != 3 || *username.MaxLength != 100 {
+			t.Errorf("expected the username length bounds, got %+v", username)
+		}
+		if doc.Components.Schemas["UpdateNoteSchema"] == nil {
+			t.Error("UpdateNoteSchema is missing from the components")
+		}
+	})
+
+	t.Run("docs", func(t *testing.T) {
+		resp := srv.request("GET", docsPath, "", nil)
+		expectStatus(t, resp, http.StatusOK)
+		page, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(page), specPath) {
+			t.Errorf("expected a docs page loading %s, got %s", specPath, page)
+		}
+	})
+}
+
+// pathParam matches the {name} wildcards of a route pattern
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// hasPathParameter reports whether the parameters hold the path parameter name
+func hasPathParameter(params []*openapi.Parameter, name string) bool {
+	for _, p := range params {
+		if p.In == "path" && p.Name == name && p.Required {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSuccess reports whether a 2xx response, or the switch to WebSocket, is documented
+func hasSuccess(responses map[string]*openapi.Response) bool {
+	for status := range responses {
+		if strings.HasPrefix(status, "2") || status == "101" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRequestValidation(t *testing.T) {
+	cfg := testConfig()
+	cfg.Server.MaxBodySize = 1024
+	srv := newTestServer(t, repository.NewMemoryStore(), cfg)
+	token := srv.login()
+
+	t.Run("unknown field", func(t *testing.T) {
+		resp := srv.request("POST", "/api/notes/", token, map[string]string{"title": "Title", "content": "text", "color": "red"})
+		expectStatus(t, resp, http.StatusBadRequest)
+		p := decodeProblem(t, resp)
+		if len(p.Errors) != 1 || p.Errors[0].Field != "color" || p.Errors[0].Tag != "unknown" {
+			t.Errorf("expected the unknown field to be rejected, got %+v", p.Errors)
+		}
+	})
+
+	t.Run("every invalid field", func(t *testing.T) {
+		resp := srv.request("POST", "/api/notes/bulk", token, map[string]interface{}{
+			"mode":       "sometimes",
+			"operations": []map[string]interface{}{{"op": "create"}, {"op": "explode", "tags": []string{""}}},
+		})
+		expectStatus(t, resp, http.StatusBadRequest)
+		var fields []string
+		for _, err := range decodeProblem(t, resp).Errors {
+			fields = append(fields, err.Field+":"+err.Tag)
+		}
+		if got := strings.Join(fields, ","); got != "mode:oneof,operations[1].op:oneof,operations[1].tags[0]:required" {
+			t.Errorf("unexpected errors %s", got)
+		}
+	})
+
+	t.Run("update is validated", func(t *testing.T) {
+		resp := srv.request("PATCH", "/api/notes/some-id", token, map[string]interface{}{"published": "yes"})
+		expectStatus(t, resp, http.StatusBadRequest)
+		if p := decodeProblem(t, resp); len(p.Errors) != 1 || p.Errors[0].Field != "published" {
+			t.Errorf("expected a type error on published, got %+v", p.Errors)
+		}
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		resp := srv.request("POST", "/api/notes/", token, strings.NewReader(`{"title": "Title", "content": "text"}`), "Content-Type", "text/plain")
+		expectStatus(t, resp, http.StatusUnsupportedMediaType)
+		decodeProblem(t, resp)
+	})
+
+	t.Run("body size", func(t *testing.T) {
+		resp := srv.request("POST", "/api/notes/", token, map[string]string{"title": "Title", "content": strings.Repeat("a", 2048)})
+		expectStatus(t, resp, http.StatusRequestEntityTooLarge)
+		decodeProblem(t, resp)
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		resp := srv.request("POST", "/api/notes/", token, strings.NewReader(""))
+		expectStatus(t, resp, http.StatusBadRequest)
+		decodeProblem(t, resp)
+	})
+
+	t.Run("query parameters", func(t *testing.T) {
+		resp := srv.request("GET", "/api/notes/?page=0&limit=ten", token, nil)
+		expectStatus(t, resp, http.StatusBadRequest)
+		var fields []string
+		for _, err := range decodeProblem(t, resp).Errors {
+			fields = append(fields, err.Field+":"+err.Tag)
+		}
+		if got := strings.Join(fields, ","); got != "page:min,limit:type" {
+			t.Errorf("unexpected errors %s", got)
+		}
+		expectStatus(t, srv.request("GET", "/api/notes/some-id?render=pdf", token, nil), http.StatusBadRequest)
+	})
+
+	t.Run("authentication comes first", func(t *testing.T) {
+		expectStatus(t, srv.request("POST", "/api/notes/", "", map[string]string{"color": "red"}), http.StatusUnauthorized)
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	forEachStore(t, func(t *testing.T, srv *testServer) {
+		token := srv.login()
+		note := map[string]interface{}{"title": "Once", "content": "text"}
+
+		first := srv.request("POST", "/api/notes/", token, note, "Idempotency-Key", "create-once")
+		expectStatus(t, first, http.StatusCreated)
+		var created noteResponse
+		decode(t, first, &created)
+		if first.Header.Get(middleware.IdempotentReplayedHeader) != "" {
+			t.Error("expected the first response not to be a replay")
+		}
+
+		// without the key the retry would conflict on the title
+		retry := srv.request("POST", "/api/notes/", token, note, "Idempotency-Key", "create-once")
+		expectStatus(t, retry, http.StatusCreated)
+		var replayed noteResponse
+		decode(t, retry, &replayed)
+		if replayed.Data.Note.ID != created.Data.Note.ID || retry.Header.Get(middleware.IdempotentReplayedHeader) != "true" {
+			t.Errorf("expected the first response to be replayed, got note %s", replayed.Data.Note.ID)
+		}
+
+		other := srv.request("POST", "/api/notes/", token, map[string]interface{}{"title": "Other", "content": "text"}, "Idempotency-Key", "create-once")
+		expectStatus(t, other, http.StatusUnprocessableEntity)
+		decodeProblem(t, other)
+
+		// keys are per user
+		otherUser := srv.request("POST", "/api/notes/", srv.login(), note, "Idempotency-Key", "create-once")
+		expectStatus(t, otherUser, http.StatusCreated)
+
+		// a failed request is replayed too
+		conflict := srv.request("POST", "/api/notes/", token, note, "Idempotency-Key", "create-twice")
+		expectStatus(t, conflict, http.StatusConflict)
+		conflict = srv.request("POST", "/api/notes/", token, note, "Idempotency-Key", "create-twice")
+		expectStatus(t, conflict, http.StatusConflict)
+		if conflict.Header.Get(middleware.IdempotentReplayedHeader) != "true" {
+			t.Error("expected the conflict to be replayed")
+		}
+
+		tooLong := srv.request("POST", "/api/notes/", token, note, "Idempotency-Key", strings.Repeat("k", 256))
+		expectStatus(t, tooLong, http.StatusBadRequest)
+		decodeProblem(t, tooLong)
+
+		// the multipart boundary changes between the retries of an upload
+		var attachments [2]models.Attachment
+		for i := range attachments {
+			resp := srv.uploadFile(token, created.Data.Note.ID, "a.txt", []byte("hello"), "Idempotency-Key", "upload-once")
+			expectStatus(t, resp, http.StatusCreated)
+			var body struct {
+				Data struct {
+					Attachment models.Attachment `json:"attachment"`
+				} `json:"data"`
+			}
+			decode(t, resp, &body)
+			attachments[i] = body.Data.Attachment
+		}
+		if attachments[0].ID == "" || attachments[0].ID != attachments[1].ID {
+			t.Errorf("expected the upload to run once, got %s and %s", attachments[0].ID, attachments[1].ID)
+		}
+	})
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	for _, store := range testStores(t) {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := store.open(t)
+			srv := newTestServer(t, repo, nil)
+			token := srv.login()
+
+			var mu sync.Mutex
+			var received []*http.Request
+			var bodies [][]byte
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				received = append(received, r)
+				bodies = append(bodies, body)
+				mu.Unlock()
+			}))
+			defer receiver.Close()
+
+			resp := srv.request("POST", "/api/webhooks", token, map[string]interface{}{"url": receiver.URL, "events": []string{"note.created", "note.deleted"}})
+			expectStatus(t, resp, http.StatusCreated)
+			var created struct {
+				Data struct {
+					Webhook models.Webhook `json:"webhook"`
+				} `json:"data"`
+			}
+			decode(t, resp, &created)
+			webhook := created.Data.Webhook
+			if webhook.Secret == "" || !webhook.Active {
+				t.Fatalf("expected an active webhook with a generated secret, got %+v", webhook)
+			}
+
+			resp = srv.request("GET", "/api/webhooks/"+webhook.ID, token, nil)
+			expectStatus(t, resp, http.StatusOK)
+			if body, _ := io.ReadAll(resp.Body); strings.Contains(string(body), webhook.Secret) {
+				t.Error("expected the secret to be sent only once")
+			}
+			expectStatus(t, srv.request("GET", "/api/webhooks/"+webhook.ID, srv.login(), nil), http.StatusNotFound)
+
+			resp = srv.request("POST", "/api/webhooks", token, map[string]interface{}{"url": receiver.URL, "systemWide": true})
+			expectStatus(t, resp, http.StatusForbidden)
+			decodeProblem(t, resp)
+			resp = srv.request("POST", "/api/webhooks", token, map[string]interface{}{"url": "ftp://example.com/hook"})
+			expectStatus(t, resp, http.StatusBadRequest)
+			if p := decodeProblem(t, resp); len(p.Errors) != 1 || p.Errors[0].Field != "url" {
+				t.Errorf("expected the url to be rejected, got %+v", p.Errors)
+			}
+
+			// the update is not subscribed to
+			note := srv.createNote(token, map[string]interface{}{"title": "Hooked", "content": "text"})
+			expectStatus(t, srv.request("PATCH", "/api/notes/"+note.ID, token, map[string]interface{}{"content": "more"}), http.StatusOK)
+			expectStatus(t, srv.request("DELETE", "/api/notes/"+note.ID, token, nil), http.StatusOK)
+
+			relay := events.NewRelay(repo, config.Default().Outbox, nil, webhooks.Sink{})
+			// the registrations of the two users and the three note events
+			if relayed, err := relay.RunOnce(ctx); err != nil || relayed != 5 {
+				t.Fatalf("expected the 5 events of the test to be relayed, got %d: %v", relayed, err)
+			}
+			dispatcher := webhooks.NewDispatcher(repo, config.Default().Webhooks, nil)
+			if sent, err := dispatcher.RunOnce(ctx); err != nil || sent != 2 {
+				t.Fatalf("expected 2 deliveries, got %d: %v", sent, err)
+			}
+			mu.Lock()
+			if len(received) != 2 {
+				t.Fatalf("expected 2 requests, got %d", len(received))
+			}
+			types := map[string]bool{}
+			for i, req := range received {
+				timestamp, _ := strconv.ParseInt(req.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+				if !webhooks.Verify(webhook.Secret, req.Header.Get(webhooks.HeaderSignature), timestamp, bodies[i]) {
+					t.Errorf("invalid signature of %s", req.Header.Get(webhooks.HeaderEvent))
+				}
+				types[req.Header.Get(webhooks.HeaderEvent)] = true
+			}
+			mu.Unlock()
+			if !types["note.created"] || !types["note.deleted"] {
+				t.Errorf("expected the created and deleted events, got %v", types)
+			}
+
+			resp = srv.request("GET", "/api/webhooks/"+webhook.ID+"/deliveries", token, nil)
+			expectStatus(t, resp, http.StatusOK)
+			var log struct {
+				Deliveries []models.WebhookDelivery `json:"deliveries"`
+			}
+			decode(t, resp, &log)
+			if len(log.Deliveries) != 2 || log.Deliveries[0].Status != models.DeliverySucceeded {
+				t.Fatalf("unexpected delivery log %+v", log.Deliveries)
+			}
+
+			resp = srv.request("POST", "/api/webhooks/"+webhook.ID+"/deliveries/"+log.Deliveries[0].ID+"/redeliver", token, nil)
+			expectStatus(t, resp, http.StatusAccepted)
+			if sent, err := dispatcher.RunOnce(ctx); err != nil || sent != 1 {
+				t.Fatalf("expected the redelivery to be sent, got %d: %v", sent, err)
+			}
+			mu.Lock()
+			if len(received) != 3 || string(bodies[2]) != string(log.Deliveries[0].Payload) {
+				t.Errorf("expected the same payload to be sent again")
+			}
+			mu.Unlock()
+
+			// a paused webhook gets no more deliveries
+			expectStatus(t, srv.request("PATCH", "/api/webhooks/"+webhook.ID, token, map[string]interface{}{"active": false}), http.StatusOK)
+			srv.createNote(token, map[string]interface{}{"title": "Unhooked", "content": "text"})
+			relay.RunOnce(ctx)
+			if sent, _ := dispatcher.RunOnce(ctx); sent != 0 {
+				t.Errorf("expected no delivery to a paused webhook, got %d", sent)
+			}
+
+			expectStatus(t, srv.request("DELETE", "/api/webhooks/"+webhook.ID, token, nil), http.StatusOK)
+			expectStatus(t, srv.request("GET", "/api/webhooks/"+webhook.ID+"/deliveries", token, nil), http.StatusNotFound)
+		})
+	}
+}
+
+func TestSystemWideWebhook(t *testing.T) {
+	repo := repository.NewMemoryStore()
+	srv := newTestServer(t, repo, nil)
+
+	// the role is not part of the registration, only the admins promoted in the database get one
+	register := map[string]string{"username": "mallory", "email": "mallory@example.com", "password": "correct horse", "fullName": "Mallory", "role": models.RoleAdmin}
+	expectStatus(t, srv.request("POST", "/api/auth/register", "", register), http.StatusBadRequest)
+	delete(register, "role")
+	resp := srv.request("POST", "/api/auth/register", "", register)
+	expectStatus(t, resp, http.StatusCreated)
+	var registered struct {
+		Data models.User `json:"data"`
+	}
+	decode(t, resp, &registered)
+	if registered.Data.Role != models.RoleUser {
+		t.Errorf("expected the %s role, got %q", models.RoleUser, registered.Data.Role)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	decode(t, srv.request("POST", "/api/auth/login", "", map[string]string{"email": register["email"], "password": register["password"]}), &login)
+	resp = srv.request("POST", "/api/webhooks", login.Token, map[string]interface{}{"url": "https://hooks.example.com/notes", "systemWide": true})
+	expectStatus(t, resp, http.StatusForbidden)
+
+	password, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	admin := models.User{Username: "admin", Email: "admin@example.com", Password: string(password), FullName: "The Admin", Role: models.RoleAdmin}
+	if err := repo.Users().Create(context.Background(), &admin); err != nil {
+		t.Fatalf("create the admin: %v", err)
+	}
+	decode(t, srv.request("POST", "/api/auth/login", "", map[string]string{"email": admin.Email, "password": "correct horse"}), &login)
+	// the registration of the admin is relayed before the webhook exists
+	relay := events.NewRelay(repo, config.Default().Outbox, nil, webhooks.Sink{})
+	relay.RunOnce(context.Background())
+
+	resp = srv.request("POST", "/api/webhooks", login.Token, map[string]interface{}{"url": "https://hooks.example.com/notes", "systemWide": true})
+	expectStatus(t, resp, http.StatusCreated)
+	var created struct {
+		Data struct {
+			Webhook models.Webhook `json:"webhook"`
+		} `json:"data"`
+	}
+	decode(t, resp, &created)
+	if created.Data.Webhook.UserID != "" {
+		t.Errorf("expected a system-wide webhook, got the owner %q", created.Data.Webhook.UserID)
+	}
+
+	// the registration and the note of another user are queued for it
+	srv.createNote(srv.login(), map[string]interface{}{"title": "Anyone's", "content": "text"})
+	if _, err := relay.RunOnce(context.Background()); err != nil {
+		t.Fatalf("relay the events: %v", err)
+	}
+	deliveries, err := repo.WebhookDeliveries().ListByWebhook(context.Background(), created.Data.Webhook.ID, 10)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d: %v", len(deliveries), err)
+	}
+	payloads := map[string]string{}
+	for _, delivery := range deliveries {
+		payloads[delivery.Event] = string(delivery.Payload)
+	}
+	if _, ok := payloads[models.EventNoteCreated]; !ok {
+		t.Errorf("expected a note.created delivery, got %v", payloads)
+	}
+	if payload, ok := payloads[models.EventUserRegistered]; !ok || strings.Contains(payload, "password") {
+		t.Errorf("expected a user.registered delivery without the password hash, got %q", payload)
+	}
+}
+
+// sseEvent is an event of a stream, heartbeats have the event ":"
+type sseEvent struct {
+	id, event, data string
+}
+
+// stream opens the note event stream, resuming after lastEventID when it is set
+func (s *testServer) stream(token, lastEventID string) <-chan sseEvent {
+	s.t.Helper()
+
+	headers := []string{}
+	if lastEventID != "" {
+		headers = append(headers, "Last-Event-ID", lastEventID)
+	}
+	resp := s.request("GET", "/api/notes/events", token, nil, headers...)
+	expectStatus(s.t, resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		s.t.Fatalf("expected an event stream, got %q", contentType)
+	}
+
+	events := make(chan sseEvent, 100)
+	go func() {
+		defer close(events)
+		var event sseEvent
+		for scanner := bufio.NewScanner(resp.Body); scanner.Scan(); {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event != (sseEvent{}) {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				event.event = ":"
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+// nextEvent returns the next event of a stream that is not a heartbeat
+func nextEvent(t *testing.T, stream <-chan sseEvent) sseEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				t.Fatal("the stream ended")
+			}
+			if event.event != ":" {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for an event")
+		}
+	}
+}
+
+func TestNoteEventStream(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig()
+	cfg.Stream.Heartbeat = 20 * time.Millisecond
+	// the streams outlive the write timeout
+	cfg.Server.WriteTimeout = 200 * time.Millisecond
+	repo := repository.NewMemoryStore()
+	srv := newTestServer(t, repo, cfg)
+	relay := events.NewRelay(repo, cfg.Outbox, nil, srv.bus)
+	// signed directly, registering takes longer than the write timeout
+	alice, _ := utils.GenerateJWT(cfg.Auth.JWTSecret, time.Hour, "alice", "alice", "")
+	bob, _ := utils.GenerateJWT(cfg.Auth.JWTSecret, time.Hour, "bob", "bob", "")
+
+	stream := srv.stream(alice, "")
+	own := srv.createNote(alice, map[string]interface{}{"title": "Mine", "content": "text"})
+	srv.createNote(bob, map[string]interface{}{"title": "Private", "content": "text"})
+	public := srv.createNote(bob, map[string]interface{}{"title": "Public", "content": "text", "published": true})
+	expectStatus(t, srv.request("PATCH", "/api/notes/"+own.ID, alice, map[string]interface{}{"content": "more"}), http.StatusOK)
+	relay.RunOnce(ctx)
+
+	// the private note of bob and the note.published event are left out
+	want := []struct{ event, noteID string }{
+		{models.EventNoteCreated, own.ID},
+		{models.EventNoteCreated, public.ID},
+		{models.EventNoteUpdated, own.ID},
+	}
+	var got []sseEvent
+	for _, w := range want {
+		event := nextEvent(t, stream)
+		var payload struct {
+			Type string `json:"type"`
+			Data struct {
+				Note models.Note `json:"note"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(event.data), &payload); err != nil {
+			t.Fatalf("decode %q: %v", event.data, err)
+		}
+		if event.event != w.event || payload.Type != w.event || payload.Data.Note.ID != w.noteID || event.id == "" {
+			t.Errorf("expected %s of %s, got %+v", w.event, w.noteID, event)
+		}
+		got = append(got, event)
+	}
+
+	// heartbeats keep the stream open past the write timeout
+	time.Sleep(300 * time.Millisecond)
+	expectStatus(t, srv.request("DELETE", "/api/notes/"+own.ID, alice, nil), http.StatusOK)
+	relay.RunOnce(ctx)
+	deleted := nextEvent(t, stream)
+	if deleted.event != models.EventNoteDeleted {
+		t.Errorf("expected the deletion, got %+v", deleted)
+	}
+
+	// a client reconnecting gets what it missed
+	resumed := srv.stream(alice, got[0].id)
+	for _, expected := range append(got[1:], deleted) {
+		if event := nextEvent(t, resumed); event.id != expected.id {
+			t.Errorf("expected the event %s to be replayed, got %+v", expected.id, event)
+		}
+	}
+
+	resp := srv.request("GET", "/api/notes/events", alice, nil, "Last-Event-ID", "latest")
+	expectStatus(t, resp, http.StatusBadRequest)
+	decodeProblem(t, resp)
+}
+
+// dial opens the collaborative editing socket of a note, headers are name and value pairs
+func (s *testServer) dial(path, token string, headers ...string) (*websocket.Conn, *http.Response) {
+	s.t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		header.Set(headers[i], headers[i+1])
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+path, header)
+	if err != nil && resp == nil {
+		s.t.Fatalf("dial %s: %v", path, err)
+	}
+	if conn != nil {
+		s.t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp
+}
+
+// readMessage returns the next message of a collaborative editing socket
+func readMessage(t *testing.T, conn *websocket.Conn) collab.Message {
+	t.Helper()
+	var msg collab.Message
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	return msg
+}
+
+func TestCollabRoute(t *testing.T) {
+	srv := newTestServer(t, repository.NewMemoryStore(), nil)
+	alice, bob := srv.login(), srv.login()
+	note := srv.createNote(alice, map[string]interface{}{"title": "Shared", "content": "hello", "published": true})
+	path := "/api/notes/" + note.ID + "/collab"
+	private := srv.createNote(alice, map[string]interface{}{"title": "Private", "content": "hello"})
+
+	expectStatus(t, srv.request("GET", path, alice, nil), http.StatusBadRequest)
+	for _, tt := range []struct {
+		name, path, token, origin string
+		want                      int
+	}{
+		{"no token", path, "", "", http.StatusUnauthorized},
+		{"unknown note", "/api/notes/00000000-0000-0000-0000-000000000000/collab", alice, "", http.StatusNotFound},
+		{"someone else's note", "/api/notes/" + private.ID + "/collab", bob, "", http.StatusNotFound},
+		{"foreign origin", path, alice, "http://evil.example", http.StatusForbidden},
+	} {
+		if _, resp := srv.dial(tt.path, tt.token, "Origin", tt.origin); resp.StatusCode != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, resp.StatusCode)
+		}
+	}
+
+	first, _ := srv.dial(path, alice, "Origin", "http://localhost:3000")
+	if init := readMessage(t, first); init.Type != collab.MessageInit || init.Content != "hello" || init.Revision != 0 {
+		t.Fatalf("unexpected init %+v", init)
+	}
+	// browsers send the token in the query, the other users follow the published note
+	second, _ := srv.dial(path+"?access_token="+bob, "")
+	if init := readMessage(t, second); len(init.Peers) != 1 {
+		t.Fatalf("expected the first client in the peers, got %+v", init)
+	}
+	if join := readMessage(t, first); join.Type != collab.MessageJoin || join.Peer.Username == "" {
+		t.Errorf("expected the second client to join, got %+v", join)
+	}
+
+	first.WriteMessage(websocket.TextMessage, []byte(`{"type":"op","revision":0,"op":[5," world"]}`))
+	if ack := readMessage(t, first); ack.Type != collab.MessageAck || ack.Revision != 1 {
+		t.Errorf("expected an ack, got %+v", ack)
+	}
+	if op := readMessage(t, second); op.Type != collab.MessageOp || op.Revision != 1 || op.Op.TargetLen() != 11 {
+		t.Errorf("expected the op, got %+v", op)
+	}
+	second.WriteMessage(websocket.TextMessage, []byte(`{"type":"cursor","cursor":{"anchor":0,"head":5}}`))
+	if cursor := readMessage(t, first); cursor.Type != collab.MessageCursor || cursor.Cursor.Head != 5 {
+		t.Errorf("expected the cursor, got %+v", cursor)
+	}
+
+	// only the owner edits the note, the op of another user closes the connection after an error
+	second.WriteMessage(websocket.TextMessage, []byte(`{"type":"op","revision":1,"op":[11]}`))
+	if msg := readMessage(t, second); msg.Type != collab.MessageError || !strings.Contains(msg.Error, "owner") {
+		t.Errorf("expected an error, got %+v", msg)
+	}
+	if _, _, err := second.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+	if leave := readMessage(t, first); leave.Type != collab.MessageLeave {
+		t.Errorf("expected the second client to leave, got %+v", leave)
+	}
+
+	// the room is saved when the last client leaves
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var body noteResponse
+		decode(t, srv.request("GET", "/api/notes/"+note.ID, alice, nil), &body)
+		if body.Data.Note.Content == "hello world" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the edit to be saved, got %q", body.Data.Note.Content)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// graphqlResponse is the body of POST /graphql
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (s *testServer) graphql(token, query string, variables map[string]interface{}, data interface{}) graphqlResponse {
+	s.t.Helper()
+
+	resp := s.request("POST", "/graphql", token, map[string]interface{}{"query": query, "variables": variables})
+	expectStatus(s.t, resp, http.StatusOK)
+	var body graphqlResponse
+	decode(s.t, resp, &body)
+	if data != nil && len(body.Data) > 0 {
+		if err := json.Unmarshal(body.Data, data); err != nil {
+			s.t.Fatalf("decode data: %v", err)
+		}
+	}
+	return body
+}
+
+// countingUsers counts the queries loading users
+type countingUsers struct {
+	repository.UserRepository
+	batches *int
+}
+
+func (u countingUsers) FindByIDs(ctx context.Context, ids []string) ([]models.User, error) {
+	*u.batches++
+	return u.UserRepository.FindByIDs(ctx, ids)
+}
+
+type countingStore struct {
+	repository.Store
+	batches *int
+}
+
+func (s countingStore) Users() repository.UserRepository {
+	return countingUsers{s.Store.Users(), s.batches}
+}
+
+func TestGraphQLRoute(t *testing.T) {
+	var batches int
+	srv := newTestServer(t, countingStore{repository.NewMemoryStore(), &batches}, nil)
+	alice, bob := srv.login(), srv.login()
+	var ids []string
+	// alice sees the published note of bob along with her own ones
+	for i, token := range []string{alice, bob, alice} {
+		ids = append(ids, srv.createNote(token, map[string]interface{}{"title": fmt.Sprintf("Note %d", i), "content": "text", "published": token == bob}).ID)
+	}
+	for i, token := range []string{alice, bob} {
+		srv.request("POST", "/api/notes/bulk", token, map[string]interface{}{
+			"operations": []map[string]interface{}{{"op": "tag", "ids": ids[i : i+1], "tags": []string{"go", "db"}}},
+		})
+	}
+
+	expectStatus(t, srv.request("POST", "/graphql", "", map[string]string{"query": "{ me { id } }"}), http.StatusUnauthorized)
+	expectStatus(t, srv.request("POST", "/graphql", alice, map[string]string{"variables": "{}"}), http.StatusBadRequest)
+
+	t.Run("query", func(t *testing.T) {
+		var data struct {
+			Me struct {
+				Email string
+				Notes struct{ Nodes []models.Note }
+			}
+			Notes struct {
+				Edges []struct {
+					Cursor string
+					Node   struct {
+						Title  string
+						Author struct{ Username, Email *string }
+					}
+				}
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			}
+			Tags []struct {
+				Name  string
+				Count int
+				Notes struct{ Nodes []models.Note }
+			}
+		}
+		body := srv.graphql(alice, `query($first: Int) {
+			me { email notes { nodes { title } } }
+			notes(first: $first) { edges { cursor node { title author { username email } } } pageInfo { hasNextPage endCursor } }
+			tags { name count notes(first: 1) { nodes { title } } }
+		}`, map[string]interface{}{"first": 2}, &data)
+		if len(body.Errors) != 0 {
+			t.Fatalf("unexpected errors %+v", body.Errors)
+		}
+		if data.Me.Email == "" || len(data.Me.Notes.Nodes) != 2 || data.Me.Notes.Nodes[1].Title != "Note 2" {
+			t.Errorf("unexpected me %+v", data.Me)
+		}
+		edges := data.Notes.Edges
+		if len(edges) != 2 || !data.Notes.PageInfo.HasNextPage || data.Notes.PageInfo.EndCursor != edges[1].Cursor {
+			t.Fatalf("unexpected page %+v", data.Notes)
+		}
+		// the email of the other users is hidden
+		if edges[0].Node.Author.Email == nil || edges[1].Node.Author.Username == nil || edges[1].Node.Author.Email != nil {
+			t.Errorf("unexpected authors %+v", edges)
+		}
+		// the authors of the page are loaded at once
+		if batches != 1 {
+			t.Errorf("expected a single batch of users, got %d", batches)
+		}
+		if len(data.Tags) != 2 || data.Tags[0].Name != "db" || data.Tags[0].Count != 2 || len(data.Tags[0].Notes.Nodes) != 1 {
+			t.Errorf("unexpected tags %+v", data.Tags)
+		}
+
+		var next struct {
+			Notes struct{ Nodes []models.Note }
+		}
+		srv.graphql(alice, `query($after: String) { notes(after: $after) { nodes { title } } }`,
+			map[string]interface{}{"after": data.Notes.PageInfo.EndCursor}, &next)
+		if len(next.Notes.Nodes) != 1 || next.Notes.Nodes[0].Title != "Note 2" {
+			t.Errorf("unexpected next page %+v", next)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		var data struct {
+			SearchNotes struct{ Nodes []models.Note }
+		}
+		// the note of alice matches too but is not published
+		srv.graphql(bob, `{ searchNotes(title: "note", tag: "go") { nodes { title tags } } }`, nil, &data)
+		if len(data.SearchNotes.Nodes) != 1 || data.SearchNotes.Nodes[0].Title != "Note 1" || len(data.SearchNotes.Nodes[0].Tags) != 2 {
+			t.Errorf("unexpected search %+v", data)
+		}
+	})
+
+	t.Run("ownership", func(t *testing.T) {
+		var me struct {
+			Me struct{ ID string }
+		}
+		srv.graphql(alice, `{ me { id } }`, nil, &me)
+
+		var data struct {
+			Notes struct{ Nodes []models.Note }
+			User  struct {
+				Notes struct{ Nodes []models.Note }
+			}
+			Tags []struct {
+				Name  string
+				Count int
+			}
+		}
+		body := srv.graphql(bob, `query($id: ID!) { notes { nodes { title } } user(id: $id) { notes { nodes { title } } } tags { name count } }`,
+			map[string]interface{}{"id": me.Me.ID}, &data)
+		if len(body.Errors) != 0 || len(data.Notes.Nodes) != 1 || data.Notes.Nodes[0].Title != "Note 1" {
+			t.Errorf("expected bob to only see his note, got %+v %+v", data.Notes, body.Errors)
+		}
+		if len(data.User.Notes.Nodes) != 0 {
+			t.Errorf("expected the notes of alice to be hidden, got %+v", data.User.Notes)
+		}
+		if len(data.Tags) != 2 || data.Tags[0].Count != 1 {
+			t.Errorf("expected the tags of the note of bob only, got %+v", data.Tags)
+		}
+
+		for name, query := range map[string]string{
+			"note":   `{ note(id: "` + ids[0] + `") { id } }`,
+			"update": `mutation { updateNote(id: "` + ids[0] + `", input: {title: "Mine"}) { id } }`,
+		} {
+			body := srv.graphql(bob, query, nil, nil)
+			if len(body.Errors) != 1 || body.Errors[0].Extensions["code"] != "NOT_FOUND" {
+				t.Errorf("%s: expected a NOT_FOUND error, got %+v", name, body.Errors)
+			}
+		}
+		var rest noteResponse
+		decode(t, srv.request("GET", "/api/notes/"+ids[0], alice, nil), &rest)
+		if rest.Data.Note.Title != "Note 0" {
+			t.Errorf("expected the note of alice to be left alone, got %q", rest.Data.Note.Title)
+		}
+	})
+
+	t.Run("mutations", func(t *testing.T) {
+		var created struct {
+			CreateNote models.Note
+		}
+		body := srv.graphql(bob, `mutation($input: CreateNoteInput!) { createNote(input: $input) { id title contentFormat } }`,
+			map[string]interface{}{"input": map[string]interface{}{"title": "From GraphQL", "content": "text"}}, &created)
+		if len(body.Errors) != 0 || created.CreateNote.ContentFormat != "plain" {
+			t.Fatalf("unexpected creation %+v %+v", created, body.Errors)
+		}
+
+		var updated struct {
+			UpdateNote models.Note
+		}
+		srv.graphql(bob, `mutation($id: ID!) { updateNote(id: $id, input: {published: true}) { title published } }`,
+			map[string]interface{}{"id": created.CreateNote.ID}, &updated)
+		if updated.UpdateNote.Title != "From GraphQL" || !updated.UpdateNote.Published {
+			t.Errorf("unexpected update %+v", updated)
+		}
+		var rest noteResponse
+		decode(t, srv.request("GET", "/api/notes/"+created.CreateNote.ID, bob, nil), &rest)
+		if !rest.Data.Note.Published {
+			t.Error("expected the update to be saved")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name, query, code string
+		}{
+			{"validation", `mutation { createNote(input: {title: "", content: "text"}) { id } }`, "BAD_USER_INPUT"},
+			{"invalid format", `mutation { updateNote(id: "` + ids[0] + `", input: {contentFormat: "html"}) { id } }`, "BAD_USER_INPUT"},
+			{"conflict", `mutation { createNote(input: {title: "Note 0", content: "text"}) { id } }`, "CONFLICT"},
+			{"not found", `{ note(id: "missing") { id } }`, "NOT_FOUND"},
+			{"page size", `{ notes(first: 500) { nodes { id } } }`, "BAD_USER_INPUT"},
+			{"cursor", `{ notes(after: "nope") { nodes { id } } }`, "BAD_USER_INPUT"},
+			{"too deep", `{ me { notes { nodes { author { notes { nodes { author { notes { nodes { author { id } } } } } } } } } } }`, "QUERY_TOO_DEEP"},
+			{"too complex", `{ notes(first: 100) { nodes { author { notes(first: 100) { nodes { id } } } } } }`, "QUERY_TOO_COMPLEX"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				body := srv.graphql(alice, tt.query, nil, nil)
+				if len(body.Errors) != 1 || body.Errors[0].Extensions["code"] != tt.code {
+					t.Errorf("expected a %s error, got %+v", tt.code, body.Errors)
+				}
+			})
+		}
+
+		body := srv.graphql(alice, `mutation { createNote(input: {title: "", content: "text"}) { id } }`, nil, nil)
+		if errs, _ := body.Errors[0].Extensions["errors"].([]interface{}); len(errs) != 1 {
+			t.Errorf("expected the invalid fields, got %+v", body.Errors[0].Extensions)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"example/rest-api/config"
+)
+
+// ErrNotFound is returned when a blob does not exist in the store
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is an opened blob that can be read from any offset
+type Blob interface {
+	io.ReadSeekCloser
+}
+
+// BlobStore stores the content of note attachments
+type BlobStore interface {
+	// Put stores size bytes read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the blob stored under key
+	Open(ctx context.Context, key string) (Blob, error)
+	// Delete removes the blob stored under key, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStore creates the blob store selected by the storage driver
+func NewStore(cfg config.StorageConfig) (BlobStore, error) {
+	switch cfg.Driver {
+	case "local":
+		return NewLocalStore(cfg.LocalDir)
+	case "s3":
+		return NewS3Store(context.Background(), S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			UseSSL:    cfg.S3.UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
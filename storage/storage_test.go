@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBlobStore runs the behaviour every BlobStore shares against store
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	content := []byte("attachment content read from any offset")
+
+	if err := store.Put(ctx, "notes/1/a.txt", bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	blob, err := store.Open(ctx, "notes/1/a.txt")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if data, err := io.ReadAll(blob); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("expected %q, got %q, %v", content, data, err)
+	}
+	if _, err := blob.Seek(11, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	part := make([]byte, 7)
+	if _, err := io.ReadFull(blob, part); err != nil || string(part) != "content" {
+		t.Errorf("expected to read from the offset, got %q, %v", part, err)
+	}
+	blob.Close()
+
+	// a blob is replaced as a whole
+	if err := store.Put(ctx, "notes/1/a.txt", strings.NewReader("v2"), 2, "text/plain"); err != nil {
+		t.Fatalf("put again: %v", err)
+	}
+	blob, err = store.Open(ctx, "notes/1/a.txt")
+	if err != nil {
+		t.Fatalf("open again: %v", err)
+	}
+	if data, _ := io.ReadAll(blob); string(data) != "v2" {
+		t.Errorf("expected the new content, got %q", data)
+	}
+	blob.Close()
+
+	if _, err := store.Open(ctx, "notes/1/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := store.Delete(ctx, "notes/1/a.txt"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := store.Open(ctx, "notes/1/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the blob to be gone, got %v", err)
+	}
+	if err := store.Delete(ctx, "notes/1/a.txt"); err != nil {
+		t.Errorf("expected deleting a missing blob to succeed, got %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	testBlobStore(t, store)
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "short", strings.NewReader("abc"), 5, "text/plain"); err == nil {
+		t.Errorf("expected a size mismatch to fail")
+	}
+	if _, err := store.Open(ctx, "short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a failed upload to leave no blob, got %v", err)
+	}
+
+	for _, key := range []string{"../escape", "notes/../../escape", "..", "/etc/passwd", ".", ""} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("%q: expected the key to be rejected on put", key)
+		}
+		if _, err := store.Open(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: expected the key to be rejected on open, got %v", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("%q: expected the key to be rejected on delete", key)
+		}
+	}
+	// a key only looking like a parent directory stays below the root
+	if err := store.Put(ctx, "notes/..hidden", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Errorf("expected ..hidden to be a valid key, got %v", err)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	opts := S3Options{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    "attachments",
+		AccessKey: "access",
+		SecretKey: "secret-key",
+	}
+	store, err := NewS3Store(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if !fake.buckets["attachments"] {
+		t.Fatalf("expected the bucket to be created")
+	}
+	testBlobStore(t, store)
+
+	// an existing bucket is reused
+	if _, err := NewS3Store(context.Background(), opts); err != nil {
+		t.Errorf("expected the existing bucket to be used, got %v", err)
+	}
+	if _, err := NewS3Store(context.Background(), S3Options{Endpoint: opts.Endpoint}); err == nil {
+		t.Errorf("expected a missing bucket name to be rejected")
+	}
+}
+
+// fakeS3 serves the subset of the S3 API the store uses, with path style buckets and unchecked signatures
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]bool{}, objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !f.buckets[bucket] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			f.buckets[bucket] = true
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	if !f.buckets[bucket] {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	name := bucket + "/" + key
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Body(r)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[name] = data
+		w.Header().Set("ETag", etag(data))
+	case http.MethodHead, http.MethodGet:
+		data, ok := f.objects[name]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				s3Error(w, http.StatusNotFound, "NoSuchKey")
+			}
+			return
+		}
+		w.Header().Set("ETag", etag(data))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, key, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func etag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, len(data))
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// readS3Body reads an upload, decoding the aws-chunked encoding the client streams over plain http
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var data []byte
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
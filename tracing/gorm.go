@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	spanKey   = "tracing:span"
+	parentKey = "tracing:parent"
+)
+
+// GormPlugin wraps every gorm operation in a client span, child of the span in the context given to WithContext.
+// Like the query logs, the spans carry the SQL with its placeholders and never the parameters.
+type GormPlugin struct {
+	tracer trace.Tracer
+	dbName string
+}
+
+func NewGormPlugin(tp trace.TracerProvider, dbName string) *GormPlugin {
+	return &GormPlugin{tracer: Tracer(tp), dbName: dbName}
+}
+
+func (p *GormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize registers the callbacks around the whole chain of each operation, transaction included
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("*").Register("tracing:before_create", p.before),
+		cb.Create().After("*").Register("tracing:after_create", p.after),
+		cb.Query().Before("*").Register("tracing:before_query", p.before),
+		cb.Query().After("*").Register("tracing:after_query", p.after),
+		cb.Update().Before("*").Register("tracing:before_update", p.before),
+		cb.Update().After("*").Register("tracing:after_update", p.after),
+		cb.Delete().Before("*").Register("tracing:before_delete", p.before),
+		cb.Delete().After("*").Register("tracing:after_delete", p.after),
+		cb.Row().Before("*").Register("tracing:before_row", p.before),
+		cb.Row().After("*").Register("tracing:after_row", p.after),
+		cb.Raw().Before("*").Register("tracing:before_raw", p.before),
+		cb.Raw().After("*").Register("tracing:after_raw", p.after),
+	)
+}
+
+func (p *GormPlugin) before(db *gorm.DB) {
+	parent := db.Statement.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	// the name is only known once the statement is built, after sets it
+	ctx, span := p.tracer.Start(parent, "db",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBNamespace(p.dbName)),
+	)
+	db.Statement.Context = ctx
+	db.InstanceSet(spanKey, span)
+	db.InstanceSet(parentKey, parent)
+}
+
+func (p *GormPlugin) after(db *gorm.DB) {
+	value, _ := db.InstanceGet(spanKey)
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+	if parent, ok := db.InstanceGet(parentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+
+	query := db.Statement.SQL.String()
+	operation := operationName(query)
+	name := operation
+	if table := db.Statement.Table; table != "" {
+		name += " " + table
+		span.SetAttributes(semconv.DBCollectionName(table))
+	}
+	span.SetName(name)
+	span.SetAttributes(
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(query),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// operationName is the first keyword of the statement, SELECT, INSERT...
+func operationName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "db"
+	}
+	return strings.ToUpper(fields[0])
+}
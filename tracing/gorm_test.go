@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"example/rest-api/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB builds the statements without a database, the callbacks still run
+func dryRunDB(t *testing.T, tp *sdktrace.TracerProvider) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("host=localhost dbname=notes"), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := db.Use(NewGormPlugin(tp, "notes")); err != nil {
+		t.Fatalf("use plugin: %v", err)
+	}
+	return db
+}
+
+func TestGormPlugin(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	db := dryRunDB(t, tp)
+
+	ctx, parent := Tracer(tp).Start(context.Background(), "request")
+	var note models.Note
+	db.WithContext(ctx).First(&note, "id = ?", "secret-id")
+	db.WithContext(ctx).Delete(&models.Note{}, "id = ?", "secret-id")
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 2 query spans and the parent, got %d", len(spans))
+	}
+
+	for i, want := range []string{"SELECT notes", "DELETE notes"} {
+		span := spans[i]
+		if span.Name() != want {
+			t.Errorf("span %d: expected name %q, got %q", i, want, span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of the request span", span.Name())
+		}
+		if span.SpanKind().String() != "client" {
+			t.Errorf("span %q: expected a client span, got %s", span.Name(), span.SpanKind())
+		}
+
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, attr := range span.Attributes() {
+			attrs[attr.Key] = attr.Value
+		}
+		if attrs["db.system"].AsString() != "postgresql" || attrs["db.collection.name"].AsString() != "notes" {
+			t.Errorf("span %q: unexpected attributes %v", span.Name(), attrs)
+		}
+		query := attrs["db.query.text"].AsString()
+		if query == "" {
+			t.Errorf("span %q has no query text", span.Name())
+		}
+		for _, attr := range span.Attributes() {
+			if strings.Contains(attr.Value.Emit(), "secret-id") {
+				t.Errorf("span %q leaks a query parameter in %s", span.Name(), attr.Key)
+			}
+		}
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	for query, want := range map[string]string{
+		`SELECT * FROM "notes"`: "SELECT",
+		"\n insert into notes":  "INSERT",
+		"":                      "db",
+	} {
+		if got := operationName(query); got != want {
+			t.Errorf("operationName(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+var frontMatterDelimiter = []byte("---")
+
+// WriteFrontMatter writes meta as a YAML front matter block followed by the body
+func WriteFrontMatter(w io.Writer, meta interface{}, body string) error {
+	var buf bytes.Buffer
+	buf.Write(frontMatterDelimiter)
+	buf.WriteByte('\n')
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(meta); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	buf.Write(frontMatterDelimiter)
+	buf.WriteString("\n\n")
+	buf.WriteString(body)
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// SplitFrontMatter decodes the YAML front matter of a document into meta and returns the body.
+// A document without front matter is returned as is and meta is left untouched.
+func SplitFrontMatter(data []byte, meta interface{}) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	if !bytes.HasPrefix(data, append(frontMatterDelimiter, '\n')) {
+		return string(data), nil
+	}
+
+	rest := data[len(frontMatterDelimiter)+1:]
+	var header []byte
+	switch end := bytes.Index(rest, []byte("\n---\n")); {
+	case bytes.HasPrefix(rest, []byte("---\n")):
+		header, rest = nil, rest[4:]
+	case end >= 0:
+		header, rest = rest[:end+1], rest[end+5:]
+	case bytes.HasSuffix(rest, []byte("\n---")):
+		header, rest = rest[:len(rest)-3], nil
+	default:
+		return "", fmt.Errorf("front matter is not closed")
+	}
+
+	if err := yaml.Unmarshal(header, meta); err != nil {
+		return "", fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	// the blank line written after the front matter is not part of the body
+	return string(bytes.TrimPrefix(rest, []byte("\n"))), nil
+}
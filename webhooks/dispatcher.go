@@ -0,0 +1,188 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/metrics"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+const (
+	// batchSize is how many deliveries are claimed and sent at once
+	batchSize = 20
+	// maxResponseBody is how much of the response of a receiver the delivery log keeps
+	maxResponseBody = 1024
+)
+
+// Dispatcher sends the queued deliveries and retries the failed ones with an exponential backoff
+type Dispatcher struct {
+	store   repository.Store
+	cfg     config.WebhookConfig
+	client  *http.Client
+	metrics *metrics.Metrics
+}
+
+// NewDispatcher returns a dispatcher of the deliveries queued in store, attempts are counted in m
+func NewDispatcher(store repository.Store, cfg config.WebhookConfig, m *metrics.Metrics) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// a redirect is answered like any other non 2xx status
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		metrics: m,
+	}
+}
+
+// Run polls the queue until ctx is cancelled, it is meant to run as a background worker
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// drain the queue before waiting for the next tick
+			for {
+				sent, err := d.RunOnce(ctx)
+				if err != nil {
+					slog.Error("Failed to claim the webhook deliveries", "error", err)
+				}
+				if err != nil || sent < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// RunOnce sends a batch of due deliveries and returns how many were claimed
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	// a claimed delivery goes back to the queue if the dispatcher dies while sending it
+	lease := 2 * d.cfg.Timeout
+	deliveries, err := d.store.WebhookDeliveries().Claim(ctx, time.Now(), lease, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// Backoff returns the delay before the retry following the given attempt
+func (d *Dispatcher) Backoff(attempt int) time.Duration {
+	backoff := d.cfg.MinBackoff
+	for i := 1; i < attempt && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.cfg.MaxBackoff)
+}
+
+// attempt sends a delivery and records the outcome in the delivery log
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	logger := slog.With("delivery_id", delivery.ID, "webhook_id", delivery.WebhookID)
+
+	webhook, err := d.store.Webhooks().FindByID(ctx, delivery.WebhookID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// the webhook was deleted along with its deliveries
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to load the webhook of a delivery", "error", err)
+		return
+	}
+
+	now := time.Now()
+	if !webhook.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "The webhook is disabled"
+	} else {
+		status, body, err := d.send(ctx, webhook, delivery, now)
+		if ctx.Err() != nil {
+			// shutting down, the lease brings the delivery back once it expires
+			return
+		}
+
+		delivery.Attempts++
+		delivery.LastAttemptAt = &now
+		delivery.ResponseStatus = status
+		delivery.ResponseBody = body
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		switch {
+		case err == nil:
+			delivery.Status = models.DeliverySucceeded
+			d.metrics.WebhookAttempt("success")
+		case delivery.Attempts >= d.cfg.MaxAttempts:
+			delivery.Status = models.DeliveryFailed
+			d.metrics.WebhookAttempt("failure")
+			logger.Warn("Webhook delivery failed for good", "attempts", delivery.Attempts, "error", err)
+		default:
+			delivery.NextAttemptAt = now.Add(d.Backoff(delivery.Attempts))
+			d.metrics.WebhookAttempt("retry")
+		}
+	}
+
+	if err := d.store.WebhookDeliveries().Update(ctx, delivery); err != nil {
+		logger.Error("Failed to record a webhook delivery attempt", "error", err)
+	}
+}
+
+// send posts the signed payload, any status but 2xx is an error
+func (d *Dispatcher) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notes-api-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// drain what is left so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	// the log is stored as text, which holds neither invalid UTF-8 nor NUL bytes
+	body := strings.ReplaceAll(strings.ToValidUTF8(string(data), "\uFFFD"), "\x00", "")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, body, fmt.Errorf("the receiver answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,171 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"example/rest-api/config"
+	"example/rest-api/events"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+// receiver records the deliveries it gets and answers them with the statuses it is given, then 204
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	statuses []int
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rec := &receiver{statuses: statuses}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, body)
+		status := http.StatusNoContent
+		if len(rec.statuses) > 0 {
+			status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func testDispatcher(store repository.Store) *Dispatcher {
+	return NewDispatcher(store, config.WebhookConfig{
+		Timeout:      time.Second,
+		MaxAttempts:  3,
+		MinBackoff:   time.Millisecond,
+		MaxBackoff:   4 * time.Millisecond,
+		PollInterval: time.Millisecond,
+	}, nil)
+}
+
+// delivery returns the single delivery of a webhook
+func delivery(t *testing.T, store repository.Store, webhookID string) models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.WebhookDeliveries().ListByWebhook(context.Background(), webhookID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("expected a single delivery, got %d: %v", len(deliveries), err)
+	}
+	return deliveries[0]
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	rec := newReceiver(t)
+
+	webhook := models.Webhook{UserID: "alice", URL: rec.URL, Secret: "a-secret-of-16-chars", Active: true, Events: []string{models.EventNoteCreated}}
+	other := models.Webhook{UserID: "bob", URL: rec.URL, Secret: "a-secret-of-16-chars", Active: true}
+	for _, w := range []*models.Webhook{&webhook, &other} {
+		if err := store.Webhooks().Create(ctx, w); err != nil {
+			t.Fatalf("create webhook: %v", err)
+		}
+	}
+
+	note := &models.Note{ID: "note-1", UserID: "alice", Title: "Hello", Published: true}
+	// the note.published event is filtered out and bob's webhook does not get alice's events
+	if err := Enqueue(ctx, store, events.NoteEvents(nil, note)...); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if sent, err := testDispatcher(store).RunOnce(ctx); err != nil || sent != 1 {
+		t.Fatalf("expected a single delivery to be sent, got %d: %v", sent, err)
+	}
+
+	if len(rec.requests) != 1 {
+		t.Fatalf("expected a single request, got %d", len(rec.requests))
+	}
+	req, body := rec.requests[0], rec.bodies[0]
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if !Verify(webhook.Secret, req.Header.Get(HeaderSignature), timestamp, body) {
+		t.Errorf("invalid signature %q", req.Header.Get(HeaderSignature))
+	}
+	if Verify("another-secret", req.Header.Get(HeaderSignature), timestamp, body) {
+		t.Error("expected the signature to depend on the secret")
+	}
+	if req.Header.Get(HeaderEvent) != models.EventNoteCreated || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+
+	var event struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Note models.Note `json:"note"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if event.ID == "" || event.Type != models.EventNoteCreated || event.Data.Note.ID != note.ID {
+		t.Errorf("unexpected payload %s", body)
+	}
+
+	logged := delivery(t, store, webhook.ID)
+	if logged.Status != models.DeliverySucceeded || logged.Attempts != 1 || logged.ResponseStatus != http.StatusNoContent || logged.ID != req.Header.Get(HeaderDelivery) {
+		t.Errorf("unexpected delivery log %+v", logged)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		want     string
+	}{
+		{"recovers", []int{http.StatusInternalServerError, http.StatusBadGateway}, 3, models.DeliverySucceeded},
+		{"gives up", []int{500, 500, 500, 500}, 3, models.DeliveryFailed},
+		{"redirects are failures", []int{http.StatusFound}, 2, models.DeliverySucceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := repository.NewMemoryStore()
+			rec := newReceiver(t, tt.statuses...)
+			webhook := models.Webhook{UserID: "alice", URL: rec.URL, Secret: "a-secret-of-16-chars", Active: true}
+			store.Webhooks().Create(ctx, &webhook)
+			Enqueue(ctx, store, events.NewEvent(models.EventNoteDeleted, "alice", nil))
+
+			dispatcher := testDispatcher(store)
+			for i := 0; i < 10; i++ {
+				dispatcher.RunOnce(ctx)
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			logged := delivery(t, store, webhook.ID)
+			if logged.Status != tt.want || logged.Attempts != tt.attempts {
+				t.Errorf("expected %s after %d attempts, got %s after %d", tt.want, tt.attempts, logged.Status, logged.Attempts)
+			}
+			if tt.want == models.DeliveryFailed && (logged.ResponseStatus != 500 || logged.Error == "" || logged.ResponseBody != "Internal Server Error") {
+				t.Errorf("expected the last response in the log, got %+v", logged)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := NewDispatcher(nil, config.WebhookConfig{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}, nil)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, backoff := range want {
+		if got := dispatcher.Backoff(i + 1); got != backoff {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, backoff, got)
+		}
+	}
+}
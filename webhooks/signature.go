@@ -0,0 +1,39 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// the headers of a delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature holds "sha256=" followed by the hex HMAC-SHA256 of the timestamp, a dot and the body
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature of a payload sent at timestamp, in Unix seconds
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a payload in constant time, receivers should also reject old timestamps
+func Verify(secret, signature string, timestamp int64, payload []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, payload)))
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+
+	"example/rest-api/events"
+	"example/rest-api/models"
+	"example/rest-api/repository"
+)
+
+// Sink queues the deliveries of the events relayed from the outbox
+type Sink struct{}
+
+func (Sink) Name() string { return "webhooks" }
+
+// Publish queues the deliveries in the transaction marking the event published, so they are queued once
+func (Sink) Publish(ctx context.Context, tx repository.Store, event events.Event) error {
+	return Enqueue(ctx, tx, event)
+}
+
+// Enqueue queues a delivery of the events for every webhook subscribed to them. Given the store of a
+// transaction, the deliveries are queued if and only if it commits.
+func Enqueue(ctx context.Context, store repository.Store, batch ...events.Event) error {
+	for _, event := range batch {
+		webhooks, err := store.Webhooks().Subscribed(ctx, event.UserID, event.Type)
+		if err != nil {
+			return err
+		}
+		if len(webhooks) == 0 {
+			continue
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		for _, webhook := range webhooks {
+			err := store.WebhookDeliveries().Create(ctx, &models.WebhookDelivery{
+				WebhookID:     webhook.ID,
+				EventID:       event.ID,
+				Event:         event.Type,
+				Payload:       payload,
+				Status:        models.DeliveryPending,
+				NextAttemptAt: event.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}